@@ -5,42 +5,208 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"path"
 	"strings"
 
 	"github.com/Ajnasz/sekret.link/api/middlewares"
 	"github.com/Ajnasz/sekret.link/internal/api"
+	"github.com/Ajnasz/sekret.link/internal/ciphersuite"
 	"github.com/Ajnasz/sekret.link/internal/hasher"
 	"github.com/Ajnasz/sekret.link/internal/key"
 	"github.com/Ajnasz/sekret.link/internal/models"
 	"github.com/Ajnasz/sekret.link/internal/parsers"
+	"github.com/Ajnasz/sekret.link/internal/ratelimit"
 	"github.com/Ajnasz/sekret.link/internal/services"
 	"github.com/Ajnasz/sekret.link/internal/views"
+	"github.com/Ajnasz/sekret.link/internal/web"
 )
 
-func newAESEncrypter(b key.Key) services.Encrypter {
-	return services.NewAESEncrypter(b)
-}
-
 // HandlerConfig configuration for http handlers
 type HandlerConfig struct {
 	ExpireSeconds    int
 	MaxExpireSeconds int
 	MaxDataSize      int64
-	WebExternalURL   *url.URL
-	DB               *sql.DB
+	// MaxPassphraseAttempts is the number of wrong passphrases after a
+	// passphrase protected key is deleted, 0 means unlimited
+	MaxPassphraseAttempts int
+	// MaxKeyAttempts is the number of wrong keys after an entry is locked or
+	// deleted by the KeyLockoutAction, 0 means unlimited
+	MaxKeyAttempts   int
+	KeyLockoutAction services.LockoutAction
+	// RequireToken requires an api token to create secrets and keys, the
+	// secrets can be read without a token
+	RequireToken bool
+	// CreateRateLimit, ReadRateLimit and GenerateKeyRateLimit are the
+	// request budgets of a client, a zero rate is unlimited. The read budget
+	// covers every request which takes a key or a delete key, so the keys
+	// can not be guessed
+	CreateRateLimit      ratelimit.Rate
+	ReadRateLimit        ratelimit.Rate
+	GenerateKeyRateLimit ratelimit.Rate
+	// AuthRateLimit is the budget of the requests with an api token of an
+	// ip address, it is checked before the token is verified
+	AuthRateLimit ratelimit.Rate
+	// DailyQuotaBytes and DailyQuotaEntries limit the size and the number of
+	// the secrets a client can create in a day, 0 means unlimited
+	DailyQuotaBytes   int64
+	DailyQuotaEntries int
+	// TrustedProxies are the proxies which can set the client address in the
+	// X-Forwarded-For header
+	TrustedProxies []netip.Prefix
+	// MasterKey wraps the stored secrets and keys, they are stored as they
+	// are when it is nil
+	MasterKey services.MasterKey
+	// Cipher encrypts the new secrets, AES-256-GCM when it is not set
+	Cipher ciphersuite.Suite
+	// RejectLegacyCipher rejects the secrets and keys which are not bound
+	// to their entry, they are bound when they are read, so it can be
+	// enabled when every secret stored before the upgrade is read or expired
+	RejectLegacyCipher bool
+	WebExternalURL     *url.URL
+	DB                 *sql.DB
+}
+
+// limits are shared by the routes of a SecretHandler, a nil limiter means
+// unlimited
+type limits struct {
+	create      *ratelimit.Limiter
+	read        *ratelimit.Limiter
+	generateKey *ratelimit.Limiter
+	auth        *ratelimit.Limiter
+	quota       *ratelimit.Quota
+	clientKey   func(r *http.Request) string
+	ipKey       func(r *http.Request) string
+}
+
+func newLimiter(rate ratelimit.Rate) *ratelimit.Limiter {
+	if rate.IsZero() {
+		return nil
+	}
+
+	return ratelimit.NewLimiter(rate)
 }
 
 // SecretHandler is an http.Handler implementation which handles requests to
 // encode or decode the post body
 type SecretHandler struct {
 	config HandlerConfig
+	limits *limits
 }
 
 // NewSecretHandler creates a SecretHandler instance
 func NewSecretHandler(config HandlerConfig) SecretHandler {
-	return SecretHandler{config: config}
+	l := &limits{
+		create:      newLimiter(config.CreateRateLimit),
+		read:        newLimiter(config.ReadRateLimit),
+		generateKey: newLimiter(config.GenerateKeyRateLimit),
+		auth:        newLimiter(config.AuthRateLimit),
+		clientKey:   middlewares.ClientKey(config.TrustedProxies),
+		ipKey:       middlewares.IPKey(config.TrustedProxies),
+	}
+
+	if quota := ratelimit.NewQuota(config.DailyQuotaBytes, config.DailyQuotaEntries); !quota.IsZero() {
+		l.quota = quota
+	}
+
+	return SecretHandler{config: config, limits: l}
+}
+
+// NewAuditLog creates the audit log of the entries
+func NewAuditLog(db *sql.DB) *services.AuditLog {
+	return services.NewAuditLog(db, &models.AuditModel{})
+}
+
+// NewMasterKeyRotator creates the rotator which rewraps the stored secrets,
+// keys and webhook secrets with the current master key
+func NewMasterKeyRotator(db *sql.DB, masterKey services.RotatingMasterKey) *services.MasterKeyRotator {
+	return services.NewMasterKeyRotator(db, masterKey, &models.EntryModel{}, &models.EntryKeyModel{}, &models.WebhookModel{}, &models.WebhookEventModel{})
+}
+
+// NewWebhookRecorder creates the recorder which queues the events of the
+// entries for their webhooks, the secrets of the webhooks are wrapped with
+// the master key when it is not nil
+func NewWebhookRecorder(masterKey services.MasterKey) *services.WebhookRecorder {
+	return services.NewWebhookRecorder(&models.WebhookModel{}, &models.WebhookEventModel{}).WithMasterKey(masterKey)
+}
+
+// newEncrypter creates the encrypter of the secrets and the keys with the
+// configured cipher
+func (s SecretHandler) newEncrypter(k key.Key) services.Encrypter {
+	return services.NewCipherEncrypter(k, s.config.Cipher).WithRejectLegacy(s.config.RejectLegacyCipher)
+}
+
+func (s SecretHandler) newEntryKeyManager() *services.EntryKeyManager {
+	return services.NewEntryKeyManager(s.config.DB, &models.EntryKeyModel{}, hasher.NewSHA256Hasher(), s.newEncrypter).
+		WithMaxPassphraseAttempts(s.config.MaxPassphraseAttempts).
+		WithKeyLockout(&models.EntryModel{}, s.config.MaxKeyAttempts, s.config.KeyLockoutAction).
+		WithLockoutNotifier(services.LockoutNotifiers{services.LogLockoutNotifier{}, NewWebhookRecorder(s.config.MasterKey), NewAuditLog(s.config.DB)}).
+		WithMasterKey(s.config.MasterKey)
+}
+
+func (s SecretHandler) newAPITokenManager() *services.APITokenManager {
+	return services.NewAPITokenManager(s.config.DB, &models.APITokenModel{}, hasher.NewSHA256Hasher())
+}
+
+// authenticate wraps the handler with the api token authentication. The token
+// is verified even when it is not required, so the authenticated clients are
+// limited by their token. The requests with a token are limited by their ip
+// address before the token is verified
+func (s SecretHandler) authenticate(h http.Handler) http.Handler {
+	if s.config.RequireToken {
+		h = middlewares.RequireToken(s.newAPITokenManager(), h)
+	} else {
+		h = middlewares.OptionalToken(s.newAPITokenManager(), h)
+	}
+
+	if s.limits.auth == nil {
+		return h
+	}
+
+	return middlewares.RateLimitToken("auth", s.limits.auth, s.limits.ipKey, h)
+}
+
+// rateLimit wraps the handler with the limiter, the limit is the name of the
+// budget in the metrics
+func (s SecretHandler) rateLimit(limit string, limiter *ratelimit.Limiter, h http.Handler) http.Handler {
+	if limiter == nil {
+		return h
+	}
+
+	return middlewares.RateLimit(limit, limiter, s.limits.clientKey, h)
+}
+
+// clientInfo wraps the handler with the client info of the audit log
+func (s SecretHandler) clientInfo(h http.Handler) http.Handler {
+	return middlewares.ClientInfo(s.config.TrustedProxies, h)
+}
+
+// limitCreate wraps the handlers which create secrets with the
+// authentication, the create budget and the daily quota. The authentication
+// comes first, so the authenticated clients are limited by their token
+func (s SecretHandler) limitCreate(h http.Handler) http.Handler {
+	h = s.clientInfo(h)
+	if s.limits.quota != nil {
+		h = middlewares.Quota(s.limits.quota, s.limits.clientKey, h)
+	}
+
+	return s.authenticate(s.rateLimit("create", s.limits.create, h))
+}
+
+func (s SecretHandler) limitRead(h http.Handler) http.Handler {
+	return s.rateLimit("read", s.limits.read, s.clientInfo(h))
+}
+
+func (s SecretHandler) limitGenerateKey(h http.Handler) http.Handler {
+	return s.authenticate(s.rateLimit("generate_key", s.limits.generateKey, s.clientInfo(h)))
+}
+
+func (s SecretHandler) newEntryManager() *services.EntryManager {
+	return services.NewEntryManager(s.config.DB, &models.EntryModel{}, s.newEncrypter, s.newEntryKeyManager()).
+		WithEvents(NewWebhookRecorder(s.config.MasterKey)).
+		WithAudit(NewAuditLog(s.config.DB)).
+		WithMasterKey(s.config.MasterKey)
 }
 
 // POST method handler
@@ -49,6 +215,14 @@ func NewSecretHandler(config HandlerConfig) SecretHandler {
 // query:
 //   - expire: the expiration time of the entry
 //   - maxReads: the maximum number of reads for the entry
+//   - webhookURL: the URL which receives the events of the entry
+//   - webhookSecret: the secret which signs the webhook requests
+//
+// header:
+//   - x-entry-passphrase: protect the key with a passphrase, it can be sent
+//     in the passphrase form field too
+//   - x-entry-webhook-url, x-entry-webhook-secret: the webhook URL and
+//     secret, the header is preferred for the secret
 //
 // method: POST
 // response: 200 OK
@@ -63,8 +237,7 @@ func (s SecretHandler) Post(w http.ResponseWriter, r *http.Request) {
 	}
 
 	parser := parsers.NewCreateEntryParser(s.config.MaxExpireSeconds)
-	keyManager := services.NewEntryKeyManager(s.config.DB, &models.EntryKeyModel{}, hasher.NewSHA256Hasher(), newAESEncrypter)
-	entryManager := services.NewEntryManager(s.config.DB, &models.EntryModel{}, newAESEncrypter, keyManager)
+	entryManager := s.newEntryManager()
 	view := views.NewEntryCreateView(s.config.WebExternalURL)
 
 	createHandler := api.NewCreateHandler(
@@ -76,12 +249,45 @@ func (s SecretHandler) Post(w http.ResponseWriter, r *http.Request) {
 	createHandler.Handle(w, r)
 }
 
-// GET method handler
+// isRevealRequest reports whether the request gets the reveal page instead of
+// the secret. Every GET request does, so the link previews and the scanners
+// do not use up the reads, the raw query parameter opts in to read the secret
+func isRevealRequest(r *http.Request) bool {
+	return r.Method == http.MethodGet && !r.URL.Query().Has("raw")
+}
+
+// GET and POST method handler
+// url: /{uuid}/{key}
+// HEAD requests are served by GetMeta
+// query:
+//   - raw: read the secret with a GET request
+//
+// header:
+//   - x-entry-passphrase: the passphrase of a passphrase protected key
+//
+// GET requests get a page which reveals the secret on an explicit POST
+// request, so link previews do not use up the reads. POST requests, and GET
+// requests with the raw query parameter read the secret, the passphrase can be
+// sent in the passphrase form field of the POST requests too
+//
+// response: 200 OK
+// response: 401 Unauthorized when the passphrase is missing or wrong
+// response: 404 Not Found
 func (s SecretHandler) Get(w http.ResponseWriter, r *http.Request) {
+	// the GET route matches HEAD requests too
+	if r.Method == http.MethodHead {
+		s.GetMeta(w, r)
+		return
+	}
+
+	if isRevealRequest(r) {
+		s.Reveal(w, r)
+		return
+	}
+
 	view := views.NewEntryReadView()
 	parser := parsers.NewGetEntryParser()
-	keyManager := services.NewEntryKeyManager(s.config.DB, &models.EntryKeyModel{}, hasher.NewSHA256Hasher(), newAESEncrypter)
-	entryManager := services.NewEntryManager(s.config.DB, &models.EntryModel{}, newAESEncrypter, keyManager)
+	entryManager := s.newEntryManager()
 	getHandler := api.NewGetHandler(
 		parser,
 		entryManager,
@@ -90,10 +296,98 @@ func (s SecretHandler) Get(w http.ResponseWriter, r *http.Request) {
 	getHandler.Handle(w, r)
 }
 
+// GetMeta returns the metadata of the entry without using up a read
+// url: /{uuid}/{key} with HEAD method, the metadata is in the headers only
+// url: /meta/{uuid}/{key} with GET method, the metadata is in the JSON body
+// header:
+//   - x-entry-passphrase: the passphrase of a passphrase protected key
+//
+// response headers:
+//   - x-entry-expire: the expiration time of the key
+//   - x-entry-remaining-reads: the remaining reads of the key
+//   - x-entry-content-type: the content type of the data
+//   - x-entry-size: the size of the data in bytes
+//
+// response: 200 OK
+// response: 401 Unauthorized when the passphrase is missing or wrong
+// response: 404 Not Found
+func (s SecretHandler) GetMeta(w http.ResponseWriter, r *http.Request) {
+	view := views.NewEntryMetaView()
+	parser := parsers.NewGetEntryParser()
+	entryManager := s.newEntryManager()
+	metaHandler := api.NewGetMetaHandler(
+		parser,
+		entryManager,
+		view,
+	)
+	metaHandler.Handle(w, r)
+}
+
+// Reveal renders the page which reads the secret on an explicit request
+// url: /{uuid}/{key}
+//
+// response: 200 OK the reveal page
+// response: 400 Bad Request
+func (s SecretHandler) Reveal(w http.ResponseWriter, r *http.Request) {
+	view := views.NewEntryRevealView()
+	parser := parsers.NewGetEntryParser()
+	revealHandler := api.NewRevealHandler(parser, view)
+	revealHandler.Handle(w, r)
+}
+
+// PostClientEncrypted stores an entry encrypted by the client
+// The key never reaches the server, the client sends only the encrypted data
+// and the hash of the key, which is required to read the entry
+// url: /zk/
+// query:
+//   - expire: the expiration time of the entry
+//   - maxReads: the maximum number of reads for the entry
+//
+// header:
+//   - x-entry-key-hash: hex encoded SHA-256 hash of the key
+//   - x-entry-content-type: the content type of the data before encryption
+//
+// method: POST
+// response: 200 OK
+// response: 400 Bad Request
+// response: 413 Payload Too Large
+func (s SecretHandler) PostClientEncrypted(w http.ResponseWriter, r *http.Request) {
+	parser := parsers.NewCreateClientEncryptedEntryParser(s.config.MaxExpireSeconds)
+	entryManager := s.newEntryManager()
+	view := views.NewClientEncryptedEntryCreateView(s.config.WebExternalURL)
+
+	createHandler := api.NewCreateClientEncryptedHandler(
+		s.config.MaxDataSize,
+		parser,
+		entryManager,
+		view,
+	)
+	createHandler.Handle(w, r)
+}
+
+// GetClientEncrypted returns the data of an entry encrypted by the client
+// url: /zk/{uuid}
+// header:
+//   - x-entry-key-hash: hex encoded SHA-256 hash of the key
+//
+// response: 200 OK the encrypted data
+// response: 400 Bad Request
+// response: 404 Not Found
+func (s SecretHandler) GetClientEncrypted(w http.ResponseWriter, r *http.Request) {
+	view := views.NewClientEncryptedEntryReadView()
+	parser := parsers.NewGetClientEncryptedEntryParser()
+	entryManager := s.newEntryManager()
+	getHandler := api.NewGetClientEncryptedHandler(
+		parser,
+		entryManager,
+		view,
+	)
+	getHandler.Handle(w, r)
+}
+
 // DELETE method handler
 func (s SecretHandler) Delete(w http.ResponseWriter, r *http.Request) {
-	keyManager := services.NewEntryKeyManager(s.config.DB, &models.EntryKeyModel{}, hasher.NewSHA256Hasher(), newAESEncrypter)
-	entryManager := services.NewEntryManager(s.config.DB, &models.EntryModel{}, newAESEncrypter, keyManager)
+	entryManager := s.newEntryManager()
 	view := views.NewEntryDeleteView()
 	deleteHandler := api.NewDeleteHandler(entryManager, view)
 	deleteHandler.Handle(w, r)
@@ -114,11 +408,14 @@ func (s SecretHandler) Options(w http.ResponseWriter, r *http.Request) {
 //   - expire: the expiration time of the new key
 //   - maxReads: the maximum number of reads for the new key
 //
+// header:
+//   - x-entry-passphrase: the passphrase of the key in the url
+//   - x-entry-new-passphrase: protect the new key with a passphrase
+//
 // method: GET
 // response: 200 OK
 func (s SecretHandler) GenerateEncryptionKey(w http.ResponseWriter, r *http.Request) {
-	keyManager := services.NewEntryKeyManager(s.config.DB, &models.EntryKeyModel{}, hasher.NewSHA256Hasher(), newAESEncrypter)
-	entryManager := services.NewEntryManager(s.config.DB, &models.EntryModel{}, newAESEncrypter, keyManager)
+	entryManager := s.newEntryManager()
 	view := views.NewGenerateEntryKeyView(s.config.WebExternalURL)
 	parser := parsers.NewGenerateEntryKeyParser(s.config.MaxExpireSeconds)
 	getHandler := api.NewGenerateEntryKeyHandler(
@@ -131,6 +428,129 @@ func (s SecretHandler) GenerateEncryptionKey(w http.ResponseWriter, r *http.Requ
 
 }
 
+// ListEntryKeys returns the keys of an entry
+// url: /keys/{uuid}/{deleteKey}
+// - uuid: the uuid of the entry
+// - deleteKey: the delete key of the entry, it authenticates the owner
+//
+// method: GET
+// response: 200 OK the keys as JSON
+// response: 401 Unauthorized when the delete key is wrong
+// response: 404 Not Found
+func (s SecretHandler) ListEntryKeys(w http.ResponseWriter, r *http.Request) {
+	view := views.NewEntryKeyListView()
+	parser := parsers.NewListEntryKeysParser()
+	entryManager := s.newEntryManager()
+	handler := api.NewListEntryKeysHandler(
+		parser,
+		entryManager,
+		view,
+	)
+	handler.Handle(w, r)
+}
+
+// ListAuditEvents returns the audit log of an entry while the entry exists,
+// the log of the removed entries is kept for the admin export
+// url: /audit/{uuid}/{deleteKey}
+// - uuid: the uuid of the entry
+// - deleteKey: the delete key of the entry, it authenticates the owner
+//
+// method: GET
+// response: 200 OK the events as JSON
+// response: 401 Unauthorized when the delete key is wrong
+// response: 404 Not Found
+func (s SecretHandler) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	view := views.NewAuditEventListView()
+	parser := parsers.NewListAuditEventsParser()
+	entryManager := s.newEntryManager()
+	handler := api.NewListAuditEventsHandler(
+		parser,
+		entryManager,
+		view,
+	)
+	handler.Handle(w, r)
+}
+
+// DeleteEntryKey revokes a single key of an entry, the entry can still be
+// read with its other keys
+// url: /keys/{uuid}/{deleteKey}/{keyUUID}
+// - uuid: the uuid of the entry
+// - deleteKey: the delete key of the entry, it authenticates the owner
+// - keyUUID: the uuid of the revoked key
+//
+// method: DELETE
+// response: 202 Accepted
+// response: 401 Unauthorized when the delete key is wrong
+// response: 404 Not Found
+func (s SecretHandler) DeleteEntryKey(w http.ResponseWriter, r *http.Request) {
+	view := views.NewEntryKeyDeleteView()
+	parser := parsers.NewDeleteEntryKeyParser()
+	entryManager := s.newEntryManager()
+	handler := api.NewDeleteEntryKeyHandler(
+		parser,
+		entryManager,
+		view,
+	)
+	handler.Handle(w, r)
+}
+
+// UpdateEntryKey changes the expiration and the remaining reads of a key
+// url: /keys/{uuid}/{deleteKey}/{keyUUID}
+// - uuid: the uuid of the entry
+// - deleteKey: the delete key of the entry, it authenticates the owner
+// - keyUUID: the uuid of the updated key
+//
+// url: /key/{uuid}/{key}
+// - uuid: the uuid of the entry
+// - key: the updated key
+//
+// query:
+//   - expire: the new expiration time of the key from now
+//   - maxReads: the new number of remaining reads, 0 disables the key
+//
+// header:
+//   - x-entry-passphrase: the passphrase of the key in the url
+//
+// method: PATCH
+// response: 200 OK the updated key as JSON
+// response: 400 Bad Request
+// response: 401 Unauthorized when the delete key or the passphrase is wrong
+// response: 404 Not Found
+func (s SecretHandler) UpdateEntryKey(w http.ResponseWriter, r *http.Request) {
+	view := views.NewEntryKeyUpdateView()
+	parser := parsers.NewUpdateEntryKeyParser(s.config.MaxExpireSeconds)
+	entryManager := s.newEntryManager()
+	handler := api.NewUpdateEntryKeyHandler(
+		parser,
+		entryManager,
+		view,
+	)
+	handler.Handle(w, r)
+}
+
+// Index serves the web frontend which creates the secrets
+// url: /
+//
+// response: 200 OK
+func (s SecretHandler) Index(w http.ResponseWriter, r *http.Request) {
+	headers := w.Header()
+	headers.Set("Cache-Control", "no-cache")
+	headers.Set("Referrer-Policy", "no-referrer")
+	headers.Set("X-Frame-Options", "deny")
+	headers.Set("Content-Security-Policy", web.ContentSecurityPolicy)
+	http.ServeFileFS(w, r, web.Static(), "index.html")
+}
+
+// Static serves the scripts and styles of the web frontend
+// url: /static/{file}
+//
+// response: 200 OK
+// response: 404 Not Found
+func (s SecretHandler) Static(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeFileFS(w, r, web.Static(), r.PathValue("file"))
+}
+
 // NotFound handler
 func (s SecretHandler) NotFound(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "Not found", http.StatusNotFound)
@@ -139,11 +559,11 @@ func (s SecretHandler) NotFound(w http.ResponseWriter, r *http.Request) {
 func (s SecretHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
-		s.Post(w, r)
-	case http.MethodGet:
-		s.Get(w, r)
+		s.limitCreate(http.HandlerFunc(s.Post)).ServeHTTP(w, r)
+	case http.MethodGet, http.MethodHead:
+		s.limitRead(http.HandlerFunc(s.Get)).ServeHTTP(w, r)
 	case http.MethodDelete:
-		s.Delete(w, r)
+		s.limitRead(http.HandlerFunc(s.Delete)).ServeHTTP(w, r)
 	case http.MethodOptions:
 		s.Options(w, r)
 	default:
@@ -163,13 +583,41 @@ func clearApiRoot(apiRoot string) string {
 
 func (s SecretHandler) RegisterHandlers(mux *http.ServeMux, apiRoot string) {
 	apiRoot = clearApiRoot(apiRoot)
+	mux.Handle(
+		fmt.Sprintf("GET %s{$}", apiRoot),
+		middlewares.SetupLogging(false, middlewares.SetupMetrics("web", http.HandlerFunc(s.Index))),
+	)
+	mux.Handle(
+		fmt.Sprintf("GET %s", path.Join("/", apiRoot, "static", "{file}")),
+		middlewares.SetupLogging(false, middlewares.SetupMetrics("web", http.HandlerFunc(s.Static))),
+	)
 	mux.Handle(
 		fmt.Sprintf("GET %s", path.Join("/", apiRoot, "{uuid}", "{key}")),
 		http.StripPrefix(
 			apiRoot,
 			middlewares.SetupLogging(
 				false,
-				middlewares.SetupHeaders(http.HandlerFunc(s.Get)),
+				middlewares.SetupMetrics("read", middlewares.SetupHeaders(s.limitRead(http.HandlerFunc(s.Get)))),
+			),
+		),
+	)
+	mux.Handle(
+		fmt.Sprintf("GET %s", path.Join("/", apiRoot, "meta", "{uuid}", "{key}")),
+		http.StripPrefix(
+			apiRoot,
+			middlewares.SetupLogging(
+				false,
+				middlewares.SetupMetrics("meta", middlewares.SetupHeaders(s.limitRead(http.HandlerFunc(s.GetMeta)))),
+			),
+		),
+	)
+	mux.Handle(
+		fmt.Sprintf("POST %s", path.Join("/", apiRoot, "{uuid}", "{key}")),
+		http.StripPrefix(
+			apiRoot,
+			middlewares.SetupLogging(
+				false,
+				middlewares.SetupMetrics("read", middlewares.SetupHeaders(s.limitRead(http.HandlerFunc(s.Get)))),
 			),
 		),
 	)
@@ -179,7 +627,7 @@ func (s SecretHandler) RegisterHandlers(mux *http.ServeMux, apiRoot string) {
 			path.Join("/", apiRoot),
 			middlewares.SetupLogging(
 				true,
-				middlewares.SetupHeaders(http.HandlerFunc(s.Post)),
+				middlewares.SetupMetrics("create", middlewares.SetupHeaders(s.limitCreate(http.HandlerFunc(s.Post)))),
 			),
 		),
 	)
@@ -190,7 +638,40 @@ func (s SecretHandler) RegisterHandlers(mux *http.ServeMux, apiRoot string) {
 			apiRoot,
 			middlewares.SetupLogging(
 				false,
-				middlewares.SetupHeaders(http.HandlerFunc(s.Delete)),
+				middlewares.SetupMetrics("delete", middlewares.SetupHeaders(s.limitRead(http.HandlerFunc(s.Delete)))),
+			),
+		),
+	)
+
+	mux.Handle(
+		fmt.Sprintf("POST %s", path.Join("/", apiRoot, "zk", "{$}")),
+		http.StripPrefix(
+			apiRoot,
+			middlewares.SetupLogging(
+				true,
+				middlewares.SetupMetrics("create", middlewares.SetupHeaders(s.limitCreate(http.HandlerFunc(s.PostClientEncrypted)))),
+			),
+		),
+	)
+
+	mux.Handle(
+		fmt.Sprintf("GET %s", path.Join("/", apiRoot, "zk", "{uuid}")),
+		http.StripPrefix(
+			apiRoot,
+			middlewares.SetupLogging(
+				false,
+				middlewares.SetupMetrics("read", middlewares.SetupHeaders(s.limitRead(http.HandlerFunc(s.GetClientEncrypted)))),
+			),
+		),
+	)
+
+	mux.Handle(
+		fmt.Sprintf("DELETE %s", path.Join("/", apiRoot, "zk", "{uuid}", "{deleteKey}")),
+		http.StripPrefix(
+			apiRoot,
+			middlewares.SetupLogging(
+				false,
+				middlewares.SetupMetrics("delete", middlewares.SetupHeaders(s.limitRead(http.HandlerFunc(s.Delete)))),
 			),
 		),
 	)
@@ -201,7 +682,7 @@ func (s SecretHandler) RegisterHandlers(mux *http.ServeMux, apiRoot string) {
 			apiRoot,
 			middlewares.SetupLogging(
 				false,
-				middlewares.SetupHeaders(http.HandlerFunc(s.Options)),
+				middlewares.SetupMetrics("options", middlewares.SetupHeaders(http.HandlerFunc(s.Options))),
 			),
 		),
 	)
@@ -213,7 +694,62 @@ func (s SecretHandler) RegisterHandlers(mux *http.ServeMux, apiRoot string) {
 			apiRoot,
 			middlewares.SetupLogging(
 				false,
-				middlewares.SetupHeaders(http.HandlerFunc(s.GenerateEncryptionKey)),
+				middlewares.SetupMetrics("generate_key", middlewares.SetupHeaders(s.limitGenerateKey(http.HandlerFunc(s.GenerateEncryptionKey)))),
+			),
+		),
+	)
+
+	mux.Handle(
+		fmt.Sprintf("GET %s", path.Join(apiRoot, "keys", "{uuid}", "{deleteKey}")),
+		http.StripPrefix(
+			apiRoot,
+			middlewares.SetupLogging(
+				false,
+				middlewares.SetupMetrics("list_keys", middlewares.SetupHeaders(s.limitRead(http.HandlerFunc(s.ListEntryKeys)))),
+			),
+		),
+	)
+
+	mux.Handle(
+		fmt.Sprintf("GET %s", path.Join(apiRoot, "audit", "{uuid}", "{deleteKey}")),
+		http.StripPrefix(
+			apiRoot,
+			middlewares.SetupLogging(
+				false,
+				middlewares.SetupMetrics("list_audit", middlewares.SetupHeaders(s.limitRead(http.HandlerFunc(s.ListAuditEvents)))),
+			),
+		),
+	)
+
+	mux.Handle(
+		fmt.Sprintf("DELETE %s", path.Join(apiRoot, "keys", "{uuid}", "{deleteKey}", "{keyUUID}")),
+		http.StripPrefix(
+			apiRoot,
+			middlewares.SetupLogging(
+				false,
+				middlewares.SetupMetrics("delete_key", middlewares.SetupHeaders(s.limitRead(http.HandlerFunc(s.DeleteEntryKey)))),
+			),
+		),
+	)
+
+	mux.Handle(
+		fmt.Sprintf("PATCH %s", path.Join(apiRoot, "keys", "{uuid}", "{deleteKey}", "{keyUUID}")),
+		http.StripPrefix(
+			apiRoot,
+			middlewares.SetupLogging(
+				false,
+				middlewares.SetupMetrics("update_key", middlewares.SetupHeaders(s.limitRead(http.HandlerFunc(s.UpdateEntryKey)))),
+			),
+		),
+	)
+
+	mux.Handle(
+		fmt.Sprintf("PATCH %s", path.Join(apiRoot, "key", "{uuid}", "{key}")),
+		http.StripPrefix(
+			apiRoot,
+			middlewares.SetupLogging(
+				false,
+				middlewares.SetupMetrics("update_key", middlewares.SetupHeaders(s.limitRead(http.HandlerFunc(s.UpdateEntryKey)))),
 			),
 		),
 	)
@@ -3,25 +3,36 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/Ajnasz/sekret.link/internal/ciphersuite"
 	"github.com/Ajnasz/sekret.link/internal/hasher"
 	"github.com/Ajnasz/sekret.link/internal/key"
+	"github.com/Ajnasz/sekret.link/internal/masterkey"
 	"github.com/Ajnasz/sekret.link/internal/models"
+	"github.com/Ajnasz/sekret.link/internal/ratelimit"
 	"github.com/Ajnasz/sekret.link/internal/services"
 	"github.com/Ajnasz/sekret.link/internal/test/durable"
 	"github.com/Ajnasz/sekret.link/internal/uuid"
+	"github.com/Ajnasz/sekret.link/internal/views"
+	"github.com/Ajnasz/sekret.link/internal/web"
+	"github.com/Ajnasz/sekret.link/internal/webhook"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -82,12 +93,12 @@ func TestCreateEntry(t *testing.T) {
 		assert.NoError(t, err)
 
 		encrypter := func(b key.Key) services.Encrypter {
-			return services.NewAESEncrypter(b)
+			return services.NewCipherEncrypter(b, ciphersuite.Suite{})
 		}
 		keyManager := services.NewEntryKeyManager(db, &models.EntryKeyModel{}, hasher.NewSHA256Hasher(), encrypter)
 
 		entryManager := services.NewEntryManager(db, &models.EntryModel{}, encrypter, keyManager)
-		entry, err := entryManager.ReadEntry(ctx, savedUUID, *k)
+		entry, err := entryManager.ReadEntry(ctx, savedUUID, *k, nil)
 
 		if err != nil {
 			t.Fatal(err)
@@ -202,11 +213,11 @@ func TestCreateEntryJSON(t *testing.T) {
 	}
 
 	encrypter := func(b key.Key) services.Encrypter {
-		return services.NewAESEncrypter(b)
+		return services.NewCipherEncrypter(b, ciphersuite.Suite{})
 	}
 	keyManager := services.NewEntryKeyManager(db, &models.EntryKeyModel{}, hasher.NewSHA256Hasher(), encrypter)
 	entryManager := services.NewEntryManager(db, &models.EntryModel{}, encrypter, keyManager)
-	entry, err := entryManager.ReadEntry(ctx, encode.UUID, *k)
+	entry, err := entryManager.ReadEntry(ctx, encode.UUID, *k, nil)
 
 	if err != nil {
 		t.Fatal(err)
@@ -293,11 +304,11 @@ func TestCreateEntryForm(t *testing.T) {
 	}
 
 	encrypter := func(b key.Key) services.Encrypter {
-		return services.NewAESEncrypter(b)
+		return services.NewCipherEncrypter(b, ciphersuite.Suite{})
 	}
 	keyManager := services.NewEntryKeyManager(db, &models.EntryKeyModel{}, hasher.NewSHA256Hasher(), encrypter)
 	entryManager := services.NewEntryManager(db, &models.EntryModel{}, encrypter, keyManager)
-	entry, err := entryManager.ReadEntry(ctx, savedUUID, *k)
+	entry, err := entryManager.ReadEntry(ctx, savedUUID, *k, nil)
 
 	if err != nil {
 		t.Fatal("Getting entry", err)
@@ -382,20 +393,20 @@ func TestGetEntry(t *testing.T) {
 	for _, testCase := range testCases {
 		t.Run(testCase.Name, func(t *testing.T) {
 			encrypter := func(b key.Key) services.Encrypter {
-				return services.NewAESEncrypter(b)
+				return services.NewCipherEncrypter(b, ciphersuite.Suite{})
 			}
 
 			keyManager := services.NewEntryKeyManager(db, &models.EntryKeyModel{}, hasher.NewSHA256Hasher(), encrypter)
 			entryManager := services.NewEntryManager(db, &models.EntryModel{}, encrypter, keyManager)
 			expire := time.Second * 10
 			maxReads := 1
-			meta, encKey, err := entryManager.CreateEntry(ctx, "text/plain", []byte(testCase.Value), &expire, &maxReads)
+			meta, encKey, err := entryManager.CreateEntry(ctx, "text/plain", []byte(testCase.Value), &expire, &maxReads, nil, nil)
 
 			if err != nil {
 				t.Fatal(err)
 			}
 
-			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("http://example.com/%s/%s", meta.UUID, encKey.String()), nil)
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("http://example.com/%s/%s?raw", meta.UUID, encKey.String()), nil)
 			w := httptest.NewRecorder()
 
 			mux := http.NewServeMux()
@@ -441,19 +452,19 @@ func TestGetEntryJSON(t *testing.T) {
 	}
 
 	encrypter := func(b key.Key) services.Encrypter {
-		return services.NewAESEncrypter(b)
+		return services.NewCipherEncrypter(b, ciphersuite.Suite{})
 	}
 
 	keyManager := services.NewEntryKeyManager(db, &models.EntryKeyModel{}, hasher.NewSHA256Hasher(), encrypter)
 	entryManager := services.NewEntryManager(db, &models.EntryModel{}, encrypter, keyManager)
 	expire := time.Second * 10
 	maxReads := 1
-	meta, encKey, err := entryManager.CreateEntry(ctx, "text/plain", []byte(testCase.Value), &expire, &maxReads)
+	meta, encKey, err := entryManager.CreateEntry(ctx, "text/plain", []byte(testCase.Value), &expire, &maxReads, nil, nil)
 	if err != nil {
 		t.Error(err)
 	}
 
-	req := httptest.NewRequest("GET", fmt.Sprintf("http://example.com/%s/%s", meta.UUID, encKey.String()), nil)
+	req := httptest.NewRequest("GET", fmt.Sprintf("http://example.com/%s/%s?raw", meta.UUID, encKey.String()), nil)
 	req.Header.Add("Accept", "application/json")
 	w := httptest.NewRecorder()
 
@@ -525,7 +536,7 @@ func TestSetAndGetEntry(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	req = httptest.NewRequest("GET", fmt.Sprintf("http://example.com/%s/%s", savedUUID, keyString), nil)
+	req = httptest.NewRequest("GET", fmt.Sprintf("http://example.com/%s/%s?raw", savedUUID, keyString), nil)
 	w = httptest.NewRecorder()
 
 	mux.ServeHTTP(w, req)
@@ -540,6 +551,176 @@ func TestSetAndGetEntry(t *testing.T) {
 	assert.Equal(t, testCase, actual, "data not saved")
 }
 
+func TestSetAndGetEntryWithPassphrase(t *testing.T) {
+	testCase := "foo"
+	passphrase := "correct horse battery staple"
+
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	mux := http.NewServeMux()
+	secretHandler := NewSecretHandler(NewHandlerConfig(db))
+	secretHandler.RegisterHandlers(mux, "")
+
+	req := httptest.NewRequest("POST", "http://example.com/", bytes.NewReader([]byte(testCase)))
+	req.Header.Set("x-entry-passphrase", passphrase)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	resp := w.Result()
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected statuscode %d got %d", 200, resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+
+	savedUUID, keyString, err := uuid.GetUUIDAndSecretFromPath(string(body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entryURL := fmt.Sprintf("http://example.com/%s/%s", savedUUID, keyString)
+
+	t.Run("missing passphrase", func(t *testing.T) {
+		req := httptest.NewRequest("POST", entryURL, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+	})
+
+	t.Run("invalid passphrase", func(t *testing.T) {
+		req := httptest.NewRequest("POST", entryURL, nil)
+		req.Header.Set("x-entry-passphrase", "wrong")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+	})
+
+	t.Run("form passphrase", func(t *testing.T) {
+		form := url.Values{}
+		form.Set("passphrase", passphrase)
+		req := httptest.NewRequest("POST", entryURL, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		resp := w.Result()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, testCase, string(body))
+	})
+}
+
+func TestClientEncryptedEntry(t *testing.T) {
+	ciphertext := []byte("encrypted by the client")
+	clientKey := []byte("client side key")
+	keyHash := sha256.Sum256(clientKey)
+	keyHashHex := hex.EncodeToString(keyHash[:])
+
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	mux := http.NewServeMux()
+	secretHandler := NewSecretHandler(NewHandlerConfig(db))
+	secretHandler.RegisterHandlers(mux, "")
+
+	create := func(t *testing.T, query string) (string, string) {
+		req := httptest.NewRequest("POST", "http://example.com/zk/"+query, bytes.NewReader(ciphertext))
+		req.Header.Set("x-entry-key-hash", keyHashHex)
+		req.Header.Set("x-entry-content-type", "text/plain")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		resp := w.Result()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected statuscode %d got %d", http.StatusOK, resp.StatusCode)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		savedUUID := resp.Header.Get("x-entry-uuid")
+		assert.Equal(t, "http://example.com/zk/"+savedUUID, string(body))
+		assert.Empty(t, resp.Header.Get("x-entry-key"))
+
+		return savedUUID, resp.Header.Get("x-entry-delete-key")
+	}
+
+	read := func(uuid string, keyHash string) *http.Response {
+		req := httptest.NewRequest("GET", "http://example.com/zk/"+uuid, nil)
+		req.Header.Set("x-entry-key-hash", keyHash)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		return w.Result()
+	}
+
+	t.Run("read", func(t *testing.T) {
+		savedUUID, _ := create(t, "")
+
+		wrongHash := sha256.Sum256([]byte("wrong"))
+		resp := read(savedUUID, hex.EncodeToString(wrongHash[:]))
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp = read(savedUUID, "nothex")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		resp = read(savedUUID, keyHashHex)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/plain", resp.Header.Get("x-entry-content-type"))
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, ciphertext, body)
+
+		resp = read(savedUUID, keyHashHex)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("not readable with a server key", func(t *testing.T) {
+		savedUUID, _ := create(t, "?maxReads=2")
+		k, err := key.NewGeneratedKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest("GET", fmt.Sprintf("http://example.com/%s/%s?raw", savedUUID, k.String()), nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+
+		resp := read(savedUUID, keyHashHex)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		savedUUID, deleteKey := create(t, "")
+
+		req := httptest.NewRequest("DELETE", fmt.Sprintf("http://example.com/zk/%s/%s", savedUUID, deleteKey), nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusAccepted, w.Result().StatusCode)
+
+		resp := read(savedUUID, keyHashHex)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
 func TestCreateEntryWithExpiration(t *testing.T) {
 	ctx := context.Background()
 	db, err := durable.TestConnection(ctx)
@@ -580,11 +761,11 @@ func TestCreateEntryWithExpiration(t *testing.T) {
 	}
 
 	encrypter := func(b key.Key) services.Encrypter {
-		return services.NewAESEncrypter(b)
+		return services.NewCipherEncrypter(b, ciphersuite.Suite{})
 	}
 	keyManager := services.NewEntryKeyManager(db, &models.EntryKeyModel{}, hasher.NewSHA256Hasher(), encrypter)
 	entryManager := services.NewEntryManager(db, &models.EntryModel{}, encrypter, keyManager)
-	entry, err := entryManager.ReadEntry(ctx, savedUUID, *decodedKey)
+	entry, err := entryManager.ReadEntry(ctx, savedUUID, *decodedKey, nil)
 
 	if err != nil {
 		t.Fatal(err)
@@ -806,7 +987,7 @@ func FuzzSetAndGetEntry(f *testing.F) {
 			t.Fatal(err)
 		}
 
-		req = httptest.NewRequest("GET", fmt.Sprintf("http://example.com/%s/%s", savedUUID, keyString), nil)
+		req = httptest.NewRequest("GET", fmt.Sprintf("http://example.com/%s/%s?raw", savedUUID, keyString), nil)
 		w = httptest.NewRecorder()
 		mux.ServeHTTP(w, req)
 
@@ -820,3 +1001,1473 @@ func FuzzSetAndGetEntry(f *testing.F) {
 		}
 	})
 }
+
+func TestEntryKeys(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	mux := http.NewServeMux()
+	secretHandler := NewSecretHandler(NewHandlerConfig(db))
+	secretHandler.RegisterHandlers(mux, "")
+
+	serve := func(method string, url string) *http.Response {
+		req := httptest.NewRequest(method, url, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	req := httptest.NewRequest("POST", "http://example.com/?maxReads=2", bytes.NewReader([]byte("foo")))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	resp := w.Result()
+
+	savedUUID := resp.Header.Get("x-entry-uuid")
+	entryKey := resp.Header.Get("x-entry-key")
+	deleteKey := resp.Header.Get("x-entry-delete-key")
+
+	resp = serve("GET", fmt.Sprintf("http://example.com/key/%s/%s?maxReads=3", savedUUID, entryKey))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	sharedKey := resp.Header.Get("x-entry-key")
+
+	listKeys := func(t *testing.T) []views.EntryKeyResponse {
+		resp := serve("GET", fmt.Sprintf("http://example.com/keys/%s/%s", savedUUID, deleteKey))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var response views.EntryKeyListResponse
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, savedUUID, response.UUID)
+		return response.Keys
+	}
+
+	t.Run("list", func(t *testing.T) {
+		keys := listKeys(t)
+		assert.Len(t, keys, 2)
+
+		if keys[0].RemainingReads == nil || keys[1].RemainingReads == nil {
+			t.Fatal("expected remaining reads")
+		}
+		remainingReads := []int{*keys[0].RemainingReads, *keys[1].RemainingReads}
+		assert.ElementsMatch(t, []int{2, 3}, remainingReads)
+
+		resp := serve("GET", fmt.Sprintf("http://example.com/keys/%s/%s", savedUUID, "wrong"))
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		var revoked string
+		for _, k := range listKeys(t) {
+			if k.RemainingReads != nil && *k.RemainingReads == 3 {
+				revoked = k.UUID
+			}
+		}
+
+		resp := serve("DELETE", fmt.Sprintf("http://example.com/keys/%s/%s/%s", savedUUID, "wrong", revoked))
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		resp = serve("DELETE", fmt.Sprintf("http://example.com/keys/%s/%s/%s", savedUUID, deleteKey, revoked))
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		resp = serve("DELETE", fmt.Sprintf("http://example.com/keys/%s/%s/%s", savedUUID, deleteKey, revoked))
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		assert.Len(t, listKeys(t), 1)
+
+		resp = serve("POST", fmt.Sprintf("http://example.com/%s/%s", savedUUID, sharedKey))
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp = serve("POST", fmt.Sprintf("http://example.com/%s/%s", savedUUID, entryKey))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestUpdateEntryKey(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	mux := http.NewServeMux()
+	secretHandler := NewSecretHandler(NewHandlerConfig(db))
+	secretHandler.RegisterHandlers(mux, "")
+
+	serve := func(method string, url string) *http.Response {
+		req := httptest.NewRequest(method, url, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	create := func(t *testing.T) (string, string, string) {
+		req := httptest.NewRequest("POST", "http://example.com/?maxReads=2&expire=1m", bytes.NewReader([]byte("foo")))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		resp := w.Result()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected statuscode %d got %d", http.StatusOK, resp.StatusCode)
+		}
+
+		return resp.Header.Get("x-entry-uuid"), resp.Header.Get("x-entry-key"), resp.Header.Get("x-entry-delete-key")
+	}
+
+	decode := func(t *testing.T, resp *http.Response) views.EntryKeyResponse {
+		var response views.EntryKeyResponse
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+
+		return response
+	}
+
+	t.Run("with the key", func(t *testing.T) {
+		savedUUID, entryKey, _ := create(t)
+
+		resp := serve("PATCH", fmt.Sprintf("http://example.com/key/%s/%s?expire=30s&maxReads=1", savedUUID, entryKey))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		response := decode(t, resp)
+		assert.Equal(t, 1, *response.RemainingReads)
+		assert.WithinDuration(t, time.Now().Add(30*time.Second), *response.Expire, 5*time.Second)
+
+		for _, query := range []string{"maxReads=2", "expire=48h"} {
+			resp = serve("PATCH", fmt.Sprintf("http://example.com/key/%s/%s?%s", savedUUID, entryKey, query))
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode, query)
+		}
+	})
+
+	t.Run("with the delete key", func(t *testing.T) {
+		savedUUID, entryKey, deleteKey := create(t)
+
+		resp := serve("GET", fmt.Sprintf("http://example.com/keys/%s/%s", savedUUID, deleteKey))
+		var list views.EntryKeyListResponse
+		if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		keyUUID := list.Keys[0].UUID
+
+		resp = serve("PATCH", fmt.Sprintf("http://example.com/keys/%s/%s/%s?maxReads=0", savedUUID, "wrong", keyUUID))
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		resp = serve("PATCH", fmt.Sprintf("http://example.com/keys/%s/%s/%s?expire=48h&maxReads=5", savedUUID, deleteKey, keyUUID))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, 5, *decode(t, resp).RemainingReads)
+
+		resp = serve("PATCH", fmt.Sprintf("http://example.com/keys/%s/%s/%s?maxReads=0", savedUUID, deleteKey, keyUUID))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, 0, *decode(t, resp).RemainingReads)
+
+		resp = serve("POST", fmt.Sprintf("http://example.com/%s/%s", savedUUID, entryKey))
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		savedUUID, entryKey, _ := create(t)
+
+		testCases := []string{
+			"",
+			"?expire=-1h",
+			fmt.Sprintf("?expire=%ds", 60*60*24*31),
+			"?maxReads=-1",
+			"?maxReads=32768",
+			"?maxReads=foo",
+		}
+
+		for _, query := range testCases {
+			resp := serve("PATCH", fmt.Sprintf("http://example.com/key/%s/%s%s", savedUUID, entryKey, query))
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+		}
+	})
+}
+
+func TestRevealEntry(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	mux := http.NewServeMux()
+	secretHandler := NewSecretHandler(NewHandlerConfig(db))
+	secretHandler.RegisterHandlers(mux, "")
+
+	create := func(t *testing.T) string {
+		req := httptest.NewRequest("POST", "http://example.com/", bytes.NewReader([]byte("foo")))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		resp := w.Result()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected statuscode %d got %d", http.StatusOK, resp.StatusCode)
+		}
+
+		return fmt.Sprintf("http://example.com/%s/%s", resp.Header.Get("x-entry-uuid"), resp.Header.Get("x-entry-key"))
+	}
+
+	browserGet := func(url string) *http.Response {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	t.Run("browser get does not read the secret", func(t *testing.T) {
+		secretURL := create(t)
+
+		for range 3 {
+			resp := browserGet(secretURL)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+			body, _ := io.ReadAll(resp.Body)
+			assert.NotContains(t, string(body), "foo")
+			assert.Contains(t, string(body), `<form id="reveal" method="post">`)
+		}
+
+		req := httptest.NewRequest("POST", secretURL, strings.NewReader(""))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		resp := w.Result()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "foo", string(body))
+
+		resp = browserGet(secretURL + "?raw")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("any get does not read the secret", func(t *testing.T) {
+		secretURL := create(t)
+
+		for _, accept := range []string{"", "*/*", "application/json", "text/plain"} {
+			req := httptest.NewRequest("GET", secretURL, nil)
+			req.Header.Set("Accept", accept)
+			req.Header.Set("User-Agent", "Slackbot-LinkExpanding 1.0")
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			resp := w.Result()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+			body, _ := io.ReadAll(resp.Body)
+			assert.NotContains(t, string(body), "foo")
+		}
+
+		req := httptest.NewRequest("POST", secretURL, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		resp := w.Result()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "foo", string(body))
+	})
+
+	t.Run("raw query reads the secret", func(t *testing.T) {
+		secretURL := create(t)
+
+		resp := browserGet(secretURL + "?raw=1")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "foo", string(body))
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		resp := browserGet(fmt.Sprintf("http://example.com/%s/%s", uuid.NewUUIDString(), "foo"))
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestGetEntryMeta(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	mux := http.NewServeMux()
+	secretHandler := NewSecretHandler(NewHandlerConfig(db))
+	secretHandler.RegisterHandlers(mux, "")
+
+	req := httptest.NewRequest("POST", "http://example.com/?maxReads=1", bytes.NewReader([]byte("foobar")))
+	req.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	resp := w.Result()
+
+	savedUUID := resp.Header.Get("x-entry-uuid")
+	entryKey := resp.Header.Get("x-entry-key")
+
+	serve := func(method string, url string) *http.Response {
+		req := httptest.NewRequest(method, url, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	t.Run("head", func(t *testing.T) {
+		resp := serve("HEAD", fmt.Sprintf("http://example.com/%s/%s", savedUUID, entryKey))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "1", resp.Header.Get("x-entry-remaining-reads"))
+		assert.Equal(t, "text/plain", resp.Header.Get("x-entry-content-type"))
+		assert.Equal(t, "6", resp.Header.Get("x-entry-size"))
+		assert.NotEmpty(t, resp.Header.Get("x-entry-expire"))
+	})
+
+	t.Run("json", func(t *testing.T) {
+		resp := serve("GET", fmt.Sprintf("http://example.com/meta/%s/%s", savedUUID, entryKey))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var response views.EntryMetaResponse
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, savedUUID, response.UUID)
+		assert.Equal(t, 1, response.RemainingReads)
+		assert.Equal(t, 6, response.Size)
+		assert.Equal(t, "text/plain", response.ContentType)
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		k, err := key.NewGeneratedKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp := serve("HEAD", fmt.Sprintf("http://example.com/%s/%s", savedUUID, k.String()))
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("read is not used up", func(t *testing.T) {
+		resp := serve("POST", fmt.Sprintf("http://example.com/%s/%s", savedUUID, entryKey))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "foobar", string(body))
+
+		resp = serve("HEAD", fmt.Sprintf("http://example.com/%s/%s", savedUUID, entryKey))
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestWebFrontend(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	for _, apiRoot := range []string{"", "/api/"} {
+		mux := http.NewServeMux()
+		secretHandler := NewSecretHandler(NewHandlerConfig(db))
+		secretHandler.RegisterHandlers(mux, apiRoot)
+		root := clearApiRoot(apiRoot)
+
+		t.Run("index"+root, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com"+root, nil)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			resp := w.Result()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+			assert.Equal(t, web.ContentSecurityPolicy, resp.Header.Get("Content-Security-Policy"))
+			body, _ := io.ReadAll(resp.Body)
+			assert.Contains(t, string(body), `src="static/create.js"`)
+		})
+
+		t.Run("static"+root, func(t *testing.T) {
+			for file, contentType := range map[string]string{
+				"create.js": "text/javascript; charset=utf-8",
+				"reveal.js": "text/javascript; charset=utf-8",
+				"style.css": "text/css; charset=utf-8",
+			} {
+				req := httptest.NewRequest("GET", "http://example.com"+root+"static/"+file, nil)
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, req)
+				resp := w.Result()
+
+				assert.Equal(t, http.StatusOK, resp.StatusCode, file)
+				assert.Equal(t, contentType, resp.Header.Get("Content-Type"), file)
+			}
+
+			req := httptest.NewRequest("GET", "http://example.com"+root+"static/missing.js", nil)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+		})
+
+		t.Run("create from the form"+root, func(t *testing.T) {
+			var body bytes.Buffer
+			writer := multipart.NewWriter(&body)
+			assert.NoError(t, writer.WriteField("secret", "foo"))
+			assert.NoError(t, writer.WriteField("expire", "1h"))
+			assert.NoError(t, writer.WriteField("maxReads", "2"))
+			assert.NoError(t, writer.Close())
+
+			req := httptest.NewRequest("POST", "http://example.com"+root, &body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			resp := w.Result()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			secretURL := fmt.Sprintf("http://example.com%s%s/%s", root, resp.Header.Get("x-entry-uuid"), resp.Header.Get("x-entry-key"))
+			req = httptest.NewRequest("GET", secretURL, nil)
+			req.Header.Set("Accept", "text/html")
+			w = httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			resp = w.Result()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, web.ContentSecurityPolicy, resp.Header.Get("Content-Security-Policy"))
+			page, _ := io.ReadAll(resp.Body)
+			assert.Contains(t, string(page), `src="../static/reveal.js"`)
+		})
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	config := NewHandlerConfig(db)
+	config.RequireToken = true
+	mux := http.NewServeMux()
+	secretHandler := NewSecretHandler(config)
+	secretHandler.RegisterHandlers(mux, "")
+
+	tokenManager := services.NewAPITokenManager(db, &models.APITokenModel{}, hasher.NewSHA256Hasher())
+	apiToken, token, err := tokenManager.Issue(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(authorization string) *http.Response {
+		req := httptest.NewRequest("POST", "http://example.com/", bytes.NewReader([]byte("foo")))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	t.Run("missing token", func(t *testing.T) {
+		resp := create("")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Contains(t, resp.Header.Get("WWW-Authenticate"), "Bearer")
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		resp := create("Bearer sekret_invalid")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Contains(t, resp.Header.Get("WWW-Authenticate"), "invalid_token")
+	})
+
+	t.Run("valid token and anonymous read", func(t *testing.T) {
+		resp := create("Bearer " + token)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		req := httptest.NewRequest("GET", fmt.Sprintf("http://example.com/%s/%s?raw", resp.Header.Get("x-entry-uuid"), resp.Header.Get("x-entry-key")), nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		assert.Equal(t, "foo", w.Body.String())
+	})
+
+	t.Run("generate key requires token", func(t *testing.T) {
+		resp := create("Bearer " + token)
+		keyURL := fmt.Sprintf("http://example.com/key/%s/%s", resp.Header.Get("x-entry-uuid"), resp.Header.Get("x-entry-key"))
+
+		req := httptest.NewRequest("GET", keyURL, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Result().StatusCode)
+
+		req = httptest.NewRequest("GET", keyURL, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	})
+
+	t.Run("revoked token", func(t *testing.T) {
+		if err := tokenManager.Revoke(ctx, apiToken.UUID); err != nil {
+			t.Fatal(err)
+		}
+
+		resp := create("Bearer " + token)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
+
+func TestRateLimit(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	config := NewHandlerConfig(db)
+	config.CreateRateLimit = ratelimit.Rate{Limit: 2, Period: time.Hour}
+	config.ReadRateLimit = ratelimit.Rate{Limit: 1, Period: time.Hour}
+	config.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+	mux := http.NewServeMux()
+	NewSecretHandler(config).RegisterHandlers(mux, "")
+
+	create := func(clientIP string) *http.Response {
+		req := httptest.NewRequest("POST", "http://example.com/", bytes.NewReader([]byte("foo")))
+		req.Header.Set("X-Forwarded-For", clientIP)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	resp := create("198.51.100.1")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, http.StatusOK, create("198.51.100.1").StatusCode)
+
+	limited := create("198.51.100.1")
+	assert.Equal(t, http.StatusTooManyRequests, limited.StatusCode)
+	assert.Equal(t, "1800", limited.Header.Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, create("198.51.100.2").StatusCode, "the clients have their own budgets")
+
+	read := func(UUID string, key string) int {
+		req := httptest.NewRequest("GET", fmt.Sprintf("http://example.com/%s/%s?raw", UUID, key), nil)
+		req.Header.Set("X-Forwarded-For", "198.51.100.1")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Result().StatusCode
+	}
+
+	assert.Equal(t, http.StatusBadRequest, read(resp.Header.Get("x-entry-uuid"), "00"))
+	assert.Equal(t, http.StatusTooManyRequests, read(resp.Header.Get("x-entry-uuid"), resp.Header.Get("x-entry-key")), "the wrong keys use up the read budget")
+}
+
+func TestOptionalToken(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	config := NewHandlerConfig(db)
+	config.CreateRateLimit = ratelimit.Rate{Limit: 1, Period: time.Hour}
+	mux := http.NewServeMux()
+	NewSecretHandler(config).RegisterHandlers(mux, "")
+
+	tokenManager := services.NewAPITokenManager(db, &models.APITokenModel{}, hasher.NewSHA256Hasher())
+	_, token, err := tokenManager.Issue(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(authorization string) int {
+		req := httptest.NewRequest("POST", "http://example.com/", bytes.NewReader([]byte("foo")))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Result().StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, create(""))
+	assert.Equal(t, http.StatusTooManyRequests, create(""))
+	assert.Equal(t, http.StatusOK, create("Bearer "+token), "the token has its own budget when it is not required")
+	assert.Equal(t, http.StatusTooManyRequests, create("Bearer "+token))
+	assert.Equal(t, http.StatusUnauthorized, create("Bearer sekret_invalid"))
+}
+
+func TestAuthRateLimit(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	config := NewHandlerConfig(db)
+	config.RequireToken = true
+	config.AuthRateLimit = ratelimit.Rate{Limit: 2, Period: time.Hour}
+	config.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+	mux := http.NewServeMux()
+	NewSecretHandler(config).RegisterHandlers(mux, "")
+
+	tokenManager := services.NewAPITokenManager(db, &models.APITokenModel{}, hasher.NewSHA256Hasher())
+	_, token, err := tokenManager.Issue(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(clientIP string, authorization string) int {
+		req := httptest.NewRequest("POST", "http://example.com/", bytes.NewReader([]byte("foo")))
+		req.Header.Set("X-Forwarded-For", clientIP)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Result().StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, create("198.51.100.1", "Bearer sekret_invalid"))
+	assert.Equal(t, http.StatusUnauthorized, create("198.51.100.1", "Bearer sekret_invalid"))
+	assert.Equal(t, http.StatusTooManyRequests, create("198.51.100.1", "Bearer sekret_invalid"), "the invalid tokens are limited before the verification")
+	assert.Equal(t, http.StatusTooManyRequests, create("198.51.100.1", "Bearer "+token), "the budget is kept by the ip address")
+	assert.Equal(t, http.StatusUnauthorized, create("198.51.100.1", ""), "the requests without a token do not use the budget")
+	assert.Equal(t, http.StatusOK, create("198.51.100.2", "Bearer "+token))
+}
+
+func TestDailyQuota(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	config := NewHandlerConfig(db)
+	config.RequireToken = true
+	config.DailyQuotaBytes = 5
+	mux := http.NewServeMux()
+	NewSecretHandler(config).RegisterHandlers(mux, "")
+
+	tokenManager := services.NewAPITokenManager(db, &models.APITokenModel{}, hasher.NewSHA256Hasher())
+	_, token, err := tokenManager.Issue(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, otherToken, err := tokenManager.Issue(ctx, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(token string, data string) *http.Response {
+		req := httptest.NewRequest("POST", "http://example.com/", strings.NewReader(data))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	assert.Equal(t, http.StatusOK, create(token, "foo").StatusCode)
+
+	resp := create(token, "foo")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, create(token, "ba").StatusCode)
+	assert.Equal(t, http.StatusOK, create(otherToken, "foo").StatusCode, "the tokens have their own quotas")
+}
+
+func TestKeyLockout(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	wrongKey, err := key.NewGeneratedKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		action   services.LockoutAction
+		expected int
+	}{
+		{action: services.LockoutLock, expected: http.StatusLocked},
+		{action: services.LockoutDelete, expected: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.action), func(t *testing.T) {
+			config := NewHandlerConfig(db)
+			config.MaxKeyAttempts = 2
+			config.KeyLockoutAction = tc.action
+			mux := http.NewServeMux()
+			NewSecretHandler(config).RegisterHandlers(mux, "")
+
+			req := httptest.NewRequest("POST", "http://example.com/", bytes.NewReader([]byte("foo")))
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			resp := w.Result()
+			UUID := resp.Header.Get("x-entry-uuid")
+
+			read := func(k string) int {
+				req := httptest.NewRequest("GET", fmt.Sprintf("http://example.com/%s/%s?raw", UUID, k), nil)
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, req)
+				return w.Result().StatusCode
+			}
+
+			assert.Equal(t, http.StatusNotFound, read(wrongKey.String()))
+			assert.Equal(t, http.StatusLocked, read(wrongKey.String()), "the last attempt locks the entry")
+			assert.Equal(t, tc.expected, read(resp.Header.Get("x-entry-key")), "the right key can not read the entry either")
+		})
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	secret := []byte("webhook secret")
+	var received []services.Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+
+		timestamp, err := strconv.ParseInt(r.Header.Get(webhook.TimestampHeader), 10, 64)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if !webhook.Verify(secret, timestamp, body, r.Header.Get(webhook.SignatureHeader)) {
+			t.Errorf("invalid signature %q", r.Header.Get(webhook.SignatureHeader))
+		}
+
+		var event services.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Error(err)
+		}
+		received = append(received, event)
+	}))
+	t.Cleanup(server.Close)
+
+	dispatcher := services.NewWebhookDispatcher(db, &models.WebhookEventModel{}, webhook.NewClient(time.Second, true))
+	dispatch := func() []services.Event {
+		received = nil
+		if _, err := dispatcher.Dispatch(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		return received
+	}
+
+	mux := http.NewServeMux()
+	NewSecretHandler(NewHandlerConfig(db)).RegisterHandlers(mux, "")
+
+	create := func(t *testing.T, query string) *http.Response {
+		req := httptest.NewRequest("POST", "http://example.com/?"+query, bytes.NewReader([]byte("foo")))
+		req.Header.Set("x-entry-webhook-url", server.URL)
+		req.Header.Set("x-entry-webhook-secret", string(secret))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		resp := w.Result()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", resp.StatusCode)
+		}
+		return resp
+	}
+
+	t.Run("read", func(t *testing.T) {
+		resp := create(t, "maxReads=2")
+		UUID := resp.Header.Get("x-entry-uuid")
+
+		assert.Empty(t, dispatch(), "the creation is not an event")
+
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest("GET", fmt.Sprintf("http://example.com/%s/%s?raw", UUID, resp.Header.Get("x-entry-key")), nil)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+		}
+
+		events := dispatch()
+		if assert.Len(t, events, 2) {
+			assert.Equal(t, services.EventRead, events[0].Type)
+			assert.Equal(t, services.EventLastRead, events[1].Type)
+			assert.Equal(t, UUID, events[0].EntryUUID)
+			assert.NotEmpty(t, events[0].KeyUUID)
+		}
+
+		assert.Empty(t, dispatch(), "the delivered events are removed from the queue")
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		resp := create(t, "")
+		UUID := resp.Header.Get("x-entry-uuid")
+
+		req := httptest.NewRequest("DELETE", fmt.Sprintf("http://example.com/%s/%s/%s", UUID, resp.Header.Get("x-entry-key"), resp.Header.Get("x-entry-delete-key")), nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusAccepted, w.Result().StatusCode)
+
+		events := dispatch()
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, services.EventDeleted, events[0].Type)
+			assert.Equal(t, UUID, events[0].EntryUUID)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		resp := create(t, "")
+		UUID := resp.Header.Get("x-entry-uuid")
+
+		// expire the key of the entry
+		if _, err := db.ExecContext(ctx, "UPDATE entry_key SET expire = $1 WHERE entry_uuid = $2", time.Now().Add(-time.Hour).UTC(), UUID); err != nil {
+			t.Fatal(err)
+		}
+
+		manager := services.NewExpiredEntryManager(db, &models.EntryModel{}, &models.EntryKeyModel{}).WithEvents(NewWebhookRecorder(nil))
+		if err := manager.DeleteExpired(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		events := dispatch()
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, services.EventExpired, events[0].Type)
+			assert.Equal(t, UUID, events[0].EntryUUID)
+		}
+	})
+
+	t.Run("invalid url", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "http://example.com/", bytes.NewReader([]byte("foo")))
+		req.Header.Set("x-entry-webhook-url", "file:///etc/passwd")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	})
+}
+
+func TestAuditLog(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	mux := http.NewServeMux()
+	NewSecretHandler(NewHandlerConfig(db)).RegisterHandlers(mux, "")
+
+	serve := func(method string, url string) *http.Response {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set("User-Agent", "audit-test")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	req := httptest.NewRequest("POST", "http://example.com/?maxReads=2", bytes.NewReader([]byte("foo")))
+	req.Header.Set("User-Agent", "audit-test")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	resp := w.Result()
+
+	savedUUID := resp.Header.Get("x-entry-uuid")
+	entryKey := resp.Header.Get("x-entry-key")
+	deleteKey := resp.Header.Get("x-entry-delete-key")
+
+	resp = serve("GET", fmt.Sprintf("http://example.com/key/%s/%s", savedUUID, entryKey))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = serve("POST", fmt.Sprintf("http://example.com/%s/%s", savedUUID, entryKey))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	t.Run("owner", func(t *testing.T) {
+		resp := serve("GET", fmt.Sprintf("http://example.com/audit/%s/%s", savedUUID, deleteKey))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var response views.AuditEventListResponse
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+
+		var events []string
+		for _, event := range response.Events {
+			events = append(events, event.Event)
+			assert.Equal(t, "192.0.2.1", event.ClientIP)
+			assert.Equal(t, "audit-test", event.UserAgent)
+			assert.NotEmpty(t, event.KeyUUID)
+		}
+
+		assert.Equal(t, []string{"created", "key_created", "read"}, events)
+	})
+
+	t.Run("wrong delete key", func(t *testing.T) {
+		resp := serve("GET", fmt.Sprintf("http://example.com/audit/%s/%s", savedUUID, "wrong"))
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		if _, err := db.ExecContext(ctx, "UPDATE entry_key SET expire = $1 WHERE entry_uuid = $2", time.Now().Add(-time.Hour).UTC(), savedUUID); err != nil {
+			t.Fatal(err)
+		}
+
+		manager := services.NewExpiredEntryManager(db, &models.EntryModel{}, &models.EntryKeyModel{}).WithAudit(NewAuditLog(db))
+		if err := manager.DeleteExpired(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		var events []services.AuditEvent
+		err := NewAuditLog(db).Export(ctx, time.Now().Add(-time.Hour), func(event services.AuditEvent) error {
+			if event.EntryUUID == savedUUID {
+				events = append(events, event)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if assert.Len(t, events, 4) {
+			assert.Equal(t, services.AuditExpired, events[3].Event)
+			assert.Empty(t, events[3].ClientIP, "the cleanup has no client")
+		}
+	})
+}
+
+func TestMasterKey(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	keyring, err := masterkey.New([]masterkey.Key{{ID: "test", Secret: bytes.Repeat([]byte{1}, masterkey.KeySize)}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := http.NewServeMux()
+	NewSecretHandler(NewHandlerConfig(db)).RegisterHandlers(plain, "")
+
+	conf := NewHandlerConfig(db)
+	conf.MasterKey = keyring
+	wrapped := http.NewServeMux()
+	NewSecretHandler(conf).RegisterHandlers(wrapped, "")
+
+	create := func(mux *http.ServeMux) (string, string) {
+		req := httptest.NewRequest("POST", "http://example.com/?maxReads=2", bytes.NewReader([]byte("foobar")))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		resp := w.Result()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		return resp.Header.Get("x-entry-uuid"), resp.Header.Get("x-entry-key")
+	}
+
+	serve := func(method string, url string) *http.Response {
+		req := httptest.NewRequest(method, url, nil)
+		w := httptest.NewRecorder()
+		wrapped.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	legacyUUID, legacyKey := create(plain)
+	wrappedUUID, wrappedKey := create(wrapped)
+
+	masterKeyID := func(query string, uuid string) string {
+		var id string
+		if err := db.QueryRowContext(ctx, query, uuid).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	assert.Equal(t, "", masterKeyID("SELECT master_key_id FROM entries WHERE uuid = $1", legacyUUID))
+	assert.Equal(t, "test", masterKeyID("SELECT master_key_id FROM entries WHERE uuid = $1", wrappedUUID))
+	assert.Equal(t, "test", masterKeyID("SELECT master_key_id FROM entry_key WHERE entry_uuid = $1", wrappedUUID))
+
+	for name, entry := range map[string][2]string{"legacy": {legacyUUID, legacyKey}, "wrapped": {wrappedUUID, wrappedKey}} {
+		t.Run(name, func(t *testing.T) {
+			resp := serve("HEAD", fmt.Sprintf("http://example.com/%s/%s", entry[0], entry[1]))
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "6", resp.Header.Get("x-entry-size"))
+
+			resp = serve("POST", fmt.Sprintf("http://example.com/%s/%s", entry[0], entry[1]))
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			body, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, "foobar", string(body))
+		})
+	}
+
+	t.Run("without the master key", func(t *testing.T) {
+		req := httptest.NewRequest("GET", fmt.Sprintf("http://example.com/%s/%s?raw", wrappedUUID, wrappedKey), nil)
+		w := httptest.NewRecorder()
+		plain.ServeHTTP(w, req)
+		assert.NotEqual(t, http.StatusOK, w.Result().StatusCode)
+	})
+}
+
+func TestMasterKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	oldKey := masterkey.Key{ID: "rotation-old", Secret: bytes.Repeat([]byte{1}, masterkey.KeySize)}
+	newKey := masterkey.Key{ID: "rotation-new", Secret: bytes.Repeat([]byte{2}, masterkey.KeySize)}
+
+	old, err := masterkey.New([]masterkey.Key{oldKey}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := masterkey.New([]masterkey.Key{oldKey, newKey}, newKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := func(masterKey services.MasterKey) *http.ServeMux {
+		conf := NewHandlerConfig(db)
+		conf.MasterKey = masterKey
+		mux := http.NewServeMux()
+		NewSecretHandler(conf).RegisterHandlers(mux, "")
+		return mux
+	}
+
+	before := handler(old)
+	req := httptest.NewRequest("POST", "http://example.com/", bytes.NewReader([]byte("foobar")))
+	w := httptest.NewRecorder()
+	before.ServeHTTP(w, req)
+	resp := w.Result()
+	savedUUID := resp.Header.Get("x-entry-uuid")
+	entryKey := resp.Header.Get("x-entry-key")
+
+	// the shared test database can contain rows wrapped by the other tests
+	if err := NewMasterKeyRotator(db, keyring).WithBatchSize(1).Rotate(ctx, nil); err != nil && !errors.Is(err, services.ErrRotationIncomplete) {
+		t.Fatal(err)
+	}
+
+	for _, query := range []string{
+		"SELECT master_key_id FROM entries WHERE uuid = $1",
+		"SELECT master_key_id FROM entry_key WHERE entry_uuid = $1",
+	} {
+		var masterKeyID string
+		if err := db.QueryRowContext(ctx, query, savedUUID).Scan(&masterKeyID); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, newKey.ID, masterKeyID)
+	}
+
+	after, err := masterkey.New([]masterkey.Key{newKey}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req = httptest.NewRequest("GET", fmt.Sprintf("http://example.com/%s/%s?raw", savedUUID, entryKey), nil)
+	w = httptest.NewRecorder()
+	handler(after).ServeHTTP(w, req)
+	resp = w.Result()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "the old key is not needed after the rotation")
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "foobar", string(body))
+}
+
+func TestCipher(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	conf := NewHandlerConfig(db)
+	conf.Cipher = ciphersuite.XChaCha20Poly1305
+	xchacha := http.NewServeMux()
+	NewSecretHandler(conf).RegisterHandlers(xchacha, "")
+
+	req := httptest.NewRequest("POST", "http://example.com/?maxReads=2", bytes.NewReader([]byte("foobar")))
+	w := httptest.NewRecorder()
+	xchacha.ServeHTTP(w, req)
+	resp := w.Result()
+	savedUUID := resp.Header.Get("x-entry-uuid")
+	entryKey := resp.Header.Get("x-entry-key")
+
+	var data []byte
+	if err := db.QueryRowContext(ctx, "SELECT data FROM entries WHERE uuid = $1", savedUUID).Scan(&data); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []byte{'S', 'L', 2, ciphersuite.XChaCha20Poly1305.ID}, data[:ciphersuite.HeaderSize], "the stored data names its cipher")
+
+	// the secrets are decrypted with their own cipher, whatever the
+	// configured one is
+	aes := http.NewServeMux()
+	NewSecretHandler(NewHandlerConfig(db)).RegisterHandlers(aes, "")
+
+	req = httptest.NewRequest("HEAD", fmt.Sprintf("http://example.com/%s/%s", savedUUID, entryKey), nil)
+	w = httptest.NewRecorder()
+	aes.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "6", w.Result().Header.Get("x-entry-size"))
+
+	req = httptest.NewRequest("GET", fmt.Sprintf("http://example.com/%s/%s?raw", savedUUID, entryKey), nil)
+	w = httptest.NewRecorder()
+	aes.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "foobar", w.Body.String())
+}
+
+func TestAssociatedData(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	mux := http.NewServeMux()
+	NewSecretHandler(NewHandlerConfig(db)).RegisterHandlers(mux, "")
+
+	create := func(contentType string, value string) (string, string) {
+		req := httptest.NewRequest("POST", "http://example.com/?maxReads=5", bytes.NewReader([]byte(value)))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Result().Header.Get("x-entry-uuid"), w.Result().Header.Get("x-entry-key")
+	}
+
+	read := func(uuid string, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", fmt.Sprintf("http://example.com/%s/%s?raw", uuid, key), nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	victimUUID, victimKey := create("text/plain", "victim")
+	attackerUUID, attackerKey := create("text/plain", "attacker")
+
+	// the data and the key of the victim are moved to the entry of the
+	// attacker, with the key of the attacker they would decrypt the data
+	// of the victim
+	for _, column := range []struct{ table, column, uuid string }{
+		{"entries", "data", "uuid"},
+		{"entry_key", "encrypted_key", "entry_uuid"},
+	} {
+		query := fmt.Sprintf("UPDATE %[1]s SET %[2]s = (SELECT %[2]s FROM %[1]s WHERE %[3]s = $1) WHERE %[3]s = $2", column.table, column.column, column.uuid)
+		if _, err := db.ExecContext(ctx, query, victimUUID, attackerUUID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := read(attackerUUID, victimKey)
+	assert.NotEqual(t, http.StatusOK, w.Code, "the moved data can not be decrypted")
+	assert.NotContains(t, w.Body.String(), "victim")
+
+	w = read(attackerUUID, attackerKey)
+	assert.NotEqual(t, http.StatusOK, w.Code)
+
+	w = read(victimUUID, victimKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "victim", w.Body.String())
+
+	// the content type is bound to the data too
+	if _, err := db.ExecContext(ctx, "UPDATE entries SET content_type = 'text/html' WHERE uuid = $1", victimUUID); err != nil {
+		t.Fatal(err)
+	}
+
+	w = read(victimUUID, victimKey)
+	assert.NotEqual(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "victim")
+}
+
+func TestLegacyEntryKey(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	dek, err := key.NewGeneratedKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kek, err := key.NewGeneratedKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the entry and its key as they were stored before the keys were
+	// wrapped: the encrypted key is found by the hash of the key
+	data, err := services.NewAESEncrypter(dek.Get()).Encrypt([]byte("legacy"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedKey, err := services.NewAESEncrypter(kek.Get()).Encrypt(dek.Get(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entryUUID := uuid.NewUUIDString()
+	maxReads := 2
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&models.EntryModel{}).CreateEntry(ctx, tx, entryUUID, "text/plain", data, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&models.EntryKeyModel{}).Create(ctx, tx, entryUUID, encryptedKey, "", hasher.NewSHA256Hasher().Hash(dek.Get()), nil, &maxReads, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	NewSecretHandler(NewHandlerConfig(db)).RegisterHandlers(mux, "")
+
+	// the legacy data is bound to its entry by the first read, so the
+	// legacy cipher can be rejected after it
+	strictConfig := NewHandlerConfig(db)
+	strictConfig.RejectLegacyCipher = true
+	strictMux := http.NewServeMux()
+	NewSecretHandler(strictConfig).RegisterHandlers(strictMux, "")
+
+	for i, handler := range []http.Handler{mux, strictMux} {
+		req := httptest.NewRequest("GET", fmt.Sprintf("http://example.com/%s/%s?raw", entryUUID, kek.String()), nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, "read %d", i)
+		assert.Equal(t, "legacy", w.Body.String())
+
+		var keyHash, storedKey, storedData []byte
+		if err := db.QueryRowContext(ctx, "SELECT key_hash, encrypted_key FROM entry_key WHERE entry_uuid = $1", entryUUID).Scan(&keyHash, &storedKey); err != nil {
+			t.Fatal(err)
+		}
+		assert.Empty(t, keyHash, "the key is wrapped when it is read")
+		assert.NotEqual(t, encryptedKey, storedKey)
+
+		if err := db.QueryRowContext(ctx, "SELECT data FROM entries WHERE uuid = $1", entryUUID).Scan(&storedData); err != nil {
+			t.Fatal(err)
+		}
+		assert.NotEqual(t, data, storedData, "the data is bound when it is read")
+	}
+}
+
+// staleEntryKeyModel lists the entry keys as they were before a concurrent
+// upgrade of the legacy keys
+type staleEntryKeyModel struct {
+	*models.EntryKeyModel
+	listed []models.WrappedBlob
+}
+
+func (m staleEntryKeyModel) ListWrapped(ctx context.Context, tx *sql.Tx, exceptKeyID string, afterUUID string, limit int) ([]models.WrappedBlob, error) {
+	if afterUUID == "" {
+		return m.listed, nil
+	}
+
+	return m.EntryKeyModel.ListWrapped(ctx, tx, exceptKeyID, afterUUID, limit)
+}
+
+func TestLegacyEntryKeyUpgradeDuringRotation(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	oldKey := masterkey.Key{ID: "upgrade-old", Secret: bytes.Repeat([]byte{3}, masterkey.KeySize)}
+	newKey := masterkey.Key{ID: "upgrade-new", Secret: bytes.Repeat([]byte{4}, masterkey.KeySize)}
+
+	// the servers still wrap with the old key while the rotation runs
+	server, err := masterkey.New([]masterkey.Key{oldKey, newKey}, oldKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := masterkey.New([]masterkey.Key{oldKey, newKey}, newKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dek, err := key.NewGeneratedKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kek, err := key.NewGeneratedKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := services.NewAESEncrypter(dek.Get()).Encrypt([]byte("legacy"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedKey, err := services.NewAESEncrypter(kek.Get()).Encrypt(dek.Get(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, sealedData, err := server.Seal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, sealedKey, err := server.Seal(encryptedKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entryUUID := uuid.NewUUIDString()
+	maxReads := 3
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&models.EntryModel{}).CreateEntry(ctx, tx, entryUUID, "text/plain", sealedData, oldKey.ID); err != nil {
+		t.Fatal(err)
+	}
+	entryKey, err := (&models.EntryKeyModel{}).Create(ctx, tx, entryUUID, sealedKey, oldKey.ID, hasher.NewSHA256Hasher().Hash(dek.Get()), nil, &maxReads, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := NewHandlerConfig(db)
+	conf.MasterKey = server
+	mux := http.NewServeMux()
+	NewSecretHandler(conf).RegisterHandlers(mux, "")
+
+	read := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", fmt.Sprintf("http://example.com/%s/%s", entryUUID, kek.String()), nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	// the rotation lists the legacy key, then the key is upgraded by a read
+	// before the batch rewraps it
+	stale := staleEntryKeyModel{
+		EntryKeyModel: &models.EntryKeyModel{},
+		listed:        []models.WrappedBlob{{UUID: entryKey.UUID, Data: sealedKey, MasterKeyID: oldKey.ID}},
+	}
+
+	w := read()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "legacy", w.Body.String())
+
+	rotator := services.NewMasterKeyRotator(db, keyring, &models.EntryModel{}, stale, &models.WebhookModel{}, &models.WebhookEventModel{})
+	if err := rotator.Rotate(ctx, nil); err != nil && !errors.Is(err, services.ErrRotationIncomplete) {
+		t.Fatal(err)
+	}
+
+	w = read()
+	assert.Equal(t, http.StatusOK, w.Code, "the upgraded key is not overwritten with the listed legacy key")
+	assert.Equal(t, "legacy", w.Body.String())
+
+	// the next rotation rewraps the upgraded key
+	if err := NewMasterKeyRotator(db, keyring).Rotate(ctx, nil); err != nil && !errors.Is(err, services.ErrRotationIncomplete) {
+		t.Fatal(err)
+	}
+
+	var masterKeyID string
+	if err := db.QueryRowContext(ctx, "SELECT master_key_id FROM entry_key WHERE uuid = $1", entryKey.UUID).Scan(&masterKeyID); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, newKey.ID, masterKeyID)
+
+	w = read()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "legacy", w.Body.String())
+}
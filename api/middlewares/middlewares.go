@@ -1,8 +1,16 @@
 package middlewares
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/metrics"
+	"github.com/Ajnasz/sekret.link/internal/services"
 )
 
 func SetupLogging(withPath bool, h http.Handler) http.Handler {
@@ -16,6 +24,120 @@ func SetupLogging(withPath bool, h http.Handler) http.Handler {
 	})
 }
 
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// SetupMetrics records the number, the status and the duration of the
+// requests handled by h, handler is the name of the handler in the metrics
+func SetupMetrics(handler string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(recorder, r)
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		metrics.ObserveRequest(handler, status, time.Since(start))
+	})
+}
+
+// TokenVerifier verifies the api tokens
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (*services.APIToken, error)
+}
+
+// bearerToken returns the token of the Authorization: Bearer header
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
+
+// RequireToken lets the request through only when it has a valid api token in
+// the Authorization: Bearer header
+func RequireToken(verifier TokenVerifier, h http.Handler) http.Handler {
+	return authenticate(verifier, true, h)
+}
+
+// OptionalToken verifies the api token of the Authorization: Bearer header
+// when the request has one, the requests without a token are let through
+// anonymously
+func OptionalToken(verifier TokenVerifier, h http.Handler) http.Handler {
+	return authenticate(verifier, false, h)
+}
+
+// authenticate puts the verified api token into the request context, the
+// requests with an invalid token are refused
+func authenticate(verifier TokenVerifier, required bool, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			if !required {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sekret.link"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		apiToken, err := verifier.Verify(r.Context(), token)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidAPIToken) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="sekret.link", error="invalid_token"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			slog.Error("api token verification failed", "error", err)
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+
+		slog.Info("authenticated", "token", apiToken.UUID, "name", apiToken.Name)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiTokenContextKey, apiToken)))
+	})
+}
+
+// ClientInfo puts the address and the user agent of the client into the
+// request context, the audit log records them with the events of the entries
+func ClientInfo(trustedProxies []netip.Prefix, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := services.ClientInfo{UserAgent: r.UserAgent()}
+		if addr := ClientIP(r, trustedProxies); addr.IsValid() {
+			info.IP = addr.String()
+		}
+
+		h.ServeHTTP(w, r.WithContext(services.ContextWithClientInfo(r.Context(), info)))
+	})
+}
+
 func SetupHeaders(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		setCORSHeaders(w, r)
@@ -26,7 +148,8 @@ func SetupHeaders(h http.Handler) http.Handler {
 func setCORSHeaders(w http.ResponseWriter, req *http.Request) {
 	if req.Header.Get("ORIGIN") != "" {
 		(w).Header().Set("Access-Control-Allow-Origin", req.Header.Get("ORIGIN"))
-		(w).Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, DELETE")
-		(w).Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, x-entry-uuid, x-entry-key, x-entry-delete-key, x-entry-expire")
+		(w).Header().Set("Access-Control-Allow-Methods", "POST, GET, HEAD, OPTIONS, DELETE, PATCH")
+		(w).Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, Content-Length, Accept-Encoding, x-entry-uuid, x-entry-key, x-entry-delete-key, x-entry-expire, x-entry-passphrase, x-entry-new-passphrase, x-entry-key-hash, x-entry-content-type")
+		(w).Header().Set("Access-Control-Expose-Headers", "x-entry-uuid, x-entry-key, x-entry-delete-key, x-entry-expire, x-entry-content-type, x-entry-remaining-reads, x-entry-size")
 	}
 }
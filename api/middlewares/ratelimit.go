@@ -0,0 +1,185 @@
+package middlewares
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/metrics"
+	"github.com/Ajnasz/sekret.link/internal/services"
+)
+
+type contextKey int
+
+const apiTokenContextKey contextKey = iota
+
+// APITokenFromContext returns the api token which authenticated the request
+func APITokenFromContext(ctx context.Context) (*services.APIToken, bool) {
+	apiToken, ok := ctx.Value(apiTokenContextKey).(*services.APIToken)
+	return apiToken, ok
+}
+
+func isTrusted(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ClientIP returns the address of the client, the X-Forwarded-For header is
+// used only when the request comes from a trusted proxy, the addresses are
+// read from the right and the first one which is not a trusted proxy is the
+// client
+func ClientIP(r *http.Request, trustedProxies []netip.Prefix) netip.Addr {
+	var addr netip.Addr
+	if addrPort, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		addr = addrPort.Addr()
+	} else if addr, err = netip.ParseAddr(r.RemoteAddr); err != nil {
+		return netip.Addr{}
+	}
+
+	addr = addr.Unmap()
+	if !isTrusted(addr, trustedProxies) {
+		return addr
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		forwardedAddr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+
+		addr = forwardedAddr.Unmap()
+		if !isTrusted(addr, trustedProxies) {
+			break
+		}
+	}
+
+	return addr
+}
+
+// ClientKey returns a function which identifies the client of the request
+// for the rate limits and the quotas, the authenticated requests by the api
+// token, the others by the ip address.
+func ClientKey(trustedProxies []netip.Prefix) func(r *http.Request) string {
+	ipKey := IPKey(trustedProxies)
+	return func(r *http.Request) string {
+		if apiToken, ok := APITokenFromContext(r.Context()); ok {
+			return "token:" + apiToken.UUID
+		}
+
+		return ipKey(r)
+	}
+}
+
+// IPKey returns a function which identifies the client of the request by its
+// ip address, even when the request has an api token. The IPv6 clients are
+// identified by their /64 network, because they usually get the whole
+// network.
+func IPKey(trustedProxies []netip.Prefix) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		addr := ClientIP(r, trustedProxies)
+		if addr.Is6() {
+			if prefix, err := addr.Prefix(64); err == nil {
+				return "ip:" + prefix.String()
+			}
+		}
+
+		return "ip:" + addr.String()
+	}
+}
+
+// tooManyRequests responds 429 Too Many Requests with the Retry-After header
+// in seconds
+func tooManyRequests(w http.ResponseWriter, limit string, retryAfter time.Duration) {
+	seconds := max(1, int(math.Ceil(retryAfter.Seconds())))
+	metrics.RateLimited.WithLabelValues(limit).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "Too many requests", http.StatusTooManyRequests)
+}
+
+// RateLimiter limits the requests of the clients
+type RateLimiter interface {
+	Allow(key string) (time.Duration, bool)
+}
+
+// RateLimit lets the request through when the budget of the client allows
+// it, limit is the name of the budget in the metrics
+func RateLimit(limit string, limiter RateLimiter, clientKey func(r *http.Request) string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if retryAfter, ok := limiter.Allow(clientKey(r)); !ok {
+			tooManyRequests(w, limit, retryAfter)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// RateLimitToken limits the requests which have an api token before the
+// token is verified, so the invalid tokens can not flood the verification.
+// The requests without a token are let through, limit is the name of the
+// budget in the metrics
+func RateLimitToken(limit string, limiter RateLimiter, clientKey func(r *http.Request) string, h http.Handler) http.Handler {
+	limited := RateLimit(limit, limiter, clientKey, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if bearerToken(r) == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		limited.ServeHTTP(w, r)
+	})
+}
+
+// QuotaLimiter limits the size and the number of the secrets the clients can
+// create
+type QuotaLimiter interface {
+	Reserve(key string, size int64) (time.Duration, bool)
+	Settle(key string, reserved int64, used int64, created bool)
+}
+
+type countingReader struct {
+	io.ReadCloser
+	count int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// Quota lets the request through when the quota of the client is not
+// exhausted. The secret is reserved with the size of the request before it is
+// created, so the concurrent requests can not exceed the quota, then the
+// reservation is settled with the size of the request body, or given back when
+// the secret is not created
+func Quota(quota QuotaLimiter, clientKey func(r *http.Request) string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := clientKey(r)
+		reserved := max(r.ContentLength, 0)
+		if retryAfter, ok := quota.Reserve(key, reserved); !ok {
+			tooManyRequests(w, "quota", retryAfter)
+			return
+		}
+
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil {
+			r.Body = body
+		}
+		recorder := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(recorder, r)
+
+		quota.Settle(key, reserved, body.count, recorder.status < http.StatusMultipleChoices)
+	})
+}
@@ -0,0 +1,444 @@
+// Package client provides a Go client for the sekret.link HTTP API
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnexpectedResponse is returned when the server responds with an
+// unexpected status code
+var ErrUnexpectedResponse = errors.New("unexpected response")
+
+// ErrInvalidSecretURL is returned when the url does not end with the uuid and
+// the key of a secret
+var ErrInvalidSecretURL = errors.New("invalid secret url")
+
+// The errors of the server are mapped back from the status code of the
+// response, so they can be checked with errors.Is
+// The client does not import the packages of the server, so the errors are
+// defined here
+var (
+	ErrEntryNotFound      = errors.New("entry not found")
+	ErrEntryLocked        = errors.New("entry locked")
+	ErrPassphraseRequired = errors.New("passphrase required")
+	ErrInvalidPassphrase  = errors.New("invalid passphrase")
+	ErrInvalidKey         = errors.New("invalid key")
+	ErrInvalidDeleteKey   = errors.New("invalid delete key")
+	ErrInvalidExpiration  = errors.New("Invalid expiration date")
+	ErrInvalidMaxRead     = errors.New("Invalid max read")
+)
+
+// ErrBadRequest is returned when the server rejects the request as invalid
+var ErrBadRequest = errors.New("bad request")
+
+// ErrTooLarge is returned when the data is larger than the server accepts
+var ErrTooLarge = errors.New("too large")
+
+// ErrTooManyRequests is returned when the client exceeded the rate limit or
+// the daily quota of the server
+var ErrTooManyRequests = errors.New("too many requests")
+
+// ErrUnauthorized is returned when the server requires an api token and the
+// token is missing or invalid
+var ErrUnauthorized = errors.New("unauthorized")
+
+// ErrForbidden is returned when the server refuses the request, like raising
+// the limits of a key
+var ErrForbidden = errors.New("forbidden")
+
+const (
+	passphraseHeader    = "x-entry-passphrase"
+	newPassphraseHeader = "x-entry-new-passphrase"
+)
+
+// Client talks to a sekret.link server
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	token      string
+}
+
+// NewClient creates a Client, the baseURL is the root of the API, eg.:
+// https://sekret.link/api
+func NewClient(baseURL string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		baseURL:    u,
+		httpClient: http.DefaultClient,
+	}, nil
+}
+
+// WithHTTPClient sets the http.Client used to send the requests, by default
+// http.DefaultClient is used
+func (c *Client) WithHTTPClient(httpClient *http.Client) *Client {
+	c.httpClient = httpClient
+	return c
+}
+
+// WithToken sets the api token sent when a secret is created or a new key is
+// generated
+func (c *Client) WithToken(token string) *Client {
+	c.token = token
+	return c
+}
+
+func (c *Client) setToken(req *http.Request) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+}
+
+// Secret is a created secret or a generated key of a secret
+type Secret struct {
+	UUID      string
+	Key       string
+	DeleteKey string
+	Created   time.Time
+	Expire    time.Time
+	// URL is the url to share
+	URL string
+}
+
+// Entry is the data of a secret
+type Entry struct {
+	UUID        string
+	ContentType string
+	Data        []byte
+	// The fields below are set by ReadWithMeta only
+	Created   time.Time
+	Accessed  time.Time
+	Expire    time.Time
+	DeleteKey string
+}
+
+// CreateOptions are the optional parameters of a new secret
+type CreateOptions struct {
+	// ContentType of the data, the server defaults to
+	// application/octet-stream
+	ContentType string
+	// Expire is the time while the secret can be read, the server default is
+	// used when it is zero
+	Expire time.Duration
+	// MaxReads is the number of times the secret can be read, the server
+	// default is used when it is zero
+	MaxReads int
+	// Passphrase protects the key of the secret
+	Passphrase string
+}
+
+// ShareOptions are the optional parameters of a generated key
+type ShareOptions struct {
+	Expire   time.Duration
+	MaxReads int
+	// Passphrase unlocks the existing key
+	Passphrase string
+	// NewPassphrase protects the generated key
+	NewPassphrase string
+}
+
+// createdResponse is the JSON response of the server to a created secret
+type createdResponse struct {
+	UUID      string
+	Key       string
+	Created   time.Time
+	Expire    time.Time
+	DeleteKey string
+}
+
+// readResponse is the JSON response of the server to a read secret
+type readResponse struct {
+	UUID        string
+	Data        string
+	Created     time.Time
+	Accessed    time.Time
+	Expire      time.Time
+	DeleteKey   string
+	ContentType string
+}
+
+func (c *Client) url(query url.Values, elem ...string) string {
+	u := c.baseURL.JoinPath(elem...)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func limitsQuery(expire time.Duration, maxReads int) url.Values {
+	query := url.Values{}
+	if expire > 0 {
+		query.Set("expire", expire.String())
+	}
+
+	if maxReads > 0 {
+		query.Set("maxReads", strconv.Itoa(maxReads))
+	}
+
+	return query
+}
+
+func (c *Client) do(req *http.Request, expectedStatus int) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != expectedStatus {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		message := strings.TrimSpace(string(body))
+		err := fmt.Errorf("%s: %s", resp.Status, message)
+		if statusErr := statusError(resp.StatusCode, message); statusErr != nil {
+			return nil, errors.Join(ErrUnexpectedResponse, statusErr, err)
+		}
+
+		return nil, errors.Join(ErrUnexpectedResponse, err)
+	}
+
+	return resp, nil
+}
+
+// statusError returns the error which the server rendered into the status
+// code and message of the response
+func statusError(statusCode int, message string) error {
+	switch statusCode {
+	case http.StatusNotFound:
+		return ErrEntryNotFound
+	case http.StatusUnauthorized:
+		switch message {
+		case "Passphrase required":
+			return ErrPassphraseRequired
+		case "Invalid passphrase":
+			return ErrInvalidPassphrase
+		case "Invalid delete key":
+			return ErrInvalidDeleteKey
+		case "Unauthorized":
+			return ErrUnauthorized
+		default:
+			return ErrInvalidKey
+		}
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusBadRequest:
+		switch message {
+		case "Invalid expiration":
+			return ErrInvalidExpiration
+		case "Invalid max read":
+			return ErrInvalidMaxRead
+		default:
+			return ErrBadRequest
+		}
+	case http.StatusRequestEntityTooLarge:
+		return ErrTooLarge
+	case http.StatusTooManyRequests:
+		return ErrTooManyRequests
+	case http.StatusLocked:
+		return ErrEntryLocked
+	default:
+		return nil
+	}
+}
+
+func secretFromResponse(resp *http.Response) (*Secret, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &Secret{
+		UUID:      resp.Header.Get("x-entry-uuid"),
+		Key:       resp.Header.Get("x-entry-key"),
+		DeleteKey: resp.Header.Get("x-entry-delete-key"),
+		URL:       strings.TrimSpace(string(body)),
+	}
+
+	if expire := resp.Header.Get("x-entry-expire"); expire != "" {
+		secret.Expire, err = time.Parse(time.RFC3339, expire)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return secret, nil
+}
+
+// Create stores the data as a new secret
+func (c *Client) Create(ctx context.Context, data io.Reader, opts CreateOptions) (*Secret, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url(limitsQuery(opts.Expire, opts.MaxReads), "/"), data)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	c.setToken(req)
+	if opts.ContentType != "" {
+		req.Header.Set("Content-Type", opts.ContentType)
+	}
+
+	if opts.Passphrase != "" {
+		req.Header.Set(passphraseHeader, opts.Passphrase)
+	}
+
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var created createdResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return nil, err
+	}
+
+	return &Secret{
+		UUID:      created.UUID,
+		Key:       created.Key,
+		DeleteKey: created.DeleteKey,
+		Created:   created.Created,
+		Expire:    created.Expire,
+		URL:       c.baseURL.JoinPath(created.UUID, created.Key).String(),
+	}, nil
+}
+
+// Read returns the data of the secret, reading the secret decreases its
+// remaining reads
+func (c *Client) Read(ctx context.Context, UUID string, key string, passphrase string) (*Entry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url(nil, UUID, key), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if passphrase != "" {
+		req.Header.Set(passphraseHeader, passphrase)
+	}
+
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Entry{
+		UUID:        UUID,
+		ContentType: resp.Header.Get("Content-Type"),
+		Data:        data,
+	}, nil
+}
+
+// ReadWithMeta returns the data of the secret with its metadata, reading the
+// secret decreases its remaining reads
+// The server sends the data as a JSON string, so it is suitable for text
+// secrets only, use Read for binary data
+func (c *Client) ReadWithMeta(ctx context.Context, UUID string, key string, passphrase string) (*Entry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url(nil, UUID, key), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if passphrase != "" {
+		req.Header.Set(passphraseHeader, passphrase)
+	}
+
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response readResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+
+	return &Entry{
+		UUID:        response.UUID,
+		ContentType: response.ContentType,
+		Data:        []byte(response.Data),
+		Created:     response.Created,
+		Accessed:    response.Accessed,
+		Expire:      response.Expire,
+		DeleteKey:   response.DeleteKey,
+	}, nil
+}
+
+// GenerateKey creates a new key for the secret, so it can be shared with
+// someone else without sharing the existing key
+func (c *Client) GenerateKey(ctx context.Context, UUID string, key string, opts ShareOptions) (*Secret, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(limitsQuery(opts.Expire, opts.MaxReads), "key", UUID, key), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c.setToken(req)
+	if opts.Passphrase != "" {
+		req.Header.Set(passphraseHeader, opts.Passphrase)
+	}
+
+	if opts.NewPassphrase != "" {
+		req.Header.Set(newPassphraseHeader, opts.NewPassphrase)
+	}
+
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return secretFromResponse(resp)
+}
+
+// Delete deletes the secret with the delete key received when the secret was
+// created
+func (c *Client) Delete(ctx context.Context, UUID string, key string, deleteKey string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.url(nil, UUID, key, deleteKey), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req, http.StatusAccepted)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// ParseSecretURL splits a secret url into the API root, the uuid and the key
+// of the secret
+func ParseSecretURL(secretURL string) (baseURL string, UUID string, key string, err error) {
+	u, err := url.Parse(secretURL)
+	if err != nil {
+		return "", "", "", errors.Join(ErrInvalidSecretURL, err)
+	}
+
+	dir, key := path.Split(strings.TrimSuffix(u.Path, "/"))
+	dir, UUID = path.Split(strings.TrimSuffix(dir, "/"))
+
+	if UUID == "" || key == "" {
+		return "", "", "", ErrInvalidSecretURL
+	}
+
+	u.Path = strings.TrimSuffix(dir, "/")
+	u.RawQuery = ""
+	u.Fragment = ""
+
+	return u.String(), UUID, key, nil
+}
@@ -0,0 +1,347 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/api"
+	"github.com/Ajnasz/sekret.link/internal/hasher"
+	"github.com/Ajnasz/sekret.link/internal/models"
+	"github.com/Ajnasz/sekret.link/internal/services"
+	"github.com/Ajnasz/sekret.link/internal/test/durable"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	return newTestServerWithDB(t, db, false)
+}
+
+func newTestServerWithDB(t *testing.T, db *sql.DB, requireToken bool) *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	extURL, err := url.Parse(server.URL + "/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api.NewSecretHandler(api.HandlerConfig{
+		ExpireSeconds:    10,
+		MaxDataSize:      1024 * 1024,
+		MaxExpireSeconds: 60 * 60 * 24 * 30,
+		WebExternalURL:   extURL,
+		DB:               db,
+		RequireToken:     requireToken,
+	}).RegisterHandlers(mux, "/api")
+
+	return server
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+
+	c, err := NewClient(server.URL + "/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("create and read", func(t *testing.T) {
+		secret, err := c.Create(ctx, strings.NewReader("foo"), CreateOptions{
+			ContentType: "text/plain",
+			Expire:      time.Hour,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.NotEmpty(t, secret.UUID)
+		assert.NotEmpty(t, secret.Key)
+		assert.NotEmpty(t, secret.DeleteKey)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), secret.Expire, time.Minute)
+		assert.Equal(t, server.URL+"/api/"+secret.UUID+"/"+secret.Key, secret.URL)
+
+		entry, err := c.Read(ctx, secret.UUID, secret.Key, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "text/plain", entry.ContentType)
+		assert.Equal(t, []byte("foo"), entry.Data)
+
+		_, err = c.Read(ctx, secret.UUID, secret.Key, "")
+		assert.ErrorIs(t, err, ErrUnexpectedResponse)
+		assert.ErrorIs(t, err, ErrEntryNotFound)
+	})
+
+	t.Run("read with meta", func(t *testing.T) {
+		secret, err := c.Create(ctx, strings.NewReader("foo"), CreateOptions{
+			ContentType: "text/plain",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entry, err := c.ReadWithMeta(ctx, secret.UUID, secret.Key, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, secret.UUID, entry.UUID)
+		assert.Equal(t, "text/plain", entry.ContentType)
+		assert.Equal(t, []byte("foo"), entry.Data)
+		assert.Equal(t, secret.DeleteKey, entry.DeleteKey)
+		assert.WithinDuration(t, secret.Created, entry.Created, time.Second)
+	})
+
+	t.Run("passphrase errors", func(t *testing.T) {
+		secret, err := c.Create(ctx, strings.NewReader("foo"), CreateOptions{Passphrase: "pass"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = c.Read(ctx, secret.UUID, secret.Key, "")
+		assert.ErrorIs(t, err, ErrPassphraseRequired)
+
+		_, err = c.Read(ctx, secret.UUID, secret.Key, "wrong")
+		assert.ErrorIs(t, err, ErrInvalidPassphrase)
+	})
+
+	t.Run("invalid expiration", func(t *testing.T) {
+		_, err := c.Create(ctx, strings.NewReader("foo"), CreateOptions{Expire: 365 * 24 * time.Hour})
+		assert.ErrorIs(t, err, ErrInvalidExpiration)
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := c.Create(ctx, strings.NewReader("foo"), CreateOptions{})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("share", func(t *testing.T) {
+		secret, err := c.Create(ctx, strings.NewReader("foo"), CreateOptions{Passphrase: "pass"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		shared, err := c.GenerateKey(ctx, secret.UUID, secret.Key, ShareOptions{Passphrase: "pass"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, secret.UUID, shared.UUID)
+		assert.NotEqual(t, secret.Key, shared.Key)
+
+		entry, err := c.Read(ctx, shared.UUID, shared.Key, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []byte("foo"), entry.Data)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		secret, err := c.Create(ctx, strings.NewReader("foo"), CreateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.Delete(ctx, secret.UUID, secret.Key, "invalid")
+		assert.ErrorIs(t, err, ErrInvalidDeleteKey)
+		assert.NotErrorIs(t, err, ErrUnauthorized)
+
+		if err := c.Delete(ctx, secret.UUID, secret.Key, secret.DeleteKey); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = c.Read(ctx, secret.UUID, secret.Key, "")
+		assert.ErrorIs(t, err, ErrEntryNotFound)
+	})
+}
+
+type countingTransport struct {
+	requests int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClientWithHTTPClient(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+
+	transport := &countingTransport{}
+	c, err := NewClient(server.URL + "/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c = c.WithHTTPClient(&http.Client{Transport: transport})
+
+	if _, err := c.Create(ctx, strings.NewReader("foo"), CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 1, transport.requests)
+}
+
+func TestClientWithToken(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	server := newTestServerWithDB(t, db, true)
+
+	_, token, err := services.NewAPITokenManager(db, &models.APITokenModel{}, hasher.NewSHA256Hasher()).Issue(ctx, "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewClient(server.URL + "/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.Create(ctx, strings.NewReader("foo"), CreateOptions{})
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	_, err = c.WithToken("sekret_invalid").Create(ctx, strings.NewReader("foo"), CreateOptions{})
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	c = c.WithToken(token)
+	secret, err := c.Create(ctx, strings.NewReader("foo"), CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shared, err := c.GenerateKey(ctx, secret.UUID, secret.Key, ShareOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := c.WithToken("").Read(ctx, shared.UUID, shared.Key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []byte("foo"), entry.Data)
+}
+
+func TestStatusError(t *testing.T) {
+	testCases := []struct {
+		name       string
+		statusCode int
+		message    string
+		err        error
+	}{
+		{name: "not found", statusCode: http.StatusNotFound, message: "Not Found", err: ErrEntryNotFound},
+		{name: "passphrase required", statusCode: http.StatusUnauthorized, message: "Passphrase required", err: ErrPassphraseRequired},
+		{name: "invalid passphrase", statusCode: http.StatusUnauthorized, message: "Invalid passphrase", err: ErrInvalidPassphrase},
+		{name: "invalid delete key", statusCode: http.StatusUnauthorized, message: "Invalid delete key", err: ErrInvalidDeleteKey},
+		{name: "unauthorized", statusCode: http.StatusUnauthorized, message: "Unauthorized", err: ErrUnauthorized},
+		{name: "invalid key", statusCode: http.StatusUnauthorized, message: "", err: ErrInvalidKey},
+		{name: "forbidden", statusCode: http.StatusForbidden, message: "Forbidden", err: ErrForbidden},
+		{name: "invalid expiration", statusCode: http.StatusBadRequest, message: "Invalid expiration", err: ErrInvalidExpiration},
+		{name: "invalid max read", statusCode: http.StatusBadRequest, message: "Invalid max read", err: ErrInvalidMaxRead},
+		{name: "bad request", statusCode: http.StatusBadRequest, message: "Bad request", err: ErrBadRequest},
+		{name: "too large", statusCode: http.StatusRequestEntityTooLarge, message: "Too large", err: ErrTooLarge},
+		{name: "too many requests", statusCode: http.StatusTooManyRequests, message: "Too many requests", err: ErrTooManyRequests},
+		{name: "locked", statusCode: http.StatusLocked, message: "Entry locked", err: ErrEntryLocked},
+		{name: "internal error", statusCode: http.StatusInternalServerError, message: "Internal error"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.err, statusError(testCase.statusCode, testCase.message))
+		})
+	}
+}
+
+func TestParseSecretURL(t *testing.T) {
+	testCases := []struct {
+		url     string
+		baseURL string
+		uuid    string
+		key     string
+		err     error
+	}{
+		{
+			url:     "https://sekret.link/api/d3bd3e1a-3b4b-4a2b-8f2b-6f2d7a8f5b1e/abcd",
+			baseURL: "https://sekret.link/api",
+			uuid:    "d3bd3e1a-3b4b-4a2b-8f2b-6f2d7a8f5b1e",
+			key:     "abcd",
+		},
+		{
+			url:     "http://localhost:8080/uuid/key/",
+			baseURL: "http://localhost:8080",
+			uuid:    "uuid",
+			key:     "key",
+		},
+		{
+			url: "http://localhost:8080/key",
+			err: ErrInvalidSecretURL,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.url, func(t *testing.T) {
+			baseURL, UUID, key, err := ParseSecretURL(testCase.url)
+			if testCase.err != nil {
+				if !errors.Is(err, testCase.err) {
+					t.Fatalf("expected error %v, got %v", testCase.err, err)
+				}
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.baseURL, baseURL)
+			assert.Equal(t, testCase.uuid, UUID)
+			assert.Equal(t, testCase.key, key)
+		})
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	// the client is imported by other programs, so it must not pull in the
+	// packages of the server, eg. internal/metrics registers its metrics on
+	// import
+	out, err := exec.Command("go", "list", "-deps", ".").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dep := range strings.Fields(string(out)) {
+		if strings.HasPrefix(dep, "github.com/Ajnasz/sekret.link/internal/") {
+			t.Errorf("client depends on %s", dep)
+		}
+	}
+}
@@ -14,7 +14,7 @@ import (
 
 func prepareDatabase(ctx context.Context) error {
 	var postgresDB string
-	flag.StringVar(&postgresDB, "postgresDB", "", "Connection string for postgresql database backend")
+	flag.StringVar(&postgresDB, "postgresDB", "", "Connection string for the database backend (postgres:// or sqlite://)")
 	flag.Parse()
 
 	db, err := durable.OpenDatabaseClient(context.Background(), config.GetConnectionString(postgresDB))
@@ -22,7 +22,7 @@ func prepareDatabase(ctx context.Context) error {
 		return err
 	}
 
-	defer db.Close()
+	defer migrate.Close(db)
 	if err := migrate.PrepareDatabase(ctx, db); err != nil {
 		return err
 	}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/api"
+	"github.com/Ajnasz/sekret.link/internal/config"
+	"github.com/Ajnasz/sekret.link/internal/durable"
+	"github.com/Ajnasz/sekret.link/internal/models/migrate"
+	"github.com/Ajnasz/sekret.link/internal/services"
+)
+
+var errAuditUsage = errors.New(`usage: sekret.link [options] audit <command>
+
+Commands:
+  export [-since <time>]   print the audit log as JSON lines, the oldest
+                           event first, since is an RFC 3339 time`)
+
+// auditRecord is a line of the audit export
+type auditRecord struct {
+	UUID      string    `json:"uuid"`
+	EntryUUID string    `json:"entryUUID"`
+	KeyUUID   string    `json:"keyUUID,omitempty"`
+	Event     string    `json:"event"`
+	Created   time.Time `json:"created"`
+	ClientIP  string    `json:"clientIP,omitempty"`
+	UserAgent string    `json:"userAgent,omitempty"`
+}
+
+// runAuditCommand reads the audit log stored in the database
+func runAuditCommand(ctx context.Context, conf config.Config, args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] != "export" {
+		return errAuditUsage
+	}
+
+	flags := flag.NewFlagSet("audit export", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	since := flags.String("since", "", "")
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 0 {
+		return errAuditUsage
+	}
+
+	var sinceTime time.Time
+	if *since != "" {
+		var err error
+		if sinceTime, err = time.Parse(time.RFC3339, *since); err != nil {
+			return errors.Join(errAuditUsage, err)
+		}
+	}
+
+	if conf.Storage == "sqlite-memory" {
+		return errors.New("the audit log can be exported with the database storage only")
+	}
+
+	db, err := durable.OpenDatabaseClient(ctx, getConnectionString(conf))
+	if err != nil {
+		return err
+	}
+	defer migrate.Close(db)
+
+	if err := migrate.PrepareDatabase(ctx, db); err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(out)
+	return api.NewAuditLog(db).Export(ctx, sinceTime, func(event services.AuditEvent) error {
+		return encoder.Encode(auditRecord{
+			UUID:      event.UUID,
+			EntryUUID: event.EntryUUID,
+			KeyUUID:   event.KeyUUID,
+			Event:     string(event.Event),
+			Created:   event.Created,
+			ClientIP:  event.ClientIP,
+			UserAgent: event.UserAgent,
+		})
+	})
+}
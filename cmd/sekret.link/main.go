@@ -4,8 +4,10 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
@@ -18,12 +20,21 @@ import (
 	"time"
 
 	"github.com/Ajnasz/sekret.link/api"
+	"github.com/Ajnasz/sekret.link/internal/ciphersuite"
 	"github.com/Ajnasz/sekret.link/internal/config"
 	"github.com/Ajnasz/sekret.link/internal/durable"
+	"github.com/Ajnasz/sekret.link/internal/health"
 	"github.com/Ajnasz/sekret.link/internal/key"
+	"github.com/Ajnasz/sekret.link/internal/masterkey"
+	"github.com/Ajnasz/sekret.link/internal/metrics"
 	"github.com/Ajnasz/sekret.link/internal/models"
 	"github.com/Ajnasz/sekret.link/internal/models/migrate"
+	"github.com/Ajnasz/sekret.link/internal/ratelimit"
 	"github.com/Ajnasz/sekret.link/internal/services"
+	"github.com/Ajnasz/sekret.link/internal/tlsconfig"
+	"github.com/Ajnasz/sekret.link/internal/webhook"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var (
@@ -53,16 +64,20 @@ func shutDown(shutdowns ...func() error) chan error {
 	return errChan
 }
 
-func scheduleDeleteExpired(ctx context.Context, db *sql.DB) error {
-	manager := services.NewExpiredEntryManager(db, &models.EntryModel{}, &models.EntryKeyModel{})
+func scheduleDeleteExpired(ctx context.Context, db *sql.DB, masterKey services.MasterKey, checker *health.Checker) error {
+	manager := services.NewExpiredEntryManager(db, &models.EntryModel{}, &models.EntryKeyModel{}).
+		WithEvents(api.NewWebhookRecorder(masterKey)).
+		WithAudit(api.NewAuditLog(db))
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
+	checker.CleanupAlive()
 	for {
 		select {
 		case <-ctx.Done():
 			slog.Info("Stop deleting expired entries")
 			return nil
 		case <-ticker.C:
+			checker.CleanupAlive()
 			if err := manager.DeleteExpired(ctx); err != nil {
 				fmt.Fprintf(os.Stderr, "error: %s", err)
 			}
@@ -70,7 +85,77 @@ func scheduleDeleteExpired(ctx context.Context, db *sql.DB) error {
 	}
 }
 
-func listen(handlerConfig api.HandlerConfig) *http.Server {
+// scheduleWebhooks delivers the queued webhook events until the context is
+// canceled
+func scheduleWebhooks(ctx context.Context, db *sql.DB, masterKey services.MasterKey, conf config.Config) {
+	client := webhook.NewClient(conf.WebhookTimeout, conf.WebhookAllowPrivate)
+	dispatcher := services.NewWebhookDispatcher(db, &models.WebhookEventModel{}, client).
+		WithMaxAttempts(conf.WebhookMaxAttempts).
+		WithMasterKey(masterKey)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Stop delivering webhooks")
+			return
+		case <-ticker.C:
+			if _, err := dispatcher.Dispatch(ctx); err != nil {
+				slog.Error("Error delivering webhooks", "error", err)
+			}
+		}
+	}
+}
+
+func serve(server *http.Server, listenAndServe func() error) {
+	if err := listenAndServe(); err != nil {
+		if err.Error() != "http: Server closed" {
+			fmt.Fprintf(os.Stderr, "error: %s", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// setupTLS configures the server to serve https and reloads the certificate
+// when the files change or on SIGHUP
+func setupTLS(ctx context.Context, conf config.Config, httpServer *http.Server) error {
+	tlsConfig, reloader, err := tlsconfig.New(tlsconfig.Options{
+		CertFile:     conf.TLSCertFile,
+		KeyFile:      conf.TLSKeyFile,
+		MinVersion:   conf.TLSMinVersion,
+		ClientCAFile: conf.TLSClientCAFile,
+	})
+	if err != nil {
+		return err
+	}
+	httpServer.TLSConfig = tlsConfig
+
+	if conf.TLSReloadInterval > 0 {
+		go reloader.Watch(ctx, conf.TLSReloadInterval)
+	}
+
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hupChan)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hupChan:
+				if err := reloader.Reload(); err != nil {
+					slog.Error("reloading certificate failed", "error", err)
+					continue
+				}
+				slog.Info("certificate reloaded", "file", conf.TLSCertFile)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func listen(ctx context.Context, conf config.Config, handlerConfig api.HandlerConfig, checker *health.Checker) ([]*http.Server, error) {
 	mux := http.NewServeMux()
 
 	apiRoot := getAPIRoot(handlerConfig.WebExternalURL)
@@ -78,24 +163,75 @@ func listen(handlerConfig api.HandlerConfig) *http.Server {
 	secretHandler := api.NewSecretHandler(handlerConfig)
 	secretHandler.RegisterHandlers(mux, apiRoot)
 
+	mux.HandleFunc("GET /healthz", checker.Live)
+	mux.HandleFunc("GET /readyz", checker.ReadyHandler)
+
+	var servers []*http.Server
+	if conf.MetricsAddress != "" {
+		servers = append(servers, listenMetrics(conf, handlerConfig))
+	}
+
 	httpServer := &http.Server{
-		Addr:         ":8080",
+		Addr:         conf.ListenAddress,
 		Handler:      mux,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		ReadTimeout:  conf.ReadTimeout,
+		WriteTimeout: conf.WriteTimeout,
 	}
 
-	go func() {
+	if !conf.TLSEnabled() {
 		slog.Info("Start listening", "address", httpServer.Addr, "path", apiRoot)
-		if err := httpServer.ListenAndServe(); err != nil {
-			if err.Error() != "http: Server closed" {
-				fmt.Fprintf(os.Stderr, "error: %s", err)
-				os.Exit(1)
-			}
+		go serve(httpServer, httpServer.ListenAndServe)
+		return append(servers, httpServer), nil
+	}
+
+	if err := setupTLS(ctx, conf, httpServer); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Start listening", "address", httpServer.Addr, "path", apiRoot, "tls", true)
+	go serve(httpServer, func() error {
+		// the certificate is provided by the TLSConfig
+		return httpServer.ListenAndServeTLS("", "")
+	})
+
+	servers = append(servers, httpServer)
+
+	if conf.RedirectAddress != "" {
+		redirectServer := &http.Server{
+			Addr:         conf.RedirectAddress,
+			Handler:      tlsconfig.RedirectHandler(conf.ListenAddress),
+			ReadTimeout:  conf.ReadTimeout,
+			WriteTimeout: conf.WriteTimeout,
 		}
-	}()
+		slog.Info("Start redirecting to https", "address", redirectServer.Addr)
+		go serve(redirectServer, redirectServer.ListenAndServe)
+		servers = append(servers, redirectServer)
+	}
 
-	return httpServer
+	return servers, nil
+}
+
+// listenMetrics serves the prometheus metrics on their own listener, so they
+// are not exposed with the public API
+func listenMetrics(conf config.Config, handlerConfig api.HandlerConfig) *http.Server {
+	prometheus.MustRegister(metrics.NewLiveCollector(
+		services.NewStatsManager(handlerConfig.DB, &models.EntryModel{}, &models.EntryKeyModel{}),
+	))
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.Handler())
+
+	metricsServer := &http.Server{
+		Addr:         conf.MetricsAddress,
+		Handler:      mux,
+		ReadTimeout:  conf.ReadTimeout,
+		WriteTimeout: conf.WriteTimeout,
+	}
+
+	slog.Info("Start serving metrics", "address", metricsServer.Addr)
+	go serve(metricsServer, metricsServer.ListenAndServe)
+
+	return metricsServer
 }
 
 func getAPIRoot(webExternalURL *url.URL) string {
@@ -118,53 +254,77 @@ func getAPIRoot(webExternalURL *url.URL) string {
 	return apiRoot
 }
 
-func getConfig(ctx context.Context) (*api.HandlerConfig, error) {
-	var (
-		externalURLParam string
-		expireSeconds    int
-		maxExpireSeconds int
-		postgresDB       string
-		maxDataSize      int64
-		queryVersion     bool
-		base62Encoding   bool
-	)
-	flag.StringVar(&externalURLParam, "webExternalURL", "", "Web server external url")
-	flag.StringVar(&postgresDB, "postgresDB", "", "Connection string for postgresql database backend")
-	flag.IntVar(&expireSeconds, "expireSeconds", 60*60*24*7, "Default expiration time in seconds")
-	flag.IntVar(&maxExpireSeconds, "maxExpireSeconds", 60*60*24*30, "Max expiration time in seconds")
-	flag.Int64Var(&maxDataSize, "maxDataSize", 1024*1024, "Max data size")
-	flag.BoolVar(&queryVersion, "version", false, "Get version information")
-	flag.BoolVar(&base62Encoding, "base62", false, "Use base62 encoding")
-	flag.Parse()
-
-	if queryVersion {
-		fmt.Printf("%s %s", version, build)
-		fmt.Println()
-		os.Exit(0)
+func getConnectionString(conf config.Config) string {
+	if conf.Storage == "sqlite-memory" {
+		return durable.MemoryConnectionString
 	}
 
-	extURL, err := url.Parse(externalURLParam)
+	return conf.PostgresDB
+}
+
+func getConfig(ctx context.Context, conf config.Config) (*api.HandlerConfig, error) {
+	extURL, err := url.Parse(conf.WebExternalURL)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if base62Encoding {
+	if conf.Base62 {
 		key.SetEncodingType(key.Base62Encoding)
 	}
 
 	handlerConfig := api.HandlerConfig{
-		ExpireSeconds:    expireSeconds,
-		MaxExpireSeconds: maxExpireSeconds,
-		MaxDataSize:      maxDataSize,
+		ExpireSeconds:         conf.ExpireSeconds,
+		MaxExpireSeconds:      conf.MaxExpireSeconds,
+		MaxDataSize:           conf.MaxDataSize,
+		MaxPassphraseAttempts: conf.MaxPassphraseAttempts,
+		MaxKeyAttempts:        conf.MaxKeyAttempts,
+		RequireToken:          conf.RequireToken,
+		DailyQuotaBytes:       conf.DailyQuotaBytes,
+		DailyQuotaEntries:     conf.DailyQuotaEntries,
+		WebExternalURL:        extURL,
 	}
 
-	if maxExpireSeconds < expireSeconds {
-		return nil, fmt.Errorf("`expireSeconds` must be less or equal then `maxExpireSeconds`")
+	if handlerConfig.KeyLockoutAction, err = services.ParseLockoutAction(conf.KeyLockoutAction); err != nil {
+		return nil, err
+	}
+
+	if handlerConfig.CreateRateLimit, err = ratelimit.ParseRate(conf.CreateRateLimit); err != nil {
+		return nil, err
+	}
+
+	if handlerConfig.ReadRateLimit, err = ratelimit.ParseRate(conf.ReadRateLimit); err != nil {
+		return nil, err
+	}
+
+	if handlerConfig.GenerateKeyRateLimit, err = ratelimit.ParseRate(conf.GenerateKeyRateLimit); err != nil {
+		return nil, err
+	}
+
+	if handlerConfig.AuthRateLimit, err = ratelimit.ParseRate(conf.AuthRateLimit); err != nil {
+		return nil, err
+	}
+
+	if handlerConfig.TrustedProxies, err = ratelimit.ParsePrefixes(conf.TrustedProxies); err != nil {
+		return nil, err
 	}
-	handlerConfig.WebExternalURL = extURL
 
-	db, err := durable.OpenDatabaseClient(context.Background(), config.GetConnectionString(postgresDB))
+	if handlerConfig.Cipher, err = ciphersuite.ByName(conf.Cipher); err != nil {
+		return nil, err
+	}
+	handlerConfig.RejectLegacyCipher = conf.RejectLegacyCipher
+
+	keyring, err := masterkey.Load(conf.MasterKeyFile, conf.MasterKeys, conf.MasterKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	// a nil keyring in the interface would not be nil
+	if keyring != nil {
+		handlerConfig.MasterKey = keyring
+	}
+
+	db, err := durable.OpenDatabaseClient(ctx, getConnectionString(conf))
 
 	if err != nil {
 		return nil, err
@@ -177,37 +337,121 @@ func getConfig(ctx context.Context) (*api.HandlerConfig, error) {
 	return &handlerConfig, nil
 }
 
+// loadConfig loads the server configuration, it exits when only the version
+// or the configuration is requested
+func loadConfig() config.Config {
+	conf, err := config.Load(os.Args[0], os.Args[1:], os.LookupEnv)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(2)
+	}
+
+	if conf.Version {
+		fmt.Printf("%s %s", version, build)
+		fmt.Println()
+		os.Exit(0)
+	}
+
+	validationErr := conf.Validate()
+
+	if conf.PrintConfig {
+		fmt.Print(conf.String())
+		if validationErr != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", validationErr)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if validationErr != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", validationErr)
+		os.Exit(1)
+	}
+
+	return *conf
+}
+
 func main() {
+	conf := loadConfig()
+
+	if len(conf.Args) > 0 {
+		var run func(context.Context, config.Config, []string, io.Writer) error
+		switch conf.Args[0] {
+		case "token":
+			run = runTokenCommand
+		case "audit":
+			run = runAuditCommand
+		case "masterkey":
+			run = runMasterKeyCommand
+		default:
+			fmt.Fprintf(os.Stderr, "error: unknown command %q\n", conf.Args[0])
+			os.Exit(2)
+		}
+
+		if err := run(context.Background(), conf, conf.Args[1:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	slog.Info("Configuration loaded", "file", conf.ConfigFile)
+
 	ctx, cancel := context.WithCancel(context.Background())
-	handlerConfig, err := getConfig(ctx)
+	handlerConfig, err := getConfig(ctx, conf)
 
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %s", err)
 		os.Exit(1)
 	}
+	checker := health.NewChecker(handlerConfig.DB)
 	go func() {
-		err := scheduleDeleteExpired(ctx, handlerConfig.DB)
+		err := scheduleDeleteExpired(ctx, handlerConfig.DB, handlerConfig.MasterKey, checker)
 		if err != nil {
 			slog.Error("Error deleting expired entries", "error", err)
 		}
 	}()
-	httpServer := listen(*handlerConfig)
+	go scheduleWebhooks(ctx, handlerConfig.DB, handlerConfig.MasterKey, conf)
+	servers, err := listen(ctx, conf, *handlerConfig, checker)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s", err)
+		os.Exit(1)
+	}
 
-	termChan := make(chan os.Signal)
+	termChan := make(chan os.Signal, 1)
 	signal.Notify(termChan, syscall.SIGTERM, syscall.SIGINT)
 
 	defer close(termChan)
 	<-termChan
+
+	// fail the readiness check first, so the load balancers stop sending
+	// new requests before the server closes
+	checker.ShutDown()
+	slog.Info("Shutting down", "delay", conf.ShutdownDelay.String())
+	time.Sleep(conf.ShutdownDelay)
 	cancel()
 
-	shutdownErrors := shutDown(func() error {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-		defer cancel()
-		return httpServer.Shutdown(ctx)
-	}, func() error {
-		return handlerConfig.DB.Close()
-	})
+	shutdowns := []func() error{
+		func() error {
+			return migrate.Close(handlerConfig.DB)
+		},
+	}
+	for _, server := range servers {
+		shutdowns = append(shutdowns, func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+			defer cancel()
+			return server.Shutdown(ctx)
+		})
+	}
+
+	shutdownErrors := shutDown(shutdowns...)
 
+	// every server has shutdownTimeout to close, give them a moment more
+	// before the process is killed
+	forceQuit := time.After(conf.ShutdownTimeout + time.Second)
 	errored := false
 	for {
 		select {
@@ -218,7 +462,7 @@ func main() {
 				errored = true
 				fmt.Fprintf(os.Stderr, "error: %s", err)
 			}
-		case <-time.After(time.Second * 15):
+		case <-forceQuit:
 			fmt.Fprint(os.Stderr, "error: force quit")
 			os.Exit(2)
 		}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Ajnasz/sekret.link/api"
+	"github.com/Ajnasz/sekret.link/internal/config"
+	"github.com/Ajnasz/sekret.link/internal/durable"
+	"github.com/Ajnasz/sekret.link/internal/masterkey"
+	"github.com/Ajnasz/sekret.link/internal/models/migrate"
+	"github.com/Ajnasz/sekret.link/internal/services"
+)
+
+var errMasterKeyUsage = errors.New(`usage: sekret.link [options] masterkey <command>
+
+Commands:
+  rotate [-batch <n>]   rewrap the stored secrets and keys with the current
+                        master key, n rows in a transaction, default 100`)
+
+// runMasterKeyCommand rewraps the stored secrets with the current master
+// key, the server can serve the secrets while it runs
+func runMasterKeyCommand(ctx context.Context, conf config.Config, args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] != "rotate" {
+		return errMasterKeyUsage
+	}
+
+	flags := flag.NewFlagSet("masterkey rotate", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	batch := flags.Int("batch", 100, "")
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 0 || *batch <= 0 {
+		return errMasterKeyUsage
+	}
+
+	if conf.Storage == "sqlite-memory" {
+		return errors.New("the master keys can be rotated with the database storage only")
+	}
+
+	keyring, err := masterkey.Load(conf.MasterKeyFile, conf.MasterKeys, conf.MasterKeyID)
+	if err != nil {
+		return err
+	}
+
+	if keyring == nil {
+		return errors.New("the master keys are not configured")
+	}
+
+	// the interrupted batch is rolled back, the next run continues with the
+	// rows which are not rewrapped yet
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db, err := durable.OpenDatabaseClient(ctx, getConnectionString(conf))
+	if err != nil {
+		return err
+	}
+	defer migrate.Close(db)
+
+	if err := migrate.PrepareDatabase(ctx, db); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "rewrapping with master key %s\n", keyring.CurrentID())
+	return api.NewMasterKeyRotator(db, keyring).WithBatchSize(*batch).Rotate(ctx, func(p services.RotationProgress) {
+		fmt.Fprintf(out, "%s: %d/%d rewrapped, %d skipped, %d failed\n", p.Table, p.Rewrapped, p.Total, p.Skipped, p.Failed)
+	})
+}
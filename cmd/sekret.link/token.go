@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/config"
+	"github.com/Ajnasz/sekret.link/internal/durable"
+	"github.com/Ajnasz/sekret.link/internal/hasher"
+	"github.com/Ajnasz/sekret.link/internal/models"
+	"github.com/Ajnasz/sekret.link/internal/models/migrate"
+	"github.com/Ajnasz/sekret.link/internal/services"
+)
+
+var errTokenUsage = errors.New(`usage: sekret.link [options] token <command>
+
+Commands:
+  issue <name>    issue a new api token, the token is printed only once
+  list            list the api tokens
+  revoke <uuid>   revoke the api token`)
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+// runTokenCommand manages the api tokens stored in the database
+func runTokenCommand(ctx context.Context, conf config.Config, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errTokenUsage
+	}
+
+	if conf.Storage == "sqlite-memory" {
+		return errors.New("the api tokens can be managed with the database storage only")
+	}
+
+	db, err := durable.OpenDatabaseClient(ctx, getConnectionString(conf))
+	if err != nil {
+		return err
+	}
+	defer migrate.Close(db)
+
+	if err := migrate.PrepareDatabase(ctx, db); err != nil {
+		return err
+	}
+
+	manager := services.NewAPITokenManager(db, &models.APITokenModel{}, hasher.NewSHA256Hasher())
+
+	switch args[0] {
+	case "issue":
+		if len(args) != 2 || args[1] == "" {
+			return errTokenUsage
+		}
+
+		apiToken, token, err := manager.Issue(ctx, args[1])
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "uuid:  %s\nname:  %s\ntoken: %s\n", apiToken.UUID, apiToken.Name, token)
+		return nil
+	case "list":
+		tokens, err := manager.List(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "UUID\tNAME\tCREATED\tLAST USED\tREVOKED")
+		for _, token := range tokens {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", token.UUID, token.Name, formatTime(token.Created), formatTime(token.LastUsed), formatTime(token.Revoked))
+		}
+		return w.Flush()
+	case "revoke":
+		if len(args) != 2 {
+			return errTokenUsage
+		}
+
+		if err := manager.Revoke(ctx, args[1]); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "revoked %s\n", args[1])
+		return nil
+	default:
+		return errTokenUsage
+	}
+}
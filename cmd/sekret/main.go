@@ -0,0 +1,304 @@
+// Command sekret is a command line client for sekret.link
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/client"
+)
+
+const defaultServer = "http://localhost:8080/api"
+
+// errUsage is returned when the command line arguments are invalid
+var errUsage = errors.New("usage error")
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: sekret [-server url] <command> [options] [arguments]
+
+Commands:
+  create [file]          create a secret from the file or from stdin
+  read <url>             print the secret
+  share <url>            generate a new key for the secret
+  delete <url> <key>     delete the secret with the delete key
+
+The server defaults to the SEKRET_URL environment variable or %s.
+The create and share commands send the api token from the SEKRET_TOKEN
+environment variable or the -token option.
+Run sekret <command> -h to see the options of a command.
+`, defaultServer)
+}
+
+// newClient creates a client for the server, when the server is not set the
+// API root is taken from the secret url
+func newClient(server string, secretURL string) (*client.Client, string, string, error) {
+	baseURL, UUID, key, err := client.ParseSecretURL(secretURL)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	if server != "" {
+		baseURL = server
+	}
+
+	c, err := client.NewClient(baseURL)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	return c, UUID, key, nil
+}
+
+func printJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func detectContentType(fileName string, data []byte) string {
+	if fileName != "" {
+		if ct := mime.TypeByExtension(filepath.Ext(fileName)); ct != "" {
+			return ct
+		}
+	}
+
+	return http.DetectContentType(data)
+}
+
+func create(ctx context.Context, server string, args []string) error {
+	flags := flag.NewFlagSet("create", flag.ContinueOnError)
+	expire := flags.Duration("expire", 0, "Expiration time of the secret, eg.: 1h, the server default is used when not set")
+	maxReads := flags.Int("max-reads", 0, "Number of times the secret can be read, the server default is used when not set")
+	contentType := flags.String("content-type", "", "Content type of the secret, detected from the data when not set")
+	passphrase := flags.String("passphrase", "", "Protect the secret with a passphrase")
+	token := flags.String("token", os.Getenv("SEKRET_TOKEN"), "API token, required when the server accepts authenticated requests only")
+	asJSON := flags.Bool("json", false, "Print the created secret as JSON")
+	if err := flags.Parse(args); err != nil {
+		return errors.Join(errUsage, err)
+	}
+
+	if flags.NArg() > 1 {
+		return errors.Join(errUsage, errors.New("create accepts at most one file"))
+	}
+
+	var data []byte
+	var err error
+	fileName := flags.Arg(0)
+	if fileName == "" || fileName == "-" {
+		fileName = ""
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(fileName)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if *contentType == "" {
+		*contentType = detectContentType(fileName, data)
+	}
+
+	c, err := client.NewClient(server)
+	if err != nil {
+		return err
+	}
+
+	c = c.WithToken(*token)
+
+	secret, err := c.Create(ctx, bytes.NewReader(data), client.CreateOptions{
+		ContentType: *contentType,
+		Expire:      *expire,
+		MaxReads:    *maxReads,
+		Passphrase:  *passphrase,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(os.Stdout, secret)
+	}
+
+	fmt.Println(secret.URL)
+	fmt.Fprintf(os.Stderr, "delete key: %s\n", secret.DeleteKey)
+	return nil
+}
+
+func isTextContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/json" ||
+		mediaType == "application/xml"
+}
+
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+func read(ctx context.Context, server string, args []string) error {
+	flags := flag.NewFlagSet("read", flag.ContinueOnError)
+	passphrase := flags.String("passphrase", "", "Passphrase of the secret")
+	output := flags.String("o", "", "Write the secret into the file instead of the standard output")
+	if err := flags.Parse(args); err != nil {
+		return errors.Join(errUsage, err)
+	}
+
+	if flags.NArg() != 1 {
+		return errors.Join(errUsage, errors.New("read requires the url of the secret"))
+	}
+
+	c, UUID, key, err := newClient(server, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	entry, err := c.Read(ctx, UUID, key, *passphrase)
+	if err != nil {
+		return err
+	}
+
+	if *output != "" {
+		return os.WriteFile(*output, entry.Data, 0600)
+	}
+
+	if !isTextContentType(entry.ContentType) && isTerminal(os.Stdout) {
+		return fmt.Errorf("refusing to print %s content to the terminal, use the -o option", entry.ContentType)
+	}
+
+	_, err = os.Stdout.Write(entry.Data)
+	return err
+}
+
+func share(ctx context.Context, server string, args []string) error {
+	flags := flag.NewFlagSet("share", flag.ContinueOnError)
+	expire := flags.Duration("expire", 0, "Expiration time of the new key, eg.: 1h, the server default is used when not set")
+	maxReads := flags.Int("max-reads", 0, "Number of times the secret can be read with the new key, the server default is used when not set")
+	passphrase := flags.String("passphrase", "", "Passphrase of the secret")
+	newPassphrase := flags.String("new-passphrase", "", "Protect the new key with a passphrase")
+	token := flags.String("token", os.Getenv("SEKRET_TOKEN"), "API token, required when the server accepts authenticated requests only")
+	asJSON := flags.Bool("json", false, "Print the new key as JSON")
+	if err := flags.Parse(args); err != nil {
+		return errors.Join(errUsage, err)
+	}
+
+	if flags.NArg() != 1 {
+		return errors.Join(errUsage, errors.New("share requires the url of the secret"))
+	}
+
+	c, UUID, key, err := newClient(server, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	secret, err := c.WithToken(*token).GenerateKey(ctx, UUID, key, client.ShareOptions{
+		Expire:        *expire,
+		MaxReads:      *maxReads,
+		Passphrase:    *passphrase,
+		NewPassphrase: *newPassphrase,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(os.Stdout, secret)
+	}
+
+	fmt.Println(secret.URL)
+	return nil
+}
+
+func deleteSecret(ctx context.Context, server string, args []string) error {
+	flags := flag.NewFlagSet("delete", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return errors.Join(errUsage, err)
+	}
+
+	if flags.NArg() != 2 {
+		return errors.Join(errUsage, errors.New("delete requires the url of the secret and the delete key"))
+	}
+
+	c, UUID, key, err := newClient(server, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return c.Delete(ctx, UUID, key, flags.Arg(1))
+}
+
+func run(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("sekret", flag.ContinueOnError)
+	flags.Usage = usage
+	server := flags.String("server", os.Getenv("SEKRET_URL"), "API root of the sekret.link server")
+	if err := flags.Parse(args); err != nil {
+		return errors.Join(errUsage, err)
+	}
+
+	if flags.NArg() < 1 {
+		usage()
+		return errUsage
+	}
+
+	command, commandArgs := flags.Arg(0), flags.Args()[1:]
+
+	switch command {
+	case "create":
+		if *server == "" {
+			*server = defaultServer
+		}
+		return create(ctx, *server, commandArgs)
+	case "read":
+		return read(ctx, *server, commandArgs)
+	case "share":
+		return share(ctx, *server, commandArgs)
+	case "delete":
+		return deleteSecret(ctx, *server, commandArgs)
+	default:
+		usage()
+		return errors.Join(errUsage, fmt.Errorf("unknown command %q", command))
+	}
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	if err := run(ctx, os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+
+		fmt.Fprintln(os.Stderr, err)
+		if errors.Is(err, errUsage) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
@@ -2,7 +2,9 @@
 package api
 
 import (
+	"context"
 	"errors"
+	"net/http"
 )
 
 // ErrInvalidExpirationDate request parse error happens when the user set
@@ -18,3 +20,10 @@ var ErrInvalidData = errors.New("Invalid data")
 
 // ErrRequestParseError request parse error happens if the post data can not be accepted
 var ErrRequestParseError = errors.New("request parse error")
+
+// requestContext returns a context with the values of the request, but
+// without its cancellation, so the started changes are finished when the
+// client goes away
+func requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithCancel(context.WithoutCancel(r.Context()))
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Ajnasz/sekret.link/internal/parsers"
+	"github.com/Ajnasz/sekret.link/internal/services"
+	"github.com/Ajnasz/sekret.link/internal/views"
+)
+
+// ListAuditEventsManager is the interface for reading the audit log of an
+// entry
+type ListAuditEventsManager interface {
+	ListAuditEvents(ctx context.Context, UUID string, deleteKey string) ([]services.AuditEvent, error)
+}
+
+// ListAuditEventsHandler is the handler for reading the audit log of an entry
+type ListAuditEventsHandler struct {
+	entryManager ListAuditEventsManager
+	view         views.View[views.AuditEventListResponse]
+	parser       parsers.Parser[parsers.ListAuditEventsRequestData]
+}
+
+// NewListAuditEventsHandler creates a new ListAuditEventsHandler instance
+func NewListAuditEventsHandler(
+	parser parsers.Parser[parsers.ListAuditEventsRequestData],
+	entryManager ListAuditEventsManager,
+	view views.View[views.AuditEventListResponse],
+) ListAuditEventsHandler {
+	return ListAuditEventsHandler{
+		view:         view,
+		parser:       parser,
+		entryManager: entryManager,
+	}
+}
+
+func (l ListAuditEventsHandler) handle(w http.ResponseWriter, r *http.Request) error {
+	request, err := l.parser.Parse(r)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	events, err := l.entryManager.ListAuditEvents(ctx, request.UUID, request.DeleteKey)
+	if err != nil {
+		return err
+	}
+
+	l.view.Render(w, r, views.BuildAuditEventListResponse(request.UUID, events))
+	return nil
+}
+
+// Handle handles the list audit events request
+func (l ListAuditEventsHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if err := l.handle(w, r); err != nil {
+		l.view.RenderError(w, r, err)
+	}
+}
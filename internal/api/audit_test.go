@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Ajnasz/sekret.link/internal/parsers"
+	"github.com/Ajnasz/sekret.link/internal/services"
+	"github.com/Ajnasz/sekret.link/internal/views"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAuditEventsManager struct {
+	mock.Mock
+}
+
+func (m *MockAuditEventsManager) ListAuditEvents(ctx context.Context, UUID string, deleteKey string) ([]services.AuditEvent, error) {
+	args := m.Called(ctx, UUID, deleteKey)
+	return args.Get(0).([]services.AuditEvent), args.Error(1)
+}
+
+type MockAuditEventListView struct {
+	mock.Mock
+}
+
+func (m *MockAuditEventListView) Render(w http.ResponseWriter, r *http.Request, data views.AuditEventListResponse) {
+	m.Called(w, r, data)
+}
+
+func (m *MockAuditEventListView) RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	m.Called(w, r, err)
+}
+
+func Test_ListAuditEventsHandle(t *testing.T) {
+	entryManager := new(MockAuditEventsManager)
+	view := new(MockAuditEventListView)
+
+	entryManager.On("ListAuditEvents", mock.Anything, "40e7d7d6-db0d-11ee-b9ee-1340bdbad9b2", "delete-key").
+		Return([]services.AuditEvent{{Event: services.AuditCreated, ClientIP: "192.0.2.1"}}, nil)
+	view.On("Render", mock.Anything, mock.Anything, mock.MatchedBy(func(data views.AuditEventListResponse) bool {
+		return len(data.Events) == 1 && data.Events[0].Event == "created" && data.Events[0].ClientIP == "192.0.2.1"
+	})).Return()
+
+	handler := NewListAuditEventsHandler(parsers.NewListAuditEventsParser(), entryManager, view)
+
+	request := newEntryKeysRequest("GET", "http://example.com/audit/40e7d7d6-db0d-11ee-b9ee-1340bdbad9b2/delete-key")
+	handler.Handle(httptest.NewRecorder(), request)
+
+	entryManager.AssertExpectations(t)
+	view.AssertExpectations(t)
+}
+
+func Test_ListAuditEventsHandle_InvalidDeleteKey(t *testing.T) {
+	entryManager := new(MockAuditEventsManager)
+	view := new(MockAuditEventListView)
+
+	entryManager.On("ListAuditEvents", mock.Anything, "40e7d7d6-db0d-11ee-b9ee-1340bdbad9b2", "delete-key").
+		Return([]services.AuditEvent(nil), services.ErrInvalidDeleteKey)
+	view.On("RenderError", mock.Anything, mock.Anything, services.ErrInvalidDeleteKey).Return()
+
+	handler := NewListAuditEventsHandler(parsers.NewListAuditEventsParser(), entryManager, view)
+
+	request := newEntryKeysRequest("GET", "http://example.com/audit/40e7d7d6-db0d-11ee-b9ee-1340bdbad9b2/delete-key")
+	handler.Handle(httptest.NewRecorder(), request)
+
+	entryManager.AssertExpectations(t)
+	view.AssertExpectations(t)
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/parsers"
+	"github.com/Ajnasz/sekret.link/internal/services"
+	"github.com/Ajnasz/sekret.link/internal/views"
+)
+
+// CreateClientEncryptedEntryParser is an interface for parsing the client
+// encrypted create entry request
+type CreateClientEncryptedEntryParser interface {
+	Parse(r *http.Request) (*parsers.CreateClientEncryptedEntryRequestData, error)
+}
+
+// CreateClientEncryptedEntryManager is an interface for creating client
+// encrypted entries
+type CreateClientEncryptedEntryManager interface {
+	CreateClientEncryptedEntry(ctx context.Context, contentType string, body []byte, keyHash []byte, expiration *time.Duration, maxReads *int) (*services.EntryMeta, error)
+}
+
+// CreateClientEncryptedHandler is an http.Handler implementaton which stores
+// secrets encrypted by the client
+type CreateClientEncryptedHandler struct {
+	maxDataSize  int64
+	parser       CreateClientEncryptedEntryParser
+	entryManager CreateClientEncryptedEntryManager
+	view         views.View[views.ClientEncryptedEntryCreatedResponse]
+}
+
+// NewCreateClientEncryptedHandler creates a new CreateClientEncryptedHandler
+func NewCreateClientEncryptedHandler(
+	maxDataSize int64,
+	parser CreateClientEncryptedEntryParser,
+	entryManager CreateClientEncryptedEntryManager,
+	view views.View[views.ClientEncryptedEntryCreatedResponse],
+) CreateClientEncryptedHandler {
+	return CreateClientEncryptedHandler{
+		maxDataSize:  maxDataSize,
+		parser:       parser,
+		entryManager: entryManager,
+		view:         view,
+	}
+}
+
+func (c CreateClientEncryptedHandler) handle(w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, c.maxDataSize)
+
+	data, err := c.parser.Parse(r)
+
+	if err != nil {
+		return errors.Join(ErrRequestParseError, err)
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+	entry, err := c.entryManager.CreateClientEncryptedEntry(ctx, data.ContentType, data.Body, data.KeyHash, &data.Expiration, &data.MaxReads)
+
+	if err != nil {
+		return err
+	}
+
+	c.view.Render(w, r, views.BuildClientEncryptedEntryCreatedResponse(entry))
+	return nil
+}
+
+// Handle handles http request to create client encrypted secret
+func (c CreateClientEncryptedHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if err := c.handle(w, r); err != nil {
+		slog.Error("create error", "error", err)
+		c.view.RenderError(w, r, err)
+	}
+}
@@ -20,7 +20,7 @@ type CreateEntryParser interface {
 
 // CreateEntryManager is an interface for creating entries
 type CreateEntryManager interface {
-	CreateEntry(ctx context.Context, contentType string, body []byte, expiration *time.Duration, maxReads *int) (*services.EntryMeta, key.Key, error)
+	CreateEntry(ctx context.Context, contentType string, body []byte, expiration *time.Duration, maxReads *int, passphrase []byte, webhook *services.Webhook) (*services.EntryMeta, key.Key, error)
 }
 
 // CreateEntryView is an interface for rendering the create entry response
@@ -61,9 +61,14 @@ func (c CreateHandler) handle(w http.ResponseWriter, r *http.Request) error {
 		return errors.Join(ErrRequestParseError, err)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := requestContext(r)
 	defer cancel()
-	entry, key, err := c.entryManager.CreateEntry(ctx, data.ContentType, data.Body, &data.Expiration, &data.MaxReads)
+	var webhook *services.Webhook
+	if data.WebhookURL != "" {
+		webhook = &services.Webhook{URL: data.WebhookURL, Secret: data.WebhookSecret}
+	}
+
+	entry, key, err := c.entryManager.CreateEntry(ctx, data.ContentType, data.Body, &data.Expiration, &data.MaxReads, data.Passphrase, webhook)
 
 	if err != nil {
 		return err
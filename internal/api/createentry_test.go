@@ -37,6 +37,8 @@ func (m *MockEntryManager) CreateEntry(
 	body []byte,
 	expiration *time.Duration,
 	maxReads *int,
+	passphrase []byte,
+	webhook *services.Webhook,
 ) (*services.EntryMeta, key.Key, error) {
 	args := m.Called(ctx, contentType, body, maxReads, expiration)
 
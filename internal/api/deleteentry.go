@@ -34,14 +34,13 @@ func NewDeleteHandler(entryManager DeleteEntryManager, view views.View[views.Del
 }
 
 func (d DeleteHandler) handle(w http.ResponseWriter, r *http.Request) error {
-	// TODO move parsing into the parsers package
-	UUID, _, deleteKey, err := parsers.ParseDeleteEntryPath(r.URL.Path)
+	UUID, deleteKey, err := parsers.ParseDeleteEntryRequest(r)
 
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := requestContext(r)
 	defer cancel()
 	if err := d.entryManager.DeleteEntry(ctx, UUID, deleteKey); err != nil {
 		return err
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Ajnasz/sekret.link/internal/parsers"
+	"github.com/Ajnasz/sekret.link/internal/services"
+	"github.com/Ajnasz/sekret.link/internal/views"
+)
+
+// ListEntryKeysManager is the interface for listing the keys of an entry
+type ListEntryKeysManager interface {
+	ListEntryKeys(ctx context.Context, UUID string, deleteKey string) ([]services.EntryKey, error)
+}
+
+// ListEntryKeysHandler is the handler for listing the keys of an entry
+type ListEntryKeysHandler struct {
+	entryManager ListEntryKeysManager
+	view         views.View[views.EntryKeyListResponse]
+	parser       parsers.Parser[parsers.ListEntryKeysRequestData]
+}
+
+// NewListEntryKeysHandler creates a new ListEntryKeysHandler instance
+func NewListEntryKeysHandler(
+	parser parsers.Parser[parsers.ListEntryKeysRequestData],
+	entryManager ListEntryKeysManager,
+	view views.View[views.EntryKeyListResponse],
+) ListEntryKeysHandler {
+	return ListEntryKeysHandler{
+		view:         view,
+		parser:       parser,
+		entryManager: entryManager,
+	}
+}
+
+func (l ListEntryKeysHandler) handle(w http.ResponseWriter, r *http.Request) error {
+	request, err := l.parser.Parse(r)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	entryKeys, err := l.entryManager.ListEntryKeys(ctx, request.UUID, request.DeleteKey)
+	if err != nil {
+		return err
+	}
+
+	l.view.Render(w, r, views.BuildEntryKeyListResponse(request.UUID, entryKeys))
+	return nil
+}
+
+// Handle handles the list entry keys request
+func (l ListEntryKeysHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if err := l.handle(w, r); err != nil {
+		l.view.RenderError(w, r, err)
+	}
+}
+
+// DeleteEntryKeyManager is the interface for revoking a key of an entry
+type DeleteEntryKeyManager interface {
+	DeleteEntryKey(ctx context.Context, UUID string, deleteKey string, keyUUID string) error
+}
+
+// DeleteEntryKeyHandler is the handler for revoking a key of an entry
+type DeleteEntryKeyHandler struct {
+	entryManager DeleteEntryKeyManager
+	view         views.View[views.DeleteEntryKeyResponse]
+	parser       parsers.Parser[parsers.DeleteEntryKeyRequestData]
+}
+
+// NewDeleteEntryKeyHandler creates a new DeleteEntryKeyHandler instance
+func NewDeleteEntryKeyHandler(
+	parser parsers.Parser[parsers.DeleteEntryKeyRequestData],
+	entryManager DeleteEntryKeyManager,
+	view views.View[views.DeleteEntryKeyResponse],
+) DeleteEntryKeyHandler {
+	return DeleteEntryKeyHandler{
+		view:         view,
+		parser:       parser,
+		entryManager: entryManager,
+	}
+}
+
+func (d DeleteEntryKeyHandler) handle(w http.ResponseWriter, r *http.Request) error {
+	request, err := d.parser.Parse(r)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	if err := d.entryManager.DeleteEntryKey(ctx, request.UUID, request.DeleteKey, request.KeyUUID); err != nil {
+		return err
+	}
+
+	d.view.Render(w, r, views.DeleteEntryKeyResponse{})
+	return nil
+}
+
+// Handle handles the delete entry key request
+func (d DeleteEntryKeyHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if err := d.handle(w, r); err != nil {
+		d.view.RenderError(w, r, err)
+	}
+}
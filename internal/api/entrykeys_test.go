@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Ajnasz/sekret.link/internal/parsers"
+	"github.com/Ajnasz/sekret.link/internal/services"
+	"github.com/Ajnasz/sekret.link/internal/views"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockEntryKeysManager struct {
+	mock.Mock
+}
+
+func (m *MockEntryKeysManager) ListEntryKeys(ctx context.Context, UUID string, deleteKey string) ([]services.EntryKey, error) {
+	args := m.Called(ctx, UUID, deleteKey)
+	return args.Get(0).([]services.EntryKey), args.Error(1)
+}
+
+func (m *MockEntryKeysManager) DeleteEntryKey(ctx context.Context, UUID string, deleteKey string, keyUUID string) error {
+	args := m.Called(ctx, UUID, deleteKey, keyUUID)
+	return args.Error(0)
+}
+
+type MockEntryKeyListView struct {
+	mock.Mock
+}
+
+func (m *MockEntryKeyListView) Render(w http.ResponseWriter, r *http.Request, data views.EntryKeyListResponse) {
+	m.Called(w, r, data)
+}
+
+func (m *MockEntryKeyListView) RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	m.Called(w, r, err)
+}
+
+type MockEntryKeyDeleteView struct {
+	mock.Mock
+}
+
+func (m *MockEntryKeyDeleteView) Render(w http.ResponseWriter, r *http.Request, data views.DeleteEntryKeyResponse) {
+	m.Called(w, r)
+}
+
+func (m *MockEntryKeyDeleteView) RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	m.Called(w, r, err)
+}
+
+func newEntryKeysRequest(method string, url string) *http.Request {
+	request := httptest.NewRequest(method, url, nil)
+	request.SetPathValue("uuid", "40e7d7d6-db0d-11ee-b9ee-1340bdbad9b2")
+	request.SetPathValue("deleteKey", "delete-key")
+	return request
+}
+
+func Test_ListEntryKeysHandle(t *testing.T) {
+	entryManager := new(MockEntryKeysManager)
+	view := new(MockEntryKeyListView)
+
+	entryManager.On("ListEntryKeys", mock.Anything, "40e7d7d6-db0d-11ee-b9ee-1340bdbad9b2", "delete-key").
+		Return([]services.EntryKey{{UUID: "b1e0a6c2-db0d-11ee-b9ee-1340bdbad9b2", RemainingReads: 2, HasReadLimit: true}}, nil)
+	view.On("Render", mock.Anything, mock.Anything, mock.MatchedBy(func(data views.EntryKeyListResponse) bool {
+		return len(data.Keys) == 1 && data.Keys[0].RemainingReads != nil && *data.Keys[0].RemainingReads == 2
+	})).Return()
+
+	handler := NewListEntryKeysHandler(parsers.NewListEntryKeysParser(), entryManager, view)
+
+	request := newEntryKeysRequest("GET", "http://example.com/keys/40e7d7d6-db0d-11ee-b9ee-1340bdbad9b2/delete-key")
+	handler.Handle(httptest.NewRecorder(), request)
+
+	entryManager.AssertExpectations(t)
+	view.AssertExpectations(t)
+}
+
+func Test_ListEntryKeysHandle_InvalidDeleteKey(t *testing.T) {
+	entryManager := new(MockEntryKeysManager)
+	view := new(MockEntryKeyListView)
+
+	entryManager.On("ListEntryKeys", mock.Anything, "40e7d7d6-db0d-11ee-b9ee-1340bdbad9b2", "delete-key").
+		Return([]services.EntryKey(nil), services.ErrInvalidDeleteKey)
+	view.On("RenderError", mock.Anything, mock.Anything, mock.MatchedBy(func(err error) bool {
+		return errors.Is(err, services.ErrInvalidDeleteKey)
+	})).Return()
+
+	handler := NewListEntryKeysHandler(parsers.NewListEntryKeysParser(), entryManager, view)
+
+	request := newEntryKeysRequest("GET", "http://example.com/keys/40e7d7d6-db0d-11ee-b9ee-1340bdbad9b2/delete-key")
+	handler.Handle(httptest.NewRecorder(), request)
+
+	entryManager.AssertExpectations(t)
+	view.AssertExpectations(t)
+}
+
+func Test_DeleteEntryKeyHandle(t *testing.T) {
+	entryManager := new(MockEntryKeysManager)
+	view := new(MockEntryKeyDeleteView)
+
+	entryManager.On("DeleteEntryKey", mock.Anything, "40e7d7d6-db0d-11ee-b9ee-1340bdbad9b2", "delete-key", "b1e0a6c2-db0d-11ee-b9ee-1340bdbad9b2").
+		Return(nil)
+	view.On("Render", mock.Anything, mock.Anything).Return()
+
+	handler := NewDeleteEntryKeyHandler(parsers.NewDeleteEntryKeyParser(), entryManager, view)
+
+	request := newEntryKeysRequest("DELETE", "http://example.com/keys/40e7d7d6-db0d-11ee-b9ee-1340bdbad9b2/delete-key/b1e0a6c2-db0d-11ee-b9ee-1340bdbad9b2")
+	request.SetPathValue("keyUUID", "b1e0a6c2-db0d-11ee-b9ee-1340bdbad9b2")
+	handler.Handle(httptest.NewRecorder(), request)
+
+	entryManager.AssertExpectations(t)
+	view.AssertExpectations(t)
+}
+
+// It should bad request when the key uuid in the URL is invalid
+func Test_DeleteEntryKeyHandle_InvalidKeyUUID(t *testing.T) {
+	entryManager := new(MockEntryKeysManager)
+	view := new(MockEntryKeyDeleteView)
+
+	view.On("RenderError", mock.Anything, mock.Anything, mock.MatchedBy(func(err error) bool {
+		return errors.Is(err, parsers.ErrInvalidUUID)
+	})).Return()
+
+	handler := NewDeleteEntryKeyHandler(parsers.NewDeleteEntryKeyParser(), entryManager, view)
+
+	request := newEntryKeysRequest("DELETE", "http://example.com/keys/40e7d7d6-db0d-11ee-b9ee-1340bdbad9b2/delete-key/foo")
+	request.SetPathValue("keyUUID", "foo")
+	handler.Handle(httptest.NewRecorder(), request)
+
+	entryManager.AssertExpectations(t)
+	view.AssertExpectations(t)
+}
@@ -17,7 +17,7 @@ type GenerateEntryKeyView interface {
 }
 
 type GenerateEntryKeyManager interface {
-	GenerateEntryKey(ctx context.Context, UUID string, k key.Key, expire *time.Duration, maxReads *int) (*services.EntryKeyData, error)
+	GenerateEntryKey(ctx context.Context, UUID string, k key.Key, passphrase []byte, expire *time.Duration, maxReads *int, newPassphrase []byte) (*services.EntryKeyData, error)
 }
 
 type GenerateEntryKeyHandler struct {
@@ -45,10 +45,10 @@ func (g GenerateEntryKeyHandler) handle(w http.ResponseWriter, r *http.Request)
 		return err
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := requestContext(r)
 	defer cancel()
 
-	entry, err := g.entryManager.GenerateEntryKey(ctx, request.UUID, request.Key, &request.Expiration, &request.MaxReads)
+	entry, err := g.entryManager.GenerateEntryKey(ctx, request.UUID, request.Key, request.Passphrase, &request.Expiration, &request.MaxReads, request.NewPassphrase)
 	if err != nil {
 		return err
 	}
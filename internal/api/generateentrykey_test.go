@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -33,8 +34,10 @@ type MockGenerateEntryKeyManager struct {
 func (m *MockGenerateEntryKeyManager) GenerateEntryKey(ctx context.Context,
 	UUID string,
 	k key.Key,
+	passphrase []byte,
 	expire *time.Duration,
 	maxReads *int,
+	newPassphrase []byte,
 ) (*services.EntryKeyData, error) {
 	args := m.Called(ctx, UUID, k)
 	return args.Get(0).(*services.EntryKeyData), args.Error(2)
@@ -77,7 +80,7 @@ func TestGenerateEntryKey_Handle(t *testing.T) {
 		KEK:       *newKey,
 	}, *newKey, nil)
 
-	handler.Handle(nil, nil)
+	handler.Handle(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
 	managerMock.AssertExpectations(t)
 	parserMock.AssertExpectations(t)
 	viewMock.AssertExpectations(t)
@@ -93,7 +96,7 @@ func TestGenerateEntryKey_HandleParseError(t *testing.T) {
 	parserMock.On("Parse", mock.Anything).Return(parsers.GenerateEntryKeyRequestData{}, assert.AnError)
 
 	viewMock.On("RenderError", mock.Anything, mock.Anything, mock.Anything).Return()
-	handler.Handle(nil, nil)
+	handler.Handle(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
 	managerMock.AssertExpectations(t)
 	parserMock.AssertExpectations(t)
 	viewMock.AssertExpectations(t)
@@ -116,7 +119,7 @@ func TestGenerateEntryKey_HandleManagerError(t *testing.T) {
 
 	managerMock.On("GenerateEntryKey", mock.Anything, "a6a9d8cc-db7f-11ee-8f4f-3b41146b31eb", *k).Return(&services.EntryKeyData{}, []byte{}, assert.AnError)
 
-	handler.Handle(nil, nil)
+	handler.Handle(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
 	managerMock.AssertExpectations(t)
 	parserMock.AssertExpectations(t)
 	viewMock.AssertExpectations(t)
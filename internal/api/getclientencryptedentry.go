@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Ajnasz/sekret.link/internal/parsers"
+	"github.com/Ajnasz/sekret.link/internal/services"
+	"github.com/Ajnasz/sekret.link/internal/views"
+)
+
+// GetClientEncryptedEntryManager is the interface for getting a client
+// encrypted entry
+type GetClientEncryptedEntryManager interface {
+	ReadClientEncryptedEntry(ctx context.Context, UUID string, keyHash []byte) (*services.Entry, error)
+}
+
+// GetClientEncryptedHandler is the handler for getting a client encrypted
+// entry
+type GetClientEncryptedHandler struct {
+	entryManager GetClientEncryptedEntryManager
+	view         views.View[views.ClientEncryptedEntryReadResponse]
+	parser       parsers.Parser[parsers.GetClientEncryptedEntryRequestData]
+}
+
+// NewGetClientEncryptedHandler creates a new GetClientEncryptedHandler instance
+func NewGetClientEncryptedHandler(
+	parser parsers.Parser[parsers.GetClientEncryptedEntryRequestData],
+	entryManager GetClientEncryptedEntryManager,
+	view views.View[views.ClientEncryptedEntryReadResponse],
+) GetClientEncryptedHandler {
+	return GetClientEncryptedHandler{
+		view:         view,
+		parser:       parser,
+		entryManager: entryManager,
+	}
+}
+
+func (g GetClientEncryptedHandler) handle(w http.ResponseWriter, r *http.Request) error {
+	request, err := g.parser.Parse(r)
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	entry, err := g.entryManager.ReadClientEncryptedEntry(ctx, request.UUID, request.KeyHash)
+	if err != nil {
+		return err
+	}
+
+	g.view.Render(w, r, views.BuildClientEncryptedEntryReadResponse(*entry))
+
+	return nil
+}
+
+// Handle handles http request to get a client encrypted secret
+func (g GetClientEncryptedHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	err := g.handle(w, r)
+	if err != nil {
+		g.view.RenderError(w, r, err)
+	}
+}
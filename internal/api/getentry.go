@@ -13,7 +13,7 @@ import (
 
 // GetEntryManager is the interface for getting an entry
 type GetEntryManager interface {
-	ReadEntry(ctx context.Context, UUID string, k key.Key) (*services.Entry, error)
+	ReadEntry(ctx context.Context, UUID string, k key.Key, passphrase []byte) (*services.Entry, error)
 }
 
 // GetEntryView is the interface for the view that should be implemented to render the get entry results
@@ -52,10 +52,10 @@ func (g GetHandler) handle(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := requestContext(r)
 	defer cancel()
 
-	entry, err := g.entryManager.ReadEntry(ctx, request.UUID, request.Key)
+	entry, err := g.entryManager.ReadEntry(ctx, request.UUID, request.Key, request.Passphrase)
 	if err != nil {
 		return err
 	}
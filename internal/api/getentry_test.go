@@ -40,7 +40,7 @@ type GetEntryManagerMock struct {
 	mock.Mock
 }
 
-func (g *GetEntryManagerMock) ReadEntry(ctx context.Context, UUID string, k key.Key) (*services.Entry, error) {
+func (g *GetEntryManagerMock) ReadEntry(ctx context.Context, UUID string, k key.Key, passphrase []byte) (*services.Entry, error) {
 	args := g.Called(ctx, UUID, k)
 	return args.Get(0).(*services.Entry), args.Error(1)
 }
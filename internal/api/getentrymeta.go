@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Ajnasz/sekret.link/internal/key"
+	"github.com/Ajnasz/sekret.link/internal/parsers"
+	"github.com/Ajnasz/sekret.link/internal/services"
+	"github.com/Ajnasz/sekret.link/internal/views"
+)
+
+// GetEntryMetaManager is the interface for getting the metadata of an entry
+type GetEntryMetaManager interface {
+	ReadEntryMeta(ctx context.Context, UUID string, k key.Key, passphrase []byte) (*services.EntryMeta, error)
+}
+
+// GetMetaHandler is the handler for getting the metadata of an entry, it does
+// not use up a read of the entry
+type GetMetaHandler struct {
+	entryManager GetEntryMetaManager
+	view         views.View[views.EntryMetaResponse]
+	parser       parsers.Parser[parsers.GetEntryRequestData]
+}
+
+// NewGetMetaHandler creates a new GetMetaHandler instance
+func NewGetMetaHandler(
+	parser parsers.Parser[parsers.GetEntryRequestData],
+	entryManager GetEntryMetaManager,
+	view views.View[views.EntryMetaResponse],
+) GetMetaHandler {
+	return GetMetaHandler{
+		view:         view,
+		parser:       parser,
+		entryManager: entryManager,
+	}
+}
+
+func (g GetMetaHandler) handle(w http.ResponseWriter, r *http.Request) error {
+	request, err := g.parser.Parse(r)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	meta, err := g.entryManager.ReadEntryMeta(ctx, request.UUID, request.Key, request.Passphrase)
+	if err != nil {
+		return err
+	}
+
+	g.view.Render(w, r, views.BuildEntryMetaResponse(*meta))
+	return nil
+}
+
+// Handle handles http request to get the metadata of an entry
+func (g GetMetaHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if err := g.handle(w, r); err != nil {
+		g.view.RenderError(w, r, err)
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Ajnasz/sekret.link/internal/parsers"
+	"github.com/Ajnasz/sekret.link/internal/views"
+)
+
+// RevealHandler renders the page which reveals the secret on an explicit
+// request, the entry is not read by the handler
+type RevealHandler struct {
+	view   views.View[views.EntryRevealResponse]
+	parser parsers.Parser[parsers.GetEntryRequestData]
+}
+
+// NewRevealHandler creates a new RevealHandler instance
+func NewRevealHandler(
+	parser parsers.Parser[parsers.GetEntryRequestData],
+	view views.View[views.EntryRevealResponse],
+) RevealHandler {
+	return RevealHandler{
+		view:   view,
+		parser: parser,
+	}
+}
+
+func (h RevealHandler) handle(w http.ResponseWriter, r *http.Request) error {
+	request, err := h.parser.Parse(r)
+	if err != nil {
+		return err
+	}
+
+	h.view.Render(w, r, views.EntryRevealResponse{UUID: request.UUID})
+	return nil
+}
+
+// Handle handles http request to show the reveal page
+func (h RevealHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if err := h.handle(w, r); err != nil {
+		h.view.RenderError(w, r, err)
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Ajnasz/sekret.link/internal/parsers"
+	"github.com/Ajnasz/sekret.link/internal/views"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockEntryRevealView struct {
+	mock.Mock
+}
+
+func (m *MockEntryRevealView) Render(w http.ResponseWriter, r *http.Request, data views.EntryRevealResponse) {
+	m.Called(w, r, data)
+}
+
+func (m *MockEntryRevealView) RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	m.Called(w, r, err)
+}
+
+func TestRevealHandle(t *testing.T) {
+	parserMock := new(GetEntryParserMock)
+	viewMock := new(MockEntryRevealView)
+
+	parserMock.On("Parse", mock.Anything).Return(parsers.GetEntryRequestData{
+		UUID: "a6a9d8cc-db7f-11ee-8f4f-3b41146b31eb",
+	}, nil)
+	viewMock.On("Render", mock.Anything, mock.Anything, views.EntryRevealResponse{UUID: "a6a9d8cc-db7f-11ee-8f4f-3b41146b31eb"}).Return()
+
+	handler := NewRevealHandler(parserMock, viewMock)
+	handler.Handle(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/a6a9d8cc-db7f-11ee-8f4f-3b41146b31eb/key", nil))
+
+	parserMock.AssertExpectations(t)
+	viewMock.AssertExpectations(t)
+}
+
+func TestRevealHandle_ParseError(t *testing.T) {
+	parserMock := new(GetEntryParserMock)
+	viewMock := new(MockEntryRevealView)
+
+	parserMock.On("Parse", mock.Anything).Return(parsers.GetEntryRequestData{}, parsers.ErrInvalidKey)
+	viewMock.On("RenderError", mock.Anything, mock.Anything, mock.MatchedBy(func(err error) bool {
+		return errors.Is(err, parsers.ErrInvalidKey)
+	})).Return()
+
+	handler := NewRevealHandler(parserMock, viewMock)
+	handler.Handle(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/a6a9d8cc-db7f-11ee-8f4f-3b41146b31eb/key", nil))
+
+	viewMock.AssertExpectations(t)
+}
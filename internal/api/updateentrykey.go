@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/key"
+	"github.com/Ajnasz/sekret.link/internal/parsers"
+	"github.com/Ajnasz/sekret.link/internal/services"
+	"github.com/Ajnasz/sekret.link/internal/views"
+)
+
+// UpdateEntryKeyManager is the interface for updating a key of an entry
+type UpdateEntryKeyManager interface {
+	UpdateEntryKey(ctx context.Context, UUID string, deleteKey string, keyUUID string, expire *time.Duration, maxReads *int) (*services.EntryKey, error)
+	UpdateEntryKeyByKey(ctx context.Context, UUID string, k key.Key, passphrase []byte, expire *time.Duration, maxReads *int) (*services.EntryKey, error)
+}
+
+// UpdateEntryKeyHandler is the handler for updating the expiration and the
+// remaining reads of a key
+type UpdateEntryKeyHandler struct {
+	entryManager UpdateEntryKeyManager
+	view         views.View[views.EntryKeyResponse]
+	parser       parsers.Parser[parsers.UpdateEntryKeyRequestData]
+}
+
+// NewUpdateEntryKeyHandler creates a new UpdateEntryKeyHandler instance
+func NewUpdateEntryKeyHandler(
+	parser parsers.Parser[parsers.UpdateEntryKeyRequestData],
+	entryManager UpdateEntryKeyManager,
+	view views.View[views.EntryKeyResponse],
+) UpdateEntryKeyHandler {
+	return UpdateEntryKeyHandler{
+		view:         view,
+		parser:       parser,
+		entryManager: entryManager,
+	}
+}
+
+func (u UpdateEntryKeyHandler) handle(w http.ResponseWriter, r *http.Request) error {
+	request, err := u.parser.Parse(r)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	var entryKey *services.EntryKey
+	if request.DeleteKey != "" {
+		entryKey, err = u.entryManager.UpdateEntryKey(ctx, request.UUID, request.DeleteKey, request.KeyUUID, request.Expiration, request.MaxReads)
+	} else {
+		entryKey, err = u.entryManager.UpdateEntryKeyByKey(ctx, request.UUID, request.Key, request.Passphrase, request.Expiration, request.MaxReads)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	u.view.Render(w, r, views.BuildEntryKeyResponse(*entryKey))
+	return nil
+}
+
+// Handle handles the update entry key request
+func (u UpdateEntryKeyHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if err := u.handle(w, r); err != nil {
+		u.view.RenderError(w, r, err)
+	}
+}
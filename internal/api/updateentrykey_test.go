@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/key"
+	"github.com/Ajnasz/sekret.link/internal/parsers"
+	"github.com/Ajnasz/sekret.link/internal/services"
+	"github.com/Ajnasz/sekret.link/internal/views"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockUpdateEntryKeyManager struct {
+	mock.Mock
+}
+
+func (m *MockUpdateEntryKeyManager) UpdateEntryKey(ctx context.Context, UUID string, deleteKey string, keyUUID string, expire *time.Duration, maxReads *int) (*services.EntryKey, error) {
+	args := m.Called(ctx, UUID, deleteKey, keyUUID, expire, maxReads)
+	return args.Get(0).(*services.EntryKey), args.Error(1)
+}
+
+func (m *MockUpdateEntryKeyManager) UpdateEntryKeyByKey(ctx context.Context, UUID string, k key.Key, passphrase []byte, expire *time.Duration, maxReads *int) (*services.EntryKey, error) {
+	args := m.Called(ctx, UUID, k, passphrase, expire, maxReads)
+	return args.Get(0).(*services.EntryKey), args.Error(1)
+}
+
+type MockEntryKeyUpdateView struct {
+	mock.Mock
+}
+
+func (m *MockEntryKeyUpdateView) Render(w http.ResponseWriter, r *http.Request, data views.EntryKeyResponse) {
+	m.Called(w, r, data)
+}
+
+func (m *MockEntryKeyUpdateView) RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	m.Called(w, r, err)
+}
+
+type UpdateEntryKeyParserMock struct {
+	mock.Mock
+}
+
+func (p *UpdateEntryKeyParserMock) Parse(r *http.Request) (parsers.UpdateEntryKeyRequestData, error) {
+	args := p.Called(r)
+	return args.Get(0).(parsers.UpdateEntryKeyRequestData), args.Error(1)
+}
+
+func Test_UpdateEntryKeyHandle(t *testing.T) {
+	maxReads := 0
+
+	t.Run("with the delete key", func(t *testing.T) {
+		parser := new(UpdateEntryKeyParserMock)
+		entryManager := new(MockUpdateEntryKeyManager)
+		view := new(MockEntryKeyUpdateView)
+
+		parser.On("Parse", mock.Anything).Return(parsers.UpdateEntryKeyRequestData{
+			UUID:      "40e7d7d6-db0d-11ee-b9ee-1340bdbad9b2",
+			DeleteKey: "delete-key",
+			KeyUUID:   "b1e0a6c2-db0d-11ee-b9ee-1340bdbad9b2",
+			MaxReads:  &maxReads,
+		}, nil)
+		entryManager.On("UpdateEntryKey", mock.Anything, "40e7d7d6-db0d-11ee-b9ee-1340bdbad9b2", "delete-key", "b1e0a6c2-db0d-11ee-b9ee-1340bdbad9b2", (*time.Duration)(nil), &maxReads).
+			Return(&services.EntryKey{UUID: "b1e0a6c2-db0d-11ee-b9ee-1340bdbad9b2"}, nil)
+		view.On("Render", mock.Anything, mock.Anything, views.EntryKeyResponse{UUID: "b1e0a6c2-db0d-11ee-b9ee-1340bdbad9b2"}).Return()
+
+		handler := NewUpdateEntryKeyHandler(parser, entryManager, view)
+		handler.Handle(httptest.NewRecorder(), httptest.NewRequest("PATCH", "http://example.com/", nil))
+
+		entryManager.AssertExpectations(t)
+		view.AssertExpectations(t)
+	})
+
+	t.Run("with the key", func(t *testing.T) {
+		k, err := key.NewGeneratedKey()
+		assert.NoError(t, err)
+
+		parser := new(UpdateEntryKeyParserMock)
+		entryManager := new(MockUpdateEntryKeyManager)
+		view := new(MockEntryKeyUpdateView)
+
+		parser.On("Parse", mock.Anything).Return(parsers.UpdateEntryKeyRequestData{
+			UUID:     "40e7d7d6-db0d-11ee-b9ee-1340bdbad9b2",
+			Key:      *k,
+			MaxReads: &maxReads,
+		}, nil)
+		entryManager.On("UpdateEntryKeyByKey", mock.Anything, "40e7d7d6-db0d-11ee-b9ee-1340bdbad9b2", *k, []byte(nil), (*time.Duration)(nil), &maxReads).
+			Return(&services.EntryKey{UUID: "b1e0a6c2-db0d-11ee-b9ee-1340bdbad9b2"}, nil)
+		view.On("Render", mock.Anything, mock.Anything, mock.Anything).Return()
+
+		handler := NewUpdateEntryKeyHandler(parser, entryManager, view)
+		handler.Handle(httptest.NewRecorder(), httptest.NewRequest("PATCH", "http://example.com/", nil))
+
+		entryManager.AssertExpectations(t)
+		view.AssertExpectations(t)
+	})
+}
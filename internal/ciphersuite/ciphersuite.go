@@ -0,0 +1,263 @@
+// Package ciphersuite is the registry of the AEAD ciphers which encrypt the
+// stored blobs. Every blob starts with a small versioned header which names
+// its cipher, so the ciphers can be changed without re-encrypting the stored
+// blobs. The blobs are bound to their context with the associated data, so a
+// blob can not be moved to an other context. The blobs stored before the
+// header was introduced are AES-256-GCM blobs without header, and the blobs
+// of the first header version have no associated data, they can be opened
+// too, unless the legacy blobs are rejected.
+package ciphersuite
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// KeySize is the size of the keys of every cipher
+const KeySize = 32
+
+// HeaderSize is the size of the header of the blobs
+const HeaderSize = 4
+
+// headerVersion is the version of the header format, the blobs of this
+// version are bound to the associated data
+const headerVersion = 2
+
+// unboundHeaderVersion is the version of the blobs without associated data
+const unboundHeaderVersion = 1
+
+// headerMagic starts the header of every blob
+var headerMagic = []byte{'S', 'L'}
+
+// ErrUnknownCipher is returned when the cipher is not registered
+var ErrUnknownCipher = errors.New("unknown cipher")
+
+// ErrInvalidBlob is returned when the blob is too short to be opened
+var ErrInvalidBlob = errors.New("invalid encrypted blob")
+
+// ErrLegacyBlob is returned by OpenBound when the blob is not bound to
+// associated data
+var ErrLegacyBlob = errors.New("legacy encrypted blob")
+
+// Suite is an AEAD cipher which can encrypt the blobs, the ID is stored in
+// the header of the blobs, so it must never change
+type Suite struct {
+	ID      byte
+	Name    string
+	NewAEAD func(key []byte) (cipher.AEAD, error)
+}
+
+// IsZero reports whether the suite is not set
+func (s Suite) IsZero() bool {
+	return s.NewAEAD == nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+var (
+	// AES256GCM is AES-256 in GCM mode with 12 byte random nonces, it is
+	// the cipher of the blobs without header too
+	AES256GCM = Suite{ID: 1, Name: "aes-256-gcm", NewAEAD: newAESGCM}
+	// XChaCha20Poly1305 is fast without AES hardware support, and its 24
+	// byte random nonces never collide in practice
+	XChaCha20Poly1305 = Suite{ID: 2, Name: "xchacha20-poly1305", NewAEAD: chacha20poly1305.NewX}
+)
+
+var (
+	mu     sync.RWMutex
+	suites = map[byte]Suite{}
+)
+
+func init() {
+	Register(AES256GCM)
+	Register(XChaCha20Poly1305)
+}
+
+// Register adds the suite to the registry, it panics when the id or the name
+// is already registered
+func Register(suite Suite) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if suite.ID == 0 || suite.Name == "" || suite.NewAEAD == nil {
+		panic("ciphersuite: invalid suite")
+	}
+
+	for _, s := range suites {
+		if s.ID == suite.ID || s.Name == suite.Name {
+			panic(fmt.Sprintf("ciphersuite: %s is already registered", suite.Name))
+		}
+	}
+
+	suites[suite.ID] = suite
+}
+
+// ByName returns the registered suite by its name
+func ByName(name string) (Suite, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, s := range suites {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+
+	return Suite{}, fmt.Errorf("%w: %q", ErrUnknownCipher, name)
+}
+
+func byID(id byte) (Suite, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	s, ok := suites[id]
+	return s, ok
+}
+
+// Names returns the names of the registered suites
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(suites))
+	for _, s := range suites {
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// parseHeader returns the suite and the version of the header of the blob,
+// it is false when the blob has no header
+func parseHeader(blob []byte) (Suite, byte, bool) {
+	if len(blob) < HeaderSize || !bytes.Equal(blob[:len(headerMagic)], headerMagic) {
+		return Suite{}, 0, false
+	}
+
+	version := blob[2]
+	if version != headerVersion && version != unboundHeaderVersion {
+		return Suite{}, 0, false
+	}
+
+	suite, ok := byID(blob[3])
+	return suite, version, ok
+}
+
+func open(aead cipher.AEAD, sealed []byte, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrInvalidBlob
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// Seal encrypts the plaintext with the suite and prepends the header, the
+// blob can be opened with the same associated data only
+func Seal(suite Suite, key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	aead, err := suite.NewAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	blob := make([]byte, HeaderSize+aead.NonceSize(), HeaderSize+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	copy(blob, headerMagic)
+	blob[2] = headerVersion
+	blob[3] = suite.ID
+
+	nonce := blob[HeaderSize:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(blob, nonce, plaintext, additionalData), nil
+}
+
+// OpenBound decrypts the blob with the suite named by its header, the
+// legacy blobs without associated data are rejected
+func OpenBound(key []byte, blob []byte, additionalData []byte) ([]byte, error) {
+	suite, version, ok := parseHeader(blob)
+	if !ok || version != headerVersion {
+		return nil, ErrLegacyBlob
+	}
+
+	aead, err := suite.NewAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return open(aead, blob[HeaderSize:], additionalData)
+}
+
+// Open decrypts the blob with the suite named by its header. The legacy blobs
+// are opened without the associated data: the blobs of the first header
+// version, and the AES-256-GCM blobs without header. A blob is opened as a
+// blob without header when it has no header, or when a blob without header
+// starts with bytes which look like a header.
+func Open(key []byte, blob []byte, additionalData []byte) ([]byte, error) {
+	plaintext, _, err := OpenLegacy(key, blob, additionalData)
+	return plaintext, err
+}
+
+// OpenLegacy decrypts the blob like Open, and reports whether it was opened
+// as a legacy blob, so the caller can seal it again bound to its associated
+// data
+func OpenLegacy(key []byte, blob []byte, additionalData []byte) ([]byte, bool, error) {
+	if suite, version, ok := parseHeader(blob); ok {
+		aead, err := suite.NewAEAD(key)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if version == unboundHeaderVersion {
+			additionalData = nil
+		}
+
+		plaintext, err := open(aead, blob[HeaderSize:], additionalData)
+		if err == nil {
+			return plaintext, version == unboundHeaderVersion, nil
+		}
+	}
+
+	aead, err := AES256GCM.NewAEAD(key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	plaintext, err := open(aead, blob, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return plaintext, true, nil
+}
+
+// PlaintextSize returns the size of the plaintext of the blob without
+// opening it
+func PlaintextSize(blob []byte) int {
+	overhead := 12 + 16 // nonce and tag of the legacy AES-256-GCM blobs
+	if suite, _, ok := parseHeader(blob); ok {
+		if aead, err := suite.NewAEAD(make([]byte, KeySize)); err == nil {
+			overhead = HeaderSize + aead.NonceSize() + aead.Overhead()
+		}
+	}
+
+	return max(len(blob)-overhead, 0)
+}
@@ -0,0 +1,106 @@
+package ciphersuite
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestSealOpen(t *testing.T) {
+	for _, name := range Names() {
+		t.Run(name, func(t *testing.T) {
+			suite, err := ByName(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			blob, err := Seal(suite, testKey(1), []byte("secret"), []byte("context"))
+			assert.NoError(t, err)
+			assert.Equal(t, []byte{'S', 'L', headerVersion, suite.ID}, blob[:HeaderSize])
+			assert.Equal(t, len("secret"), PlaintextSize(blob))
+
+			for _, open := range []func([]byte, []byte, []byte) ([]byte, error){Open, OpenBound} {
+				plaintext, err := open(testKey(1), blob, []byte("context"))
+				assert.NoError(t, err)
+				assert.Equal(t, []byte("secret"), plaintext)
+
+				_, err = open(testKey(2), blob, []byte("context"))
+				assert.Error(t, err)
+
+				_, err = open(testKey(1), blob, []byte("other context"))
+				assert.Error(t, err, "the blob is bound to its context")
+			}
+
+			plaintext, legacy, err := OpenLegacy(testKey(1), blob, []byte("context"))
+			assert.NoError(t, err)
+			assert.False(t, legacy)
+			assert.Equal(t, []byte("secret"), plaintext)
+
+			// the header can not be downgraded to the unbound version
+			downgraded := append([]byte{}, blob...)
+			downgraded[2] = unboundHeaderVersion
+			_, err = Open(testKey(1), downgraded, []byte("context"))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestOpen_Legacy(t *testing.T) {
+	aead, err := AES256GCM.NewAEAD(testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := func(nonce []byte) []byte {
+		return aead.Seal(append([]byte{}, nonce...), nonce, []byte("legacy"), nil)
+	}
+
+	unbound := append([]byte{'S', 'L', unboundHeaderVersion, AES256GCM.ID}, legacy(bytes.Repeat([]byte{8}, aead.NonceSize()))...)
+
+	testCases := map[string][]byte{
+		"without header":    legacy(bytes.Repeat([]byte{7}, aead.NonceSize())),
+		"header like nonce": legacy(append([]byte{'S', 'L', headerVersion, XChaCha20Poly1305.ID}, bytes.Repeat([]byte{7}, aead.NonceSize()-HeaderSize)...)),
+		"unbound header":    unbound,
+	}
+
+	for name, blob := range testCases {
+		t.Run(name, func(t *testing.T) {
+			plaintext, err := Open(testKey(1), blob, []byte("context"))
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("legacy"), plaintext)
+
+			_, err = OpenBound(testKey(1), blob, []byte("context"))
+			assert.Error(t, err, "the legacy blobs can be rejected")
+
+			plaintext, legacy, err := OpenLegacy(testKey(1), blob, []byte("context"))
+			assert.NoError(t, err)
+			assert.True(t, legacy)
+			assert.Equal(t, []byte("legacy"), plaintext)
+		})
+	}
+
+	assert.Equal(t, len("legacy"), PlaintextSize(testCases["without header"]))
+	assert.Equal(t, len("legacy"), PlaintextSize(unbound))
+
+	_, err = Open(testKey(1), []byte("short"), nil)
+	assert.ErrorIs(t, err, ErrInvalidBlob)
+}
+
+func TestRegistry(t *testing.T) {
+	suite, err := ByName("xchacha20-poly1305")
+	assert.NoError(t, err)
+	assert.Equal(t, XChaCha20Poly1305.ID, suite.ID)
+
+	_, err = ByName("rot13")
+	assert.ErrorIs(t, err, ErrUnknownCipher)
+
+	assert.Panics(t, func() {
+		Register(Suite{ID: AES256GCM.ID, Name: "other", NewAEAD: func([]byte) (cipher.AEAD, error) { return nil, nil }})
+	})
+}
@@ -0,0 +1,772 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/ciphersuite"
+	"github.com/Ajnasz/sekret.link/internal/masterkey"
+	"github.com/Ajnasz/sekret.link/internal/ratelimit"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidConfig is returned when the configuration is invalid
+var ErrInvalidConfig = errors.New("invalid config")
+
+// ErrUnknownOption is returned when the configuration file contains an option
+// which does not exist
+var ErrUnknownOption = errors.New("unknown option")
+
+// Config is the configuration of the server
+type Config struct {
+	ListenAddress         string
+	WebExternalURL        string
+	ReadTimeout           time.Duration
+	WriteTimeout          time.Duration
+	ShutdownTimeout       time.Duration
+	ShutdownDelay         time.Duration
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSMinVersion         string
+	TLSClientCAFile       string
+	TLSReloadInterval     time.Duration
+	RedirectAddress       string
+	MetricsAddress        string
+	Storage               string
+	PostgresDB            string
+	ExpireSeconds         int
+	MaxExpireSeconds      int
+	MaxDataSize           int64
+	MaxPassphraseAttempts int
+	MaxKeyAttempts        int
+	KeyLockoutAction      string
+	Base62                bool
+	RequireToken          bool
+	CreateRateLimit       string
+	ReadRateLimit         string
+	GenerateKeyRateLimit  string
+	AuthRateLimit         string
+	DailyQuotaBytes       int64
+	DailyQuotaEntries     int
+	TrustedProxies        string
+	WebhookTimeout        time.Duration
+	WebhookMaxAttempts    int
+	WebhookAllowPrivate   bool
+	MasterKeyFile         string
+	MasterKeys            string
+	MasterKeyID           string
+	Cipher                string
+	RejectLegacyCipher    bool
+
+	// ConfigFile is the path of the configuration file
+	ConfigFile string
+	// PrintConfig prints the effective configuration and exits
+	PrintConfig bool
+	// Version prints the version and exits
+	Version bool
+	// Args are the arguments after the flags
+	Args []string
+}
+
+// Default returns the default configuration
+func Default() Config {
+	return Config{
+		ListenAddress:     ":8080",
+		MetricsAddress:    "localhost:9090",
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		ShutdownTimeout:   5 * time.Second,
+		ShutdownDelay:     5 * time.Second,
+		TLSMinVersion:     "1.2",
+		TLSReloadInterval: 10 * time.Second,
+		Storage:           "database",
+		ExpireSeconds:     60 * 60 * 24 * 7,
+		MaxExpireSeconds:  60 * 60 * 24 * 30,
+		MaxDataSize:       1024 * 1024,
+		KeyLockoutAction:  "lock",
+		Cipher:            "aes-256-gcm",
+
+		CreateRateLimit:      "10/1m",
+		ReadRateLimit:        "60/1m",
+		GenerateKeyRateLimit: "10/1m",
+		AuthRateLimit:        "60/1m",
+
+		WebhookTimeout:     10 * time.Second,
+		WebhookMaxAttempts: 10,
+	}
+}
+
+// option describes a configuration option, which can be set from the
+// configuration file, from an environment variable and from a flag
+type option struct {
+	name  string
+	env   string
+	usage string
+	field func(c *Config) any
+	// cli options can not be set in the configuration file
+	cli bool
+}
+
+var options = []option{
+	{
+		name:  "config",
+		env:   "SEKRET_CONFIG",
+		usage: "Path of the configuration file, json, yaml or toml",
+		field: func(c *Config) any { return &c.ConfigFile },
+		cli:   true,
+	},
+	{
+		name:  "listenAddress",
+		env:   "SEKRET_LISTEN_ADDRESS",
+		usage: "Address the http server listens on",
+		field: func(c *Config) any { return &c.ListenAddress },
+	},
+	{
+		name:  "webExternalURL",
+		env:   "SEKRET_WEB_EXTERNAL_URL",
+		usage: "Web server external url",
+		field: func(c *Config) any { return &c.WebExternalURL },
+	},
+	{
+		name:  "readTimeout",
+		env:   "SEKRET_READ_TIMEOUT",
+		usage: "Maximum duration of reading a request",
+		field: func(c *Config) any { return &c.ReadTimeout },
+	},
+	{
+		name:  "writeTimeout",
+		env:   "SEKRET_WRITE_TIMEOUT",
+		usage: "Maximum duration of writing a response",
+		field: func(c *Config) any { return &c.WriteTimeout },
+	},
+	{
+		name:  "shutdownTimeout",
+		env:   "SEKRET_SHUTDOWN_TIMEOUT",
+		usage: "Maximum duration of waiting for the open requests on shutdown",
+		field: func(c *Config) any { return &c.ShutdownTimeout },
+	},
+	{
+		name:  "shutdownDelay",
+		env:   "SEKRET_SHUTDOWN_DELAY",
+		usage: "Time to wait after failing the readiness check before the server stops on shutdown",
+		field: func(c *Config) any { return &c.ShutdownDelay },
+	},
+	{
+		name:  "tlsCertFile",
+		env:   "SEKRET_TLS_CERT_FILE",
+		usage: "Certificate file, the server serves https when it is set",
+		field: func(c *Config) any { return &c.TLSCertFile },
+	},
+	{
+		name:  "tlsKeyFile",
+		env:   "SEKRET_TLS_KEY_FILE",
+		usage: "Private key file of the certificate",
+		field: func(c *Config) any { return &c.TLSKeyFile },
+	},
+	{
+		name:  "tlsMinVersion",
+		env:   "SEKRET_TLS_MIN_VERSION",
+		usage: "Minimum TLS version: 1.2 or 1.3",
+		field: func(c *Config) any { return &c.TLSMinVersion },
+	},
+	{
+		name:  "tlsClientCAFile",
+		env:   "SEKRET_TLS_CLIENT_CA_FILE",
+		usage: "CA certificates file, the clients must present a certificate signed by one of them when it is set",
+		field: func(c *Config) any { return &c.TLSClientCAFile },
+	},
+	{
+		name:  "tlsReloadInterval",
+		env:   "SEKRET_TLS_RELOAD_INTERVAL",
+		usage: "How often the certificate files are checked for changes, 0 disables the check",
+		field: func(c *Config) any { return &c.TLSReloadInterval },
+	},
+	{
+		name:  "redirectAddress",
+		env:   "SEKRET_REDIRECT_ADDRESS",
+		usage: "Address of the plain http listener which redirects to https, eg.: :80",
+		field: func(c *Config) any { return &c.RedirectAddress },
+	},
+	{
+		name:  "metricsAddress",
+		env:   "SEKRET_METRICS_ADDRESS",
+		usage: "Address of the plain http listener which serves the prometheus metrics, empty disables the metrics",
+		field: func(c *Config) any { return &c.MetricsAddress },
+	},
+	{
+		name:  "storage",
+		env:   "SEKRET_STORAGE",
+		usage: "Storage backend: database or sqlite-memory, the sqlite-memory storage is an in-memory SQLite database on a single connection, it loses every secret on restart and serves one request at a time",
+		field: func(c *Config) any { return &c.Storage },
+	},
+	{
+		name:  "postgresDB",
+		env:   "SEKRET_POSTGRES_DB",
+		usage: "Connection string for the database backend (postgres:// or sqlite://)",
+		field: func(c *Config) any { return &c.PostgresDB },
+	},
+	{
+		name:  "expireSeconds",
+		env:   "SEKRET_EXPIRE_SECONDS",
+		usage: "Default expiration time in seconds",
+		field: func(c *Config) any { return &c.ExpireSeconds },
+	},
+	{
+		name:  "maxExpireSeconds",
+		env:   "SEKRET_MAX_EXPIRE_SECONDS",
+		usage: "Max expiration time in seconds",
+		field: func(c *Config) any { return &c.MaxExpireSeconds },
+	},
+	{
+		name:  "maxDataSize",
+		env:   "SEKRET_MAX_DATA_SIZE",
+		usage: "Max data size",
+		field: func(c *Config) any { return &c.MaxDataSize },
+	},
+	{
+		name:  "maxPassphraseAttempts",
+		env:   "SEKRET_MAX_PASSPHRASE_ATTEMPTS",
+		usage: "Delete the passphrase protected key after this many wrong passphrases, 0 means unlimited",
+		field: func(c *Config) any { return &c.MaxPassphraseAttempts },
+	},
+	{
+		name:  "maxKeyAttempts",
+		env:   "SEKRET_MAX_KEY_ATTEMPTS",
+		usage: "Lock or delete the secret after this many wrong keys, 0 means unlimited",
+		field: func(c *Config) any { return &c.MaxKeyAttempts },
+	},
+	{
+		name:  "keyLockoutAction",
+		env:   "SEKRET_KEY_LOCKOUT_ACTION",
+		usage: "What happens with the secret after maxKeyAttempts wrong keys: lock or delete",
+		field: func(c *Config) any { return &c.KeyLockoutAction },
+	},
+	{
+		name:  "base62",
+		env:   "SEKRET_BASE62",
+		usage: "Use base62 encoding",
+		field: func(c *Config) any { return &c.Base62 },
+	},
+	{
+		name:  "requireToken",
+		env:   "SEKRET_REQUIRE_TOKEN",
+		usage: "Require an api token to create secrets, the secrets can be read without a token",
+		field: func(c *Config) any { return &c.RequireToken },
+	},
+	{
+		name:  "createRateLimit",
+		env:   "SEKRET_CREATE_RATE_LIMIT",
+		usage: "Secrets a client can create, in limit/period format, eg.: 10/1m, 0 means unlimited",
+		field: func(c *Config) any { return &c.CreateRateLimit },
+	},
+	{
+		name:  "readRateLimit",
+		env:   "SEKRET_READ_RATE_LIMIT",
+		usage: "Requests with a key or a delete key a client can send, in limit/period format, 0 means unlimited",
+		field: func(c *Config) any { return &c.ReadRateLimit },
+	},
+	{
+		name:  "generateKeyRateLimit",
+		env:   "SEKRET_GENERATE_KEY_RATE_LIMIT",
+		usage: "Keys a client can generate, in limit/period format, 0 means unlimited",
+		field: func(c *Config) any { return &c.GenerateKeyRateLimit },
+	},
+	{
+		name:  "authRateLimit",
+		env:   "SEKRET_AUTH_RATE_LIMIT",
+		usage: "Requests with an api token an ip address can send, checked before the token is verified, in limit/period format, 0 means unlimited",
+		field: func(c *Config) any { return &c.AuthRateLimit },
+	},
+	{
+		name:  "dailyQuotaBytes",
+		env:   "SEKRET_DAILY_QUOTA_BYTES",
+		usage: "Bytes a client can store in a day, 0 means unlimited",
+		field: func(c *Config) any { return &c.DailyQuotaBytes },
+	},
+	{
+		name:  "dailyQuotaEntries",
+		env:   "SEKRET_DAILY_QUOTA_ENTRIES",
+		usage: "Secrets a client can create in a day, 0 means unlimited",
+		field: func(c *Config) any { return &c.DailyQuotaEntries },
+	},
+	{
+		name:  "trustedProxies",
+		env:   "SEKRET_TRUSTED_PROXIES",
+		usage: "Comma separated ip addresses and CIDR prefixes of the proxies which set the X-Forwarded-For header",
+		field: func(c *Config) any { return &c.TrustedProxies },
+	},
+	{
+		name:  "webhookTimeout",
+		env:   "SEKRET_WEBHOOK_TIMEOUT",
+		usage: "Timeout of a webhook request",
+		field: func(c *Config) any { return &c.WebhookTimeout },
+	},
+	{
+		name:  "webhookMaxAttempts",
+		env:   "SEKRET_WEBHOOK_MAX_ATTEMPTS",
+		usage: "Drop the webhook event after this many failed deliveries",
+		field: func(c *Config) any { return &c.WebhookMaxAttempts },
+	},
+	{
+		name:  "webhookAllowPrivate",
+		env:   "SEKRET_WEBHOOK_ALLOW_PRIVATE",
+		usage: "Allow the webhooks on loopback, private and link local addresses",
+		field: func(c *Config) any { return &c.WebhookAllowPrivate },
+	},
+	{
+		name:  "masterKeyFile",
+		env:   "SEKRET_MASTER_KEY_FILE",
+		usage: "File of the master keys which wrap the stored secrets, one <id>:<base64 key> per line",
+		field: func(c *Config) any { return &c.MasterKeyFile },
+	},
+	{
+		name:  "masterKeys",
+		env:   "SEKRET_MASTER_KEYS",
+		usage: "Comma separated master keys in <id>:<base64 key> format",
+		field: func(c *Config) any { return &c.MasterKeys },
+	},
+	{
+		name:  "masterKeyID",
+		env:   "SEKRET_MASTER_KEY_ID",
+		usage: "Id of the master key which wraps the new secrets, the last key by default",
+		field: func(c *Config) any { return &c.MasterKeyID },
+	},
+	{
+		name:  "cipher",
+		env:   "SEKRET_CIPHER",
+		usage: "Cipher of the new secrets: " + strings.Join(ciphersuite.Names(), " or ") + ", the secrets are decrypted with their own cipher",
+		field: func(c *Config) any { return &c.Cipher },
+	},
+	{
+		name:  "rejectLegacyCipher",
+		env:   "SEKRET_REJECT_LEGACY_CIPHER",
+		usage: "Reject the secrets and keys encrypted before they were bound to their entry",
+		field: func(c *Config) any { return &c.RejectLegacyCipher },
+	},
+	{
+		name:  "printConfig",
+		usage: "Print the effective configuration and exit",
+		field: func(c *Config) any { return &c.PrintConfig },
+		cli:   true,
+	},
+	{
+		name:  "version",
+		usage: "Get version information",
+		field: func(c *Config) any { return &c.Version },
+		cli:   true,
+	},
+}
+
+// setValue parses the value and stores it in the field
+func setValue(field any, value string) error {
+	switch f := field.(type) {
+	case *string:
+		*f = value
+	case *int:
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*f = v
+	case *int64:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		*f = v
+	case *bool:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*f = v
+	case *time.Duration:
+		v, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*f = v
+	default:
+		return fmt.Errorf("unsupported option type %T", field)
+	}
+
+	return nil
+}
+
+func formatValue(field any) string {
+	switch f := field.(type) {
+	case *string:
+		return *f
+	case *int:
+		return strconv.Itoa(*f)
+	case *int64:
+		return strconv.FormatInt(*f, 10)
+	case *bool:
+		return strconv.FormatBool(*f)
+	case *time.Duration:
+		return f.String()
+	default:
+		return ""
+	}
+}
+
+// flagValue binds an option to a flag
+type flagValue struct {
+	field any
+}
+
+func (f flagValue) String() string {
+	if f.field == nil {
+		return ""
+	}
+	return formatValue(f.field)
+}
+
+func (f flagValue) Set(value string) error {
+	return setValue(f.field, value)
+}
+
+func (f flagValue) IsBoolFlag() bool {
+	_, ok := f.field.(*bool)
+	return ok
+}
+
+// unmarshalFile decodes the configuration file by its extension
+func unmarshalFile(path string, data []byte) (map[string]any, error) {
+	values := map[string]any{}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		// keep the numbers as they are written, float64 would format the
+		// large integers in exponent form
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&values); err != nil {
+			return nil, err
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		if err := toml.Unmarshal(data, &values); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q", filepath.Ext(path))
+	}
+
+	return values, nil
+}
+
+func findOption(name string) (option, bool) {
+	for _, opt := range options {
+		if opt.name == name {
+			return opt, true
+		}
+	}
+
+	return option{}, false
+}
+
+// LoadFile sets the options from the json, yaml or toml configuration file,
+// the options set to null are left unchanged
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	values, err := unmarshalFile(path, data)
+	if err != nil {
+		return errors.Join(ErrInvalidConfig, err)
+	}
+
+	for name, value := range values {
+		opt, ok := findOption(name)
+		if !ok || opt.cli {
+			return fmt.Errorf("%w: %q in %s", ErrUnknownOption, name, path)
+		}
+
+		if value == nil {
+			continue
+		}
+
+		if err := setValue(opt.field(c), fmt.Sprint(value)); err != nil {
+			return fmt.Errorf("%w: %s in %s: %w", ErrInvalidConfig, name, path, err)
+		}
+	}
+
+	return nil
+}
+
+// LoadEnv sets the options from the SEKRET_* environment variables, the
+// POSTGRES_URL variable is supported too, but SEKRET_POSTGRES_DB takes
+// precedence over it
+func (c *Config) LoadEnv(lookupEnv func(string) (string, bool)) error {
+	if value, ok := lookupEnv("POSTGRES_URL"); ok && value != "" {
+		c.PostgresDB = value
+	}
+
+	for _, opt := range options {
+		if opt.env == "" || opt.cli {
+			continue
+		}
+
+		value, ok := lookupEnv(opt.env)
+		if !ok {
+			continue
+		}
+
+		if err := setValue(opt.field(c), value); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrInvalidConfig, opt.env, err)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the options together
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.ListenAddress == "" {
+		errs = append(errs, errors.New("listenAddress must be set"))
+	}
+
+	if c.MetricsAddress != "" && (c.MetricsAddress == c.ListenAddress || c.MetricsAddress == c.RedirectAddress) {
+		errs = append(errs, errors.New("metricsAddress must differ from listenAddress and redirectAddress"))
+	}
+
+	if _, err := url.Parse(c.WebExternalURL); err != nil {
+		errs = append(errs, fmt.Errorf("webExternalURL: %w", err))
+	}
+
+	for name, timeout := range map[string]time.Duration{
+		"readTimeout":     c.ReadTimeout,
+		"writeTimeout":    c.WriteTimeout,
+		"shutdownTimeout": c.ShutdownTimeout,
+	} {
+		if timeout <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", name))
+		}
+	}
+
+	if c.ShutdownDelay < 0 {
+		errs = append(errs, errors.New("shutdownDelay must not be negative"))
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, errors.New("tlsCertFile and tlsKeyFile must be set together"))
+	}
+
+	if c.TLSMinVersion != "1.2" && c.TLSMinVersion != "1.3" {
+		errs = append(errs, fmt.Errorf("unsupported tlsMinVersion %q", c.TLSMinVersion))
+	}
+
+	if c.TLSReloadInterval < 0 {
+		errs = append(errs, errors.New("tlsReloadInterval must not be negative"))
+	}
+
+	if !c.TLSEnabled() {
+		if c.TLSClientCAFile != "" {
+			errs = append(errs, errors.New("tlsClientCAFile requires tlsCertFile and tlsKeyFile"))
+		}
+
+		if c.RedirectAddress != "" {
+			errs = append(errs, errors.New("redirectAddress requires tlsCertFile and tlsKeyFile"))
+		}
+	}
+
+	switch c.Storage {
+	case "database":
+		if c.PostgresDB == "" {
+			errs = append(errs, errors.New("postgresDB must be set when the storage is database"))
+		}
+	case "sqlite-memory":
+	default:
+		errs = append(errs, fmt.Errorf("unknown storage %q", c.Storage))
+	}
+
+	if c.ExpireSeconds <= 0 {
+		errs = append(errs, errors.New("expireSeconds must be positive"))
+	}
+
+	if c.MaxExpireSeconds < c.ExpireSeconds {
+		errs = append(errs, errors.New("`expireSeconds` must be less or equal then `maxExpireSeconds`"))
+	}
+
+	if c.MaxDataSize <= 0 {
+		errs = append(errs, errors.New("maxDataSize must be positive"))
+	}
+
+	if c.MaxPassphraseAttempts < 0 {
+		errs = append(errs, errors.New("maxPassphraseAttempts must not be negative"))
+	}
+
+	if c.MaxKeyAttempts < 0 {
+		errs = append(errs, errors.New("maxKeyAttempts must not be negative"))
+	}
+
+	if c.KeyLockoutAction != "lock" && c.KeyLockoutAction != "delete" {
+		errs = append(errs, fmt.Errorf("unknown keyLockoutAction %q", c.KeyLockoutAction))
+	}
+
+	for name, rate := range map[string]string{
+		"createRateLimit":      c.CreateRateLimit,
+		"readRateLimit":        c.ReadRateLimit,
+		"generateKeyRateLimit": c.GenerateKeyRateLimit,
+		"authRateLimit":        c.AuthRateLimit,
+	} {
+		if _, err := ratelimit.ParseRate(rate); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	if c.DailyQuotaBytes < 0 || c.DailyQuotaEntries < 0 {
+		errs = append(errs, errors.New("dailyQuotaBytes and dailyQuotaEntries must not be negative"))
+	}
+
+	if _, err := ratelimit.ParsePrefixes(c.TrustedProxies); err != nil {
+		errs = append(errs, fmt.Errorf("trustedProxies: %w", err))
+	}
+
+	if c.WebhookTimeout <= 0 {
+		errs = append(errs, errors.New("webhookTimeout must be positive"))
+	}
+
+	if c.WebhookMaxAttempts <= 0 {
+		errs = append(errs, errors.New("webhookMaxAttempts must be positive"))
+	}
+
+	if _, err := masterkey.Parse(c.MasterKeys); err != nil {
+		errs = append(errs, fmt.Errorf("masterKeys: %w", err))
+	}
+
+	if c.MasterKeyID != "" && c.MasterKeyFile == "" && c.MasterKeys == "" {
+		errs = append(errs, errors.New("masterKeyID requires masterKeyFile or masterKeys"))
+	}
+
+	if _, err := ciphersuite.ByName(c.Cipher); err != nil {
+		errs = append(errs, fmt.Errorf("cipher: %w", err))
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(append([]error{ErrInvalidConfig}, errs...)...)
+	}
+
+	return nil
+}
+
+// TLSEnabled reports whether the server serves https
+func (c Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+var dsnPassword = regexp.MustCompile(`(password=)(\S+)`)
+
+// redactConnectionString hides the password of the connection string
+func redactConnectionString(connStr string) string {
+	if u, err := url.Parse(connStr); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "REDACTED")
+			return u.String()
+		}
+	}
+
+	return dsnPassword.ReplaceAllString(connStr, "${1}REDACTED")
+}
+
+// Redacted returns the configuration without the secrets, so it can be
+// printed or logged
+func (c Config) Redacted() Config {
+	c.PostgresDB = redactConnectionString(c.PostgresDB)
+	if c.MasterKeys != "" {
+		c.MasterKeys = "REDACTED"
+	}
+	return c
+}
+
+// String returns the redacted configuration in yaml format, so the output
+// can be used as a configuration file
+func (c Config) String() string {
+	redacted := c.Redacted()
+	var b strings.Builder
+	for _, opt := range options {
+		if opt.cli {
+			continue
+		}
+
+		value := formatValue(opt.field(&redacted))
+		if _, ok := opt.field(&redacted).(*string); ok {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, "%s: %s\n", opt.name, value)
+	}
+
+	return b.String()
+}
+
+// Load builds the configuration from the defaults, the configuration file,
+// the environment variables and the flags, the later ones take precedence
+// over the former ones. The configuration file is set by the -config flag or
+// by the SEKRET_CONFIG environment variable.
+func Load(name string, args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	flagConfig := Default()
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+
+	for _, opt := range options {
+		fs.Var(flagValue{field: opt.field(&flagConfig)}, opt.name, opt.usage)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	visited := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		visited[f.Name] = true
+	})
+
+	config := Default()
+
+	configFile := flagConfig.ConfigFile
+	if !visited["config"] {
+		configFile, _ = lookupEnv("SEKRET_CONFIG")
+	}
+
+	if configFile != "" {
+		if err := config.LoadFile(configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.LoadEnv(lookupEnv); err != nil {
+		return nil, err
+	}
+
+	for _, opt := range options {
+		if visited[opt.name] {
+			if err := setValue(opt.field(&config), formatValue(opt.field(&flagConfig))); err != nil {
+				return nil, err
+			}
+		}
+	}
+	config.ConfigFile = configFile
+	if fs.NArg() > 0 {
+		config.Args = fs.Args()
+	}
+
+	return &config, nil
+}
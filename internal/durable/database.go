@@ -4,8 +4,32 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"net/url"
+	"strings"
+
+	// import postgresql driver
+	_ "github.com/lib/pq"
+	// import sqlite driver
+	"modernc.org/sqlite"
 )
 
+// Dialect is the SQL flavour spoken by the database backend
+type Dialect string
+
+const (
+	// DialectPostgres is the PostgreSQL backend
+	DialectPostgres Dialect = "postgres"
+	// DialectSQLite is the embedded SQLite backend
+	DialectSQLite Dialect = "sqlite"
+)
+
+const sqliteScheme = "sqlite://"
+
+// MemoryConnectionString opens a private in-memory SQLite database. The
+// database lives on a single connection, so it serves one query at a time, and
+// the stored data vanishes when the database is closed.
+const MemoryConnectionString = sqliteScheme + ":memory:"
+
 type ConnectionInfo struct {
 	Host     string
 	Port     int
@@ -19,8 +43,82 @@ func (c ConnectionInfo) String() string {
 	return fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s", c.Username, c.Password, c.Host, c.Port, c.Database, c.SslMode)
 }
 
+// GetDialect returns the backend selected by the connection string scheme.
+// Connection strings starting with sqlite:// use SQLite, everything else is
+// passed to the PostgreSQL driver.
+func GetDialect(connStr string) Dialect {
+	if strings.HasPrefix(connStr, sqliteScheme) {
+		return DialectSQLite
+	}
+
+	return DialectPostgres
+}
+
+// DialectOf returns the dialect of an opened database
+func DialectOf(db *sql.DB) Dialect {
+	if _, ok := db.Driver().(*sqlite.Driver); ok {
+		return DialectSQLite
+	}
+
+	return DialectPostgres
+}
+
+// sqliteDSN converts a sqlite://path?query connection string to the data
+// source name expected by the sqlite driver
+func sqliteDSN(connStr string) (string, error) {
+	dbPath, rawQuery, _ := strings.Cut(strings.TrimPrefix(connStr, sqliteScheme), "?")
+
+	if dbPath == "" {
+		return "", fmt.Errorf("missing database path in %q", connStr)
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", err
+	}
+
+	// foreign keys are required to cascade the entry deletion to the keys
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Add("_pragma", "busy_timeout(5000)")
+	// store times in a lexically comparable format
+	query.Set("_time_format", "sqlite")
+
+	return fmt.Sprintf("file:%s?%s", dbPath, query.Encode()), nil
+}
+
+func openSQLite(connStr string) (*sql.DB, error) {
+	dsn, err := sqliteDSN(connStr)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite allows only one writer at a time, serialize the access instead
+	// of failing with SQLITE_BUSY errors
+	// it also keeps in-memory databases alive, since every connection would
+	// open a new, empty database
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxIdleTime(0)
+	db.SetConnMaxLifetime(0)
+
+	return db, nil
+}
+
 func OpenDatabaseClient(ctx context.Context, connStr string) (*sql.DB, error) {
-	db, err := sql.Open("postgres", connStr)
+	var db *sql.DB
+	var err error
+
+	switch GetDialect(connStr) {
+	case DialectSQLite:
+		db, err = openSQLite(connStr)
+	default:
+		db, err = sql.Open("postgres", connStr)
+	}
 
 	if err != nil {
 		return nil, err
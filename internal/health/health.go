@@ -0,0 +1,119 @@
+// Package health provides the liveness and readiness checks of the service
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/models/migrate"
+)
+
+var (
+	// ErrShuttingDown is returned when the service is shutting down and
+	// does not accept new requests
+	ErrShuttingDown = errors.New("shutting down")
+	// ErrDatabaseUnavailable is returned when the database does not respond
+	ErrDatabaseUnavailable = errors.New("database unavailable")
+	// ErrMigrationsNotApplied is returned when the database migrations have
+	// not been applied
+	ErrMigrationsNotApplied = errors.New("migrations not applied")
+	// ErrCleanupStalled is returned when the expired entry cleanup loop has
+	// not run for a while
+	ErrCleanupStalled = errors.New("cleanup stalled")
+)
+
+// Checker checks the state of the service
+type Checker struct {
+	db            *sql.DB
+	shuttingDown  atomic.Bool
+	cleanupBeat   atomic.Int64
+	cleanupMaxAge time.Duration
+	pingTimeout   time.Duration
+}
+
+// NewChecker creates a Checker which pings the db
+func NewChecker(db *sql.DB) *Checker {
+	return &Checker{
+		db:            db,
+		cleanupMaxAge: time.Minute,
+		pingTimeout:   time.Second * 2,
+	}
+}
+
+// WithCleanupMaxAge sets how long the cleanup loop can be silent before the
+// service is reported as not ready
+func (c *Checker) WithCleanupMaxAge(maxAge time.Duration) *Checker {
+	c.cleanupMaxAge = maxAge
+	return c
+}
+
+// CleanupAlive records that the cleanup loop is running, the loop calls it on
+// every tick
+func (c *Checker) CleanupAlive() {
+	c.cleanupBeat.Store(time.Now().UnixNano())
+}
+
+// ShutDown marks the service as shutting down, so the readiness check fails
+// and the load balancers stop sending requests
+func (c *Checker) ShutDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Ready returns an error when the service can not serve requests
+func (c *Checker) Ready(ctx context.Context) error {
+	if c.shuttingDown.Load() {
+		return ErrShuttingDown
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, c.pingTimeout)
+	defer cancel()
+	if err := c.db.PingContext(pingCtx); err != nil {
+		return errors.Join(ErrDatabaseUnavailable, err)
+	}
+
+	if !migrate.Prepared(c.db) {
+		return ErrMigrationsNotApplied
+	}
+
+	beat := c.cleanupBeat.Load()
+	if beat == 0 || time.Since(time.Unix(0, beat)) > c.cleanupMaxAge {
+		return ErrCleanupStalled
+	}
+
+	return nil
+}
+
+// Live responds 200 OK while the process is able to serve requests
+func (c *Checker) Live(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// ReadyHandler responds 200 OK when the service is ready, 503 Service
+// Unavailable otherwise
+func (c *Checker) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := c.Ready(r.Context()); err != nil {
+		if !errors.Is(err, ErrShuttingDown) {
+			slog.Error("readiness check failed", "error", err)
+		}
+		// the details of the database errors are logged only
+		if errors.Is(err, ErrDatabaseUnavailable) {
+			err = ErrDatabaseUnavailable
+		}
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,106 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/durable"
+	"github.com/Ajnasz/sekret.link/internal/models/migrate"
+	testDurable "github.com/Ajnasz/sekret.link/internal/test/durable"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker_Ready(t *testing.T) {
+	ctx := context.Background()
+	db, err := testDurable.TestConnection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := migrate.PrepareDatabase(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("cleanup not started", func(t *testing.T) {
+		checker := NewChecker(db)
+		assert.ErrorIs(t, checker.Ready(ctx), ErrCleanupStalled)
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		checker := NewChecker(db)
+		checker.CleanupAlive()
+		assert.NoError(t, checker.Ready(ctx))
+	})
+
+	t.Run("cleanup stalled", func(t *testing.T) {
+		checker := NewChecker(db).WithCleanupMaxAge(time.Millisecond)
+		checker.CleanupAlive()
+		time.Sleep(time.Millisecond * 2)
+		assert.ErrorIs(t, checker.Ready(ctx), ErrCleanupStalled)
+	})
+
+	t.Run("shutting down", func(t *testing.T) {
+		checker := NewChecker(db)
+		checker.CleanupAlive()
+		checker.ShutDown()
+		assert.ErrorIs(t, checker.Ready(ctx), ErrShuttingDown)
+	})
+
+	t.Run("migrations not applied", func(t *testing.T) {
+		db, err := durable.OpenDatabaseClient(ctx, durable.MemoryConnectionString)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		checker := NewChecker(db)
+		checker.CleanupAlive()
+		assert.ErrorIs(t, checker.Ready(ctx), ErrMigrationsNotApplied)
+	})
+
+	t.Run("database closed", func(t *testing.T) {
+		db, err := testDurable.TestConnection(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.Close()
+
+		checker := NewChecker(db)
+		checker.CleanupAlive()
+		assert.ErrorIs(t, checker.Ready(ctx), ErrDatabaseUnavailable)
+	})
+}
+
+func TestChecker_Handlers(t *testing.T) {
+	ctx := context.Background()
+	db, err := testDurable.TestConnection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := migrate.PrepareDatabase(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := NewChecker(db)
+	checker.CleanupAlive()
+
+	w := httptest.NewRecorder()
+	checker.Live(w, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	checker.ReadyHandler(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	checker.ShutDown()
+	w = httptest.NewRecorder()
+	checker.ReadyHandler(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+}
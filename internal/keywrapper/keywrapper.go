@@ -1,18 +1,41 @@
-package services
+// Package keywrapper implements the AES key wrap algorithms of RFC 3394 and
+// RFC 5649. The wrapped keys carry an integrity check value, so unwrapping
+// with a wrong key encryption key, or unwrapping a changed key fails.
+package keywrapper
 
 import (
-	"github.com/Ajnasz/sekret.link/internal/key"
-	"github.com/Ajnasz/sekret.link/internal/services"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
 )
 
-// KeyWrapper is a simple interface to wrap and unwrap keys
-// rfc3394
+// ErrInvalidKeySize is returned when the key can not be wrapped or the
+// wrapped key can not be unwrapped because of its size
+var ErrInvalidKeySize = errors.New("invalid key size")
+
+// ErrUnwrapFailed is returned when the integrity check of the wrapped key
+// fails
+var ErrUnwrapFailed = errors.New("key unwrap failed")
+
+// KeyWrapper wraps the keys with a key encryption key
 type KeyWrapper interface {
-	Wrap(dek *key.Key) ([]byte, *key.Key, error)
-	Unwrap(kek *key.Key, encrypted []byte) (*key.Key, error)
+	Wrap(kek []byte, k []byte) ([]byte, error)
+	Unwrap(kek []byte, wrapped []byte) ([]byte, error)
 }
 
-// AesKeyWrapper is a simple key wrapper that uses AES to wrap and unwrap keys
+const blockSize = 8
+
+// defaultIV is the initial value of RFC 3394
+var defaultIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// alternativeIV is the constant half of the initial value of RFC 5649, the
+// other half is the length of the key
+var alternativeIV = []byte{0xa6, 0x59, 0x59, 0xa6}
+
+// AesKeyWrapper wraps the keys as described in RFC 3394, the size of the keys
+// must be a multiple of 8 bytes, at least 16 bytes
 type AesKeyWrapper struct{}
 
 // NewAesKeyWrapper creates a new AesKeyWrapper
@@ -20,37 +43,152 @@ func NewAesKeyWrapper() *AesKeyWrapper {
 	return &AesKeyWrapper{}
 }
 
-// Wrap will wrap the Data Encryption Key (DEK) with the Key Encryption Key (KEK)
-func (*AesKeyWrapper) Wrap(dek *key.Key) ([]byte, *key.Key, error) {
-	kek := key.NewKey()
-	err := kek.Generate()
+// Wrap will wrap the key with the Key Encryption Key (KEK)
+func (*AesKeyWrapper) Wrap(kek []byte, k []byte) ([]byte, error) {
+	if len(k) < 2*blockSize || len(k)%blockSize != 0 {
+		return nil, ErrInvalidKeySize
+	}
+
+	block, err := aes.NewCipher(kek)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	encrypter := services.NewAESEncrypter(kek.Get())
+	return wrap(block, defaultIV, k), nil
+}
+
+// Unwrap will unwrap the key with the Key Encryption Key (KEK)
+func (*AesKeyWrapper) Unwrap(kek []byte, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 3*blockSize || len(wrapped)%blockSize != 0 {
+		return nil, ErrInvalidKeySize
+	}
 
-	encrypted, err := encrypter.Encrypt(dek.Get())
+	block, err := aes.NewCipher(kek)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	return encrypted, kek, nil
+	iv, k := unwrap(block, wrapped)
+	if subtle.ConstantTimeCompare(iv, defaultIV) != 1 {
+		return nil, ErrUnwrapFailed
+	}
+
+	return k, nil
 }
 
-// Unwrap will unwrap the Data Encryption Key (DEK) with the Key Encryption Key (KEK)
-func (*AesKeyWrapper) Unwrap(kek *key.Key, encrypted []byte) (*key.Key, error) {
-	decrypter := services.NewAESEncrypter(kek.Get())
+// AesKeyWrapperWithPadding wraps the keys as described in RFC 5649, the keys
+// can be of any size
+type AesKeyWrapperWithPadding struct{}
 
-	decrypted, err := decrypter.Decrypt(encrypted)
+// NewAesKeyWrapperWithPadding creates a new AesKeyWrapperWithPadding
+func NewAesKeyWrapperWithPadding() *AesKeyWrapperWithPadding {
+	return &AesKeyWrapperWithPadding{}
+}
+
+// Wrap will wrap the key with the Key Encryption Key (KEK)
+func (*AesKeyWrapperWithPadding) Wrap(kek []byte, k []byte) ([]byte, error) {
+	if len(k) == 0 || uint64(len(k)) > 0xffffffff {
+		return nil, ErrInvalidKeySize
+	}
+
+	block, err := aes.NewCipher(kek)
 	if err != nil {
 		return nil, err
 	}
 
-	k := key.NewKey()
-	if err := k.Set(decrypted); err != nil {
+	iv := binary.BigEndian.AppendUint32(append([]byte{}, alternativeIV...), uint32(len(k)))
+	padded := make([]byte, (len(k)+blockSize-1)/blockSize*blockSize)
+	copy(padded, k)
+
+	// a single block is encrypted with the initial value in one step
+	if len(padded) == blockSize {
+		wrapped := append(iv, padded...)
+		block.Encrypt(wrapped, wrapped)
+		return wrapped, nil
+	}
+
+	return wrap(block, iv, padded), nil
+}
+
+// Unwrap will unwrap the key with the Key Encryption Key (KEK)
+func (*AesKeyWrapperWithPadding) Unwrap(kek []byte, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 2*blockSize || len(wrapped)%blockSize != 0 {
+		return nil, ErrInvalidKeySize
+	}
+
+	block, err := aes.NewCipher(kek)
+	if err != nil {
 		return nil, err
 	}
 
-	return k, nil
+	var iv, padded []byte
+	if len(wrapped) == 2*blockSize {
+		decrypted := make([]byte, 2*blockSize)
+		block.Decrypt(decrypted, wrapped)
+		iv, padded = decrypted[:blockSize], decrypted[blockSize:]
+	} else {
+		iv, padded = unwrap(block, wrapped)
+	}
+
+	size := int(binary.BigEndian.Uint32(iv[len(alternativeIV):]))
+	valid := subtle.ConstantTimeCompare(iv[:len(alternativeIV)], alternativeIV) == 1
+	if !valid || size > len(padded) || size <= len(padded)-blockSize {
+		return nil, ErrUnwrapFailed
+	}
+
+	// the padding must be zero
+	if subtle.ConstantTimeCompare(padded[size:], make([]byte, len(padded)-size)) != 1 {
+		return nil, ErrUnwrapFailed
+	}
+
+	return padded[:size], nil
+}
+
+// wrap is the wrapping process of RFC 3394 with the initial value, the size
+// of the key must be a multiple of 8 bytes, at least 16 bytes
+func wrap(block cipher.Block, iv []byte, k []byte) []byte {
+	n := len(k) / blockSize
+	wrapped := make([]byte, blockSize+len(k))
+	copy(wrapped[blockSize:], k)
+
+	b := make([]byte, 2*blockSize)
+	copy(b, iv)
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			r := wrapped[i*blockSize : (i+1)*blockSize]
+			copy(b[blockSize:], r)
+			block.Encrypt(b, b)
+
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(b[:blockSize], binary.BigEndian.Uint64(b[:blockSize])^t)
+			copy(r, b[blockSize:])
+		}
+	}
+
+	copy(wrapped, b[:blockSize])
+	return wrapped
+}
+
+// unwrap is the unwrapping process of RFC 3394, it returns the initial value
+// and the key, the initial value must be checked by the caller
+func unwrap(block cipher.Block, wrapped []byte) ([]byte, []byte) {
+	n := len(wrapped)/blockSize - 1
+	k := make([]byte, len(wrapped)-blockSize)
+	copy(k, wrapped[blockSize:])
+
+	b := make([]byte, 2*blockSize)
+	copy(b, wrapped[:blockSize])
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			r := k[(i-1)*blockSize : i*blockSize]
+
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(b[:blockSize], binary.BigEndian.Uint64(b[:blockSize])^t)
+			copy(b[blockSize:], r)
+			block.Decrypt(b, b)
+			copy(r, b[blockSize:])
+		}
+	}
+
+	return b[:blockSize], k
 }
@@ -1,43 +1,127 @@
-package services
+package keywrapper
 
 import (
+	"bytes"
+	"encoding/hex"
+	"strings"
 	"testing"
 
-	"github.com/Ajnasz/sekret.link/internal/key"
+	"github.com/stretchr/testify/assert"
 )
 
-func Test_KeyWrap(t *testing.T) {
-	k := key.NewKey()
+func fromHex(t *testing.T, s string) []byte {
+	t.Helper()
 
-	err := k.Generate()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	keyWrapper := NewAesKeyWrapper()
+	return b
+}
 
-	encrypted, kek, err := keyWrapper.Wrap(k)
-	if err != nil {
-		t.Fatal(err)
+func TestAesKeyWrapper(t *testing.T) {
+	// test vectors of RFC 3394 section 4
+	testCases := map[string]struct {
+		kek     string
+		key     string
+		wrapped string
+	}{
+		"128 bit key with 128 bit KEK": {
+			kek:     "000102030405060708090A0B0C0D0E0F",
+			key:     "00112233445566778899AABBCCDDEEFF",
+			wrapped: "1FA68B0A8112B447 AEF34BD8FB5A7B82 9D3E862371D2CFE5",
+		},
+		"256 bit key with 256 bit KEK": {
+			kek:     "000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F",
+			key:     "00112233445566778899AABBCCDDEEFF000102030405060708090A0B0C0D0E0F",
+			wrapped: "28C9F404C4B810F4 CBCCB35CFB87F826 3F5786E2D80ED326 CBC7F0E71A99F43B FB988B9B7A02DD21",
+		},
 	}
 
-	badKek := key.NewKey()
-	err = badKek.Generate()
-	if err != nil {
-		t.Fatal(err)
+	wrapper := NewAesKeyWrapper()
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			kek, k, expected := fromHex(t, testCase.kek), fromHex(t, testCase.key), fromHex(t, testCase.wrapped)
+
+			wrapped, err := wrapper.Wrap(kek, k)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, wrapped)
+
+			unwrapped, err := wrapper.Unwrap(kek, wrapped)
+			assert.NoError(t, err)
+			assert.Equal(t, k, unwrapped)
+
+			wrapped[len(wrapped)-1] ^= 1
+			_, err = wrapper.Unwrap(kek, wrapped)
+			assert.ErrorIs(t, err, ErrUnwrapFailed)
+		})
 	}
 
-	decrypted, err := keyWrapper.Unwrap(kek, encrypted)
-	if err != nil {
-		t.Fatal(err)
+	_, err := wrapper.Wrap(bytes.Repeat([]byte{1}, 32), make([]byte, 20))
+	assert.ErrorIs(t, err, ErrInvalidKeySize)
+}
+
+func TestAesKeyWrapperWithPadding(t *testing.T) {
+	// test vectors of RFC 5649 section 6
+	kek := "5840df6e29b02af1 ab493b705bf16ea1 ae8338f4dcc176a8"
+	testCases := map[string]struct {
+		key     string
+		wrapped string
+	}{
+		"20 byte key": {
+			key:     "c37b7e6492584340 bed1220780894115 5068f738",
+			wrapped: "138bdeaa9b8fa7fc 61f97742e72248ee 5ae6ae5360d1ae6a 5f54f373fa543b6a",
+		},
+		"7 byte key": {
+			key:     "466f7250617369",
+			wrapped: "afbeb0f07dfbf541 9200f2ccb50bb24f",
+		},
 	}
 
-	if string(decrypted.Get()) != string(k.Get()) {
-		t.Errorf("key unwrap failed, expected %s, got %s", k.Get(), decrypted.Get())
+	wrapper := NewAesKeyWrapperWithPadding()
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			kek, k, expected := fromHex(t, kek), fromHex(t, testCase.key), fromHex(t, testCase.wrapped)
+
+			wrapped, err := wrapper.Wrap(kek, k)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, wrapped)
+
+			unwrapped, err := wrapper.Unwrap(kek, wrapped)
+			assert.NoError(t, err)
+			assert.Equal(t, k, unwrapped)
+
+			badKEK := append([]byte{}, kek...)
+			badKEK[0] ^= 1
+			_, err = wrapper.Unwrap(badKEK, wrapped)
+			assert.ErrorIs(t, err, ErrUnwrapFailed)
+		})
 	}
 
-	_, err = keyWrapper.Unwrap(badKek, encrypted)
-	if err == nil {
-		t.Error("Expected error, got nil")
+	_, err := wrapper.Wrap(fromHex(t, kek), nil)
+	assert.ErrorIs(t, err, ErrInvalidKeySize)
+}
+
+func TestAesKeyWrapperWithPadding_Sizes(t *testing.T) {
+	wrapper := NewAesKeyWrapperWithPadding()
+	kek := bytes.Repeat([]byte{7}, 32)
+
+	for size := 1; size <= 80; size++ {
+		k := bytes.Repeat([]byte{byte(size)}, size)
+
+		wrapped, err := wrapper.Wrap(kek, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		unwrapped, err := wrapper.Unwrap(kek, wrapped)
+		if err != nil {
+			t.Fatalf("%d: %s", size, err)
+		}
+
+		if !bytes.Equal(k, unwrapped) {
+			t.Errorf("%d: expected %x, got %x", size, k, unwrapped)
+		}
 	}
 }
@@ -0,0 +1,202 @@
+// Package masterkey wraps the stored secrets with the server side master
+// keys, so a database dump can not be decrypted even with the keys of the
+// secrets
+package masterkey
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// KeySize is the size of the master keys, they are AES-256 keys
+const KeySize = 32
+
+// ErrInvalidKey is returned when a master key is not a base64 encoded 32 byte
+// key
+var ErrInvalidKey = errors.New("invalid master key")
+
+// ErrInvalidKeyID is returned when the id of a master key is empty, too long
+// or contains other than letters, digits, dots, dashes and underscores
+var ErrInvalidKeyID = errors.New("invalid master key id")
+
+// ErrDuplicateKeyID is returned when two master keys have the same id
+var ErrDuplicateKeyID = errors.New("duplicate master key id")
+
+// ErrUnknownKeyID is returned when the blob is wrapped with a key which is
+// not in the keyring
+var ErrUnknownKeyID = errors.New("unknown master key id")
+
+// ErrNoKeys is returned when the keyring is created without keys
+var ErrNoKeys = errors.New("no master keys")
+
+// ErrOpenFailed is returned when the wrapped blob can not be opened
+var ErrOpenFailed = errors.New("master key open failed")
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,32}$`)
+
+// Key is a master key with its id, the id is stored with the wrapped blobs
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// Parse reads the master keys in <id>:<base64 key> format, the keys are
+// separated by new lines or commas, the empty lines and the lines starting
+// with # are skipped
+func Parse(text string) ([]Key, error) {
+	var keys []Key
+	for _, line := range strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == ',' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: missing key id", ErrInvalidKey)
+		}
+
+		secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidKey, id, err)
+		}
+
+		keys = append(keys, Key{ID: strings.TrimSpace(id), Secret: secret})
+	}
+
+	return keys, nil
+}
+
+// Load reads the master keys from the file and from the inline keys, both
+// are optional. The keyring is nil when there are no keys.
+func Load(file string, inline string, currentID string) (*Keyring, error) {
+	var text string
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	}
+
+	keys, err := Parse(text + "\n" + inline)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 && currentID == "" {
+		return nil, nil
+	}
+
+	return New(keys, currentID)
+}
+
+// Keyring holds the master keys, the current key wraps the new blobs, every
+// key can open the blobs wrapped by it
+type Keyring struct {
+	keys    map[string]cipher.AEAD
+	current string
+}
+
+// New creates a Keyring, the currentID is the id of the key which wraps the
+// new blobs, when it is empty the last key is the current one
+func New(keys []Key, currentID string) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	keyring := &Keyring{keys: make(map[string]cipher.AEAD, len(keys))}
+	for _, k := range keys {
+		if !keyIDPattern.MatchString(k.ID) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidKeyID, k.ID)
+		}
+
+		if len(k.Secret) != KeySize {
+			return nil, fmt.Errorf("%w: %s: the key must be %d bytes", ErrInvalidKey, k.ID, KeySize)
+		}
+
+		if _, ok := keyring.keys[k.ID]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateKeyID, k.ID)
+		}
+
+		block, err := aes.NewCipher(k.Secret)
+		if err != nil {
+			return nil, err
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		keyring.keys[k.ID] = aead
+	}
+
+	if currentID == "" {
+		currentID = keys[len(keys)-1].ID
+	}
+
+	if _, ok := keyring.keys[currentID]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKeyID, currentID)
+	}
+
+	keyring.current = currentID
+	return keyring, nil
+}
+
+// CurrentID returns the id of the key which wraps the new blobs
+func (k *Keyring) CurrentID() string {
+	return k.current
+}
+
+// Has reports whether the keyring has the key
+func (k *Keyring) Has(keyID string) bool {
+	_, ok := k.keys[keyID]
+	return ok
+}
+
+// Overhead returns the number of bytes the wrapping adds to the blob
+func (k *Keyring) Overhead() int {
+	aead := k.keys[k.current]
+	return aead.NonceSize() + aead.Overhead()
+}
+
+// Seal wraps the blob with the current key and returns the id of the key
+func (k *Keyring) Seal(plaintext []byte) (string, []byte, error) {
+	aead := k.keys[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", nil, err
+	}
+
+	// the key id is authenticated, so the id of a blob can not be changed
+	return k.current, aead.Seal(nonce, nonce, plaintext, []byte(k.current)), nil
+}
+
+// Open unwraps the blob wrapped with the key
+func (k *Keyring) Open(keyID string, sealed []byte) ([]byte, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKeyID, keyID)
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrOpenFailed
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(keyID))
+	if err != nil {
+		return nil, errors.Join(ErrOpenFailed, err)
+	}
+
+	return plaintext, nil
+}
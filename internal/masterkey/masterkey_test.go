@@ -0,0 +1,112 @@
+package masterkey
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestParse(t *testing.T) {
+	text := "# rotated in 2024\nold:" + base64.StdEncoding.EncodeToString(testKey(1)) + "\n\n new : " + base64.StdEncoding.EncodeToString(testKey(2)) + " ,"
+
+	keys, err := Parse(text)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Key{{ID: "old", Secret: testKey(1)}, {ID: "new", Secret: testKey(2)}}, keys)
+
+	_, err = Parse("missing-id")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	_, err = Parse("id:not base64")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		name      string
+		keys      []Key
+		currentID string
+		err       error
+	}{
+		{name: "no keys", err: ErrNoKeys},
+		{name: "short key", keys: []Key{{ID: "a", Secret: []byte("short")}}, err: ErrInvalidKey},
+		{name: "invalid id", keys: []Key{{ID: "a b", Secret: testKey(1)}}, err: ErrInvalidKeyID},
+		{name: "empty id", keys: []Key{{Secret: testKey(1)}}, err: ErrInvalidKeyID},
+		{name: "duplicate id", keys: []Key{{ID: "a", Secret: testKey(1)}, {ID: "a", Secret: testKey(2)}}, err: ErrDuplicateKeyID},
+		{name: "unknown current", keys: []Key{{ID: "a", Secret: testKey(1)}}, currentID: "b", err: ErrUnknownKeyID},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(tc.keys, tc.currentID)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+
+	keyring, err := New([]Key{{ID: "a", Secret: testKey(1)}, {ID: "b", Secret: testKey(2)}}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", keyring.CurrentID(), "the last key is the current one by default")
+
+	keyring, err = New([]Key{{ID: "a", Secret: testKey(1)}, {ID: "b", Secret: testKey(2)}}, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "a", keyring.CurrentID())
+}
+
+func TestKeyring_SealOpen(t *testing.T) {
+	old, err := New([]Key{{ID: "old", Secret: testKey(1)}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyID, sealed, err := old.Seal([]byte("secret"))
+	assert.NoError(t, err)
+	assert.Equal(t, "old", keyID)
+	assert.Len(t, sealed, len("secret")+old.Overhead())
+	assert.NotContains(t, string(sealed), "secret")
+
+	rotated, err := New([]Key{{ID: "old", Secret: testKey(1)}, {ID: "new", Secret: testKey(2)}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err := rotated.Open(keyID, sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("secret"), opened, "the blobs of the old keys stay readable")
+
+	_, err = rotated.Open("new", sealed)
+	assert.ErrorIs(t, err, ErrOpenFailed, "the key id is authenticated")
+
+	_, err = rotated.Open("missing", sealed)
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+
+	_, err = rotated.Open(keyID, sealed[:4])
+	assert.ErrorIs(t, err, ErrOpenFailed)
+}
+
+func TestLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "master.keys")
+	if err := os.WriteFile(file, []byte("a:"+base64.StdEncoding.EncodeToString(testKey(1))+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := Load("", "", "")
+	assert.NoError(t, err)
+	assert.Nil(t, keyring, "the master keys are optional")
+
+	keyring, err = Load(file, "b:"+base64.StdEncoding.EncodeToString(testKey(2)), "a")
+	assert.NoError(t, err)
+	assert.True(t, keyring.Has("a"))
+	assert.True(t, keyring.Has("b"))
+	assert.Equal(t, "a", keyring.CurrentID())
+
+	_, err = Load("", "", "a")
+	assert.ErrorIs(t, err, ErrNoKeys)
+}
@@ -0,0 +1,169 @@
+// Package metrics contains the prometheus metrics of the service
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "sekret_link"
+
+var (
+	// Requests counts the handled http requests by handler and status code
+	Requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of the handled http requests",
+	}, []string{"handler", "code"})
+
+	// RequestDuration is the duration of the http requests by handler
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of the http requests",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"handler"})
+
+	// PayloadSize is the size of the stored and read secrets
+	PayloadSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "payload_size_bytes",
+		Help:      "Size of the stored and read secrets",
+		Buckets:   prometheus.ExponentialBuckets(64, 4, 8),
+	}, []string{"operation"})
+
+	// CryptoDuration is the duration of the encryption and decryption of the
+	// secrets
+	CryptoDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "crypto_duration_seconds",
+		Help:      "Duration of the encryption and decryption of the secrets",
+		Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 8),
+	}, []string{"operation"})
+
+	// TransactionDuration is the duration of the database transactions by
+	// operation
+	TransactionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_transaction_duration_seconds",
+		Help:      "Duration of the database transactions",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	// ExpiredDeleted counts the deleted expired entries and keys
+	ExpiredDeleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "expired_deleted_total",
+		Help:      "Number of the deleted expired entries and keys",
+	}, []string{"kind"})
+
+	// RateLimited counts the requests rejected by the rate limits and the
+	// quotas
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Number of the requests rejected by the rate limits and the quotas",
+	}, []string{"limit"})
+
+	// KeyLockouts counts the entries locked or deleted after too many failed
+	// key attempts
+	KeyLockouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "key_lockouts_total",
+		Help:      "Number of the entries locked or deleted after too many failed key attempts",
+	}, []string{"action"})
+
+	// WebhookDeliveries counts the webhook delivery attempts by the event
+	// and the result: delivered, retried or dropped
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Number of the webhook delivery attempts",
+	}, []string{"event", "result"})
+)
+
+// ObserveRequest records a handled http request
+func ObserveRequest(handler string, code int, duration time.Duration) {
+	Requests.WithLabelValues(handler, strconv.Itoa(code)).Inc()
+	RequestDuration.WithLabelValues(handler).Observe(duration.Seconds())
+}
+
+// ObservePayloadSize records the size of a stored or read secret
+func ObservePayloadSize(operation string, size int) {
+	PayloadSize.WithLabelValues(operation).Observe(float64(size))
+}
+
+// CryptoTimer starts measuring an encryption or decryption, the returned
+// timer's ObserveDuration records the duration
+func CryptoTimer(operation string) *prometheus.Timer {
+	return prometheus.NewTimer(CryptoDuration.WithLabelValues(operation))
+}
+
+// TransactionTimer starts measuring a database transaction, the returned
+// timer's ObserveDuration records the duration
+func TransactionTimer(operation string) *prometheus.Timer {
+	return prometheus.NewTimer(TransactionDuration.WithLabelValues(operation))
+}
+
+// Counter counts the live entries and keys
+type Counter interface {
+	CountEntries(ctx context.Context) (int, error)
+	CountEntryKeys(ctx context.Context) (int, error)
+}
+
+// LiveCollector collects the number of the live entries and keys on scrape
+type LiveCollector struct {
+	counter Counter
+	timeout time.Duration
+	entries *prometheus.Desc
+	keys    *prometheus.Desc
+}
+
+// NewLiveCollector creates a LiveCollector
+func NewLiveCollector(counter Counter) *LiveCollector {
+	return &LiveCollector{
+		counter: counter,
+		timeout: 5 * time.Second,
+		entries: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "entries"),
+			"Number of the live entries",
+			nil, nil,
+		),
+		keys: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "entry_keys"),
+			"Number of the live entry keys",
+			nil, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *LiveCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.entries
+	ch <- c.keys
+}
+
+// Collect implements prometheus.Collector
+func (c *LiveCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	if entries, err := c.counter.CountEntries(ctx); err != nil {
+		slog.Error("count entries failed", "error", err)
+		ch <- prometheus.NewInvalidMetric(c.entries, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(entries))
+	}
+
+	if keys, err := c.counter.CountEntryKeys(ctx); err != nil {
+		slog.Error("count entry keys failed", "error", err)
+		ch <- prometheus.NewInvalidMetric(c.keys, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.keys, prometheus.GaugeValue, float64(keys))
+	}
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type testCounter struct {
+	entries int
+	keys    int
+	err     error
+}
+
+func (c testCounter) CountEntries(ctx context.Context) (int, error) {
+	return c.entries, c.err
+}
+
+func (c testCounter) CountEntryKeys(ctx context.Context) (int, error) {
+	return c.keys, c.err
+}
+
+func TestLiveCollector(t *testing.T) {
+	collector := NewLiveCollector(testCounter{entries: 2, keys: 3})
+
+	expected := `
+# HELP sekret_link_entries Number of the live entries
+# TYPE sekret_link_entries gauge
+sekret_link_entries 2
+# HELP sekret_link_entry_keys Number of the live entry keys
+# TYPE sekret_link_entry_keys gauge
+sekret_link_entry_keys 3
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLiveCollectorError(t *testing.T) {
+	collector := NewLiveCollector(testCounter{err: errors.New("count failed")})
+
+	if _, err := testutil.CollectAndLint(collector); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestObserveRequest(t *testing.T) {
+	before := testutil.ToFloat64(Requests.WithLabelValues("test", "201"))
+	ObserveRequest("test", 201, 0)
+	after := testutil.ToFloat64(Requests.WithLabelValues("test", "201"))
+
+	if after != before+1 {
+		t.Errorf("expected %f got %f", before+1, after)
+	}
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/uuid"
+)
+
+// ErrAPITokenNotFound is returned when the token does not exist or it is
+// revoked
+var ErrAPITokenNotFound = errors.New("api token not found")
+
+// APIToken is a token which allows to create secrets, only the hash of the
+// token is stored
+type APIToken struct {
+	UUID      string
+	Name      string
+	TokenHash []byte
+	Created   time.Time
+	LastUsed  sql.NullTime
+	Revoked   sql.NullTime
+}
+
+type APITokenModel struct{}
+
+// Create stores the hash of a new token
+func (a *APITokenModel) Create(ctx context.Context, tx *sql.Tx, name string, tokenHash []byte) (*APIToken, error) {
+	now := time.Now().UTC()
+	uid := uuid.NewUUIDString()
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO api_token (uuid, name, token_hash, created)
+		VALUES ($1, $2, $3, $4)
+	`, uid, name, tokenHash, now)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &APIToken{
+		UUID:      uid,
+		Name:      name,
+		TokenHash: tokenHash,
+		Created:   now,
+	}, nil
+}
+
+// FindByHash returns the token which is not revoked by its hash
+func (a *APITokenModel) FindByHash(ctx context.Context, tx *sql.Tx, tokenHash []byte) (*APIToken, error) {
+	var token APIToken
+	err := tx.QueryRowContext(ctx, `
+		SELECT uuid, name, token_hash, created, last_used, revoked
+		FROM api_token
+		WHERE token_hash = $1 AND revoked IS NULL
+	`, tokenHash).Scan(&token.UUID, &token.Name, &token.TokenHash, &token.Created, &token.LastUsed, &token.Revoked)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAPITokenNotFound
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// List returns every token, the revoked ones too
+func (a *APITokenModel) List(ctx context.Context, tx *sql.Tx) ([]APIToken, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT uuid, name, token_hash, created, last_used, revoked
+		FROM api_token
+		ORDER BY created
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var token APIToken
+		if err := rows.Scan(&token.UUID, &token.Name, &token.TokenHash, &token.Created, &token.LastUsed, &token.Revoked); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// Use records the last usage of the token
+func (a *APITokenModel) Use(ctx context.Context, tx *sql.Tx, uuid string) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE api_token
+		SET last_used = $1
+		WHERE uuid = $2
+	`, time.Now().UTC(), uuid)
+
+	return err
+}
+
+// Revoke revokes the token, the revoked tokens are kept for the audit
+func (a *APITokenModel) Revoke(ctx context.Context, tx *sql.Tx, uuid string) error {
+	res, err := tx.ExecContext(ctx, `
+		UPDATE api_token
+		SET revoked = $1
+		WHERE uuid = $2 AND revoked IS NULL
+	`, time.Now().UTC(), uuid)
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrAPITokenNotFound
+	}
+
+	return nil
+}
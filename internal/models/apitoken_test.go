@@ -0,0 +1,68 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func Test_APITokenModel(t *testing.T) {
+	ctx := context.Background()
+	db, tx, err := getTestDbTx(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer tx.Rollback()
+
+	model := &APITokenModel{}
+
+	token, err := model.Create(ctx, tx, "ci", []byte("api token model hash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := model.FindByHash(ctx, tx, []byte("api token model hash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found.UUID != token.UUID || found.Name != "ci" {
+		t.Errorf("expected token %s ci got %s %s", token.UUID, found.UUID, found.Name)
+	}
+
+	if err := model.Use(ctx, tx, token.UUID); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := model.List(ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listed := false
+	for _, listedToken := range tokens {
+		if listedToken.UUID == token.UUID {
+			listed = true
+			if !listedToken.LastUsed.Valid {
+				t.Error("expected last used to be set")
+			}
+		}
+	}
+
+	if !listed {
+		t.Errorf("expected token %s in the list", token.UUID)
+	}
+
+	if err := model.Revoke(ctx, tx, token.UUID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := model.FindByHash(ctx, tx, []byte("api token model hash")); !errors.Is(err, ErrAPITokenNotFound) {
+		t.Errorf("expected %v got %v", ErrAPITokenNotFound, err)
+	}
+
+	if err := model.Revoke(ctx, tx, token.UUID); !errors.Is(err, ErrAPITokenNotFound) {
+		t.Errorf("expected %v got %v", ErrAPITokenNotFound, err)
+	}
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/uuid"
+)
+
+// AuditEvent is a row of the append-only audit log, it never contains the
+// secret or the keys
+type AuditEvent struct {
+	UUID      string
+	EntryUUID string
+	KeyUUID   sql.NullString
+	Event     string
+	Created   time.Time
+	ClientIP  string
+	UserAgent string
+}
+
+// nilUUID is the smallest uuid, the first page of the events starts after it
+const nilUUID = "00000000-0000-0000-0000-000000000000"
+
+type AuditModel struct{}
+
+// Create appends an event to the audit log, the keyUUID is optional
+func (a *AuditModel) Create(ctx context.Context, tx *sql.Tx, entryUUID string, keyUUID string, event string, clientIP string, userAgent string) (*AuditEvent, error) {
+	auditEvent := AuditEvent{
+		UUID:      uuid.NewUUIDString(),
+		EntryUUID: entryUUID,
+		KeyUUID:   sql.NullString{String: keyUUID, Valid: keyUUID != ""},
+		Event:     event,
+		Created:   time.Now().UTC(),
+		ClientIP:  clientIP,
+		UserAgent: userAgent,
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO audit_log (uuid, entry_uuid, key_uuid, event, created, client_ip, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, auditEvent.UUID, auditEvent.EntryUUID, auditEvent.KeyUUID, auditEvent.Event, auditEvent.Created, auditEvent.ClientIP, auditEvent.UserAgent)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &auditEvent, nil
+}
+
+func scanAuditEvents(rows *sql.Rows) ([]AuditEvent, error) {
+	defer rows.Close()
+
+	var events []AuditEvent
+	for rows.Next() {
+		var event AuditEvent
+		if err := rows.Scan(&event.UUID, &event.EntryUUID, &event.KeyUUID, &event.Event, &event.Created, &event.ClientIP, &event.UserAgent); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// ListByEntry returns the events of the entry, the oldest first
+func (a *AuditModel) ListByEntry(ctx context.Context, tx *sql.Tx, entryUUID string) ([]AuditEvent, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT uuid, entry_uuid, key_uuid, event, created, client_ip, user_agent
+		FROM audit_log
+		WHERE entry_uuid = $1
+		ORDER BY created, uuid
+	`, entryUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAuditEvents(rows)
+}
+
+// List returns at most limit events created at or after since, the oldest
+// first. The events created at the same time are ordered by their uuid, so
+// the next page starts after the last event of the previous one.
+func (a *AuditModel) List(ctx context.Context, tx *sql.Tx, since time.Time, afterUUID string, limit int) ([]AuditEvent, error) {
+	if afterUUID == "" {
+		afterUUID = nilUUID
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT uuid, entry_uuid, key_uuid, event, created, client_ip, user_agent
+		FROM audit_log
+		WHERE created > $1 OR (created = $1 AND uuid > $2)
+		ORDER BY created, uuid
+		LIMIT $3
+	`, since.UTC(), afterUUID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAuditEvents(rows)
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func Test_AuditModel(t *testing.T) {
+	ctx := context.Background()
+	db, tx, err := getTestDbTx(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer tx.Rollback()
+
+	model := &AuditModel{}
+
+	since := time.Now().Add(-time.Second)
+	uid := uuid.New().String()
+	keyUUID := uuid.New().String()
+
+	created, err := model.Create(ctx, tx, uid, "", "created", "127.0.0.1", "test-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := model.Create(ctx, tx, uid, keyUUID, "read", "127.0.0.2", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := model.ListByEntry(ctx, tx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+
+	if events[0].UUID != created.UUID || events[0].Event != "created" || events[0].KeyUUID.Valid || events[0].ClientIP != "127.0.0.1" || events[0].UserAgent != "test-agent" {
+		t.Errorf("unexpected first event %+v", events[0])
+	}
+
+	if events[1].UUID != read.UUID || events[1].Event != "read" || events[1].KeyUUID.String != keyUUID {
+		t.Errorf("unexpected second event %+v", events[1])
+	}
+
+	page, err := model.List(ctx, tx, since, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page) != 1 {
+		t.Fatalf("expected 1 event on the page, got %d", len(page))
+	}
+
+	next, err := model.List(ctx, tx, page[0].Created, page[0].UUID, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, event := range next {
+		if event.UUID == page[0].UUID {
+			t.Error("expected the next page not to contain the last event of the previous page")
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM audit_log WHERE uuid = $1", created.UUID); err == nil {
+		t.Error("expected the audit log to be append-only")
+	}
+}
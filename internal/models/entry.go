@@ -8,9 +8,6 @@ import (
 	"strings"
 	"time"
 
-	// import postgresql driver
-	_ "github.com/lib/pq"
-
 	"github.com/Ajnasz/sekret.link/internal/key"
 )
 
@@ -25,6 +22,14 @@ type EntryMeta struct {
 	Created     time.Time
 	Accessed    sql.NullTime
 	ContentType string
+	// ClientEncrypted is true when the data was encrypted by the client and
+	// the server never had the key
+	ClientEncrypted bool
+	// Size is the size of the stored data, it is set by ReadEntryMeta
+	Size int
+	// MasterKeyID is the id of the master key which wraps the data, it is
+	// empty when the data is not wrapped
+	MasterKeyID string
 }
 
 // uuid uuid PRIMARY KEY,
@@ -48,15 +53,26 @@ func (e *EntryModel) getDeleteKey() (string, error) {
 	return k.String(), nil
 }
 
-// CreateEntry creates a new entry into the database
-func (e *EntryModel) CreateEntry(ctx context.Context, tx *sql.Tx, uuid string, contenType string, data []byte) (*EntryMeta, error) {
+// CreateEntry creates a new entry into the database, the masterKeyID is the
+// id of the master key which wraps the data
+func (e *EntryModel) CreateEntry(ctx context.Context, tx *sql.Tx, uuid string, contenType string, data []byte, masterKeyID string) (*EntryMeta, error) {
+	return e.createEntry(ctx, tx, uuid, contenType, data, masterKeyID, false)
+}
+
+// CreateClientEncryptedEntry creates a new entry into the database which data
+// is encrypted by the client
+func (e *EntryModel) CreateClientEncryptedEntry(ctx context.Context, tx *sql.Tx, uuid string, contenType string, data []byte, masterKeyID string) (*EntryMeta, error) {
+	return e.createEntry(ctx, tx, uuid, contenType, data, masterKeyID, true)
+}
+
+func (e *EntryModel) createEntry(ctx context.Context, tx *sql.Tx, uuid string, contenType string, data []byte, masterKeyID string, clientEncrypted bool) (*EntryMeta, error) {
 	deleteKey, err := e.getDeleteKey()
 	if err != nil {
 		return nil, errors.Join(err, ErrCreateEntry)
 	}
 
-	now := time.Now()
-	res, err := tx.ExecContext(ctx, `INSERT INTO entries (uuid, data, created, delete_key, content_type) VALUES  ($1, $2, $3, $4, $5) RETURNING uuid, delete_key;`, uuid, data, now, deleteKey, contenType)
+	now := time.Now().UTC()
+	res, err := tx.ExecContext(ctx, `INSERT INTO entries (uuid, data, created, delete_key, content_type, client_encrypted, master_key_id) VALUES  ($1, $2, $3, $4, $5, $6, $7);`, uuid, data, now, deleteKey, contenType, clientEncrypted, masterKeyID)
 
 	if err != nil {
 		return nil, errors.Join(err, ErrCreateEntry)
@@ -72,23 +88,33 @@ func (e *EntryModel) CreateEntry(ctx context.Context, tx *sql.Tx, uuid string, c
 	}
 
 	return &EntryMeta{
-		UUID:      uuid,
-		DeleteKey: deleteKey,
-		Created:   now,
+		UUID:            uuid,
+		DeleteKey:       deleteKey,
+		Created:         now,
+		ContentType:     contenType,
+		ClientEncrypted: clientEncrypted,
+		MasterKeyID:     masterKeyID,
 	}, err
 }
 
 func (e *EntryModel) Use(ctx context.Context, tx *sql.Tx, uuid string) error {
-	_, err := tx.ExecContext(ctx, "UPDATE entries SET accessed = NOW() WHERE uuid = $1", uuid)
+	_, err := tx.ExecContext(ctx, "UPDATE entries SET accessed = $1 WHERE uuid = $2", time.Now().UTC(), uuid)
+	return err
+}
+
+// SetData replaces the data of the entry, the data is sealed with the master
+// key of the masterKeyID
+func (e *EntryModel) SetData(ctx context.Context, tx *sql.Tx, uuid string, data []byte, masterKeyID string) error {
+	_, err := tx.ExecContext(ctx, "UPDATE entries SET data = $1, master_key_id = $2 WHERE uuid = $3", data, masterKeyID, uuid)
 	return err
 }
 
 // ReadEntry reads a entry from the database
 // and updates the read count
 func (e *EntryModel) ReadEntry(ctx context.Context, tx *sql.Tx, uuid string) (*Entry, error) {
-	row := tx.QueryRow("SELECT uuid, data, delete_key, created, accessed, content_type FROM entries WHERE uuid=$1 LIMIT 1", uuid)
+	row := tx.QueryRow("SELECT uuid, data, delete_key, created, accessed, content_type, client_encrypted, master_key_id FROM entries WHERE uuid=$1 LIMIT 1", uuid)
 	var s Entry
-	err := row.Scan(&s.UUID, &s.Data, &s.DeleteKey, &s.Created, &s.Accessed, &s.ContentType)
+	err := row.Scan(&s.UUID, &s.Data, &s.DeleteKey, &s.Created, &s.Accessed, &s.ContentType, &s.ClientEncrypted, &s.MasterKeyID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrEntryNotFound
@@ -99,10 +125,11 @@ func (e *EntryModel) ReadEntry(ctx context.Context, tx *sql.Tx, uuid string) (*E
 	return &s, nil
 }
 
+// ReadEntryMeta reads the metadata of the entry without the data
 func (e *EntryModel) ReadEntryMeta(ctx context.Context, tx *sql.Tx, uuid string) (*EntryMeta, error) {
-	row := tx.QueryRow("SELECT created, accessed, delete_key, content_type FROM entries WHERE uuid=$1 LIMIT 1", uuid)
+	row := tx.QueryRowContext(ctx, "SELECT created, accessed, delete_key, content_type, client_encrypted, length(data), master_key_id FROM entries WHERE uuid=$1 LIMIT 1", uuid)
 	var s EntryMeta
-	err := row.Scan(&s.Created, &s.Accessed, &s.DeleteKey, &s.ContentType)
+	err := row.Scan(&s.Created, &s.Accessed, &s.DeleteKey, &s.ContentType, &s.ClientEncrypted, &s.Size, &s.MasterKeyID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrEntryNotFound
@@ -152,24 +179,97 @@ func (e *EntryModel) DeleteEntry(ctx context.Context, tx *sql.Tx, uuid string, d
 	return nil
 }
 
-func (e *EntryModel) DeleteExpired(ctx context.Context, tx *sql.Tx) error {
+// DeleteExpired deletes the entries which have no keys left and returns the
+// number of the deleted entries
+func (e *EntryModel) DeleteExpired(ctx context.Context, tx *sql.Tx) (int64, error) {
+	uuids, err := e.DeleteExpiredEntries(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(uuids)), nil
+}
+
+// DeleteExpiredEntries deletes the entries which have no keys left and
+// returns their uuids
+func (e *EntryModel) DeleteExpiredEntries(ctx context.Context, tx *sql.Tx) ([]string, error) {
 	now := time.Now()
-	// TODO join with entry_keys table and delete if no living entry found
-	// _, err := tx.ExecContext(ctx, "DELETE FROM entries WHERE expire < NOW()")
-	ret, err := tx.ExecContext(ctx, "DELETE FROM entries WHERE uuid IN(SELECT e.uuid FROM entries e WHERE NOT EXISTS(select 1 FROM entry_key ek WHERE ek.entry_uuid = e.uuid) ORDER BY e.created LIMIT 1000)")
+	rows, err := tx.QueryContext(ctx, "DELETE FROM entries WHERE uuid IN(SELECT e.uuid FROM entries e WHERE NOT EXISTS(select 1 FROM entry_key ek WHERE ek.entry_uuid = e.uuid) ORDER BY e.created LIMIT 1000) RETURNING uuid")
 
 	if err != nil {
-		return errors.Join(err, ErrDeleteExpiredFailed)
+		return nil, errors.Join(err, ErrDeleteExpiredFailed)
 	}
+	defer rows.Close()
 
-	rows, err := ret.RowsAffected()
+	var uuids []string
+	for rows.Next() {
+		var uuid string
+		if err := rows.Scan(&uuid); err != nil {
+			return nil, errors.Join(err, ErrDeleteExpiredFailed)
+		}
+		uuids = append(uuids, uuid)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Join(err, ErrDeleteExpiredFailed)
+	}
+
+	if len(uuids) != 0 {
+		slog.Info("Deleted expired entries", "count", len(uuids), "duration", time.Since(now).String())
+	}
+
+	return uuids, nil
+}
+
+// Count returns the number of the stored entries
+func (e *EntryModel) Count(ctx context.Context, tx *sql.Tx) (int, error) {
+	var count int
+	err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM entries").Scan(&count)
+
+	return count, err
+}
+
+// AddFailedKeyAttempt increments the number of the failed key attempts of the
+// entry and returns the updated count
+func (e *EntryModel) AddFailedKeyAttempt(ctx context.Context, tx *sql.Tx, uuid string) (int, error) {
+	var failedAttempts int
+	err := tx.QueryRowContext(ctx, "UPDATE entries SET failed_attempts = failed_attempts + 1 WHERE uuid = $1 RETURNING failed_attempts", uuid).Scan(&failedAttempts)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrEntryNotFound
+		}
+		return 0, err
+	}
+
+	return failedAttempts, nil
+}
+
+// IsLocked reports whether the entry is locked
+func (e *EntryModel) IsLocked(ctx context.Context, tx *sql.Tx, uuid string) (bool, error) {
+	var locked bool
+	err := tx.QueryRowContext(ctx, "SELECT locked FROM entries WHERE uuid = $1", uuid).Scan(&locked)
 	if err != nil {
-		return errors.Join(err, ErrDeleteExpiredFailed)
+		if err == sql.ErrNoRows {
+			return false, ErrEntryNotFound
+		}
+		return false, err
 	}
 
-	if rows != 0 {
-		slog.Info("Deleted expired entries", "count", rows, "duration", time.Since(now).String())
+	return locked, nil
+}
+
+// Lock locks the entry, the locked entries can not be read
+func (e *EntryModel) Lock(ctx context.Context, tx *sql.Tx, uuid string) error {
+	_, err := tx.ExecContext(ctx, "UPDATE entries SET locked = TRUE WHERE uuid = $1", uuid)
+	return err
+}
+
+// Destroy deletes the entry and its keys without the delete key
+func (e *EntryModel) Destroy(ctx context.Context, tx *sql.Tx, uuid string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM entry_key WHERE entry_uuid = $1", uuid); err != nil {
+		return err
 	}
 
-	return nil
+	_, err := tx.ExecContext(ctx, "DELETE FROM entries WHERE uuid = $1", uuid)
+	return err
 }
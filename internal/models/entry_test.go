@@ -28,7 +28,7 @@ func Test_EntryModel_CreateEntry(t *testing.T) {
 
 	model := &EntryModel{}
 
-	meta, err := model.CreateEntry(ctx, tx, uid, "text/plain", data)
+	meta, err := model.CreateEntry(ctx, tx, uid, "text/plain", data, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -73,7 +73,7 @@ func Test_EntryModel_Use(t *testing.T) {
 
 	model := &EntryModel{}
 
-	meta, err := model.CreateEntry(ctx, tx, uid, "text/plain", data)
+	meta, err := model.CreateEntry(ctx, tx, uid, "text/plain", data, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -107,3 +107,236 @@ func Test_EntryModel_Use(t *testing.T) {
 		t.Fatal(errors.Join(err, errors.New("failed to rollback transaction")))
 	}
 }
+
+func Test_EntryModel_CreateClientEncryptedEntry(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			t.Fatal(errors.Join(err, errors.New("failed to rollback transaction")))
+		}
+	}()
+
+	uid := uuid.New().String()
+	data := []byte("test data")
+
+	model := &EntryModel{}
+
+	if _, err := model.CreateClientEncryptedEntry(ctx, tx, uid, "text/plain", data, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := model.ReadEntry(ctx, tx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !entry.ClientEncrypted {
+		t.Errorf("expected client encrypted to be set")
+	}
+
+	if string(entry.Data) != string(data) {
+		t.Errorf("expected %q got %q", data, entry.Data)
+	}
+}
+
+func Test_EntryModel_ReadEntryMeta(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uid := uuid.New().String()
+	data := []byte("test data")
+
+	model := &EntryModel{}
+
+	if _, err := model.CreateEntry(ctx, tx, uid, "text/plain", data, "master-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := model.ReadEntryMeta(ctx, tx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if meta.ContentType != "text/plain" {
+		t.Errorf("expected %s got %s", "text/plain", meta.ContentType)
+	}
+
+	if meta.MasterKeyID != "master-1" {
+		t.Errorf("expected master key id %s got %s", "master-1", meta.MasterKeyID)
+	}
+
+	if meta.Size != len(data) {
+		t.Errorf("expected size %d got %d", len(data), meta.Size)
+	}
+
+	if _, err := model.ReadEntryMeta(ctx, tx, uuid.New().String()); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("expected %v got %v", ErrEntryNotFound, err)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(errors.Join(err, errors.New("failed to rollback transaction")))
+	}
+}
+
+func Test_EntryModel_Count(t *testing.T) {
+	ctx := context.Background()
+	db, tx, err := getTestDbTx(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	model := &EntryModel{}
+
+	before, err := model.Count(ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := model.CreateEntry(ctx, tx, uuid.New().String(), "text/plain", []byte("test data"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := model.Count(ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after != before+1 {
+		t.Errorf("expected %d got %d", before+1, after)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(errors.Join(err, errors.New("failed to rollback transaction")))
+	}
+}
+
+func Test_EntryModel_Lockout(t *testing.T) {
+	ctx := context.Background()
+	db, tx, err := getTestDbTx(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	model := &EntryModel{}
+	uid := uuid.New().String()
+	if _, err := model.CreateEntry(ctx, tx, uid, "text/plain", []byte("test data"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		failedAttempts, err := model.AddFailedKeyAttempt(ctx, tx, uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if failedAttempts != i {
+			t.Errorf("expected %d got %d", i, failedAttempts)
+		}
+	}
+
+	locked, err := model.IsLocked(ctx, tx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if locked {
+		t.Errorf("expected entry not to be locked")
+	}
+
+	if err := model.Lock(ctx, tx, uid); err != nil {
+		t.Fatal(err)
+	}
+
+	locked, err = model.IsLocked(ctx, tx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !locked {
+		t.Errorf("expected entry to be locked")
+	}
+
+	if err := model.Destroy(ctx, tx, uid); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := model.IsLocked(ctx, tx, uid); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("expected %v got %v", ErrEntryNotFound, err)
+	}
+
+	if _, err := model.AddFailedKeyAttempt(ctx, tx, uid); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("expected %v got %v", ErrEntryNotFound, err)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(errors.Join(err, errors.New("failed to rollback transaction")))
+	}
+}
+
+func Test_EntryModel_SetData(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.TestConnection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			t.Errorf("rollback failed: %v", err)
+		}
+	}()
+
+	uid := uuid.New().String()
+	model := &EntryModel{}
+
+	if _, err := model.CreateEntry(ctx, tx, uid, "text/plain", []byte("legacy"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := model.SetData(ctx, tx, uid, []byte("bound"), "mk"); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := model.ReadEntry(ctx, tx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(entry.Data) != "bound" {
+		t.Errorf("expected bound data, got %q", entry.Data)
+	}
+
+	if entry.MasterKeyID != "mk" {
+		t.Errorf("expected master key id mk, got %q", entry.MasterKeyID)
+	}
+}
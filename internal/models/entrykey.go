@@ -4,34 +4,69 @@ import (
 	"context"
 	"database/sql"
 	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/uuid"
 )
 
+// KeyPassphrase holds the key derivation setup of a passphrase protected
+// entry key
+type KeyPassphrase struct {
+	Salt   []byte
+	Params string
+}
+
 type EntryKey struct {
 	UUID           string
 	EntryUUID      string
 	EncryptedKey   []byte
 	KeyHash        []byte
 	Created        time.Time
+	Accessed       sql.NullTime
 	Expire         sql.NullTime
 	RemainingReads sql.NullInt16
+	Passphrase     *KeyPassphrase
+	FailedAttempts int
+	// MasterKeyID is the id of the master key which wraps the encrypted key,
+	// it is empty when the key is not wrapped
+	MasterKeyID string
 }
 
 type EntryKeyModel struct{}
 
+// utcTime normalizes the optional time, so it is stored in the same time zone
+// on every backend
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	utc := t.UTC()
+	return &utc
+}
+
 func (e *EntryKeyModel) Create(ctx context.Context,
 	tx *sql.Tx,
 	entryUUID string,
 	encryptedKey []byte,
+	masterKeyID string,
 	hash []byte,
 	expire *time.Time,
 	remainingReads *int,
+	passphrase *KeyPassphrase,
 ) (*EntryKey, error) {
 
-	now := time.Now()
+	var salt []byte
+	var params sql.NullString
+	if passphrase != nil {
+		salt = passphrase.Salt
+		params = sql.NullString{String: passphrase.Params, Valid: true}
+	}
+
+	now := time.Now().UTC()
 	res := tx.QueryRowContext(ctx, `
-		INSERT INTO entry_key (uuid, entry_uuid, encrypted_key, key_hash, created, remaining_reads, expire)
-		VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6) RETURNING uuid, created, expire;
-	`, entryUUID, encryptedKey, hash, now, remainingReads, expire)
+		INSERT INTO entry_key (uuid, entry_uuid, encrypted_key, key_hash, created, remaining_reads, expire, passphrase_salt, passphrase_params, master_key_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING uuid, created, expire;
+	`, uuid.NewUUIDString(), entryUUID, encryptedKey, hash, now, remainingReads, utcTime(expire), salt, params, masterKeyID)
 
 	var uid string
 	var created time.Time
@@ -51,12 +86,14 @@ func (e *EntryKeyModel) Create(ctx context.Context,
 		KeyHash:      hash,
 		Created:      now,
 		Expire:       expireResult,
+		Passphrase:   passphrase,
+		MasterKeyID:  masterKeyID,
 	}, err
 }
 
 func (e *EntryKeyModel) Get(ctx context.Context, tx *sql.Tx, entryUUID string) ([]EntryKey, error) {
 	rows, err := tx.QueryContext(ctx, `
-		SELECT uuid, entry_uuid, encrypted_key, key_hash, created, expire, remaining_reads
+		SELECT uuid, entry_uuid, encrypted_key, key_hash, created, accessed, expire, remaining_reads, passphrase_salt, passphrase_params, failed_attempts, master_key_id
 		FROM entry_key
 		WHERE entry_uuid = $1
 		;
@@ -72,11 +109,17 @@ func (e *EntryKeyModel) Get(ctx context.Context, tx *sql.Tx, entryUUID string) (
 
 	for rows.Next() {
 		var ek EntryKey
-		err := rows.Scan(&ek.UUID, &ek.EntryUUID, &ek.EncryptedKey, &ek.KeyHash, &ek.Created, &ek.Expire, &ek.RemainingReads)
+		var salt []byte
+		var params sql.NullString
+		err := rows.Scan(&ek.UUID, &ek.EntryUUID, &ek.EncryptedKey, &ek.KeyHash, &ek.Created, &ek.Accessed, &ek.Expire, &ek.RemainingReads, &salt, &params, &ek.FailedAttempts, &ek.MasterKeyID)
 		if err != nil {
 			return nil, err
 		}
 
+		if params.Valid {
+			ek.Passphrase = &KeyPassphrase{Salt: salt, Params: params.String}
+		}
+
 		entryKeys = append(entryKeys, ek)
 	}
 
@@ -94,13 +137,19 @@ func (e *EntryKeyModel) Delete(ctx context.Context, tx *sql.Tx, uuid string) err
 	return err
 }
 
-func (e *EntryKeyModel) DeleteExpired(ctx context.Context, tx *sql.Tx) error {
-	_, err := tx.ExecContext(ctx, `
+// DeleteExpired deletes the expired keys and returns the number of the
+// deleted keys
+func (e *EntryKeyModel) DeleteExpired(ctx context.Context, tx *sql.Tx) (int64, error) {
+	res, err := tx.ExecContext(ctx, `
 		DELETE FROM entry_key
-		WHERE expire < NOW()
-	`)
+		WHERE expire < $1
+	`, time.Now().UTC())
 
-	return err
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
 }
 
 // SetExpire sets the expire time for the entry key
@@ -109,7 +158,7 @@ func (e *EntryKeyModel) SetExpire(ctx context.Context, tx *sql.Tx, uuid string,
 		UPDATE entry_key
 		SET expire = $1
 		WHERE uuid = $2
-	`, expire, uuid)
+	`, expire.UTC(), uuid)
 
 	return err
 }
@@ -124,12 +173,63 @@ func (e *EntryKeyModel) SetMaxReads(ctx context.Context, tx *sql.Tx, uuid string
 	return err
 }
 
+// SetWrappedKey replaces the encrypted key of the entry key with the key
+// wrapped by the key wrap, the key hash of the wrapped keys is empty
+func (e *EntryKeyModel) SetWrappedKey(ctx context.Context, tx *sql.Tx, uuid string, wrappedKey []byte, masterKeyID string) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE entry_key
+		SET encrypted_key = $1, master_key_id = $2, key_hash = $3
+		WHERE uuid = $4
+	`, wrappedKey, masterKeyID, []byte{}, uuid)
+
+	return err
+}
+
+// SetPassphraseKey replaces the encrypted key of the entry key with the
+// wrapped key which is locked again with the passphrase, the salt and the
+// params of the passphrase are replaced too
+func (e *EntryKeyModel) SetPassphraseKey(ctx context.Context, tx *sql.Tx, uuid string, wrappedKey []byte, masterKeyID string, passphrase *KeyPassphrase) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE entry_key
+		SET encrypted_key = $1, master_key_id = $2, key_hash = $3, passphrase_salt = $4, passphrase_params = $5
+		WHERE uuid = $6
+	`, wrappedKey, masterKeyID, []byte{}, passphrase.Salt, passphrase.Params, uuid)
+
+	return err
+}
+
 func (e *EntryKeyModel) Use(ctx context.Context, tx *sql.Tx, uuid string) error {
 	_, err := tx.ExecContext(ctx, `
 		UPDATE entry_key
-		SET remaining_reads = remaining_reads - 1, accessed = NOW()
-		WHERE uuid = $1 AND remaining_reads IS NOT NULL
-	`, uuid)
+		SET remaining_reads = remaining_reads - 1, accessed = $1
+		WHERE uuid = $2 AND remaining_reads IS NOT NULL
+	`, time.Now().UTC(), uuid)
 
 	return err
 }
+
+// AddFailedAttempt increments the number of failed passphrase attempts of the
+// entry key and returns the updated count
+func (e *EntryKeyModel) AddFailedAttempt(ctx context.Context, tx *sql.Tx, uuid string) (int, error) {
+	var failedAttempts int
+	err := tx.QueryRowContext(ctx, `
+		UPDATE entry_key
+		SET failed_attempts = failed_attempts + 1
+		WHERE uuid = $1
+		RETURNING failed_attempts
+	`, uuid).Scan(&failedAttempts)
+
+	return failedAttempts, err
+}
+
+// Count returns the number of the entry keys which are not expired yet
+func (e *EntryKeyModel) Count(ctx context.Context, tx *sql.Tx) (int, error) {
+	var count int
+	err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM entry_key
+		WHERE expire IS NULL OR expire >= $1
+	`, time.Now().UTC()).Scan(&count)
+
+	return count, err
+}
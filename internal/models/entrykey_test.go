@@ -33,7 +33,7 @@ func createTestEntryKey(ctx context.Context, tx *sql.Tx) (string, string, error)
 
 	entryModel := &EntryModel{}
 
-	_, err := entryModel.CreateEntry(ctx, tx, uid, "text/plain", []byte("test data"))
+	_, err := entryModel.CreateEntry(ctx, tx, uid, "text/plain", []byte("test data"), "")
 
 	if err != nil {
 		return "", "", err
@@ -43,7 +43,7 @@ func createTestEntryKey(ctx context.Context, tx *sql.Tx) (string, string, error)
 
 	expire := time.Now().Add(time.Hour)
 	maxReads := 2
-	entryKey, err := model.Create(ctx, tx, uid, []byte("test"), []byte("hash entrykey use tx"), &expire, &maxReads)
+	entryKey, err := model.Create(ctx, tx, uid, []byte("test"), "", []byte("hash entrykey use tx"), &expire, &maxReads, nil)
 
 	if err != nil {
 		return "", "", err
@@ -68,7 +68,7 @@ func Test_EntryKeyModel_Create(t *testing.T) {
 	uid := uuid.New().String()
 
 	entryModel := &EntryModel{}
-	_, err = entryModel.CreateEntry(ctx, tx, uid, "text/plain", []byte("test data"))
+	_, err = entryModel.CreateEntry(ctx, tx, uid, "text/plain", []byte("test data"), "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -77,7 +77,7 @@ func Test_EntryKeyModel_Create(t *testing.T) {
 
 	expire := time.Now().Add(time.Hour)
 	remainingReads := 2
-	entryKey, err := model.Create(ctx, tx, uid, []byte("test"), []byte("hashke"), &expire, &remainingReads)
+	entryKey, err := model.Create(ctx, tx, uid, []byte("test"), "", []byte("hashke"), &expire, &remainingReads, nil)
 
 	if err != nil {
 		if err := tx.Rollback(); err != nil {
@@ -128,7 +128,7 @@ func Test_EntryKeyModel_Get(t *testing.T) {
 	uid := uuid.New().String()
 
 	entryModel := &EntryModel{}
-	_, err = entryModel.CreateEntry(ctx, tx, uid, "text/plain", []byte("test data"))
+	_, err = entryModel.CreateEntry(ctx, tx, uid, "text/plain", []byte("test data"), "")
 	if err != nil {
 		if err := tx.Rollback(); err != nil {
 			t.Error(err)
@@ -141,7 +141,7 @@ func Test_EntryKeyModel_Get(t *testing.T) {
 	for i := range 10 {
 		expire := time.Now().Add(time.Hour)
 		maxReads := 2
-		_, err = model.Create(ctx, tx, uid, []byte("test"), fmt.Appendf(nil, "hashke %d", i), &expire, &maxReads)
+		_, err = model.Create(ctx, tx, uid, []byte("test"), "master-1", fmt.Appendf(nil, "hashke %d", i), &expire, &maxReads, nil)
 
 		if err != nil {
 			if err := tx.Rollback(); err != nil {
@@ -189,6 +189,10 @@ func Test_EntryKeyModel_Get(t *testing.T) {
 	if entryKeys[0].KeyHash == nil {
 		t.Error("expected encrypted key to be set")
 	}
+
+	if entryKeys[0].MasterKeyID != "master-1" {
+		t.Errorf("expected master key id %s got %s", "master-1", entryKeys[0].MasterKeyID)
+	}
 }
 
 func Test_EntryKeyModel_Get_Empty(t *testing.T) {
@@ -477,3 +481,150 @@ func Test_EntryKeyModel_UseTx(t *testing.T) {
 		t.Errorf("expected 1 got %d", entryKeys[0].RemainingReads.Int16)
 	}
 }
+
+func Test_EntryKeyModel_Count(t *testing.T) {
+	ctx := context.Background()
+	db, tx, err := getTestDbTx(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	model := &EntryKeyModel{}
+
+	before, err := model.Count(ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := createTestEntryKey(ctx, tx); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := model.Count(ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after != before+1 {
+		t.Errorf("expected %d got %d", before+1, after)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_EntryKeyModel_SetWrappedKey(t *testing.T) {
+	ctx := context.Background()
+	db, tx, err := getTestDbTx(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			t.Errorf("rollback failed: %v", err)
+		}
+	}()
+
+	model := &EntryKeyModel{}
+
+	uid, entryKeyUUID, err := createTestEntryKey(ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := model.SetWrappedKey(ctx, tx, entryKeyUUID, []byte("wrapped"), "mk"); err != nil {
+		t.Fatal(err)
+	}
+
+	entryKeys, err := model.Get(ctx, tx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entryKeys) != 1 {
+		t.Fatalf("expected 1 got %d", len(entryKeys))
+	}
+
+	if string(entryKeys[0].EncryptedKey) != "wrapped" {
+		t.Errorf("expected wrapped key, got %q", entryKeys[0].EncryptedKey)
+	}
+
+	if entryKeys[0].MasterKeyID != "mk" {
+		t.Errorf("expected master key id mk, got %q", entryKeys[0].MasterKeyID)
+	}
+
+	if len(entryKeys[0].KeyHash) != 0 {
+		t.Errorf("expected empty key hash, got %q", entryKeys[0].KeyHash)
+	}
+}
+
+func Test_EntryKeyModel_SetPassphraseKey(t *testing.T) {
+	ctx := context.Background()
+	db, tx, err := getTestDbTx(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			t.Errorf("rollback failed: %v", err)
+		}
+	}()
+
+	model := &EntryKeyModel{}
+
+	uid, entryKeyUUID, err := createTestEntryKey(ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := model.SetPassphraseKey(ctx, tx, entryKeyUUID, []byte("wrapped"), "mk", &KeyPassphrase{Salt: []byte("salt"), Params: "params"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entryKeys, err := model.Get(ctx, tx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entryKeys) != 1 {
+		t.Fatalf("expected 1 got %d", len(entryKeys))
+	}
+
+	if string(entryKeys[0].EncryptedKey) != "wrapped" {
+		t.Errorf("expected wrapped key, got %q", entryKeys[0].EncryptedKey)
+	}
+
+	if entryKeys[0].MasterKeyID != "mk" {
+		t.Errorf("expected master key id mk, got %q", entryKeys[0].MasterKeyID)
+	}
+
+	if len(entryKeys[0].KeyHash) != 0 {
+		t.Errorf("expected empty key hash, got %q", entryKeys[0].KeyHash)
+	}
+
+	if entryKeys[0].Passphrase == nil {
+		t.Fatal("expected passphrase")
+	}
+
+	if string(entryKeys[0].Passphrase.Salt) != "salt" || entryKeys[0].Passphrase.Params != "params" {
+		t.Errorf("expected the new passphrase, got %+v", entryKeys[0].Passphrase)
+	}
+}
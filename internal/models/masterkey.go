@@ -0,0 +1,215 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+)
+
+// WrappedBlob is a stored blob with the id of the master key which wraps it,
+// the rotation of the master keys reads and rewrites them
+type WrappedBlob struct {
+	UUID        string
+	Data        []byte
+	MasterKeyID string
+}
+
+func scanWrappedBlobs(rows *sql.Rows) ([]WrappedBlob, error) {
+	defer rows.Close()
+
+	var blobs []WrappedBlob
+	for rows.Next() {
+		var blob WrappedBlob
+		if err := rows.Scan(&blob.UUID, &blob.Data, &blob.MasterKeyID); err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, blob)
+	}
+
+	return blobs, rows.Err()
+}
+
+func rewrapped(res sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	return rows == 1, err
+}
+
+// CountWrapped returns the number of the entries which are not wrapped with
+// the master key
+func (e *EntryModel) CountWrapped(ctx context.Context, tx *sql.Tx, exceptKeyID string) (int, error) {
+	var count int
+	err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM entries WHERE master_key_id <> $1", exceptKeyID).Scan(&count)
+
+	return count, err
+}
+
+// ListWrapped returns at most limit entries which are not wrapped with the
+// master key, ordered by their uuid, starting after the afterUUID
+func (e *EntryModel) ListWrapped(ctx context.Context, tx *sql.Tx, exceptKeyID string, afterUUID string, limit int) ([]WrappedBlob, error) {
+	if afterUUID == "" {
+		afterUUID = nilUUID
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT uuid, data, master_key_id
+		FROM entries
+		WHERE master_key_id <> $1 AND uuid > $2
+		ORDER BY uuid
+		LIMIT $3
+	`, exceptKeyID, afterUUID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanWrappedBlobs(rows)
+}
+
+// Rewrap replaces the data of the entry if it is still the listed blob, so
+// the data written since it was listed is not overwritten, it reports whether
+// the entry was updated
+func (e *EntryModel) Rewrap(ctx context.Context, tx *sql.Tx, blob WrappedBlob, newKeyID string, data []byte) (bool, error) {
+	return rewrapped(tx.ExecContext(ctx, `
+		UPDATE entries
+		SET data = $1, master_key_id = $2
+		WHERE uuid = $3 AND master_key_id = $4 AND data = $5
+	`, data, newKeyID, blob.UUID, blob.MasterKeyID, blob.Data))
+}
+
+// CountWrapped returns the number of the entry keys which are not wrapped
+// with the master key, the keys of the client encrypted entries have no
+// encrypted key, they are not counted
+func (e *EntryKeyModel) CountWrapped(ctx context.Context, tx *sql.Tx, exceptKeyID string) (int, error) {
+	var count int
+	err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM entry_key
+		WHERE master_key_id <> $1 AND length(encrypted_key) > 0
+	`, exceptKeyID).Scan(&count)
+
+	return count, err
+}
+
+// ListWrapped returns at most limit entry keys which are not wrapped with the
+// master key, ordered by their uuid, starting after the afterUUID
+func (e *EntryKeyModel) ListWrapped(ctx context.Context, tx *sql.Tx, exceptKeyID string, afterUUID string, limit int) ([]WrappedBlob, error) {
+	if afterUUID == "" {
+		afterUUID = nilUUID
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT uuid, encrypted_key, master_key_id
+		FROM entry_key
+		WHERE master_key_id <> $1 AND length(encrypted_key) > 0 AND uuid > $2
+		ORDER BY uuid
+		LIMIT $3
+	`, exceptKeyID, afterUUID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanWrappedBlobs(rows)
+}
+
+// Rewrap replaces the encrypted key if it is still the listed blob, so a key
+// upgraded since it was listed is not overwritten with its legacy form, it
+// reports whether the entry key was updated
+func (e *EntryKeyModel) Rewrap(ctx context.Context, tx *sql.Tx, blob WrappedBlob, newKeyID string, data []byte) (bool, error) {
+	return rewrapped(tx.ExecContext(ctx, `
+		UPDATE entry_key
+		SET encrypted_key = $1, master_key_id = $2
+		WHERE uuid = $3 AND master_key_id = $4 AND encrypted_key = $5
+	`, data, newKeyID, blob.UUID, blob.MasterKeyID, blob.Data))
+}
+
+// CountWrapped returns the number of the webhooks which are not wrapped with
+// the master key, the webhooks without secret are not counted
+func (w *WebhookModel) CountWrapped(ctx context.Context, tx *sql.Tx, exceptKeyID string) (int, error) {
+	var count int
+	err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM webhook
+		WHERE master_key_id <> $1 AND length(secret) > 0
+	`, exceptKeyID).Scan(&count)
+
+	return count, err
+}
+
+// ListWrapped returns at most limit webhooks which are not wrapped with the
+// master key, ordered by the uuid of their entry, starting after the
+// afterUUID
+func (w *WebhookModel) ListWrapped(ctx context.Context, tx *sql.Tx, exceptKeyID string, afterUUID string, limit int) ([]WrappedBlob, error) {
+	if afterUUID == "" {
+		afterUUID = nilUUID
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT entry_uuid, secret, master_key_id
+		FROM webhook
+		WHERE master_key_id <> $1 AND length(secret) > 0 AND entry_uuid > $2
+		ORDER BY entry_uuid
+		LIMIT $3
+	`, exceptKeyID, afterUUID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanWrappedBlobs(rows)
+}
+
+// Rewrap replaces the secret of the webhook if it is still the listed blob,
+// the uuid of the blob is the uuid of the entry, it reports whether the
+// webhook was updated
+func (w *WebhookModel) Rewrap(ctx context.Context, tx *sql.Tx, blob WrappedBlob, newKeyID string, data []byte) (bool, error) {
+	return rewrapped(tx.ExecContext(ctx, `
+		UPDATE webhook
+		SET secret = $1, master_key_id = $2
+		WHERE entry_uuid = $3 AND master_key_id = $4 AND secret = $5
+	`, data, newKeyID, blob.UUID, blob.MasterKeyID, blob.Data))
+}
+
+// CountWrapped returns the number of the queued events which are not wrapped
+// with the master key, the events without secret are not counted
+func (w *WebhookEventModel) CountWrapped(ctx context.Context, tx *sql.Tx, exceptKeyID string) (int, error) {
+	var count int
+	err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM webhook_event
+		WHERE master_key_id <> $1 AND length(secret) > 0
+	`, exceptKeyID).Scan(&count)
+
+	return count, err
+}
+
+// ListWrapped returns at most limit queued events which are not wrapped with
+// the master key, ordered by their uuid, starting after the afterUUID
+func (w *WebhookEventModel) ListWrapped(ctx context.Context, tx *sql.Tx, exceptKeyID string, afterUUID string, limit int) ([]WrappedBlob, error) {
+	if afterUUID == "" {
+		afterUUID = nilUUID
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT uuid, secret, master_key_id
+		FROM webhook_event
+		WHERE master_key_id <> $1 AND length(secret) > 0 AND uuid > $2
+		ORDER BY uuid
+		LIMIT $3
+	`, exceptKeyID, afterUUID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanWrappedBlobs(rows)
+}
+
+// Rewrap replaces the secret of the queued event if it is still the listed
+// blob, it reports whether the event was updated
+func (w *WebhookEventModel) Rewrap(ctx context.Context, tx *sql.Tx, blob WrappedBlob, newKeyID string, data []byte) (bool, error) {
+	return rewrapped(tx.ExecContext(ctx, `
+		UPDATE webhook_event
+		SET secret = $1, master_key_id = $2
+		WHERE uuid = $3 AND master_key_id = $4 AND secret = $5
+	`, data, newKeyID, blob.UUID, blob.MasterKeyID, blob.Data))
+}
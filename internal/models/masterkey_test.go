@@ -0,0 +1,298 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func Test_EntryModel_Rewrap(t *testing.T) {
+	ctx := context.Background()
+	db, tx, err := getTestDbTx(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer tx.Rollback()
+
+	model := &EntryModel{}
+	keyModel := &EntryKeyModel{}
+
+	before, err := model.CountWrapped(ctx, tx, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keysBefore, err := keyModel.CountWrapped(ctx, tx, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrapped := map[string]string{}
+	for _, masterKeyID := range []string{"", "old", "new"} {
+		uid := uuid.New().String()
+		if _, err := model.CreateEntry(ctx, tx, uid, "text/plain", []byte("data"), masterKeyID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := keyModel.Create(ctx, tx, uid, []byte("key"), masterKeyID, []byte("hash "+uid), nil, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := keyModel.Create(ctx, tx, uid, []byte{}, "", []byte("client hash "+uid), nil, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		wrapped[uid] = masterKeyID
+	}
+
+	count, err := model.CountWrapped(ctx, tx, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != before+2 {
+		t.Errorf("expected %d entries to rotate, got %d", before+2, count)
+	}
+
+	keyCount, err := keyModel.CountWrapped(ctx, tx, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keyCount != keysBefore+2 {
+		t.Errorf("expected %d keys to rotate, got %d, the keys without encrypted key are skipped", keysBefore+2, keyCount)
+	}
+
+	var found []WrappedBlob
+	afterUUID := ""
+	for {
+		page, err := model.ListWrapped(ctx, tx, "new", afterUUID, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(page) == 0 {
+			break
+		}
+
+		if page[0].UUID <= afterUUID {
+			t.Fatalf("expected the page to start after %s, got %s", afterUUID, page[0].UUID)
+		}
+
+		if _, ok := wrapped[page[0].UUID]; ok {
+			found = append(found, page[0])
+		}
+		afterUUID = page[0].UUID
+	}
+
+	if len(found) != 2 {
+		t.Fatalf("expected 2 entries to rotate, got %d", len(found))
+	}
+
+	for _, blob := range found {
+		if blob.MasterKeyID != wrapped[blob.UUID] || string(blob.Data) != "data" {
+			t.Errorf("unexpected blob %+v", blob)
+		}
+
+		ok, err := model.Rewrap(ctx, tx, blob, "new", []byte("rewrapped"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !ok {
+			t.Errorf("expected the entry %s to be rewrapped", blob.UUID)
+		}
+
+		ok, err = model.Rewrap(ctx, tx, blob, "new", []byte("rewrapped"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok {
+			t.Error("expected the rewrapped entry not to be rewrapped again with the old key id")
+		}
+
+		entry, err := model.ReadEntry(ctx, tx, blob.UUID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if entry.MasterKeyID != "new" || string(entry.Data) != "rewrapped" {
+			t.Errorf("unexpected entry %+v", entry)
+		}
+	}
+
+	keys, err := keyModel.ListWrapped(ctx, tx, "new", "", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range keys {
+		if len(key.Data) == 0 {
+			t.Errorf("expected the keys without encrypted key to be skipped, got %s", key.UUID)
+		}
+
+		if _, err := keyModel.Rewrap(ctx, tx, key, "new", []byte("rewrapped")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keyCount, err = keyModel.CountWrapped(ctx, tx, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keyCount != 0 && len(keys) < 1000 {
+		t.Errorf("expected every key to be rewrapped, %d left", keyCount)
+	}
+}
+
+func Test_EntryKeyModel_RewrapUpgraded(t *testing.T) {
+	ctx := context.Background()
+	db, tx, err := getTestDbTx(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer tx.Rollback()
+
+	model := &EntryModel{}
+	keyModel := &EntryKeyModel{}
+
+	uid := uuid.New().String()
+	if _, err := model.CreateEntry(ctx, tx, uid, "text/plain", []byte("data"), "old"); err != nil {
+		t.Fatal(err)
+	}
+	entryKey, err := keyModel.Create(ctx, tx, uid, []byte("legacy"), "old", []byte("hash "+uid), nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the key is upgraded with the same master key after the rotation listed
+	// it, the rotation must not write the legacy key back
+	listed := WrappedBlob{UUID: entryKey.UUID, Data: []byte("legacy"), MasterKeyID: "old"}
+	if err := keyModel.SetWrappedKey(ctx, tx, entryKey.UUID, []byte("wrapped"), "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := keyModel.Rewrap(ctx, tx, listed, "new", []byte("rewrapped legacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok {
+		t.Error("expected the upgraded key not to be rewrapped with the listed blob")
+	}
+
+	keys, err := keyModel.Get(ctx, tx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 1 || string(keys[0].EncryptedKey) != "wrapped" || keys[0].MasterKeyID != "old" || len(keys[0].KeyHash) != 0 {
+		t.Errorf("unexpected keys %+v", keys)
+	}
+}
+
+func Test_WebhookModel_Rewrap(t *testing.T) {
+	ctx := context.Background()
+	db, tx, err := getTestDbTx(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer tx.Rollback()
+
+	model := &WebhookModel{}
+	eventModel := &WebhookEventModel{}
+
+	before, err := model.CountWrapped(ctx, tx, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventsBefore, err := eventModel.CountWrapped(ctx, tx, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := uuid.New().String()
+	if err := model.Create(ctx, tx, signed, "https://example.com/hook", []byte("secret"), "old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := model.Create(ctx, tx, uuid.New().String(), "https://example.com/hook", nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := eventModel.Enqueue(ctx, tx, signed, "read", "https://example.com/hook", []byte("secret"), "old", []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := eventModel.Enqueue(ctx, tx, signed, "read", "https://example.com/hook", nil, "", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := model.CountWrapped(ctx, tx, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != before+1 {
+		t.Errorf("expected %d webhooks to rotate, got %d, the webhooks without secret are skipped", before+1, count)
+	}
+
+	eventCount, err := eventModel.CountWrapped(ctx, tx, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if eventCount != eventsBefore+1 {
+		t.Errorf("expected %d events to rotate, got %d, the events without secret are skipped", eventsBefore+1, eventCount)
+	}
+
+	webhooks, err := model.ListWrapped(ctx, tx, "new", "", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, blob := range webhooks {
+		if blob.UUID == signed && (blob.MasterKeyID != "old" || string(blob.Data) != "secret") {
+			t.Errorf("unexpected blob %+v", blob)
+		}
+	}
+
+	ok, err := model.Rewrap(ctx, tx, WrappedBlob{UUID: signed, Data: []byte("secret"), MasterKeyID: "old"}, "new", []byte("rewrapped"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok {
+		t.Error("expected the webhook to be rewrapped")
+	}
+
+	webhook, err := model.Get(ctx, tx, signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if webhook.MasterKeyID != "new" || string(webhook.Secret) != "rewrapped" {
+		t.Errorf("unexpected webhook %+v", webhook)
+	}
+
+	ok, err = eventModel.Rewrap(ctx, tx, WrappedBlob{UUID: event.UUID, Data: []byte("secret"), MasterKeyID: "old"}, "new", []byte("rewrapped"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok {
+		t.Error("expected the event to be rewrapped")
+	}
+
+	ok, err = eventModel.Rewrap(ctx, tx, WrappedBlob{UUID: event.UUID, Data: []byte("secret"), MasterKeyID: "old"}, "new", []byte("rewrapped"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok {
+		t.Error("expected the rewrapped event not to be rewrapped again with the old key id")
+	}
+}
@@ -0,0 +1,52 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Ajnasz/sekret.link/internal/durable"
+)
+
+type APITokenMigration struct {
+	dialect durable.Dialect
+}
+
+func NewAPITokenMigration(dialect durable.Dialect) *APITokenMigration {
+	return &APITokenMigration{dialect: dialect}
+}
+
+func (a *APITokenMigration) Create(ctx context.Context, tx *sql.Tx) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS api_token (
+	uuid UUID PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	token_hash BYTEA NOT NULL UNIQUE,
+	created TIMESTAMPTZ NOT NULL,
+	last_used TIMESTAMPTZ DEFAULT NULL,
+	revoked TIMESTAMPTZ DEFAULT NULL
+	);
+`
+	if a.dialect == durable.DialectSQLite {
+		query = `
+	CREATE TABLE IF NOT EXISTS api_token (
+	uuid TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	token_hash BLOB NOT NULL UNIQUE,
+	created TIMESTAMP NOT NULL,
+	last_used TIMESTAMP DEFAULT NULL,
+	revoked TIMESTAMP DEFAULT NULL
+	);
+`
+	}
+
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create api_token table: %w", err)
+	}
+
+	return nil
+}
+
+func (a *APITokenMigration) Alter(ctx context.Context, tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,90 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Ajnasz/sekret.link/internal/durable"
+)
+
+// AuditMigration creates the append-only audit log of the entries
+type AuditMigration struct {
+	dialect durable.Dialect
+}
+
+func NewAuditMigration(dialect durable.Dialect) *AuditMigration {
+	return &AuditMigration{dialect: dialect}
+}
+
+func (a *AuditMigration) Create(ctx context.Context, tx *sql.Tx) error {
+	if a.dialect == durable.DialectSQLite {
+		return a.createSQLite(ctx, tx)
+	}
+
+	// the rows are not removed with the entries, the log must outlive them
+	queries := []string{`
+	CREATE TABLE IF NOT EXISTS audit_log (
+	uuid UUID PRIMARY KEY,
+	entry_uuid UUID NOT NULL,
+	key_uuid UUID DEFAULT NULL,
+	event VARCHAR(32) NOT NULL,
+	created TIMESTAMPTZ NOT NULL,
+	client_ip VARCHAR(64) NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT ''
+	);`,
+		"CREATE INDEX IF NOT EXISTS audit_log_entry_uuid ON audit_log (entry_uuid, created);",
+		"CREATE INDEX IF NOT EXISTS audit_log_created ON audit_log (created);",
+		`CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'audit_log is append-only';
+	END;
+	$$ LANGUAGE plpgsql;`,
+		"DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;",
+		"CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();",
+	}
+
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to create audit_log table: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (*AuditMigration) createSQLite(ctx context.Context, tx *sql.Tx) error {
+	queries := []string{`
+	CREATE TABLE IF NOT EXISTS audit_log (
+	uuid TEXT PRIMARY KEY,
+	entry_uuid TEXT NOT NULL,
+	key_uuid TEXT DEFAULT NULL,
+	event TEXT NOT NULL,
+	created TIMESTAMP NOT NULL,
+	client_ip TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT ''
+	);`,
+		"CREATE INDEX IF NOT EXISTS audit_log_entry_uuid ON audit_log (entry_uuid, created);",
+		"CREATE INDEX IF NOT EXISTS audit_log_created ON audit_log (created);",
+		`CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN
+		SELECT RAISE(ABORT, 'audit_log is append-only');
+	END;`,
+		`CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+	BEGIN
+		SELECT RAISE(ABORT, 'audit_log is append-only');
+	END;`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to create audit_log table: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (a *AuditMigration) Alter(ctx context.Context, tx *sql.Tx) error {
+	return nil
+}
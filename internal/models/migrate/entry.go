@@ -5,16 +5,23 @@ import (
 	"database/sql"
 	"fmt"
 
+	"github.com/Ajnasz/sekret.link/internal/durable"
 	"github.com/Ajnasz/sekret.link/internal/key"
 )
 
-type EntryMigration struct{}
+type EntryMigration struct {
+	dialect durable.Dialect
+}
 
-func NewEntryMigration() *EntryMigration {
-	return &EntryMigration{}
+func NewEntryMigration(dialect durable.Dialect) *EntryMigration {
+	return &EntryMigration{dialect: dialect}
 }
 
-func (*EntryMigration) Create(ctx context.Context, tx *sql.Tx) error {
+func (e *EntryMigration) Create(ctx context.Context, tx *sql.Tx) error {
+	if e.dialect == durable.DialectSQLite {
+		return e.createSQLite(ctx, tx)
+	}
+
 	_, err := tx.ExecContext(ctx, `
 		CREATE TABLE IF NOT EXISTS entries (
 		uuid uuid PRIMARY KEY,
@@ -33,7 +40,37 @@ func (*EntryMigration) Create(ctx context.Context, tx *sql.Tx) error {
 	return nil
 }
 
+func (*EntryMigration) createSQLite(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS entries (
+		uuid TEXT PRIMARY KEY,
+		data BLOB,
+		delete_key TEXT NOT NULL,
+		created TIMESTAMP,
+		accessed TIMESTAMP,
+		content_type TEXT NOT NULL DEFAULT ''
+	);`)
+
+	if err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	return nil
+}
+
 func (e *EntryMigration) Alter(ctx context.Context, tx *sql.Tx) error {
+	if e.dialect == durable.DialectSQLite {
+		if err := e.addClientEncrypted(ctx, tx); err != nil {
+			return err
+		}
+
+		if err := e.addLockout(ctx, tx); err != nil {
+			return err
+		}
+
+		return e.addMasterKeyID(ctx, tx)
+	}
+
 	if err := e.addRemainingRead(ctx, tx); err != nil {
 		return err
 	}
@@ -49,6 +86,18 @@ func (e *EntryMigration) Alter(ctx context.Context, tx *sql.Tx) error {
 		return err
 	}
 
+	if err := e.addClientEncrypted(ctx, tx); err != nil {
+		return err
+	}
+
+	if err := e.addLockout(ctx, tx); err != nil {
+		return err
+	}
+
+	if err := e.addMasterKeyID(ctx, tx); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -141,3 +190,22 @@ func (e *EntryMigration) dropKeyFields(ctx context.Context, tx *sql.Tx) error {
 
 	return nil
 }
+
+func (e *EntryMigration) addClientEncrypted(ctx context.Context, tx *sql.Tx) error {
+	return addColumn(ctx, tx, e.dialect, "entries", "client_encrypted", "BOOLEAN NOT NULL DEFAULT FALSE")
+}
+
+// addLockout adds the columns counting the failed key attempts
+func (e *EntryMigration) addLockout(ctx context.Context, tx *sql.Tx) error {
+	if err := addColumn(ctx, tx, e.dialect, "entries", "failed_attempts", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	return addColumn(ctx, tx, e.dialect, "entries", "locked", "BOOLEAN NOT NULL DEFAULT FALSE")
+}
+
+// addMasterKeyID adds the id of the master key which wraps the data, the
+// empty id means the data is not wrapped
+func (e *EntryMigration) addMasterKeyID(ctx context.Context, tx *sql.Tx) error {
+	return addColumn(ctx, tx, e.dialect, "entries", "master_key_id", "VARCHAR(32) NOT NULL DEFAULT ''")
+}
@@ -4,15 +4,23 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+
+	"github.com/Ajnasz/sekret.link/internal/durable"
 )
 
-type EntryKeyMigration struct{}
+type EntryKeyMigration struct {
+	dialect durable.Dialect
+}
 
-func NewEntryKeyMigration() *EntryKeyMigration {
-	return &EntryKeyMigration{}
+func NewEntryKeyMigration(dialect durable.Dialect) *EntryKeyMigration {
+	return &EntryKeyMigration{dialect: dialect}
 }
 
 func (e *EntryKeyMigration) Create(ctx context.Context, tx *sql.Tx) error {
+	if e.dialect == durable.DialectSQLite {
+		return e.createSQLite(ctx, tx)
+	}
+
 	query := `
 	CREATE TABLE IF NOT EXISTS entry_key (
 	uuid UUID PRIMARY KEY,
@@ -35,6 +43,29 @@ func (e *EntryKeyMigration) Create(ctx context.Context, tx *sql.Tx) error {
 	return nil
 }
 
+func (e *EntryKeyMigration) createSQLite(ctx context.Context, tx *sql.Tx) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS entry_key (
+	uuid TEXT PRIMARY KEY,
+	entry_uuid TEXT NOT NULL,
+	encrypted_key BLOB NOT NULL,
+	key_hash BLOB NOT NULL,
+	expire TIMESTAMP DEFAULT NULL,
+	remaining_reads SMALLINT DEFAULT NULL,
+	accessed TIMESTAMP DEFAULT NULL,
+	created TIMESTAMP,
+	FOREIGN KEY (entry_uuid) REFERENCES entries(uuid) ON DELETE CASCADE
+	);
+`
+	_, err := tx.ExecContext(ctx, query)
+
+	if err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	return nil
+}
+
 func (e *EntryKeyMigration) renameAccesedToAccessed(ctx context.Context, tx *sql.Tx) error {
 	// in postgresql db if it has a column named accesed rename it to accessed
 	hasColumnQuery := `
@@ -70,9 +101,47 @@ func (e *EntryKeyMigration) renameAccesedToAccessed(ctx context.Context, tx *sql
 	return nil
 }
 
+func (e *EntryKeyMigration) addPassphrase(ctx context.Context, tx *sql.Tx) error {
+	saltType := "BYTEA"
+	if e.dialect == durable.DialectSQLite {
+		saltType = "BLOB"
+	}
+
+	if err := addColumn(ctx, tx, e.dialect, "entry_key", "passphrase_salt", saltType+" DEFAULT NULL"); err != nil {
+		return err
+	}
+
+	if err := addColumn(ctx, tx, e.dialect, "entry_key", "passphrase_params", "VARCHAR(256) DEFAULT NULL"); err != nil {
+		return err
+	}
+
+	if err := addColumn(ctx, tx, e.dialect, "entry_key", "failed_attempts", "SMALLINT NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (e *EntryKeyMigration) Alter(ctx context.Context, tx *sql.Tx) error {
-	if err := e.renameAccesedToAccessed(ctx, tx); err != nil {
+	if e.dialect == durable.DialectPostgres {
+		if err := e.renameAccesedToAccessed(ctx, tx); err != nil {
+			return err
+		}
+	}
+
+	if err := e.addPassphrase(ctx, tx); err != nil {
+		return err
+	}
+
+	if err := e.addMasterKeyID(ctx, tx); err != nil {
 		return err
 	}
+
 	return nil
 }
+
+// addMasterKeyID adds the id of the master key which wraps the encrypted
+// key, the empty id means the key is not wrapped
+func (e *EntryKeyMigration) addMasterKeyID(ctx context.Context, tx *sql.Tx) error {
+	return addColumn(ctx, tx, e.dialect, "entry_key", "master_key_id", "VARCHAR(32) NOT NULL DEFAULT ''")
+}
@@ -5,6 +5,9 @@ import (
 	"database/sql"
 	"fmt"
 	"sync"
+	"sync/atomic"
+
+	"github.com/Ajnasz/sekret.link/internal/durable"
 )
 
 type Migrator interface {
@@ -18,9 +21,13 @@ func prepareDatabase(ctx context.Context, db *sql.DB) error {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 
+	dialect := durable.DialectOf(db)
 	migrations := []Migrator{
-		NewEntryMigration(),
-		NewEntryKeyMigration(),
+		NewEntryMigration(dialect),
+		NewEntryKeyMigration(dialect),
+		NewAPITokenMigration(dialect),
+		NewWebhookMigration(dialect),
+		NewAuditMigration(dialect),
 	}
 
 	for _, migration := range migrations {
@@ -43,12 +50,68 @@ func prepareDatabase(ctx context.Context, db *sql.DB) error {
 
 }
 
-var once = sync.Once{}
+// addColumn adds the column to the table if it does not exist yet
+func addColumn(ctx context.Context, tx *sql.Tx, dialect durable.Dialect, table string, column string, definition string) error {
+	if dialect != durable.DialectSQLite {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s;", table, column, definition)); err != nil {
+			return fmt.Errorf("failed to add %s column: %w", column, err)
+		}
+
+		return nil
+	}
+
+	// sqlite does not support the IF NOT EXISTS clause for columns
+	var hasColumn int
+	err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info($1) WHERE name = $2", table, column).Scan(&hasColumn)
+	if err != nil {
+		return fmt.Errorf("failed to check if column %s exists: %w", column, err)
+	}
+
+	if hasColumn > 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add %s column: %w", column, err)
+	}
+
+	return nil
+}
+
+type preparation struct {
+	once    sync.Once
+	err     error
+	applied atomic.Bool
+}
+
+var prepared sync.Map
 
+// PrepareDatabase creates or updates the tables, the migrations run only once
+// per database
 func PrepareDatabase(ctx context.Context, db *sql.DB) error {
-	var err error
-	once.Do(func() {
-		err = prepareDatabase(ctx, db)
+	p, _ := prepared.LoadOrStore(db, &preparation{})
+	prep := p.(*preparation)
+	prep.once.Do(func() {
+		prep.err = prepareDatabase(ctx, db)
+		prep.applied.Store(prep.err == nil)
 	})
-	return err
+	return prep.err
+}
+
+// Close closes the database and forgets its migrations, so the database is
+// not kept alive by the prepared databases
+func Close(db *sql.DB) error {
+	prepared.Delete(db)
+	return db.Close()
+}
+
+// Prepared reports whether the migrations of the database have been applied
+// successfully by PrepareDatabase
+func Prepared(db *sql.DB) bool {
+	p, ok := prepared.Load(db)
+	if !ok {
+		return false
+	}
+
+	return p.(*preparation).applied.Load()
 }
@@ -0,0 +1,104 @@
+package migrate
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/durable"
+	"github.com/Ajnasz/sekret.link/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestPrepareDatabaseSQLite(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.OpenDatabaseClient(ctx, "sqlite://"+filepath.Join(t.TempDir(), "sekret.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := prepareDatabase(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	// running the migrations again must be a no-op
+	if err := prepareDatabase(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	uid := uuid.New().String()
+	entryModel := &models.EntryModel{}
+	meta, err := entryModel.CreateEntry(ctx, tx, uid, "text/plain", []byte("test data"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entryKeyModel := &models.EntryKeyModel{}
+	expire := time.Now().Add(time.Hour)
+	maxReads := 1
+	if _, err := entryKeyModel.Create(ctx, tx, uid, []byte("key"), "", []byte("hash"), &expire, &maxReads, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := entryModel.DeleteEntry(ctx, tx, uid, meta.DeleteKey); err != nil {
+		t.Fatal(err)
+	}
+
+	entryKeys, err := entryKeyModel.Get(ctx, tx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entryKeys) != 0 {
+		t.Errorf("expected entry keys to be deleted with the entry, got %d", len(entryKeys))
+	}
+}
+
+func TestPrepared(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.OpenDatabaseClient(ctx, durable.MemoryConnectionString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if Prepared(db) {
+		t.Error("expected the database not to be prepared before the migrations")
+	}
+
+	if err := PrepareDatabase(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	if !Prepared(db) {
+		t.Error("expected the database to be prepared after the migrations")
+	}
+}
+
+func TestClose(t *testing.T) {
+	ctx := context.Background()
+	db, err := durable.OpenDatabaseClient(ctx, durable.MemoryConnectionString)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PrepareDatabase(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Close(db); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := prepared.Load(db); ok {
+		t.Error("expected the closed database to be forgotten")
+	}
+}
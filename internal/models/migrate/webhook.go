@@ -0,0 +1,95 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Ajnasz/sekret.link/internal/durable"
+)
+
+// WebhookMigration creates the webhook registrations of the entries and the
+// queue of the events to deliver
+type WebhookMigration struct {
+	dialect durable.Dialect
+}
+
+func NewWebhookMigration(dialect durable.Dialect) *WebhookMigration {
+	return &WebhookMigration{dialect: dialect}
+}
+
+func (w *WebhookMigration) Create(ctx context.Context, tx *sql.Tx) error {
+	// the webhook rows are not removed with the entries, the cleanup
+	// finds the orphaned ones to notify about the expiration
+	webhookQuery := `
+	CREATE TABLE IF NOT EXISTS webhook (
+	entry_uuid UUID PRIMARY KEY,
+	url TEXT NOT NULL,
+	secret BYTEA DEFAULT NULL,
+	created TIMESTAMPTZ NOT NULL
+	);
+`
+	eventQuery := `
+	CREATE TABLE IF NOT EXISTS webhook_event (
+	uuid UUID PRIMARY KEY,
+	entry_uuid UUID NOT NULL,
+	event VARCHAR(32) NOT NULL,
+	url TEXT NOT NULL,
+	secret BYTEA DEFAULT NULL,
+	payload BYTEA NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt TIMESTAMPTZ NOT NULL,
+	last_error TEXT DEFAULT NULL,
+	created TIMESTAMPTZ NOT NULL
+	);
+`
+	if w.dialect == durable.DialectSQLite {
+		webhookQuery = `
+	CREATE TABLE IF NOT EXISTS webhook (
+	entry_uuid TEXT PRIMARY KEY,
+	url TEXT NOT NULL,
+	secret BLOB DEFAULT NULL,
+	created TIMESTAMP NOT NULL
+	);
+`
+		eventQuery = `
+	CREATE TABLE IF NOT EXISTS webhook_event (
+	uuid TEXT PRIMARY KEY,
+	entry_uuid TEXT NOT NULL,
+	event TEXT NOT NULL,
+	url TEXT NOT NULL,
+	secret BLOB DEFAULT NULL,
+	payload BLOB NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt TIMESTAMP NOT NULL,
+	last_error TEXT DEFAULT NULL,
+	created TIMESTAMP NOT NULL
+	);
+`
+	}
+
+	if _, err := tx.ExecContext(ctx, webhookQuery); err != nil {
+		return fmt.Errorf("failed to create webhook table: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, eventQuery); err != nil {
+		return fmt.Errorf("failed to create webhook_event table: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "CREATE INDEX IF NOT EXISTS webhook_event_next_attempt ON webhook_event (next_attempt);"); err != nil {
+		return fmt.Errorf("failed to create webhook_event index: %w", err)
+	}
+
+	return nil
+}
+
+// Alter adds the id of the master key which wraps the secret of the
+// webhooks and the queued events, the empty id means the secret is not
+// wrapped
+func (w *WebhookMigration) Alter(ctx context.Context, tx *sql.Tx) error {
+	if err := addColumn(ctx, tx, w.dialect, "webhook", "master_key_id", "VARCHAR(32) NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	return addColumn(ctx, tx, w.dialect, "webhook_event", "master_key_id", "VARCHAR(32) NOT NULL DEFAULT ''")
+}
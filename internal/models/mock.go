@@ -17,6 +17,19 @@ func (m *MockEntryModel) CreateEntry(
 	UUID string,
 	contentType string,
 	data []byte,
+	masterKeyID string,
+) (*EntryMeta, error) {
+	args := m.Called(ctx, tx, UUID, data)
+	return args.Get(0).(*EntryMeta), args.Error(1)
+}
+
+func (m *MockEntryModel) CreateClientEncryptedEntry(
+	ctx context.Context,
+	tx *sql.Tx,
+	UUID string,
+	contentType string,
+	data []byte,
+	masterKeyID string,
 ) (*EntryMeta, error) {
 	args := m.Called(ctx, tx, UUID, data)
 	return args.Get(0).(*EntryMeta), args.Error(1)
@@ -27,17 +40,32 @@ func (m *MockEntryModel) ReadEntry(ctx context.Context, tx *sql.Tx, UUID string)
 	return args.Get(0).(*Entry), args.Error(1)
 }
 
+func (m *MockEntryModel) ReadEntryMeta(ctx context.Context, tx *sql.Tx, UUID string) (*EntryMeta, error) {
+	args := m.Called(ctx, tx, UUID)
+	return args.Get(0).(*EntryMeta), args.Error(1)
+}
+
 func (m *MockEntryModel) Use(ctx context.Context, tx *sql.Tx, UUID string) error {
 	args := m.Called(ctx, tx, UUID)
 	return args.Error(0)
 }
 
+func (m *MockEntryModel) SetData(ctx context.Context, tx *sql.Tx, UUID string, data []byte, masterKeyID string) error {
+	args := m.Called(ctx, tx, UUID, data, masterKeyID)
+	return args.Error(0)
+}
+
 func (m *MockEntryModel) DeleteEntry(ctx context.Context, tx *sql.Tx, UUID string, deleteKey string) error {
 	args := m.Called(ctx, tx, UUID, deleteKey)
 	return args.Error(0)
 }
 
-func (m *MockEntryModel) DeleteExpired(ctx context.Context, tx *sql.Tx) error {
+func (m *MockEntryModel) DeleteExpired(ctx context.Context, tx *sql.Tx) (int64, error) {
 	args := m.Called(ctx, tx)
-	return args.Error(0)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockEntryModel) Count(ctx context.Context, tx *sql.Tx) (int, error) {
+	args := m.Called(ctx, tx)
+	return args.Int(0), args.Error(1)
 }
@@ -0,0 +1,214 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/uuid"
+)
+
+// ErrWebhookNotFound is returned when the entry has no webhook
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// Webhook is the callback URL of an entry, the events of the entry are
+// posted to it signed with the secret
+type Webhook struct {
+	EntryUUID string
+	URL       string
+	Secret    []byte
+	Created   time.Time
+	// MasterKeyID is the id of the master key which wraps the secret, it is
+	// empty when the secret is not wrapped
+	MasterKeyID string
+}
+
+type WebhookModel struct{}
+
+// Create registers the webhook of the entry, the secret is wrapped with the
+// master key of the masterKeyID
+func (w *WebhookModel) Create(ctx context.Context, tx *sql.Tx, entryUUID string, url string, secret []byte, masterKeyID string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO webhook (entry_uuid, url, secret, created, master_key_id)
+		VALUES ($1, $2, $3, $4, $5)
+	`, entryUUID, url, secret, time.Now().UTC(), masterKeyID)
+
+	return err
+}
+
+// Get returns the webhook of the entry
+func (w *WebhookModel) Get(ctx context.Context, tx *sql.Tx, entryUUID string) (*Webhook, error) {
+	var webhook Webhook
+	err := tx.QueryRowContext(ctx, `
+		SELECT entry_uuid, url, secret, created, master_key_id
+		FROM webhook
+		WHERE entry_uuid = $1
+	`, entryUUID).Scan(&webhook.EntryUUID, &webhook.URL, &webhook.Secret, &webhook.Created, &webhook.MasterKeyID)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+// Delete removes the webhook of the entry
+func (w *WebhookModel) Delete(ctx context.Context, tx *sql.Tx, entryUUID string) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM webhook WHERE entry_uuid = $1", entryUUID)
+
+	return err
+}
+
+// ListOrphans returns at most limit webhooks whose entry does not exist
+// anymore
+func (w *WebhookModel) ListOrphans(ctx context.Context, tx *sql.Tx, limit int) ([]Webhook, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT w.entry_uuid, w.url, w.secret, w.created, w.master_key_id
+		FROM webhook w
+		WHERE NOT EXISTS(SELECT 1 FROM entries e WHERE e.uuid = w.entry_uuid)
+		ORDER BY w.created
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []Webhook
+	for rows.Next() {
+		var webhook Webhook
+		if err := rows.Scan(&webhook.EntryUUID, &webhook.URL, &webhook.Secret, &webhook.Created, &webhook.MasterKeyID); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// WebhookEvent is an event in the delivery queue, it carries the URL and the
+// secret, because the webhook of the entry may be removed before the
+// delivery
+type WebhookEvent struct {
+	UUID        string
+	EntryUUID   string
+	Event       string
+	URL         string
+	Secret      []byte
+	Payload     []byte
+	Attempts    int
+	NextAttempt time.Time
+	LastError   sql.NullString
+	Created     time.Time
+	// MasterKeyID is the id of the master key which wraps the secret, it is
+	// empty when the secret is not wrapped
+	MasterKeyID string
+}
+
+type WebhookEventModel struct{}
+
+// Enqueue adds an event to the delivery queue, it is due immediately. The
+// secret is wrapped with the master key of the masterKeyID.
+func (w *WebhookEventModel) Enqueue(ctx context.Context, tx *sql.Tx, entryUUID string, event string, url string, secret []byte, masterKeyID string, payload []byte) (*WebhookEvent, error) {
+	now := time.Now().UTC()
+	uid := uuid.NewUUIDString()
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO webhook_event (uuid, entry_uuid, event, url, secret, payload, next_attempt, created, master_key_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, uid, entryUUID, event, url, secret, payload, now, now, masterKeyID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebhookEvent{
+		UUID:        uid,
+		EntryUUID:   entryUUID,
+		Event:       event,
+		URL:         url,
+		Secret:      secret,
+		Payload:     payload,
+		NextAttempt: now,
+		Created:     now,
+		MasterKeyID: masterKeyID,
+	}, nil
+}
+
+// ListDue returns at most limit events which are due at now, the oldest
+// first
+func (w *WebhookEventModel) ListDue(ctx context.Context, tx *sql.Tx, now time.Time, limit int) ([]WebhookEvent, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT uuid, entry_uuid, event, url, secret, payload, attempts, next_attempt, last_error, created, master_key_id
+		FROM webhook_event
+		WHERE next_attempt <= $1
+		ORDER BY next_attempt
+		LIMIT $2
+	`, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []WebhookEvent
+	for rows.Next() {
+		var event WebhookEvent
+		if err := rows.Scan(&event.UUID, &event.EntryUUID, &event.Event, &event.URL, &event.Secret, &event.Payload, &event.Attempts, &event.NextAttempt, &event.LastError, &event.Created, &event.MasterKeyID); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// Claim postpones the next attempt of an event which is due at now to until,
+// so the other dispatchers skip it while it is delivered. It returns false
+// when the event is already claimed or delivered.
+func (w *WebhookEventModel) Claim(ctx context.Context, tx *sql.Tx, uuid string, now time.Time, until time.Time) (bool, error) {
+	res, err := tx.ExecContext(ctx, `
+		UPDATE webhook_event
+		SET next_attempt = $1
+		WHERE uuid = $2 AND next_attempt <= $3
+	`, until.UTC(), uuid, now.UTC())
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
+
+// Retry records a failed delivery attempt and schedules the next one
+func (w *WebhookEventModel) Retry(ctx context.Context, tx *sql.Tx, uuid string, nextAttempt time.Time, lastError string) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE webhook_event
+		SET attempts = attempts + 1, next_attempt = $1, last_error = $2
+		WHERE uuid = $3
+	`, nextAttempt.UTC(), lastError, uuid)
+
+	return err
+}
+
+// Delete removes the event from the queue
+func (w *WebhookEventModel) Delete(ctx context.Context, tx *sql.Tx, uuid string) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM webhook_event WHERE uuid = $1", uuid)
+
+	return err
+}
+
+// Count returns the number of the events waiting for the delivery
+func (w *WebhookEventModel) Count(ctx context.Context, tx *sql.Tx) (int, error) {
+	var count int
+	err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM webhook_event").Scan(&count)
+
+	return count, err
+}
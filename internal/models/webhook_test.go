@@ -0,0 +1,165 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func Test_WebhookModel(t *testing.T) {
+	ctx := context.Background()
+	db, tx, err := getTestDbTx(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer tx.Rollback()
+
+	entryModel := &EntryModel{}
+	model := &WebhookModel{}
+
+	uid := uuid.New().String()
+	meta, err := entryModel.CreateEntry(ctx, tx, uid, "text/plain", []byte("test data"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := model.Create(ctx, tx, uid, "https://example.com/hook", []byte("secret"), "key-id"); err != nil {
+		t.Fatal(err)
+	}
+
+	webhook, err := model.Get(ctx, tx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if webhook.URL != "https://example.com/hook" || string(webhook.Secret) != "secret" || webhook.MasterKeyID != "key-id" {
+		t.Errorf("unexpected webhook %+v", webhook)
+	}
+
+	orphans, err := model.ListOrphans(ctx, tx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, orphan := range orphans {
+		if orphan.EntryUUID == uid {
+			t.Error("expected the webhook of an existing entry not to be an orphan")
+		}
+	}
+
+	if err := entryModel.DeleteEntry(ctx, tx, uid, meta.DeleteKey); err != nil {
+		t.Fatal(err)
+	}
+
+	orphans, err = model.ListOrphans(ctx, tx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, orphan := range orphans {
+		found = found || orphan.EntryUUID == uid
+	}
+
+	if !found {
+		t.Error("expected the webhook of the deleted entry to be an orphan")
+	}
+
+	if err := model.Delete(ctx, tx, uid); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := model.Get(ctx, tx, uid); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("expected ErrWebhookNotFound, got %v", err)
+	}
+}
+
+func Test_WebhookEventModel(t *testing.T) {
+	ctx := context.Background()
+	db, tx, err := getTestDbTx(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer tx.Rollback()
+
+	model := &WebhookEventModel{}
+
+	uid := uuid.New().String()
+	event, err := model.Enqueue(ctx, tx, uid, "read", "https://example.com/hook", []byte("secret"), "key-id", []byte(`{"event":"read"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	findDue := func(now time.Time) *WebhookEvent {
+		events, err := model.ListDue(ctx, tx, now, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, e := range events {
+			if e.UUID == event.UUID {
+				return &e
+			}
+		}
+
+		return nil
+	}
+
+	now := time.Now().Add(time.Second)
+	due := findDue(now)
+	if due == nil {
+		t.Fatal("expected the new event to be due")
+	}
+
+	if due.EntryUUID != uid || due.Event != "read" || string(due.Payload) != `{"event":"read"}` || string(due.Secret) != "secret" || due.MasterKeyID != "key-id" {
+		t.Errorf("unexpected event %+v", due)
+	}
+
+	claimed, err := model.Claim(ctx, tx, event.UUID, now, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !claimed {
+		t.Error("expected the event to be claimed")
+	}
+
+	claimed, err = model.Claim(ctx, tx, event.UUID, now, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claimed {
+		t.Error("expected the claimed event not to be claimed again")
+	}
+
+	if findDue(now) != nil {
+		t.Error("expected the claimed event not to be due")
+	}
+
+	if err := model.Retry(ctx, tx, event.UUID, now.Add(time.Hour), "status code 500"); err != nil {
+		t.Fatal(err)
+	}
+
+	due = findDue(now.Add(2 * time.Hour))
+	if due == nil {
+		t.Fatal("expected the event to be due after the next attempt")
+	}
+
+	if due.Attempts != 1 || due.LastError.String != "status code 500" {
+		t.Errorf("expected 1 attempt with the last error, got %d %q", due.Attempts, due.LastError.String)
+	}
+
+	if err := model.Delete(ctx, tx, event.UUID); err != nil {
+		t.Fatal(err)
+	}
+
+	if findDue(now.Add(2*time.Hour)) != nil {
+		t.Error("expected the deleted event not to be due")
+	}
+}
@@ -0,0 +1,31 @@
+package parsers
+
+import "net/http"
+
+// ListAuditEventsRequestData is the data for the ListAuditEvents endpoint
+type ListAuditEventsRequestData struct {
+	UUID      string
+	DeleteKey string
+}
+
+// ListAuditEventsParser is the http request parser for the ListAuditEvents
+// endpoint
+type ListAuditEventsParser struct{}
+
+// NewListAuditEventsParser returns a new ListAuditEventsParser
+func NewListAuditEventsParser() ListAuditEventsParser {
+	return ListAuditEventsParser{}
+}
+
+// Parse parses the http request for the ListAuditEvents endpoint
+func (l ListAuditEventsParser) Parse(r *http.Request) (ListAuditEventsRequestData, error) {
+	UUID, deleteKey, err := parseEntryOwner(r)
+	if err != nil {
+		return ListAuditEventsRequestData{}, err
+	}
+
+	return ListAuditEventsRequestData{
+		UUID:      UUID,
+		DeleteKey: deleteKey,
+	}, nil
+}
@@ -0,0 +1,137 @@
+package parsers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// KeyHashHeader is the request header to send the hex encoded SHA-256 hash of
+// the key of a client encrypted entry
+const KeyHashHeader = "x-entry-key-hash"
+
+// ContentTypeHeader is the request header to send the content type of the
+// data before the client encrypted it
+const ContentTypeHeader = "x-entry-content-type"
+
+func getKeyHash(r *http.Request) ([]byte, error) {
+	keyHash, err := hex.DecodeString(r.Header.Get(KeyHashHeader))
+	if err != nil {
+		return nil, errors.Join(ErrInvalidKeyHash, err)
+	}
+
+	if len(keyHash) != sha256.Size {
+		return nil, ErrInvalidKeyHash
+	}
+
+	return keyHash, nil
+}
+
+// CreateClientEncryptedEntryRequestData is the data for the client encrypted
+// create endpoint
+type CreateClientEncryptedEntryRequestData struct {
+	ContentType string
+	Body        []byte
+	KeyHash     []byte
+	Expiration  time.Duration
+	MaxReads    int
+}
+
+// CreateClientEncryptedEntryParser is the http request parser for the client
+// encrypted create endpoint
+type CreateClientEncryptedEntryParser struct {
+	createEntryParser CreateEntryParser
+}
+
+// NewCreateClientEncryptedEntryParser returns a new CreateClientEncryptedEntryParser
+func NewCreateClientEncryptedEntryParser(maxExpireSeconds int) CreateClientEncryptedEntryParser {
+	return CreateClientEncryptedEntryParser{
+		createEntryParser: NewCreateEntryParser(maxExpireSeconds),
+	}
+}
+
+func getClientContentType(r *http.Request) string {
+	ct, _, err := mime.ParseMediaType(r.Header.Get(ContentTypeHeader))
+	if err != nil {
+		return "application/octet-stream"
+	}
+
+	return ct
+}
+
+// Parse reads the encrypted data from the request body
+func (c CreateClientEncryptedEntryParser) Parse(r *http.Request) (*CreateClientEncryptedEntryRequestData, error) {
+	keyHash, err := getKeyHash(r)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) == 0 {
+		return nil, ErrInvalidData
+	}
+
+	expiration, err := c.createEntryParser.getSecretExpiration(r)
+	if err != nil {
+		return nil, err
+	}
+
+	maxReads, err := c.createEntryParser.getSecretMaxReads(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreateClientEncryptedEntryRequestData{
+		ContentType: getClientContentType(r),
+		Body:        body,
+		KeyHash:     keyHash,
+		Expiration:  expiration,
+		MaxReads:    maxReads,
+	}, nil
+}
+
+// GetClientEncryptedEntryRequestData is the data for the client encrypted
+// read endpoint
+type GetClientEncryptedEntryRequestData struct {
+	UUID    string
+	KeyHash []byte
+}
+
+// GetClientEncryptedEntryParser is the http request parser for the client
+// encrypted read endpoint
+type GetClientEncryptedEntryParser struct{}
+
+// NewGetClientEncryptedEntryParser returns a new GetClientEncryptedEntryParser
+func NewGetClientEncryptedEntryParser() GetClientEncryptedEntryParser {
+	return GetClientEncryptedEntryParser{}
+}
+
+// Parse reads the entry uuid from the path and the key hash from the header
+func (g GetClientEncryptedEntryParser) Parse(r *http.Request) (GetClientEncryptedEntryRequestData, error) {
+	var reqData GetClientEncryptedEntryRequestData
+
+	UUID, err := uuid.Parse(r.PathValue("uuid"))
+	if err != nil {
+		return reqData, errors.Join(ErrInvalidUUID, err)
+	}
+
+	keyHash, err := getKeyHash(r)
+	if err != nil {
+		return reqData, err
+	}
+
+	return GetClientEncryptedEntryRequestData{
+		UUID:    UUID.String(),
+		KeyHash: keyHash,
+	}, nil
+}
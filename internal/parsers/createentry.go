@@ -1,6 +1,7 @@
 package parsers
 
 import (
+	"errors"
 	"io"
 	"mime"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/Ajnasz/sekret.link/internal/parsers/expiration"
 	"github.com/Ajnasz/sekret.link/internal/parsers/maxreads"
+	"github.com/Ajnasz/sekret.link/internal/webhook"
 )
 
 type CreateEntryParser struct {
@@ -19,6 +21,11 @@ type CreateEntryRequestData struct {
 	Body        []byte
 	Expiration  time.Duration
 	MaxReads    int
+	Passphrase  []byte
+	// WebhookURL receives the events of the entry when it is not empty
+	WebhookURL string
+	// WebhookSecret signs the webhook requests
+	WebhookSecret []byte
 }
 
 func NewCreateEntryParser(maxExpireSeconds int) CreateEntryParser {
@@ -107,6 +114,41 @@ func (c CreateEntryParser) getSecretMaxReads(r *http.Request) (int, error) {
 	return reads, nil
 }
 
+// getWebhook reads the webhook URL and secret from the headers or from the
+// webhookURL and webhookSecret fields
+func getWebhook(r *http.Request) (string, []byte, error) {
+	if err := r.ParseForm(); err != nil {
+		return "", nil, err
+	}
+
+	webhookURL := r.Header.Get(WebhookURLHeader)
+	if webhookURL == "" {
+		webhookURL = r.Form.Get("webhookURL")
+	}
+
+	secret := r.Header.Get(WebhookSecretHeader)
+	if secret == "" {
+		secret = r.Form.Get("webhookSecret")
+	}
+
+	if webhookURL == "" {
+		if secret != "" {
+			return "", nil, ErrInvalidWebhookURL
+		}
+		return "", nil, nil
+	}
+
+	if err := webhook.ValidateURL(webhookURL); err != nil {
+		return "", nil, errors.Join(ErrInvalidWebhookURL, err)
+	}
+
+	if secret == "" {
+		return webhookURL, nil, nil
+	}
+
+	return webhookURL, []byte(secret), nil
+}
+
 func (c CreateEntryParser) Parse(r *http.Request) (*CreateEntryRequestData, error) {
 	body, contentType, err := getContent(r)
 
@@ -130,11 +172,20 @@ func (c CreateEntryParser) Parse(r *http.Request) (*CreateEntryRequestData, erro
 		return nil, err
 	}
 
+	webhookURL, webhookSecret, err := getWebhook(r)
+
+	if err != nil {
+		return nil, err
+	}
+
 	return &CreateEntryRequestData{
-		ContentType: contentType,
-		Body:        body,
-		Expiration:  expiration,
-		MaxReads:    maxReads,
+		ContentType:   contentType,
+		Body:          body,
+		Expiration:    expiration,
+		MaxReads:      maxReads,
+		Passphrase:    getPassphrase(r),
+		WebhookURL:    webhookURL,
+		WebhookSecret: webhookSecret,
 	}, nil
 
 }
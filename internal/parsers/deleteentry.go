@@ -2,6 +2,7 @@ package parsers
 
 import (
 	"errors"
+	"net/http"
 	"path"
 
 	"github.com/google/uuid"
@@ -28,3 +29,21 @@ func ParseDeleteEntryPath(urlPath string) (string, string, string, error) {
 
 	return UUID.String(), keyPart, delKey, nil
 }
+
+// ParseDeleteEntryRequest returns the uuid and the delete key of the request.
+// The values are taken from the uuid and deleteKey path values when the route
+// defines them, otherwise the path is parsed.
+func ParseDeleteEntryRequest(r *http.Request) (string, string, error) {
+	deleteKey := r.PathValue("deleteKey")
+	if deleteKey == "" {
+		UUID, _, deleteKey, err := ParseDeleteEntryPath(r.URL.Path)
+		return UUID, deleteKey, err
+	}
+
+	UUID, err := uuid.Parse(r.PathValue("uuid"))
+	if err != nil {
+		return "", "", errors.Join(ErrInvalidUUID, err)
+	}
+
+	return UUID.String(), deleteKey, nil
+}
@@ -0,0 +1,86 @@
+package parsers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// ListEntryKeysRequestData is the data for the ListEntryKeys endpoint
+type ListEntryKeysRequestData struct {
+	UUID      string
+	DeleteKey string
+}
+
+// ListEntryKeysParser is the http request parser for the ListEntryKeys
+// endpoint
+type ListEntryKeysParser struct{}
+
+// NewListEntryKeysParser returns a new ListEntryKeysParser
+func NewListEntryKeysParser() ListEntryKeysParser {
+	return ListEntryKeysParser{}
+}
+
+func parseEntryOwner(r *http.Request) (string, string, error) {
+	UUID, err := uuid.Parse(r.PathValue("uuid"))
+	if err != nil {
+		return "", "", errors.Join(ErrInvalidUUID, err)
+	}
+
+	deleteKey := r.PathValue("deleteKey")
+	if deleteKey == "" {
+		return "", "", ErrInvalidKey
+	}
+
+	return UUID.String(), deleteKey, nil
+}
+
+// Parse parses the http request for the ListEntryKeys endpoint
+func (l ListEntryKeysParser) Parse(r *http.Request) (ListEntryKeysRequestData, error) {
+	UUID, deleteKey, err := parseEntryOwner(r)
+	if err != nil {
+		return ListEntryKeysRequestData{}, err
+	}
+
+	return ListEntryKeysRequestData{
+		UUID:      UUID,
+		DeleteKey: deleteKey,
+	}, nil
+}
+
+// DeleteEntryKeyRequestData is the data for the DeleteEntryKey endpoint
+type DeleteEntryKeyRequestData struct {
+	UUID      string
+	DeleteKey string
+	// KeyUUID is the uuid of the revoked entry key
+	KeyUUID string
+}
+
+// DeleteEntryKeyParser is the http request parser for the DeleteEntryKey
+// endpoint
+type DeleteEntryKeyParser struct{}
+
+// NewDeleteEntryKeyParser returns a new DeleteEntryKeyParser
+func NewDeleteEntryKeyParser() DeleteEntryKeyParser {
+	return DeleteEntryKeyParser{}
+}
+
+// Parse parses the http request for the DeleteEntryKey endpoint
+func (d DeleteEntryKeyParser) Parse(r *http.Request) (DeleteEntryKeyRequestData, error) {
+	UUID, deleteKey, err := parseEntryOwner(r)
+	if err != nil {
+		return DeleteEntryKeyRequestData{}, err
+	}
+
+	keyUUID, err := uuid.Parse(r.PathValue("keyUUID"))
+	if err != nil {
+		return DeleteEntryKeyRequestData{}, errors.Join(ErrInvalidUUID, err)
+	}
+
+	return DeleteEntryKeyRequestData{
+		UUID:      UUID,
+		DeleteKey: deleteKey,
+		KeyUUID:   keyUUID.String(),
+	}, nil
+}
@@ -25,3 +25,11 @@ var ErrInvalidUUID = errors.New("invalid UUID")
 var ErrInvalidKey = errors.New("invalid key")
 
 var ErrInvalidKeyLength = errors.New("invalid key length")
+
+// ErrInvalidKeyHash is returned when the key verification hash is missing or
+// it is not a hex encoded SHA-256 hash
+var ErrInvalidKeyHash = errors.New("invalid key hash")
+
+// ErrInvalidWebhookURL is returned when the webhook URL is not an absolute
+// http or https URL, or the webhook secret is set without a URL
+var ErrInvalidWebhookURL = errors.New("invalid webhook URL")
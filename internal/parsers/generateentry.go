@@ -17,6 +17,10 @@ type GenerateEntryKeyRequestData struct {
 	Key        key.Key
 	Expiration time.Duration
 	MaxReads   int
+	// Passphrase unlocks the existing key
+	Passphrase []byte
+	// NewPassphrase protects the generated key
+	NewPassphrase []byte
 }
 
 // GenerateEntryKeyParser is the http request parser for the GenerateEntryKey endpoint.
@@ -87,6 +91,11 @@ func (g *GenerateEntryKeyParser) Parse(r *http.Request) (GenerateEntryKeyRequest
 	reqData.Key = *keyByte
 	reqData.Expiration = expiration
 	reqData.MaxReads = maxReads
+	reqData.Passphrase = getPassphrase(r)
+
+	if newPassphrase := r.Header.Get(NewPassphraseHeader); newPassphrase != "" {
+		reqData.NewPassphrase = []byte(newPassphrase)
+	}
 
 	return reqData, nil
 }
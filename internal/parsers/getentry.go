@@ -15,9 +15,10 @@ func NewGetEntryParser() GetEntryParser {
 }
 
 type GetEntryRequestData struct {
-	UUID      string
-	KeyString string
-	Key       key.Key
+	UUID       string
+	KeyString  string
+	Key        key.Key
+	Passphrase []byte
 }
 
 func (g GetEntryParser) Parse(req *http.Request) (GetEntryRequestData, error) {
@@ -39,5 +40,10 @@ func (g GetEntryParser) Parse(req *http.Request) (GetEntryRequestData, error) {
 	if err != nil {
 		return reqData, errors.Join(ErrInvalidKey, err)
 	}
-	return GetEntryRequestData{UUID: UUID.String(), Key: *keyByte, KeyString: keyString}, nil
+	return GetEntryRequestData{
+		UUID:       UUID.String(),
+		Key:        *keyByte,
+		KeyString:  keyString,
+		Passphrase: getPassphrase(req),
+	}, nil
 }
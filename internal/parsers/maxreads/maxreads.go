@@ -2,6 +2,7 @@ package maxreads
 
 import (
 	"errors"
+	"math"
 	"strconv"
 )
 
@@ -9,6 +10,10 @@ import (
 // number is greater than the system maximum read number
 var ErrInvalidMaxRead = errors.New("Invalid max read")
 
+// Limit is the largest number of reads, the remaining reads are stored in a
+// SMALLINT column
+const Limit int = math.MaxInt16
+
 // Parse returns the maximum number of reads for a secret.
 func Parse(val string) (int, error) {
 	const minMaxReadCount int = 1
@@ -25,7 +30,7 @@ func Parse(val string) (int, error) {
 		return 0, err
 	}
 
-	if maxReads < minMaxReadCount {
+	if maxReads < minMaxReadCount || maxReads > Limit {
 		return 0, ErrInvalidMaxRead
 	}
 
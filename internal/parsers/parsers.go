@@ -10,6 +10,39 @@ type Parser[T any] interface {
 	Parse(r *http.Request) (T, error)
 }
 
+// PassphraseHeader is the request header to send the passphrase of an entry key
+const PassphraseHeader = "x-entry-passphrase"
+
+// NewPassphraseHeader is the request header to set the passphrase of a newly
+// generated entry key
+const NewPassphraseHeader = "x-entry-new-passphrase"
+
+// WebhookURLHeader is the request header to set the URL which receives the
+// events of a new entry
+const WebhookURLHeader = "x-entry-webhook-url"
+
+// WebhookSecretHeader is the request header to set the secret which signs the
+// webhook requests of a new entry
+const WebhookSecretHeader = "x-entry-webhook-secret"
+
+// getPassphrase reads the passphrase from the header or from the posted
+// passphrase form field
+func getPassphrase(r *http.Request) []byte {
+	if passphrase := r.Header.Get(PassphraseHeader); passphrase != "" {
+		return []byte(passphrase)
+	}
+
+	if r.Method != http.MethodPost {
+		return nil
+	}
+
+	if passphrase := r.PostFormValue("passphrase"); passphrase != "" {
+		return []byte(passphrase)
+	}
+
+	return nil
+}
+
 func getEntryKeyByte(keyString string) (*key.Key, error) {
 	if len(keyString) == 64 {
 		return key.FromHex(keyString)
@@ -0,0 +1,121 @@
+package parsers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/key"
+	"github.com/Ajnasz/sekret.link/internal/parsers/expiration"
+	"github.com/Ajnasz/sekret.link/internal/parsers/maxreads"
+	"github.com/google/uuid"
+)
+
+// UpdateEntryKeyRequestData is the data for the UpdateEntryKey endpoint
+// The key is identified either by the delete key of the entry and the uuid of
+// the key or by the key itself
+type UpdateEntryKeyRequestData struct {
+	UUID string
+	// DeleteKey authenticates the owner of the entry, KeyUUID selects the key
+	DeleteKey string
+	KeyUUID   string
+	// Key is set when the key is updated by its holder
+	Key        key.Key
+	Passphrase []byte
+	// Expiration and MaxReads are nil when they are not changed
+	Expiration *time.Duration
+	MaxReads   *int
+}
+
+// UpdateEntryKeyParser is the http request parser for the UpdateEntryKey
+// endpoint
+type UpdateEntryKeyParser struct {
+	maxExpireSeconds int
+}
+
+// NewUpdateEntryKeyParser returns a new UpdateEntryKeyParser
+func NewUpdateEntryKeyParser(maxExpireSeconds int) *UpdateEntryKeyParser {
+	return &UpdateEntryKeyParser{
+		maxExpireSeconds: maxExpireSeconds,
+	}
+}
+
+func (u UpdateEntryKeyParser) getExpiration(r *http.Request) (*time.Duration, error) {
+	expire := r.URL.Query().Get("expire")
+	if expire == "" {
+		return nil, nil
+	}
+
+	exp, err := expiration.Parse(expire, 0, u.maxExpireSeconds)
+	if err != nil {
+		return nil, ErrInvalidExpirationDate
+	}
+
+	return &exp, nil
+}
+
+// getMaxReads returns the new remaining reads, unlike at creation zero is
+// accepted, so a key can be disabled
+func (u UpdateEntryKeyParser) getMaxReads(r *http.Request) (*int, error) {
+	value := r.URL.Query().Get("maxReads")
+	if value == "" {
+		return nil, nil
+	}
+
+	maxReads, err := strconv.Atoi(value)
+	if err != nil || maxReads < 0 || maxReads > maxreads.Limit {
+		return nil, ErrInvalidMaxRead
+	}
+
+	return &maxReads, nil
+}
+
+// Parse parses the http request for the UpdateEntryKey endpoint
+func (u *UpdateEntryKeyParser) Parse(r *http.Request) (UpdateEntryKeyRequestData, error) {
+	var reqData UpdateEntryKeyRequestData
+
+	UUID, err := uuid.Parse(r.PathValue("uuid"))
+	if err != nil {
+		return reqData, errors.Join(ErrInvalidUUID, err)
+	}
+
+	reqData.UUID = UUID.String()
+
+	if deleteKey := r.PathValue("deleteKey"); deleteKey != "" {
+		keyUUID, err := uuid.Parse(r.PathValue("keyUUID"))
+		if err != nil {
+			return reqData, errors.Join(ErrInvalidUUID, err)
+		}
+
+		reqData.DeleteKey = deleteKey
+		reqData.KeyUUID = keyUUID.String()
+	} else {
+		keyString := r.PathValue("key")
+		if keyString == "" {
+			return reqData, ErrInvalidKey
+		}
+
+		keyByte, err := getEntryKeyByte(keyString)
+		if err != nil {
+			return reqData, errors.Join(ErrInvalidKey, err)
+		}
+
+		reqData.Key = *keyByte
+		reqData.Passphrase = getPassphrase(r)
+	}
+
+	if reqData.Expiration, err = u.getExpiration(r); err != nil {
+		return reqData, err
+	}
+
+	if reqData.MaxReads, err = u.getMaxReads(r); err != nil {
+		return reqData, err
+	}
+
+	if reqData.Expiration == nil && reqData.MaxReads == nil {
+		return reqData, ErrInvalidData
+	}
+
+	return reqData, nil
+}
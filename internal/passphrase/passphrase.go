@@ -0,0 +1,74 @@
+// Package passphrase derives key encryption keys from user provided
+// passphrases using Argon2id
+package passphrase
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+
+	"github.com/Ajnasz/sekret.link/internal/key"
+)
+
+// ErrInvalidParams occures when the stored key derivation parameters can not
+// be parsed
+var ErrInvalidParams = errors.New("invalid passphrase params")
+
+// SaltSize is the size of the random salt in bytes
+const SaltSize = 16
+
+// Params are the Argon2id cost parameters
+type Params struct {
+	// Time is the number of passes over the memory
+	Time uint32
+	// Memory is the size of the memory in KiB
+	Memory uint32
+	// Threads is the degree of parallelism
+	Threads uint8
+}
+
+// DefaultParams follows the OWASP recommendation for Argon2id
+var DefaultParams = Params{
+	Time:    2,
+	Memory:  19 * 1024,
+	Threads: 1,
+}
+
+// String encodes the parameters in the PHC string format, without salt and
+// hash, eg.: argon2id$v=19$m=19456,t=2,p=1
+func (p Params) String() string {
+	return fmt.Sprintf("argon2id$v=%d$m=%d,t=%d,p=%d", argon2.Version, p.Memory, p.Time, p.Threads)
+}
+
+// ParseParams decodes the parameters encoded by Params.String
+func ParseParams(s string) (Params, error) {
+	var p Params
+	var version int
+
+	if _, err := fmt.Sscanf(s, "argon2id$v=%d$m=%d,t=%d,p=%d", &version, &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, errors.Join(ErrInvalidParams, err)
+	}
+
+	if version != argon2.Version || p.Time == 0 || p.Memory == 0 || p.Threads == 0 {
+		return p, ErrInvalidParams
+	}
+
+	return p, nil
+}
+
+// NewSalt generates a random salt
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return salt, nil
+}
+
+// DeriveKey creates a key from the passphrase
+func DeriveKey(passphrase []byte, salt []byte, params Params) key.Key {
+	return argon2.IDKey(passphrase, salt, params.Time, params.Memory, params.Threads, uint32(key.SizeAES256))
+}
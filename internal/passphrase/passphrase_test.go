@@ -0,0 +1,63 @@
+package passphrase
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseParams(t *testing.T) {
+	params, err := ParseParams(DefaultParams.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if params != DefaultParams {
+		t.Errorf("expected: %v, actual: %v", DefaultParams, params)
+	}
+}
+
+func TestParseParamsInvalid(t *testing.T) {
+	testCases := []string{
+		"",
+		"argon2i$v=19$m=19456,t=2,p=1",
+		"argon2id$v=16$m=19456,t=2,p=1",
+		"argon2id$v=19$m=0,t=2,p=1",
+	}
+
+	for _, testCase := range testCases {
+		if _, err := ParseParams(testCase); err == nil {
+			t.Errorf("expected error for %q", testCase)
+		}
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	salt, err := NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := Params{Time: 1, Memory: 64, Threads: 1}
+
+	k := DeriveKey([]byte("passphrase"), salt, params)
+	if len(k) != 32 {
+		t.Errorf("expected 32 bytes key, got %d", len(k))
+	}
+
+	if !bytes.Equal(k, DeriveKey([]byte("passphrase"), salt, params)) {
+		t.Error("expected the same key for the same passphrase")
+	}
+
+	if bytes.Equal(k, DeriveKey([]byte("other passphrase"), salt, params)) {
+		t.Error("expected different keys for different passphrases")
+	}
+
+	otherSalt, err := NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(k, DeriveKey([]byte("passphrase"), otherSalt, params)) {
+		t.Error("expected different keys for different salts")
+	}
+}
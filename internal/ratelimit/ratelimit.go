@@ -0,0 +1,282 @@
+// Package ratelimit limits the requests and the created secrets of the
+// clients with token buckets and daily quotas
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidRate is returned when the rate can not be parsed
+var ErrInvalidRate = errors.New("invalid rate")
+
+// ErrInvalidPrefix is returned when a trusted proxy is not an ip address or
+// a CIDR prefix
+var ErrInvalidPrefix = errors.New("invalid prefix")
+
+// Rate is the number of requests allowed in a period, the requests can come
+// in a burst up to the Limit, then one is allowed in every Period/Limit
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+// IsZero reports whether the rate is unlimited
+func (r Rate) IsZero() bool {
+	return r.Limit == 0
+}
+
+// interval is the time while one token is refilled
+func (r Rate) interval() time.Duration {
+	return r.Period / time.Duration(r.Limit)
+}
+
+// ParseRate parses the rate in limit/period format, eg.: 10/1m or 100/h, an
+// empty string or 0 means unlimited
+func ParseRate(value string) (Rate, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" {
+		return Rate{}, nil
+	}
+
+	limitValue, periodValue, ok := strings.Cut(value, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("%w: %q, expected limit/period", ErrInvalidRate, value)
+	}
+
+	limit, err := strconv.Atoi(limitValue)
+	if err != nil || limit < 0 {
+		return Rate{}, fmt.Errorf("%w: %q, the limit must be a non negative integer", ErrInvalidRate, value)
+	}
+
+	// allow the unit without a number, eg.: 10/m
+	if periodValue != "" && (periodValue[0] < '0' || periodValue[0] > '9') {
+		periodValue = "1" + periodValue
+	}
+
+	period, err := time.ParseDuration(periodValue)
+	if err != nil || period <= 0 {
+		return Rate{}, fmt.Errorf("%w: %q, the period must be a positive duration", ErrInvalidRate, value)
+	}
+
+	if limit == 0 {
+		return Rate{}, nil
+	}
+
+	return Rate{Limit: limit, Period: period}, nil
+}
+
+// ParsePrefixes parses the comma separated list of ip addresses and CIDR
+// prefixes
+func ParsePrefixes(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if addr, err := netip.ParseAddr(item); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidPrefix, item)
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Limiter is a token bucket rate limiter, every key has its own bucket
+type Limiter struct {
+	rate    Rate
+	now     func() time.Time
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	pruned  time.Time
+}
+
+// NewLimiter creates a Limiter
+func NewLimiter(rate Rate) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// WithClock sets the function which returns the current time, for testing
+func (l *Limiter) WithClock(now func() time.Time) *Limiter {
+	l.now = now
+	return l
+}
+
+// prune removes the buckets which are full again, the missing buckets are
+// created full, so it is the same as keeping them
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < l.rate.Period {
+		return
+	}
+
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= l.rate.Period {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.pruned = now
+}
+
+// Allow takes a token from the bucket of the key, when the bucket is empty
+// it returns false and the time after the next token is available
+func (l *Limiter) Allow(key string) (time.Duration, bool) {
+	if l.rate.IsZero() {
+		return 0, true
+	}
+
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.rate.Limit), updated: now}
+		l.buckets[key] = b
+	}
+
+	interval := l.rate.interval()
+	b.tokens = min(float64(l.rate.Limit), b.tokens+float64(now.Sub(b.updated))/float64(interval))
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+
+	return time.Duration((1 - b.tokens) * float64(interval)), false
+}
+
+type usage struct {
+	bytes   int64
+	entries int
+}
+
+// Quota limits the size and the number of the secrets a key can create in a
+// day, the days start at midnight UTC
+type Quota struct {
+	maxBytes   int64
+	maxEntries int
+	now        func() time.Time
+	mu         sync.Mutex
+	day        time.Time
+	usage      map[string]*usage
+}
+
+// NewQuota creates a Quota, 0 means unlimited
+func NewQuota(maxBytes int64, maxEntries int) *Quota {
+	return &Quota{
+		maxBytes:   maxBytes,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		usage:      map[string]*usage{},
+	}
+}
+
+// WithClock sets the function which returns the current time, for testing
+func (q *Quota) WithClock(now func() time.Time) *Quota {
+	q.now = now
+	return q
+}
+
+// IsZero reports whether the quota is unlimited
+func (q *Quota) IsZero() bool {
+	return q.maxBytes == 0 && q.maxEntries == 0
+}
+
+// today returns the current day, the usage is reset when the day changes
+func (q *Quota) today() (time.Time, time.Time) {
+	now := q.now().UTC()
+	day := now.Truncate(24 * time.Hour)
+	if !day.Equal(q.day) {
+		q.day = day
+		q.usage = map[string]*usage{}
+	}
+
+	return now, day
+}
+
+// Reserve records a secret of the size for the key when the quota allows
+// it. The check and the record are one step, so the concurrent requests of a
+// key can not exceed the quota together. When the quota is exceeded it
+// returns the time until the quota resets
+func (q *Quota) Reserve(key string, size int64) (time.Duration, bool) {
+	if q.IsZero() {
+		return 0, true
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now, day := q.today()
+
+	u, ok := q.usage[key]
+	if !ok {
+		u = &usage{}
+	}
+
+	if (q.maxEntries > 0 && u.entries >= q.maxEntries) || (q.maxBytes > 0 && u.bytes+size > q.maxBytes) {
+		return day.Add(24 * time.Hour).Sub(now), false
+	}
+
+	u.bytes += size
+	u.entries++
+	q.usage[key] = u
+
+	return 0, true
+}
+
+// Settle finishes the reservation of a secret: the reservation is given back
+// when the secret was not created, otherwise the reserved size is replaced by
+// the used one
+func (q *Quota) Settle(key string, reserved int64, used int64, created bool) {
+	if q.IsZero() {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.today()
+
+	// the usage is reset when the day changed since the reservation
+	u, ok := q.usage[key]
+	if !ok {
+		return
+	}
+
+	if created {
+		u.bytes = max(0, u.bytes-reserved+used)
+		return
+	}
+
+	u.bytes = max(0, u.bytes-reserved)
+	u.entries = max(0, u.entries-1)
+}
@@ -0,0 +1,221 @@
+package ratelimit
+
+import (
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func TestParseRate(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected Rate
+		err      error
+	}{
+		{value: "", expected: Rate{}},
+		{value: "0", expected: Rate{}},
+		{value: "0/m", expected: Rate{}},
+		{value: "10/1m", expected: Rate{Limit: 10, Period: time.Minute}},
+		{value: "10/m", expected: Rate{Limit: 10, Period: time.Minute}},
+		{value: "100/24h", expected: Rate{Limit: 100, Period: 24 * time.Hour}},
+		{value: "10", err: ErrInvalidRate},
+		{value: "a/m", err: ErrInvalidRate},
+		{value: "-1/m", err: ErrInvalidRate},
+		{value: "10/0s", err: ErrInvalidRate},
+		{value: "10/day", err: ErrInvalidRate},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			rate, err := ParseRate(tc.value)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, rate)
+		})
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes("10.0.0.0/8, 192.168.1.1,::1,")
+	assert.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.168.1.1/32"),
+		netip.MustParsePrefix("::1/128"),
+	}, prefixes)
+
+	prefixes, err = ParsePrefixes("")
+	assert.NoError(t, err)
+	assert.Empty(t, prefixes)
+
+	_, err = ParsePrefixes("10.0.0.0/8,localhost")
+	assert.ErrorIs(t, err, ErrInvalidPrefix)
+}
+
+func TestLimiter(t *testing.T) {
+	c := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := NewLimiter(Rate{Limit: 2, Period: time.Minute}).WithClock(c.Now)
+
+	for i := 0; i < 2; i++ {
+		_, ok := limiter.Allow("a")
+		assert.True(t, ok)
+	}
+
+	retryAfter, ok := limiter.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 30*time.Second, retryAfter)
+
+	_, ok = limiter.Allow("b")
+	assert.True(t, ok, "the keys have their own buckets")
+
+	c.now = c.now.Add(10 * time.Second)
+	retryAfter, ok = limiter.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 20*time.Second, retryAfter)
+
+	c.now = c.now.Add(20 * time.Second)
+	_, ok = limiter.Allow("a")
+	assert.True(t, ok, "a token is refilled in every 30 seconds")
+
+	_, ok = limiter.Allow("a")
+	assert.False(t, ok)
+
+	c.now = c.now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		_, ok := limiter.Allow("a")
+		assert.True(t, ok)
+	}
+
+	_, ok = limiter.Allow("a")
+	assert.False(t, ok, "the bucket is not filled over the limit")
+}
+
+func TestLimiter_Prune(t *testing.T) {
+	c := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := NewLimiter(Rate{Limit: 1, Period: time.Minute}).WithClock(c.Now)
+
+	limiter.Allow("a")
+	limiter.Allow("b")
+	assert.Len(t, limiter.buckets, 2)
+
+	c.now = c.now.Add(time.Minute)
+	limiter.Allow("c")
+	assert.Len(t, limiter.buckets, 1)
+}
+
+func TestLimiter_Unlimited(t *testing.T) {
+	limiter := NewLimiter(Rate{})
+	for i := 0; i < 100; i++ {
+		_, ok := limiter.Allow("a")
+		assert.True(t, ok)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	c := &clock{now: time.Date(2024, 1, 1, 18, 0, 0, 0, time.UTC)}
+
+	t.Run("entries", func(t *testing.T) {
+		quota := NewQuota(0, 2).WithClock(c.Now)
+		for i := 0; i < 2; i++ {
+			_, ok := quota.Reserve("a", 10)
+			assert.True(t, ok)
+		}
+
+		retryAfter, ok := quota.Reserve("a", 10)
+		assert.False(t, ok)
+		assert.Equal(t, 6*time.Hour, retryAfter)
+
+		_, ok = quota.Reserve("b", 10)
+		assert.True(t, ok)
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		quota := NewQuota(100, 0).WithClock(c.Now)
+		_, ok := quota.Reserve("a", 101)
+		assert.False(t, ok)
+
+		_, ok = quota.Reserve("a", 60)
+		assert.True(t, ok)
+
+		_, ok = quota.Reserve("a", 41)
+		assert.False(t, ok)
+
+		_, ok = quota.Reserve("a", 40)
+		assert.True(t, ok)
+	})
+
+	t.Run("settle", func(t *testing.T) {
+		quota := NewQuota(100, 2).WithClock(c.Now)
+		_, ok := quota.Reserve("a", 0)
+		assert.True(t, ok)
+		quota.Settle("a", 0, 70, true)
+
+		_, ok = quota.Reserve("a", 31)
+		assert.False(t, ok, "the used size replaces the reserved one")
+
+		_, ok = quota.Reserve("a", 30)
+		assert.True(t, ok)
+		quota.Settle("a", 30, 30, false)
+
+		_, ok = quota.Reserve("a", 30)
+		assert.True(t, ok, "the reservation of a secret which was not created is given back")
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		quota := NewQuota(0, 10).WithClock(c.Now)
+
+		var wg sync.WaitGroup
+		var allowed atomic.Int32
+		for range 100 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, ok := quota.Reserve("a", 1); ok {
+					allowed.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(10), allowed.Load())
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		quota := NewQuota(0, 1).WithClock(c.Now)
+		_, ok := quota.Reserve("a", 10)
+		assert.True(t, ok)
+		_, ok = quota.Reserve("a", 10)
+		assert.False(t, ok)
+
+		c.now = c.now.Add(6 * time.Hour)
+		quota.Settle("a", 10, 10, false)
+		_, ok = quota.Reserve("a", 10)
+		assert.True(t, ok)
+		_, ok = quota.Reserve("a", 10)
+		assert.False(t, ok, "the reservation of the previous day is not given back to the new day")
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		quota := NewQuota(0, 0)
+		for range 1000 {
+			_, ok := quota.Reserve("a", 1000)
+			assert.True(t, ok)
+		}
+	})
+}
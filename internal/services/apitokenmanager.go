@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/hasher"
+	"github.com/Ajnasz/sekret.link/internal/models"
+)
+
+// ErrInvalidAPIToken is returned when the token does not exist or it is
+// revoked
+var ErrInvalidAPIToken = errors.New("invalid api token")
+
+// ErrAPITokenNotFound is returned when the token to revoke does not exist
+var ErrAPITokenNotFound = errors.New("api token not found")
+
+var ErrAPITokenFailed = errors.New("api token operation failed")
+
+// apiTokenPrefix makes the tokens easy to recognize, eg. by secret scanners
+const apiTokenPrefix = "sekret_"
+
+// apiTokenSize is the number of the random bytes of a token
+const apiTokenSize = 32
+
+type APITokenModel interface {
+	Create(ctx context.Context, tx *sql.Tx, name string, tokenHash []byte) (*models.APIToken, error)
+	FindByHash(ctx context.Context, tx *sql.Tx, tokenHash []byte) (*models.APIToken, error)
+	List(ctx context.Context, tx *sql.Tx) ([]models.APIToken, error)
+	Use(ctx context.Context, tx *sql.Tx, uuid string) error
+	Revoke(ctx context.Context, tx *sql.Tx, uuid string) error
+}
+
+// APIToken is a token which allows to create secrets
+type APIToken struct {
+	UUID     string
+	Name     string
+	Created  time.Time
+	LastUsed time.Time
+	Revoked  time.Time
+}
+
+func modelAPITokenToAPIToken(m *models.APIToken) *APIToken {
+	return &APIToken{
+		UUID:     m.UUID,
+		Name:     m.Name,
+		Created:  m.Created,
+		LastUsed: m.LastUsed.Time,
+		Revoked:  m.Revoked.Time,
+	}
+}
+
+// APITokenManager issues, verifies and revokes the api tokens, only the hash
+// of the tokens is stored
+type APITokenManager struct {
+	db     *sql.DB
+	model  APITokenModel
+	hasher hasher.Hasher
+}
+
+func NewAPITokenManager(db *sql.DB, model APITokenModel, hasher hasher.Hasher) *APITokenManager {
+	return &APITokenManager{
+		db:     db,
+		model:  model,
+		hasher: hasher,
+	}
+}
+
+func generateAPIToken() (string, error) {
+	b := make([]byte, apiTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return apiTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Issue creates a new token, the returned token is not stored, it can not be
+// queried later
+func (a *APITokenManager) Issue(ctx context.Context, name string) (*APIToken, string, error) {
+	token, err := generateAPIToken()
+	if err != nil {
+		return nil, "", errors.Join(ErrAPITokenFailed, err)
+	}
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, "", errors.Join(ErrAPITokenFailed, err)
+	}
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	apiToken, err := a.model.Create(ctx, tx, name, a.hasher.Hash([]byte(token)))
+	if err != nil {
+		return nil, "", errors.Join(ErrAPITokenFailed, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, "", errors.Join(ErrAPITokenFailed, err)
+	}
+	tx = nil
+
+	return modelAPITokenToAPIToken(apiToken), token, nil
+}
+
+// Verify returns the token if it is valid and records its usage
+func (a *APITokenManager) Verify(ctx context.Context, token string) (*APIToken, error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return nil, ErrInvalidAPIToken
+	}
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Join(ErrAPITokenFailed, err)
+	}
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	apiToken, err := a.model.FindByHash(ctx, tx, a.hasher.Hash([]byte(token)))
+	if err != nil {
+		if errors.Is(err, models.ErrAPITokenNotFound) {
+			return nil, ErrInvalidAPIToken
+		}
+		return nil, errors.Join(ErrAPITokenFailed, err)
+	}
+
+	if err := a.model.Use(ctx, tx, apiToken.UUID); err != nil {
+		return nil, errors.Join(ErrAPITokenFailed, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Join(ErrAPITokenFailed, err)
+	}
+	tx = nil
+
+	return modelAPITokenToAPIToken(apiToken), nil
+}
+
+// List returns every token, the revoked ones too
+func (a *APITokenManager) List(ctx context.Context) ([]APIToken, error) {
+	tx, err := a.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, errors.Join(ErrAPITokenFailed, err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	apiTokens, err := a.model.List(ctx, tx)
+	if err != nil {
+		return nil, errors.Join(ErrAPITokenFailed, err)
+	}
+
+	tokens := make([]APIToken, 0, len(apiTokens))
+	for _, apiToken := range apiTokens {
+		tokens = append(tokens, *modelAPITokenToAPIToken(&apiToken))
+	}
+
+	return tokens, nil
+}
+
+// Revoke revokes the token by its uuid
+func (a *APITokenManager) Revoke(ctx context.Context, uuid string) error {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Join(ErrAPITokenFailed, err)
+	}
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err := a.model.Revoke(ctx, tx, uuid); err != nil {
+		if errors.Is(err, models.ErrAPITokenNotFound) {
+			return ErrAPITokenNotFound
+		}
+		return errors.Join(ErrAPITokenFailed, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Join(ErrAPITokenFailed, err)
+	}
+	tx = nil
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/Ajnasz/sekret.link/internal/hasher"
+	"github.com/Ajnasz/sekret.link/internal/models"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAPITokenModel struct {
+	mock.Mock
+}
+
+func (m *MockAPITokenModel) Create(ctx context.Context, tx *sql.Tx, name string, tokenHash []byte) (*models.APIToken, error) {
+	args := m.Called(ctx, tx, name, tokenHash)
+	return args.Get(0).(*models.APIToken), args.Error(1)
+}
+
+func (m *MockAPITokenModel) FindByHash(ctx context.Context, tx *sql.Tx, tokenHash []byte) (*models.APIToken, error) {
+	args := m.Called(ctx, tx, tokenHash)
+	return args.Get(0).(*models.APIToken), args.Error(1)
+}
+
+func (m *MockAPITokenModel) List(ctx context.Context, tx *sql.Tx) ([]models.APIToken, error) {
+	args := m.Called(ctx, tx)
+	return args.Get(0).([]models.APIToken), args.Error(1)
+}
+
+func (m *MockAPITokenModel) Use(ctx context.Context, tx *sql.Tx, uuid string) error {
+	args := m.Called(ctx, tx, uuid)
+	return args.Error(0)
+}
+
+func (m *MockAPITokenModel) Revoke(ctx context.Context, tx *sql.Tx, uuid string) error {
+	args := m.Called(ctx, tx, uuid)
+	return args.Error(0)
+}
+
+func Test_APITokenManager_IssueVerify(t *testing.T) {
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	tokenHasher := hasher.NewSHA256Hasher()
+	model := new(MockAPITokenModel)
+	manager := NewAPITokenManager(db, model, tokenHasher)
+
+	var storedHash []byte
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectCommit()
+	model.On("Create", ctx, mock.Anything, "ci", mock.Anything).
+		Run(func(args mock.Arguments) {
+			storedHash = args.Get(3).([]byte)
+		}).
+		Return(&models.APIToken{UUID: "token-uuid", Name: "ci"}, nil)
+
+	apiToken, token, err := manager.Issue(ctx, "ci")
+	assert.NoError(t, err)
+	assert.Equal(t, "token-uuid", apiToken.UUID)
+	assert.True(t, strings.HasPrefix(token, apiTokenPrefix))
+	assert.Equal(t, tokenHasher.Hash([]byte(token)), storedHash)
+	assert.NotContains(t, string(storedHash), token)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectCommit()
+	model.On("FindByHash", ctx, mock.Anything, storedHash).Return(&models.APIToken{UUID: "token-uuid", Name: "ci"}, nil)
+	model.On("Use", ctx, mock.Anything, "token-uuid").Return(nil)
+
+	verified, err := manager.Verify(ctx, token)
+	assert.NoError(t, err)
+	assert.Equal(t, "ci", verified.Name)
+
+	model.AssertExpectations(t)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_APITokenManager_VerifyInvalid(t *testing.T) {
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	model := new(MockAPITokenModel)
+	manager := NewAPITokenManager(db, model, hasher.NewSHA256Hasher())
+
+	_, err = manager.Verify(ctx, "not a token")
+	assert.ErrorIs(t, err, ErrInvalidAPIToken)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectRollback()
+	model.On("FindByHash", ctx, mock.Anything, mock.Anything).Return((*models.APIToken)(nil), models.ErrAPITokenNotFound)
+
+	_, err = manager.Verify(ctx, apiTokenPrefix+"revoked")
+	assert.ErrorIs(t, err, ErrInvalidAPIToken)
+
+	model.AssertExpectations(t)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_APITokenManager_Revoke(t *testing.T) {
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	model := new(MockAPITokenModel)
+	manager := NewAPITokenManager(db, model, hasher.NewSHA256Hasher())
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectCommit()
+	model.On("Revoke", ctx, mock.Anything, "token-uuid").Return(nil).Once()
+	assert.NoError(t, manager.Revoke(ctx, "token-uuid"))
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectRollback()
+	model.On("Revoke", ctx, mock.Anything, "missing").Return(models.ErrAPITokenNotFound).Once()
+	assert.ErrorIs(t, manager.Revoke(ctx, "missing"), ErrAPITokenNotFound)
+
+	model.AssertExpectations(t)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+}
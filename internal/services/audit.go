@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/metrics"
+	"github.com/Ajnasz/sekret.link/internal/models"
+)
+
+// ErrAuditDisabled is returned when the audit log is requested but it is not
+// recorded
+var ErrAuditDisabled = errors.New("audit log disabled")
+
+// ErrAuditExportFailed is returned when the audit log can not be exported
+var ErrAuditExportFailed = errors.New("audit export failed")
+
+// AuditEventType is the type of the events in the audit log
+type AuditEventType string
+
+const (
+	// AuditCreated is recorded when the entry is created
+	AuditCreated AuditEventType = "created"
+	// AuditRead is recorded when the entry is read
+	AuditRead AuditEventType = "read"
+	// AuditDeleted is recorded when the entry is deleted with the delete key
+	AuditDeleted AuditEventType = "deleted"
+	// AuditKeyCreated is recorded when a new key is generated for the entry
+	AuditKeyCreated AuditEventType = "key_created"
+	// AuditExpired is recorded when the expired entry is removed by the
+	// cleanup
+	AuditExpired AuditEventType = "expired"
+	// AuditLocked is recorded when the entry is locked or deleted after too
+	// many failed key attempts
+	AuditLocked AuditEventType = "locked"
+)
+
+// maxUserAgentLength is the maximum length of the user agent stored in the
+// audit log
+const maxUserAgentLength = 512
+
+// auditExportBatchSize is the number of the events read in one transaction
+// by the export
+const auditExportBatchSize = 1000
+
+// ClientInfo identifies the client of a request in the audit log
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+type clientInfoContextKey struct{}
+
+// ContextWithClientInfo returns a context which carries the client info
+func ContextWithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoContextKey{}, info)
+}
+
+// ClientInfoFromContext returns the client info of the context, it is empty
+// for the background jobs
+func ClientInfoFromContext(ctx context.Context) ClientInfo {
+	info, _ := ctx.Value(clientInfoContextKey{}).(ClientInfo)
+	return info
+}
+
+// AuditEvent is an event of the audit log
+type AuditEvent struct {
+	UUID      string
+	EntryUUID string
+	KeyUUID   string
+	Event     AuditEventType
+	Created   time.Time
+	ClientIP  string
+	UserAgent string
+}
+
+func modelAuditEventToAuditEvent(m models.AuditEvent) AuditEvent {
+	return AuditEvent{
+		UUID:      m.UUID,
+		EntryUUID: m.EntryUUID,
+		KeyUUID:   m.KeyUUID.String,
+		Event:     AuditEventType(m.Event),
+		Created:   m.Created,
+		ClientIP:  m.ClientIP,
+		UserAgent: m.UserAgent,
+	}
+}
+
+// AuditModel stores the audit log
+type AuditModel interface {
+	Create(ctx context.Context, tx *sql.Tx, entryUUID string, keyUUID string, event string, clientIP string, userAgent string) (*models.AuditEvent, error)
+	ListByEntry(ctx context.Context, tx *sql.Tx, entryUUID string) ([]models.AuditEvent, error)
+	List(ctx context.Context, tx *sql.Tx, since time.Time, afterUUID string, limit int) ([]models.AuditEvent, error)
+}
+
+// AuditRecorder records the events of the entries in the transaction of the
+// change, so the log contains only the committed changes
+type AuditRecorder interface {
+	RecordTx(ctx context.Context, tx *sql.Tx, event AuditEventType, entryUUID string, keyUUID string) error
+	ListTx(ctx context.Context, tx *sql.Tx, entryUUID string) ([]AuditEvent, error)
+}
+
+// AuditLog records the lifecycle of the entries, the content of the entries
+// and the keys are never recorded
+type AuditLog struct {
+	db    *sql.DB
+	model AuditModel
+}
+
+// NewAuditLog creates an AuditLog, the db is used by the export only
+func NewAuditLog(db *sql.DB, model AuditModel) *AuditLog {
+	return &AuditLog{db: db, model: model}
+}
+
+// RecordTx appends the event with the client info of the context to the log
+func (a *AuditLog) RecordTx(ctx context.Context, tx *sql.Tx, event AuditEventType, entryUUID string, keyUUID string) error {
+	client := ClientInfoFromContext(ctx)
+	userAgent := client.UserAgent
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	_, err := a.model.Create(ctx, tx, entryUUID, keyUUID, string(event), client.IP, userAgent)
+	return err
+}
+
+// ListTx returns the events of the entry, the oldest first
+func (a *AuditLog) ListTx(ctx context.Context, tx *sql.Tx, entryUUID string) ([]AuditEvent, error) {
+	rows, err := a.model.ListByEntry(ctx, tx, entryUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]AuditEvent, 0, len(rows))
+	for _, row := range rows {
+		events = append(events, modelAuditEventToAuditEvent(row))
+	}
+
+	return events, nil
+}
+
+// EntryLocked records the lockout of the entry
+func (a *AuditLog) EntryLocked(ctx context.Context, tx *sql.Tx, entryUUID string, _ int, _ LockoutAction) error {
+	return a.RecordTx(ctx, tx, AuditLocked, entryUUID, "")
+}
+
+// listPage returns the events after the last exported event
+func (a *AuditLog) listPage(ctx context.Context, since time.Time, afterUUID string) ([]models.AuditEvent, error) {
+	tx, err := a.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer metrics.TransactionTimer("export_audit_log").ObserveDuration()
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	rows, err := a.model.List(ctx, tx, since, afterUUID, auditExportBatchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	tx = nil
+
+	return rows, nil
+}
+
+// Export calls fn with every event created at or after since, the oldest
+// first
+func (a *AuditLog) Export(ctx context.Context, since time.Time, fn func(AuditEvent) error) error {
+	afterUUID := ""
+	for {
+		rows, err := a.listPage(ctx, since, afterUUID)
+		if err != nil {
+			return errors.Join(ErrAuditExportFailed, err)
+		}
+
+		for _, row := range rows {
+			if err := fn(modelAuditEventToAuditEvent(row)); err != nil {
+				return err
+			}
+		}
+
+		if len(rows) < auditExportBatchSize {
+			return nil
+		}
+
+		last := rows[len(rows)-1]
+		since, afterUUID = last.Created, last.UUID
+	}
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/models"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAuditRecorder struct {
+	mock.Mock
+}
+
+func (m *MockAuditRecorder) RecordTx(ctx context.Context, tx *sql.Tx, event AuditEventType, entryUUID string, keyUUID string) error {
+	args := m.Called(ctx, tx, event, entryUUID, keyUUID)
+	return args.Error(0)
+}
+
+func (m *MockAuditRecorder) ListTx(ctx context.Context, tx *sql.Tx, entryUUID string) ([]AuditEvent, error) {
+	args := m.Called(ctx, tx, entryUUID)
+	return args.Get(0).([]AuditEvent), args.Error(1)
+}
+
+type MockAuditModel struct {
+	mock.Mock
+}
+
+func (m *MockAuditModel) Create(ctx context.Context, tx *sql.Tx, entryUUID string, keyUUID string, event string, clientIP string, userAgent string) (*models.AuditEvent, error) {
+	args := m.Called(ctx, tx, entryUUID, keyUUID, event, clientIP, userAgent)
+	return &models.AuditEvent{EntryUUID: entryUUID, Event: event}, args.Error(0)
+}
+
+func (m *MockAuditModel) ListByEntry(ctx context.Context, tx *sql.Tx, entryUUID string) ([]models.AuditEvent, error) {
+	args := m.Called(ctx, tx, entryUUID)
+	return args.Get(0).([]models.AuditEvent), args.Error(1)
+}
+
+func (m *MockAuditModel) List(ctx context.Context, tx *sql.Tx, since time.Time, afterUUID string, limit int) ([]models.AuditEvent, error) {
+	args := m.Called(ctx, tx, since, afterUUID, limit)
+	return args.Get(0).([]models.AuditEvent), args.Error(1)
+}
+
+func TestAuditLog_RecordTx(t *testing.T) {
+	t.Run("with client info", func(t *testing.T) {
+		ctx := ContextWithClientInfo(context.Background(), ClientInfo{IP: "192.0.2.1", UserAgent: strings.Repeat("a", 600)})
+
+		model := &MockAuditModel{}
+		model.On("Create", ctx, mock.Anything, "entry", "key", "read", "192.0.2.1", strings.Repeat("a", maxUserAgentLength)).Return(nil)
+
+		err := NewAuditLog(nil, model).RecordTx(ctx, nil, AuditRead, "entry", "key")
+
+		assert.NoError(t, err)
+		model.AssertExpectations(t)
+	})
+
+	t.Run("without client info", func(t *testing.T) {
+		ctx := context.Background()
+
+		model := &MockAuditModel{}
+		model.On("Create", ctx, mock.Anything, "entry", "", "expired", "", "").Return(nil)
+
+		err := NewAuditLog(nil, model).RecordTx(ctx, nil, AuditExpired, "entry", "")
+
+		assert.NoError(t, err)
+		model.AssertExpectations(t)
+	})
+}
+
+func TestAuditLog_EntryLocked(t *testing.T) {
+	ctx := context.Background()
+
+	model := &MockAuditModel{}
+	model.On("Create", ctx, mock.Anything, "entry", "", "locked", "", "").Return(nil)
+
+	err := NewAuditLog(nil, model).EntryLocked(ctx, nil, "entry", 3, LockoutLock)
+
+	assert.NoError(t, err)
+	model.AssertExpectations(t)
+}
+
+func TestAuditLog_Export(t *testing.T) {
+	ctx := context.Background()
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	firstPage := make([]models.AuditEvent, auditExportBatchSize)
+	for i := range firstPage {
+		firstPage[i] = models.AuditEvent{UUID: "first", EntryUUID: "entry", Event: "created", Created: since}
+	}
+	last := models.AuditEvent{UUID: "last", EntryUUID: "entry", Event: "read", Created: since.Add(time.Minute), KeyUUID: sql.NullString{String: "key", Valid: true}}
+	firstPage[len(firstPage)-1] = last
+
+	model := &MockAuditModel{}
+	model.On("List", ctx, mock.Anything, since, "", auditExportBatchSize).Return(firstPage, nil)
+	model.On("List", ctx, mock.Anything, last.Created, last.UUID, auditExportBatchSize).Return([]models.AuditEvent{{UUID: "next", Event: "deleted"}}, nil)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectCommit()
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectCommit()
+
+	var exported []AuditEvent
+	err = NewAuditLog(db, model).Export(ctx, since, func(event AuditEvent) error {
+		exported = append(exported, event)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, exported, auditExportBatchSize+1)
+	assert.Equal(t, "key", exported[auditExportBatchSize-1].KeyUUID)
+	assert.Equal(t, AuditDeleted, exported[auditExportBatchSize].Event)
+	model.AssertExpectations(t)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_EntryManager_ListAuditEvents(t *testing.T) {
+	t.Run("list the events with the delete key", func(t *testing.T) {
+		db, sqlMock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectCommit()
+
+		ctx := context.Background()
+
+		entryModel := new(models.MockEntryModel)
+		entryModel.On("ReadEntryMeta", ctx, mock.Anything, "uuid").
+			Return(&models.EntryMeta{UUID: "uuid", DeleteKey: "delete_key"}, nil)
+
+		audit := new(MockAuditRecorder)
+		audit.On("ListTx", ctx, mock.Anything, "uuid").
+			Return([]AuditEvent{{EntryUUID: "uuid", Event: AuditCreated}}, nil)
+
+		service := NewEntryManager(db, entryModel, nil, nil).WithAudit(audit)
+		events, err := service.ListAuditEvents(ctx, "uuid", "delete_key")
+
+		assert.NoError(t, err)
+		assert.Len(t, events, 1)
+		entryModel.AssertExpectations(t)
+		audit.AssertExpectations(t)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid delete key", func(t *testing.T) {
+		db, sqlMock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectRollback()
+
+		ctx := context.Background()
+
+		entryModel := new(models.MockEntryModel)
+		entryModel.On("ReadEntryMeta", ctx, mock.Anything, "uuid").
+			Return(&models.EntryMeta{UUID: "uuid", DeleteKey: "delete_key"}, nil)
+
+		audit := new(MockAuditRecorder)
+
+		service := NewEntryManager(db, entryModel, nil, nil).WithAudit(audit)
+		events, err := service.ListAuditEvents(ctx, "uuid", "wrong_key")
+
+		assert.ErrorIs(t, err, ErrInvalidDeleteKey)
+		assert.Nil(t, events)
+		audit.AssertNotCalled(t, "ListTx", ctx, mock.Anything, "uuid")
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		_, err := NewEntryManager(nil, nil, nil, nil).ListAuditEvents(context.Background(), "uuid", "delete_key")
+
+		assert.ErrorIs(t, err, ErrAuditDisabled)
+	})
+}
+
+func TestDeleteEntry_Audit(t *testing.T) {
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectRollback()
+
+	ctx := context.Background()
+
+	entryModel := new(models.MockEntryModel)
+	entryModel.On("DeleteEntry", ctx, mock.Anything, "uuid", "delete_key").Return(nil)
+
+	audit := new(MockAuditRecorder)
+	audit.On("RecordTx", ctx, mock.Anything, AuditDeleted, "uuid", "").Return(errors.New("audit failed"))
+
+	err = NewEntryManager(db, entryModel, nil, nil).WithAudit(audit).DeleteEntry(ctx, "uuid", "delete_key")
+
+	assert.ErrorIs(t, err, ErrDeleteEntryFailed, "the entry must not be deleted without the audit event")
+	audit.AssertExpectations(t)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+}
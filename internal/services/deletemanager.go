@@ -4,21 +4,30 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+
+	"github.com/Ajnasz/sekret.link/internal/metrics"
 )
 
 var ErrDeleteExpiredFailed = errors.New("delete expired failed")
 
 type ExpiredEntryModel interface {
-	DeleteExpired(ctx context.Context, tx *sql.Tx) error
+	DeleteExpired(ctx context.Context, tx *sql.Tx) (int64, error)
+}
+
+// ExpiredEntriesModel removes the expired entries and returns their uuids
+type ExpiredEntriesModel interface {
+	DeleteExpiredEntries(ctx context.Context, tx *sql.Tx) ([]string, error)
 }
 
 type ExpiredEntryManager struct {
 	db            *sql.DB
-	entryModel    ExpiredEntryModel
+	entryModel    ExpiredEntriesModel
 	entryKeyModel ExpiredEntryModel
+	events        ExpiredEventRecorder
+	audit         AuditRecorder
 }
 
-func NewExpiredEntryManager(db *sql.DB, entryModel ExpiredEntryModel, entryKeyModel ExpiredEntryModel) *ExpiredEntryManager {
+func NewExpiredEntryManager(db *sql.DB, entryModel ExpiredEntriesModel, entryKeyModel ExpiredEntryModel) *ExpiredEntryManager {
 	return &ExpiredEntryManager{
 		db:            db,
 		entryModel:    entryModel,
@@ -26,13 +35,44 @@ func NewExpiredEntryManager(db *sql.DB, entryModel ExpiredEntryModel, entryKeyMo
 	}
 }
 
+// WithEvents sets the recorder of the expired events, the webhooks of the
+// removed entries are notified when it is set
+func (d *ExpiredEntryManager) WithEvents(events ExpiredEventRecorder) *ExpiredEntryManager {
+	d.events = events
+	return d
+}
+
+// WithAudit sets the audit log, the removed entries are recorded in it when
+// it is set
+func (d *ExpiredEntryManager) WithAudit(audit AuditRecorder) *ExpiredEntryManager {
+	d.audit = audit
+	return d
+}
+
+// recordExpired records the removed entries in the audit log
+func (d *ExpiredEntryManager) recordExpired(ctx context.Context, tx *sql.Tx, entryUUIDs []string) error {
+	if d.audit == nil {
+		return nil
+	}
+
+	for _, entryUUID := range entryUUIDs {
+		if err := d.audit.RecordTx(ctx, tx, AuditExpired, entryUUID, ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (d *ExpiredEntryManager) DeleteExpired(ctx context.Context) error {
 	tx, err := d.db.Begin()
 	if err != nil {
 		return errors.Join(ErrDeleteExpiredFailed, err)
 	}
+	defer metrics.TransactionTimer("delete_expired").ObserveDuration()
 
-	if err := d.entryKeyModel.DeleteExpired(ctx, tx); err != nil {
+	deletedKeys, err := d.entryKeyModel.DeleteExpired(ctx, tx)
+	if err != nil {
 		if rollbackErr := tx.Rollback(); rollbackErr != nil {
 			return errors.Join(ErrDeleteExpiredFailed, err, rollbackErr)
 		}
@@ -40,16 +80,36 @@ func (d *ExpiredEntryManager) DeleteExpired(ctx context.Context) error {
 		return errors.Join(ErrDeleteExpiredFailed, err)
 	}
 
-	if err := d.entryModel.DeleteExpired(ctx, tx); err != nil {
+	deletedEntries, err := d.entryModel.DeleteExpiredEntries(ctx, tx)
+	if err != nil {
 		if rollbackErr := tx.Rollback(); rollbackErr != nil {
 			return errors.Join(ErrDeleteExpiredFailed, err, rollbackErr)
 		}
 		return errors.Join(ErrDeleteExpiredFailed, err)
 	}
 
+	if err := d.recordExpired(ctx, tx, deletedEntries); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return errors.Join(ErrDeleteExpiredFailed, err, rollbackErr)
+		}
+		return errors.Join(ErrDeleteExpiredFailed, err)
+	}
+
+	if d.events != nil {
+		if _, err := d.events.RecordExpiredTx(ctx, tx); err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				return errors.Join(ErrDeleteExpiredFailed, err, rollbackErr)
+			}
+			return errors.Join(ErrDeleteExpiredFailed, err)
+		}
+	}
+
 	if err := tx.Commit(); err != nil {
 		return errors.Join(ErrDeleteExpiredFailed, err)
 	}
 
+	metrics.ExpiredDeleted.WithLabelValues("entry_key").Add(float64(deletedKeys))
+	metrics.ExpiredDeleted.WithLabelValues("entry").Add(float64(len(deletedEntries)))
+
 	return nil
 }
@@ -4,15 +4,124 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"encoding/binary"
 	"io"
+
+	"github.com/Ajnasz/sekret.link/internal/ciphersuite"
 )
 
+// Encrypter encrypts the data, the encrypted data can be decrypted with the
+// same additional data only
+// PlaintextSize returns the size of the decrypted data without decrypting it
 type Encrypter interface {
-	Encrypt(data []byte) ([]byte, error)
-	Decrypt(data []byte) ([]byte, error)
+	Encrypt(data []byte, additionalData []byte) ([]byte, error)
+	Decrypt(data []byte, additionalData []byte) ([]byte, error)
+	PlaintextSize(data []byte) int
+}
+
+// legacyDecrypter is implemented by the encrypters which can report that the
+// data was decrypted without its additional data
+type legacyDecrypter interface {
+	DecryptLegacy(data []byte, additionalData []byte) ([]byte, bool, error)
+}
+
+// decryptLegacy decrypts the data and reports whether it is legacy data
+// which is not bound to the additional data yet
+func decryptLegacy(crypto Encrypter, data []byte, additionalData []byte) ([]byte, bool, error) {
+	if d, ok := crypto.(legacyDecrypter); ok {
+		return d.DecryptLegacy(data, additionalData)
+	}
+
+	plaintext, err := crypto.Decrypt(data, additionalData)
+	return plaintext, false, err
+}
+
+// associatedData builds the additional data which binds the encrypted data
+// to its row, the parts are length prefixed, so they can not be shifted into
+// each other
+func associatedData(label string, parts ...string) []byte {
+	ad := binary.AppendUvarint(nil, uint64(len(label)))
+	ad = append(ad, label...)
+	for _, part := range parts {
+		ad = binary.AppendUvarint(ad, uint64(len(part)))
+		ad = append(ad, part...)
+	}
+
+	return ad
+}
+
+// entryDataAD binds the data of the entry to the entry and its content type
+func entryDataAD(entryUUID string, contentType string) []byte {
+	return associatedData("entries.data", entryUUID, contentType)
+}
+
+// entryKeyAD binds the encrypted key to its entry
+func entryKeyAD(entryUUID string) []byte {
+	return associatedData("entry_key.encrypted_key", entryUUID)
 }
 
-// AESEncrypter is a simple encrypter that uses aes to encrypt and decrypt data
+// entryKeyPassphraseAD binds the key locked with the passphrase to its entry
+func entryKeyPassphraseAD(entryUUID string) []byte {
+	return associatedData("entry_key.passphrase", entryUUID)
+}
+
+// CipherEncrypter encrypts the data with a cipher suite, the encrypted data
+// names its cipher, so the data encrypted with any registered cipher and the
+// legacy AES encrypted data can be decrypted
+type CipherEncrypter struct {
+	key          []byte
+	suite        ciphersuite.Suite
+	rejectLegacy bool
+}
+
+// NewCipherEncrypter creates a CipherEncrypter which encrypts with the suite,
+// AES-256-GCM is used when the suite is not set
+func NewCipherEncrypter(key []byte, suite ciphersuite.Suite) *CipherEncrypter {
+	if suite.IsZero() {
+		suite = ciphersuite.AES256GCM
+	}
+
+	return &CipherEncrypter{key: key, suite: suite}
+}
+
+// WithRejectLegacy rejects the legacy data which is not bound to its
+// additional data, it can be enabled when every legacy secret is read or
+// expired, the legacy secrets are bound to their entry when they are read
+func (e *CipherEncrypter) WithRejectLegacy(rejectLegacy bool) *CipherEncrypter {
+	e.rejectLegacy = rejectLegacy
+	return e
+}
+
+// Encrypt encrypts the data with the suite of the encrypter
+func (e *CipherEncrypter) Encrypt(data []byte, additionalData []byte) ([]byte, error) {
+	return ciphersuite.Seal(e.suite, e.key, data, additionalData)
+}
+
+// Decrypt decrypts the data with the suite named by the data, the legacy
+// data is decrypted without the additional data unless it is rejected
+func (e *CipherEncrypter) Decrypt(data []byte, additionalData []byte) ([]byte, error) {
+	plaintext, _, err := e.DecryptLegacy(data, additionalData)
+	return plaintext, err
+}
+
+// DecryptLegacy decrypts the data like Decrypt, and reports whether the data
+// was decrypted without the additional data
+func (e *CipherEncrypter) DecryptLegacy(data []byte, additionalData []byte) ([]byte, bool, error) {
+	if e.rejectLegacy {
+		plaintext, err := ciphersuite.OpenBound(e.key, data, additionalData)
+		return plaintext, false, err
+	}
+
+	return ciphersuite.OpenLegacy(e.key, data, additionalData)
+}
+
+// PlaintextSize returns the size of the decrypted data without decrypting it
+func (e *CipherEncrypter) PlaintextSize(data []byte) int {
+	return ciphersuite.PlaintextSize(data)
+}
+
+// AESEncrypter is a simple encrypter that uses aes to encrypt and decrypt data,
+// the encrypted data has no header
 type AESEncrypter struct {
 	Key []byte
 }
@@ -27,8 +136,15 @@ func (e *AESEncrypter) WithKey(key []byte) *AESEncrypter {
 	return e
 }
 
+// PlaintextSize returns the size of the decrypted data without decrypting it,
+// the encryption adds the nonce and the authentication tag to the data
+func (e *AESEncrypter) PlaintextSize(data []byte) int {
+	const nonceSize, tagSize = 12, 16
+	return max(len(data)-nonceSize-tagSize, 0)
+}
+
 // Encrypt will encrypt the data with the AESEncrypter.Key
-func (e *AESEncrypter) Encrypt(data []byte) ([]byte, error) {
+func (e *AESEncrypter) Encrypt(data []byte, additionalData []byte) ([]byte, error) {
 	block, err := aes.NewCipher(e.Key)
 	if err != nil {
 		return nil, err
@@ -44,11 +160,11 @@ func (e *AESEncrypter) Encrypt(data []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	return aesGCM.Seal(nonce, nonce, data, nil), nil
+	return aesGCM.Seal(nonce, nonce, data, additionalData), nil
 }
 
 // Decrypt will dencrypt the data with the AESEncrypter.Key
-func (e *AESEncrypter) Decrypt(data []byte) ([]byte, error) {
+func (e *AESEncrypter) Decrypt(data []byte, additionalData []byte) ([]byte, error) {
 	block, err := aes.NewCipher(e.Key)
 	if err != nil {
 		return nil, err
@@ -60,10 +176,13 @@ func (e *AESEncrypter) Decrypt(data []byte) ([]byte, error) {
 	}
 
 	nonceSize := aesGCM.NonceSize()
+	if len(data) < nonceSize {
+		return nil, ciphersuite.ErrInvalidBlob
+	}
 
 	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
 
-	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, additionalData)
 	if err != nil {
 		return nil, err
 	}
@@ -1,7 +1,10 @@
 package services
 
 import (
+	"errors"
 	"testing"
+
+	"github.com/Ajnasz/sekret.link/internal/ciphersuite"
 )
 
 func Test_Encrypter_Encrypt(t *testing.T) {
@@ -10,7 +13,7 @@ func Test_Encrypter_Encrypt(t *testing.T) {
 
 	encrypter := NewAESEncrypter(encKey)
 
-	data, err := encrypter.Encrypt([]byte(testData))
+	data, err := encrypter.Encrypt([]byte(testData), nil)
 
 	if err != nil {
 		t.Fatal(err)
@@ -35,7 +38,7 @@ func Test_Encrypter_Decrypt(t *testing.T) {
 
 	encrypter := NewAESEncrypter(encKey)
 
-	data, err := encrypter.Encrypt([]byte(testData))
+	data, err := encrypter.Encrypt([]byte(testData), nil)
 
 	if err != nil {
 		t.Fatal(err)
@@ -45,7 +48,7 @@ func Test_Encrypter_Decrypt(t *testing.T) {
 		t.Error("Encrypted data is nil")
 	}
 
-	decrypted, err := encrypter.Decrypt(data)
+	decrypted, err := encrypter.Decrypt(data, nil)
 
 	if err != nil {
 		t.Fatal(err)
@@ -56,3 +59,123 @@ func Test_Encrypter_Decrypt(t *testing.T) {
 		t.Errorf("Decryption failed, expected %q, got %s", testData, actual)
 	}
 }
+
+func Test_Encrypter_PlaintextSize(t *testing.T) {
+	testData := "Lorem ipsum dolor sit amet"
+	encKey := []byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+
+	encrypters := map[string]Encrypter{
+		"aes":    NewAESEncrypter(encKey),
+		"cipher": NewCipherEncrypter(encKey, ciphersuite.XChaCha20Poly1305),
+	}
+
+	for name, encrypter := range encrypters {
+		t.Run(name, func(t *testing.T) {
+			data, err := encrypter.Encrypt([]byte(testData), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if size := encrypter.PlaintextSize(data); size != len(testData) {
+				t.Errorf("expected size %d, got %d", len(testData), size)
+			}
+		})
+	}
+}
+
+func Test_CipherEncrypter(t *testing.T) {
+	testData := "Lorem ipsum dolor sit amet"
+	encKey := []byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+
+	legacy, err := NewAESEncrypter(encKey).Encrypt([]byte(testData), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xchacha, err := NewCipherEncrypter(encKey, ciphersuite.XChaCha20Poly1305).Encrypt([]byte(testData), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the default encrypter decrypts the data of every cipher
+	encrypter := NewCipherEncrypter(encKey, ciphersuite.Suite{})
+	for name, data := range map[string][]byte{"legacy": legacy, "xchacha20-poly1305": xchacha} {
+		decrypted, err := encrypter.Decrypt(data, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if string(decrypted) != testData {
+			t.Errorf("%s: expected %q, got %q", name, testData, decrypted)
+		}
+
+		if size := encrypter.PlaintextSize(data); size != len(testData) {
+			t.Errorf("%s: expected size %d, got %d", name, len(testData), size)
+		}
+	}
+
+	if _, err := NewAESEncrypter(encKey).Decrypt([]byte("short"), nil); err == nil {
+		t.Error("expected error on short data")
+	}
+}
+
+func Test_CipherEncrypter_AssociatedData(t *testing.T) {
+	testData := "Lorem ipsum dolor sit amet"
+	encKey := []byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+
+	encrypter := NewCipherEncrypter(encKey, ciphersuite.Suite{})
+	data, err := encrypter.Encrypt([]byte(testData), entryDataAD("uuid", "text/plain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := encrypter.Decrypt(data, entryDataAD("uuid", "text/plain")); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, ad := range map[string][]byte{
+		"other entry":        entryDataAD("other", "text/plain"),
+		"other content type": entryDataAD("uuid", "text/html"),
+		"shifted parts":      entryDataAD("uuidtext/", "plain"),
+		"entry key":          entryKeyAD("uuid"),
+	} {
+		if _, err := encrypter.Decrypt(data, ad); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	legacy, err := NewAESEncrypter(encKey).Encrypt([]byte(testData), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := encrypter.Decrypt(legacy, entryDataAD("uuid", "text/plain")); err != nil {
+		t.Errorf("legacy: %s", err)
+	}
+
+	for name, tc := range map[string]struct {
+		data   []byte
+		legacy bool
+	}{
+		"bound":  {data: data, legacy: false},
+		"legacy": {data: legacy, legacy: true},
+	} {
+		_, isLegacy, err := decryptLegacy(encrypter, tc.data, entryDataAD("uuid", "text/plain"))
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+
+		if isLegacy != tc.legacy {
+			t.Errorf("%s: expected legacy %t, got %t", name, tc.legacy, isLegacy)
+		}
+	}
+
+	strict := NewCipherEncrypter(encKey, ciphersuite.Suite{}).WithRejectLegacy(true)
+	if _, err := strict.Decrypt(legacy, entryDataAD("uuid", "text/plain")); !errors.Is(err, ciphersuite.ErrLegacyBlob) {
+		t.Errorf("expected legacy blob error, got %v", err)
+	}
+
+	if _, err := strict.Decrypt(data, entryDataAD("uuid", "text/plain")); err != nil {
+		t.Errorf("strict: %s", err)
+	}
+}
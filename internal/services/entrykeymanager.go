@@ -2,18 +2,33 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"io"
 	"time"
 
 	"github.com/Ajnasz/sekret.link/internal/hasher"
 	"github.com/Ajnasz/sekret.link/internal/key"
+	"github.com/Ajnasz/sekret.link/internal/keywrapper"
+	"github.com/Ajnasz/sekret.link/internal/metrics"
 	"github.com/Ajnasz/sekret.link/internal/models"
+	"github.com/Ajnasz/sekret.link/internal/passphrase"
+	"golang.org/x/crypto/hkdf"
 )
 
 var ErrEntryKeyNotFound = errors.New("entry key not found")
 
+// ErrPassphraseRequired is returned when the entry key is protected by a
+// passphrase, but no passphrase was provided
+var ErrPassphraseRequired = errors.New("passphrase required")
+
+// ErrInvalidPassphrase is returned when the passphrase does not unlock the
+// entry key
+var ErrInvalidPassphrase = errors.New("invalid passphrase")
+
 var ErrEntryKeyDeleteFailed = errors.New("entry key delete failed")
+var ErrEntryKeyUpdateFailed = errors.New("entry key update failed")
 var ErrEntryCreateFailed = errors.New("entry create failed")
 var ErrGetDEKFailed = errors.New("get DEK failed")
 
@@ -22,31 +37,80 @@ type EntryKeyModel interface {
 		tx *sql.Tx,
 		entryUUID string,
 		encryptedKey []byte,
+		masterKeyID string,
 		hash []byte,
 		expire *time.Time,
 		remainingReads *int,
+		passphrase *models.KeyPassphrase,
 	) (*models.EntryKey, error)
 	Get(ctx context.Context, tx *sql.Tx, entryUUID string) ([]models.EntryKey, error)
 	Delete(ctx context.Context, tx *sql.Tx, uuid string) error
 	SetExpire(ctx context.Context, tx *sql.Tx, uuid string, expire time.Time) error
 	SetMaxReads(ctx context.Context, tx *sql.Tx, uuid string, maxRead int) error
 	Use(ctx context.Context, tx *sql.Tx, uuid string) error
+	AddFailedAttempt(ctx context.Context, tx *sql.Tx, uuid string) (int, error)
+	SetWrappedKey(ctx context.Context, tx *sql.Tx, uuid string, wrappedKey []byte, masterKeyID string) error
+	SetPassphraseKey(ctx context.Context, tx *sql.Tx, uuid string, wrappedKey []byte, masterKeyID string, passphrase *models.KeyPassphrase) error
 }
 
 type EntryKeyManager struct {
-	db        *sql.DB
-	model     EntryKeyModel
-	hasher    hasher.Hasher
-	encrypter EncrypterFactory
+	db                    *sql.DB
+	model                 EntryKeyModel
+	hasher                hasher.Hasher
+	encrypter             EncrypterFactory
+	keyWrapper            keywrapper.KeyWrapper
+	maxPassphraseAttempts int
+	lockModel             EntryLockModel
+	maxKeyAttempts        int
+	lockoutAction         LockoutAction
+	lockoutNotifier       LockoutNotifier
+	masterKey             MasterKey
 }
 
 func NewEntryKeyManager(db *sql.DB, model EntryKeyModel, hasher hasher.Hasher, encrypter EncrypterFactory) *EntryKeyManager {
 	return &EntryKeyManager{
-		db:        db,
-		model:     model,
-		hasher:    hasher,
-		encrypter: encrypter,
+		db:              db,
+		model:           model,
+		hasher:          hasher,
+		encrypter:       encrypter,
+		keyWrapper:      keywrapper.NewAesKeyWrapperWithPadding(),
+		lockoutAction:   LockoutLock,
+		lockoutNotifier: LogLockoutNotifier{},
+	}
+}
+
+// WithMaxPassphraseAttempts sets the number of failed passphrase attempts
+// after the entry key is deleted. Zero means unlimited attempts.
+func (e *EntryKeyManager) WithMaxPassphraseAttempts(maxPassphraseAttempts int) *EntryKeyManager {
+	e.maxPassphraseAttempts = maxPassphraseAttempts
+	return e
+}
+
+// WithKeyLockout counts the keys which do not belong to the entry in the
+// model, after maxKeyAttempts failed attempts the entry is locked or deleted
+// by the action. Zero maxKeyAttempts means unlimited attempts, an empty action
+// locks the entry.
+func (e *EntryKeyManager) WithKeyLockout(model EntryLockModel, maxKeyAttempts int, action LockoutAction) *EntryKeyManager {
+	e.lockModel = model
+	e.maxKeyAttempts = maxKeyAttempts
+	if action != "" {
+		e.lockoutAction = action
 	}
+	return e
+}
+
+// WithLockoutNotifier sets the notifier of the key lockouts, by default they
+// are logged
+func (e *EntryKeyManager) WithLockoutNotifier(notifier LockoutNotifier) *EntryKeyManager {
+	e.lockoutNotifier = notifier
+	return e
+}
+
+// WithMasterKey sets the master key which wraps the stored keys, the keys
+// are stored as they are without it
+func (e *EntryKeyManager) WithMasterKey(masterKey MasterKey) *EntryKeyManager {
+	e.masterKey = masterKey
+	return e
 }
 
 func (e *EntryKeyManager) Create(ctx context.Context,
@@ -54,14 +118,16 @@ func (e *EntryKeyManager) Create(ctx context.Context,
 	dek key.Key,
 	expire *time.Time,
 	maxRead *int,
+	passphrase []byte,
 ) (*EntryKey, key.Key, error) {
 
 	tx, err := e.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, nil, err
 	}
+	defer metrics.TransactionTimer("entry_key_create").ObserveDuration()
 
-	entryKey, k, err := e.CreateWithTx(ctx, tx, entryUUID, dek, expire, maxRead)
+	entryKey, k, err := e.CreateWithTx(ctx, tx, entryUUID, dek, expire, maxRead, passphrase)
 
 	if err != nil {
 		if rollbackErr := tx.Rollback(); rollbackErr != nil {
@@ -78,13 +144,18 @@ func (e *EntryKeyManager) Create(ctx context.Context,
 }
 
 type EntryKey struct {
-	UUID           string
-	EntryUUID      string
-	EncryptedKey   []byte
-	KeyHash        []byte
-	Created        time.Time
-	Expire         time.Time
+	UUID         string
+	EntryUUID    string
+	EncryptedKey []byte
+	KeyHash      []byte
+	Created      time.Time
+	Accessed     time.Time
+	// Expire is zero when the key does not expire
+	Expire time.Time
+	// RemainingReads is meaningful only when HasReadLimit is true
 	RemainingReads int
+	HasReadLimit   bool
+	HasPassphrase  bool
 }
 
 func modelEntryKeyToEntryKey(m *models.EntryKey) *EntryKey {
@@ -94,17 +165,85 @@ func modelEntryKeyToEntryKey(m *models.EntryKey) *EntryKey {
 		EncryptedKey:   m.EncryptedKey,
 		KeyHash:        m.KeyHash,
 		Created:        m.Created,
+		Accessed:       m.Accessed.Time,
 		Expire:         m.Expire.Time,
 		RemainingReads: int(m.RemainingReads.Int16),
+		HasReadLimit:   m.RemainingReads.Valid,
+		HasPassphrase:  m.Passphrase != nil,
+	}
+}
+
+// lockWithPassphrase encrypts the key with a key derived from the passphrase
+func (e *EntryKeyManager) lockWithPassphrase(entryUUID string, dek key.Key, pass []byte) ([]byte, *models.KeyPassphrase, error) {
+	salt, err := passphrase.NewSalt()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params := passphrase.DefaultParams
+	locked, err := e.encrypter(passphrase.DeriveKey(pass, salt, params)).Encrypt(dek, entryKeyPassphraseAD(entryUUID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return locked, &models.KeyPassphrase{Salt: salt, Params: params.String()}, nil
+}
+
+// unlockWithPassphrase decrypts the key locked by lockWithPassphrase, and
+// reports whether the key was locked before the lock was bound to its entry
+func (e *EntryKeyManager) unlockWithPassphrase(entryUUID string, locked []byte, pass []byte, keyPassphrase *models.KeyPassphrase) (key.Key, bool, error) {
+	params, err := passphrase.ParseParams(keyPassphrase.Params)
+	if err != nil {
+		return nil, false, err
+	}
+
+	dek, legacy, err := decryptLegacy(e.encrypter(passphrase.DeriveKey(pass, keyPassphrase.Salt, params)), locked, entryKeyPassphraseAD(entryUUID))
+	if err != nil {
+		return nil, false, ErrInvalidPassphrase
+	}
+
+	return dek, legacy, nil
+}
+
+// wrappingKey derives the key which wraps the data encryption key from the
+// key encryption key, so the wrapped key is bound to its entry
+func wrappingKey(kek key.Key, entryUUID string) ([]byte, error) {
+	k := make([]byte, key.SizeAES256)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, kek, entryKeyAD(entryUUID)), k); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// wrapKey wraps the key with the key derived from the key encryption key
+// and seals it with the master key
+func (e *EntryKeyManager) wrapKey(kek key.Key, entryUUID string, k []byte) (string, []byte, error) {
+	wk, err := wrappingKey(kek, entryUUID)
+	if err != nil {
+		return "", nil, err
 	}
+
+	wrapped, err := e.keyWrapper.Wrap(wk, k)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return sealBlob(e.masterKey, wrapped)
 }
 
+// CreateWithTx creates a new key encryption key and stores the data
+// encryption key wrapped with it. If a passphrase is provided the data
+// encryption key is encrypted with a key derived from the passphrase first.
+// The key wrap has an integrity check, so the wrapped keys are stored
+// without key hash.
 func (e *EntryKeyManager) CreateWithTx(ctx context.Context,
 	tx *sql.Tx,
 	entryUUID string,
 	dek key.Key,
 	expire *time.Time,
 	maxRead *int,
+	passphrase []byte,
 ) (*EntryKey, key.Key,
 	error) {
 	k, err := key.NewGeneratedKey()
@@ -112,14 +251,22 @@ func (e *EntryKeyManager) CreateWithTx(ctx context.Context,
 	if err != nil {
 		return nil, nil, errors.Join(ErrEntryCreateFailed, err)
 	}
-	encrypter := e.encrypter(k.Get())
-	encryptedKey, err := encrypter.Encrypt(dek)
+
+	lockedKey := dek.Get()
+	var keyPassphrase *models.KeyPassphrase
+	if len(passphrase) > 0 {
+		lockedKey, keyPassphrase, err = e.lockWithPassphrase(entryUUID, dek, passphrase)
+		if err != nil {
+			return nil, nil, errors.Join(ErrEntryCreateFailed, err)
+		}
+	}
+
+	masterKeyID, wrappedKey, err := e.wrapKey(*k, entryUUID, lockedKey)
 	if err != nil {
 		return nil, nil, errors.Join(ErrEntryCreateFailed, err)
 	}
 
-	hash := e.hasher.Hash(dek.Get())
-	entryKey, err := e.model.Create(ctx, tx, entryUUID, encryptedKey, hash, expire, maxRead)
+	entryKey, err := e.model.Create(ctx, tx, entryUUID, wrappedKey, masterKeyID, []byte{}, expire, maxRead, keyPassphrase)
 	if err != nil {
 		return nil, nil, errors.Join(ErrEntryCreateFailed, err)
 	}
@@ -132,6 +279,7 @@ func (e *EntryKeyManager) Delete(ctx context.Context, uuid string) error {
 	if err != nil {
 		return errors.Join(ErrEntryKeyDeleteFailed, err)
 	}
+	defer metrics.TransactionTimer("entry_key_delete").ObserveDuration()
 
 	if err := e.model.Delete(ctx, tx, uuid); err != nil {
 		if rollbackErr := tx.Rollback(); rollbackErr != nil {
@@ -147,48 +295,345 @@ func (e *EntryKeyManager) Delete(ctx context.Context, uuid string) error {
 	return nil
 }
 
+// ListTx returns the keys of the entry
+func (e *EntryKeyManager) ListTx(ctx context.Context, tx *sql.Tx, entryUUID string) ([]EntryKey, error) {
+	entryKeys, err := e.model.Get(ctx, tx, entryUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]EntryKey, 0, len(entryKeys))
+	for _, ek := range entryKeys {
+		ret = append(ret, *modelEntryKeyToEntryKey(&ek))
+	}
+
+	return ret, nil
+}
+
+// DeleteTx deletes the key of the entry, the entry and its other keys are
+// kept
+// if the key does not belong to the entry it returns ErrEntryKeyNotFound
+func (e *EntryKeyManager) DeleteTx(ctx context.Context, tx *sql.Tx, entryUUID string, keyUUID string) error {
+	entryKeys, err := e.model.Get(ctx, tx, entryUUID)
+	if err != nil {
+		return errors.Join(ErrEntryKeyDeleteFailed, err)
+	}
+
+	for _, ek := range entryKeys {
+		if ek.UUID != keyUUID {
+			continue
+		}
+
+		if err := e.model.Delete(ctx, tx, keyUUID); err != nil {
+			return errors.Join(ErrEntryKeyDeleteFailed, err)
+		}
+
+		return nil
+	}
+
+	return ErrEntryKeyNotFound
+}
+
+// UpdateTx changes the expiration and the remaining reads of the entry key,
+// the nil values are left unchanged
+func (e *EntryKeyManager) UpdateTx(ctx context.Context, tx *sql.Tx, keyUUID string, expire *time.Time, maxReads *int) error {
+	if expire != nil {
+		if err := e.model.SetExpire(ctx, tx, keyUUID, *expire); err != nil {
+			return errors.Join(ErrEntryKeyUpdateFailed, err)
+		}
+	}
+
+	if maxReads != nil {
+		if err := e.model.SetMaxReads(ctx, tx, keyUUID, *maxReads); err != nil {
+			return errors.Join(ErrEntryKeyUpdateFailed, err)
+		}
+	}
+
+	return nil
+}
+
 func (e *EntryKeyManager) UseTx(ctx context.Context, tx *sql.Tx, entryUUID string) error {
 	return e.model.Use(ctx, tx, entryUUID)
 }
 
-func (e *EntryKeyManager) findDEK(ctx context.Context, tx *sql.Tx, entryUUID string, k key.Key) (dek key.Key, entryKey *models.EntryKey, err error) {
+// CreateKeyHashWithTx stores the key verification hash of a client encrypted
+// entry. The server never sees the key, only a hash of it, which is hashed
+// again before storing, so a leaked database can not be used to read the
+// entries.
+func (e *EntryKeyManager) CreateKeyHashWithTx(ctx context.Context,
+	tx *sql.Tx,
+	entryUUID string,
+	keyHash []byte,
+	expire *time.Time,
+	maxRead *int,
+) (*EntryKey, error) {
+	entryKey, err := e.model.Create(ctx, tx, entryUUID, []byte{}, "", e.hasher.Hash(keyHash), expire, maxRead, nil)
+	if err != nil {
+		return nil, errors.Join(ErrEntryCreateFailed, err)
+	}
+
+	return modelEntryKeyToEntryKey(entryKey), nil
+}
+
+// FindByKeyHashTx returns the entry key of a client encrypted entry which
+// belongs to the key verification hash
+// if the key is not found it returns ErrEntryKeyNotFound, the failed attempt
+// is recorded in the transaction like in findDEK
+func (e *EntryKeyManager) FindByKeyHashTx(ctx context.Context, tx *sql.Tx, entryUUID string, keyHash []byte) (*EntryKey, error) {
+	if err := e.checkLocked(ctx, tx, entryUUID); err != nil {
+		return nil, err
+	}
+
 	entryKeys, err := e.model.Get(ctx, tx, entryUUID)
+	if err != nil {
+		return nil, errors.Join(ErrGetDEKFailed, err)
+	}
+
+	hash := e.hasher.Hash(keyHash)
+	for _, ek := range entryKeys {
+		// keys generated by the server have an encrypted key
+		if len(ek.EncryptedKey) > 0 {
+			continue
+		}
+
+		if !hasher.Compare(hash, ek.KeyHash) {
+			continue
+		}
+
+		if err := validateEntryKey(&ek); err != nil {
+			return nil, err
+		}
+
+		return modelEntryKeyToEntryKey(&ek), nil
+	}
+
+	return nil, e.registerFailedKeyAttempt(ctx, tx, entryUUID)
+}
+
+// checkLocked returns ErrEntryLocked when the entry is locked
+func (e *EntryKeyManager) checkLocked(ctx context.Context, tx *sql.Tx, entryUUID string) error {
+	if e.lockModel == nil {
+		return nil
+	}
+
+	locked, err := e.lockModel.IsLocked(ctx, tx, entryUUID)
+	if err != nil {
+		if errors.Is(err, models.ErrEntryNotFound) {
+			return ErrEntryKeyNotFound
+		}
+		return err
+	}
+
+	if locked {
+		return ErrEntryLocked
+	}
+
+	return nil
+}
+
+// registerFailedKeyAttempt counts the key which does not belong to any key
+// of the entry and locks or deletes the entry when it reached the maximum
+// number of attempts. It returns ErrEntryKeyNotFound, or ErrEntryLocked when
+// the entry got locked.
+func (e *EntryKeyManager) registerFailedKeyAttempt(ctx context.Context, tx *sql.Tx, entryUUID string) error {
+	if e.lockModel == nil {
+		return ErrEntryKeyNotFound
+	}
+
+	failedAttempts, err := e.lockModel.AddFailedKeyAttempt(ctx, tx, entryUUID)
+	if err != nil {
+		if errors.Is(err, models.ErrEntryNotFound) {
+			return ErrEntryKeyNotFound
+		}
+		return err
+	}
+
+	if e.maxKeyAttempts == 0 || failedAttempts < e.maxKeyAttempts {
+		return errors.Join(ErrEntryKeyNotFound, errAttemptRecorded)
+	}
+
+	if e.lockoutAction == LockoutDelete {
+		err = e.lockModel.Destroy(ctx, tx, entryUUID)
+	} else {
+		err = e.lockModel.Lock(ctx, tx, entryUUID)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := e.lockoutNotifier.EntryLocked(ctx, tx, entryUUID, failedAttempts, e.lockoutAction); err != nil {
+		return err
+	}
+
+	metrics.KeyLockouts.WithLabelValues(string(e.lockoutAction)).Inc()
+
+	return errors.Join(ErrEntryLocked, errAttemptRecorded)
+}
+
+// registerFailedAttempt counts the failed passphrase attempt and deletes the
+// entry key when it reached the maximum number of attempts
+func (e *EntryKeyManager) registerFailedAttempt(ctx context.Context, tx *sql.Tx, uuid string) error {
+	failedAttempts, err := e.model.AddFailedAttempt(ctx, tx, uuid)
+	if err != nil {
+		return err
+	}
+
+	if e.maxPassphraseAttempts > 0 && failedAttempts >= e.maxPassphraseAttempts {
+		return e.model.Delete(ctx, tx, uuid)
+	}
+
+	return nil
+}
+
+// findDEK looks for the entry key which can be unwrapped with the key. If
+// the entry key is protected with a passphrase, it returns
+// ErrPassphraseRequired when the passphrase is empty and ErrInvalidPassphrase
+// if the passphrase is wrong. When the key does not belong to the entry it
+// returns ErrEntryKeyNotFound, or ErrEntryLocked when the entry is locked.
+// The failed attempts are recorded in the transaction, so callers should
+// finish it with finishFailedTx.
+// The legacy entry keys, which are encrypted instead of wrapped, are found by
+// their key hash, and they are wrapped when they are found.
+func (e *EntryKeyManager) findDEK(ctx context.Context, tx *sql.Tx, entryUUID string, k key.Key, passphrase []byte) (dek key.Key, entryKey *models.EntryKey, err error) {
+	if err := e.checkLocked(ctx, tx, entryUUID); err != nil {
+		return nil, nil, err
+	}
+
+	entryKeys, err := e.model.Get(ctx, tx, entryUUID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wk, err := wrappingKey(k, entryUUID)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	crypter := e.encrypter(k)
+	ad := entryKeyAD(entryUUID)
 	for _, ek := range entryKeys {
-		decrypted, err := crypter.Decrypt(ek.EncryptedKey)
+		// the keys of the client encrypted entries have no encrypted key
+		if len(ek.EncryptedKey) == 0 {
+			continue
+		}
+
+		encryptedKey, err := openBlob(e.masterKey, ek.MasterKeyID, ek.EncryptedKey)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		legacy := len(ek.KeyHash) > 0
+
+		var lockedKey []byte
+		if legacy {
+			lockedKey, err = crypter.Decrypt(encryptedKey, ad)
+		} else {
+			lockedKey, err = e.keyWrapper.Unwrap(wk, encryptedKey)
+		}
 		if err != nil {
 			continue
 		}
 
-		hash := e.hasher.Hash(decrypted)
+		decrypted := lockedKey
+		var legacyLock bool
+		if ek.Passphrase != nil {
+			if len(passphrase) == 0 {
+				return nil, nil, ErrPassphraseRequired
+			}
+
+			decrypted, legacyLock, err = e.unlockWithPassphrase(entryUUID, lockedKey, passphrase, ek.Passphrase)
+			if err != nil {
+				if errors.Is(err, ErrInvalidPassphrase) {
+					if err := e.registerFailedAttempt(ctx, tx, ek.UUID); err != nil {
+						return nil, nil, err
+					}
+				}
+				return nil, nil, err
+			}
+		}
+
+		if legacy && !hasher.Compare(e.hasher.Hash(decrypted), ek.KeyHash) {
+			continue
+		}
+
+		if legacyLock {
+			if err := e.relockLegacyKey(ctx, tx, entryUUID, &ek, k, decrypted, passphrase); err != nil {
+				return nil, nil, err
+			}
 
-		if hasher.Compare(hash, ek.KeyHash) {
 			return decrypted, &ek, nil
 		}
+
+		if legacy {
+			if err := e.upgradeLegacyKey(ctx, tx, entryUUID, &ek, k, lockedKey); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		return decrypted, &ek, nil
+	}
+
+	return nil, nil, e.registerFailedKeyAttempt(ctx, tx, entryUUID)
+}
+
+// upgradeLegacyKey replaces the encrypted key of the legacy entry key with
+// the wrapped key, so its key hash is not needed anymore
+func (e *EntryKeyManager) upgradeLegacyKey(ctx context.Context, tx *sql.Tx, entryUUID string, ek *models.EntryKey, kek key.Key, lockedKey []byte) error {
+	masterKeyID, wrappedKey, err := e.wrapKey(kek, entryUUID, lockedKey)
+	if err != nil {
+		return err
 	}
 
-	return nil, nil, ErrEntryKeyNotFound
+	if err := e.model.SetWrappedKey(ctx, tx, ek.UUID, wrappedKey, masterKeyID); err != nil {
+		return err
+	}
+
+	ek.EncryptedKey = wrappedKey
+	ek.MasterKeyID = masterKeyID
+	ek.KeyHash = []byte{}
+
+	return nil
+}
+
+// relockLegacyKey locks the key again with the passphrase, bound to its
+// entry, and wraps it, so the legacy entry key is upgraded too
+func (e *EntryKeyManager) relockLegacyKey(ctx context.Context, tx *sql.Tx, entryUUID string, ek *models.EntryKey, kek key.Key, dek key.Key, pass []byte) error {
+	lockedKey, keyPassphrase, err := e.lockWithPassphrase(entryUUID, dek, pass)
+	if err != nil {
+		return err
+	}
+
+	masterKeyID, wrappedKey, err := e.wrapKey(kek, entryUUID, lockedKey)
+	if err != nil {
+		return err
+	}
+
+	if err := e.model.SetPassphraseKey(ctx, tx, ek.UUID, wrappedKey, masterKeyID, keyPassphrase); err != nil {
+		return err
+	}
+
+	ek.EncryptedKey = wrappedKey
+	ek.MasterKeyID = masterKeyID
+	ek.KeyHash = []byte{}
+	ek.Passphrase = keyPassphrase
+
+	return nil
 }
 
 // GetDEK returns the decrypted data encryption key and the entry key
 // if the key is not found it returns ErrEntryKeyNotFound
 // if the key is found but the hash does not match it returns an error
-func (e *EntryKeyManager) GetDEK(ctx context.Context, entryUUID string, key key.Key) (dek key.Key, entryKey *EntryKey, err error) {
+func (e *EntryKeyManager) GetDEK(ctx context.Context, entryUUID string, key key.Key, passphrase []byte) (dek key.Key, entryKey *EntryKey, err error) {
 	tx, err := e.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, nil, err
 	}
+	defer metrics.TransactionTimer("entry_key_get_dek").ObserveDuration()
 
-	dek, entryKey, err = e.GetDEKTx(ctx, tx, entryUUID, key)
+	dek, entryKey, err = e.GetDEKTx(ctx, tx, entryUUID, key, passphrase)
 	if err != nil {
-		if rollbackErr := tx.Rollback(); rollbackErr != nil {
-			return nil, nil, errors.Join(err, rollbackErr)
-		}
-		return nil, nil, err
+		return nil, nil, finishFailedTx(tx, err)
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -201,8 +646,8 @@ func (e *EntryKeyManager) GetDEK(ctx context.Context, entryUUID string, key key.
 // GetDEKTx returns the decrypted data encryption key and the entry key
 // if the key is not found it returns ErrEntryKeyNotFound
 // if the key is found but the hash does not match it returns an error
-func (e *EntryKeyManager) GetDEKTx(ctx context.Context, tx *sql.Tx, entryUUID string, key key.Key) (dek key.Key, entryKey *EntryKey, err error) {
-	dek, entryKeyModel, err := e.findDEK(ctx, tx, entryUUID, key)
+func (e *EntryKeyManager) GetDEKTx(ctx context.Context, tx *sql.Tx, entryUUID string, key key.Key, passphrase []byte) (dek key.Key, entryKey *EntryKey, err error) {
+	dek, entryKeyModel, err := e.findDEK(ctx, tx, entryUUID, key, passphrase)
 
 	if err != nil {
 		return nil, nil, errors.Join(ErrGetDEKFailed, err)
@@ -221,38 +666,52 @@ func (e *EntryKeyManager) GetDEKTx(ctx context.Context, tx *sql.Tx, entryUUID st
 }
 
 // GenerateEncryptionKey creates a new key for the entry
+// The passphrase unlocks the existing key, the newPassphrase protects the new
+// key.
 func (e EntryKeyManager) GenerateEncryptionKey(
 	ctx context.Context,
 	entryUUID string,
 	existingKey key.Key,
+	passphrase []byte,
 	expire *time.Time,
 	maxRead *int,
+	newPassphrase []byte,
 ) (*EntryKey, key.Key, error) {
 	tx, err := e.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, nil, err
 	}
+	defer metrics.TransactionTimer("generate_encryption_key").ObserveDuration()
 
-	dek, _, err := e.findDEK(ctx, tx, entryUUID, existingKey)
-
+	entryKey, k, err := e.GenerateEncryptionKeyTx(ctx, tx, entryUUID, existingKey, passphrase, expire, maxRead, newPassphrase)
 	if err != nil {
-		if rollbackErr := tx.Rollback(); rollbackErr != nil {
-			return nil, nil, errors.Join(err, rollbackErr)
-		}
-		return nil, nil, err
+		return nil, nil, finishFailedTx(tx, err)
 	}
 
-	entryKey, k, err := e.CreateWithTx(ctx, tx, entryUUID, dek, expire, maxRead)
-	if err != nil {
-		if rollbackErr := tx.Rollback(); rollbackErr != nil {
-			return nil, nil, errors.Join(err, rollbackErr)
-		}
+	if err := tx.Commit(); err != nil {
 		return nil, nil, err
 	}
 
-	if err := tx.Commit(); err != nil {
+	return entryKey, k, nil
+}
+
+// GenerateEncryptionKeyTx creates a new key for the entry in the transaction
+// The passphrase unlocks the existing key, the newPassphrase protects the new
+// key.
+func (e EntryKeyManager) GenerateEncryptionKeyTx(
+	ctx context.Context,
+	tx *sql.Tx,
+	entryUUID string,
+	existingKey key.Key,
+	passphrase []byte,
+	expire *time.Time,
+	maxRead *int,
+	newPassphrase []byte,
+) (*EntryKey, key.Key, error) {
+	dek, _, err := e.findDEK(ctx, tx, entryUUID, existingKey, passphrase)
+	if err != nil {
 		return nil, nil, err
 	}
 
-	return entryKey, k, nil
+	return e.CreateWithTx(ctx, tx, entryUUID, dek, expire, maxRead, newPassphrase)
 }
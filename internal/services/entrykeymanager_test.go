@@ -6,8 +6,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Ajnasz/sekret.link/internal/ciphersuite"
+	"github.com/Ajnasz/sekret.link/internal/hasher"
 	"github.com/Ajnasz/sekret.link/internal/key"
+	"github.com/Ajnasz/sekret.link/internal/keywrapper"
 	"github.com/Ajnasz/sekret.link/internal/models"
+	"github.com/Ajnasz/sekret.link/internal/passphrase"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -21,11 +25,13 @@ func (m *MockEntryKeyModel) Create(ctx context.Context,
 	tx *sql.Tx,
 	entryUUID string,
 	encryptedKey []byte,
+	masterKeyID string,
 	hash []byte,
 	expire *time.Time,
 	remainingReads *int,
+	passphrase *models.KeyPassphrase,
 ) (*models.EntryKey, error) {
-	args := m.Called(ctx, tx, entryUUID, encryptedKey, hash, expire, remainingReads)
+	args := m.Called(ctx, tx, entryUUID, encryptedKey, masterKeyID, hash, expire, remainingReads, passphrase)
 	return args.Get(0).(*models.EntryKey), args.Error(1)
 }
 
@@ -54,6 +60,40 @@ func (m *MockEntryKeyModel) Use(ctx context.Context, tx *sql.Tx, uuid string) er
 	return args.Error(0)
 }
 
+func (m *MockEntryKeyModel) AddFailedAttempt(ctx context.Context, tx *sql.Tx, uuid string) (int, error) {
+	args := m.Called(ctx, tx, uuid)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockEntryKeyModel) SetWrappedKey(ctx context.Context, tx *sql.Tx, uuid string, wrappedKey []byte, masterKeyID string) error {
+	args := m.Called(ctx, tx, uuid, wrappedKey, masterKeyID)
+	return args.Error(0)
+}
+
+func (m *MockEntryKeyModel) SetPassphraseKey(ctx context.Context, tx *sql.Tx, uuid string, wrappedKey []byte, masterKeyID string, passphrase *models.KeyPassphrase) error {
+	args := m.Called(ctx, tx, uuid, wrappedKey, masterKeyID, passphrase)
+	return args.Error(0)
+}
+
+// unwrapKey unwraps the key wrapped with the key encryption key of the entry
+func unwrapKey(kek key.Key, entryUUID string, wrapped []byte) ([]byte, error) {
+	wk, err := wrappingKey(kek, entryUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	return keywrapper.NewAesKeyWrapperWithPadding().Unwrap(wk, wrapped)
+}
+
+// wrapsKey matches the wrapped key which is unwrapped to the key with the
+// key encryption key of the entry
+func wrapsKey(kek key.Key, entryUUID string, k []byte) any {
+	return mock.MatchedBy(func(wrapped []byte) bool {
+		unwrapped, err := unwrapKey(kek, entryUUID, wrapped)
+		return err == nil && string(unwrapped) == string(k)
+	})
+}
+
 type MockHasher struct {
 	mock.Mock
 }
@@ -67,16 +107,21 @@ type EncrypterMock struct {
 	mock.Mock
 }
 
-func (e *EncrypterMock) Encrypt(data []byte) ([]byte, error) {
-	args := e.Called(data)
+func (e *EncrypterMock) Encrypt(data []byte, additionalData []byte) ([]byte, error) {
+	args := e.Called(data, additionalData)
 	return args.Get(0).([]byte), args.Error(1)
 }
 
-func (e *EncrypterMock) Decrypt(data []byte) ([]byte, error) {
-	args := e.Called(data)
+func (e *EncrypterMock) Decrypt(data []byte, additionalData []byte) ([]byte, error) {
+	args := e.Called(data, additionalData)
 	return args.Get(0).([]byte), args.Error(1)
 }
 
+func (e *EncrypterMock) PlaintextSize(data []byte) int {
+	args := e.Called(data)
+	return args.Int(0)
+}
+
 func TestEntryKeyManager_Create(t *testing.T) {
 	db, sqlMock, err := sqlmock.New()
 	if err != nil {
@@ -95,17 +140,15 @@ func TestEntryKeyManager_Create(t *testing.T) {
 	entryUUID := "test-entry-uuid"
 	dek, err := key.NewGeneratedKey()
 	assert.NoError(t, err)
-	encryptedKey := []byte("test-encrypted-key")
-	hash := []byte("test-hash")
 	expire := time.Now()
 	maxRead := 10
 
-	encrypter.On("Encrypt", dek.Get()).Return(encryptedKey, nil)
-	hasher.On("Hash", dek.Get()).Return(hash)
-	model.On("Create", ctx, mock.Anything, entryUUID, encryptedKey, hash, &expire, &maxRead).Return(&models.EntryKey{
+	var wrappedKey []byte
+	model.On("Create", ctx, mock.Anything, entryUUID, mock.Anything, "", []byte{}, &expire, &maxRead, (*models.KeyPassphrase)(nil)).Run(func(args mock.Arguments) {
+		wrappedKey = args.Get(3).([]byte)
+	}).Return(&models.EntryKey{
 		UUID:           "test-uuid",
 		EntryUUID:      entryUUID,
-		EncryptedKey:   encryptedKey,
 		Created:        time.Now(),
 		Expire:         sql.NullTime{Time: expire, Valid: false},
 		RemainingReads: sql.NullInt16{Int16: int16(maxRead), Valid: false},
@@ -119,7 +162,7 @@ func TestEntryKeyManager_Create(t *testing.T) {
 	}
 
 	manager := NewEntryKeyManager(db, model, hasher, crypto)
-	entryKey, key, err := manager.Create(ctx, entryUUID, *dek, &expire, &maxRead)
+	entryKey, key, err := manager.Create(ctx, entryUUID, *dek, &expire, &maxRead, nil)
 
 	model.AssertExpectations(t)
 	encrypter.AssertExpectations(t)
@@ -132,6 +175,10 @@ func TestEntryKeyManager_Create(t *testing.T) {
 	assert.Equal(t, expire, entryKey.Expire)
 	assert.Equal(t, maxRead, entryKey.RemainingReads)
 	assert.NotEmpty(t, key.Get())
+
+	unwrapped, err := unwrapKey(key, entryUUID, wrappedKey)
+	assert.NoError(t, err)
+	assert.Equal(t, dek.Get(), unwrapped, "the key is wrapped with the new key")
 }
 
 func TestEntryKeyManager_Create_NoExpire(t *testing.T) {
@@ -153,17 +200,13 @@ func TestEntryKeyManager_Create_NoExpire(t *testing.T) {
 	assert.NoError(t, err)
 	entryUUID := "test-entry-uuid"
 	encryptedKey := []byte("test-encrypted-key")
-	hash := []byte("test-hash")
 
-	hasher.On("Hash", dek.Get()).Return(hash)
-	encrypter.On("Encrypt", dek.Get()).Return(encryptedKey, nil)
 	var maxRead int
 	var nullTime sql.NullTime
-	model.On("Create", ctx, mock.Anything, entryUUID, encryptedKey, hash, mock.Anything, &maxRead).Return(&models.EntryKey{
+	model.On("Create", ctx, mock.Anything, entryUUID, mock.Anything, "", []byte{}, mock.Anything, &maxRead, (*models.KeyPassphrase)(nil)).Return(&models.EntryKey{
 		UUID:           "test-uuid",
 		EntryUUID:      entryUUID,
 		EncryptedKey:   encryptedKey,
-		KeyHash:        hash,
 		Created:        time.Now(),
 		Expire:         nullTime,
 		RemainingReads: sql.NullInt16{Int16: 0, Valid: false},
@@ -173,7 +216,7 @@ func TestEntryKeyManager_Create_NoExpire(t *testing.T) {
 		return encrypter
 	}
 	manager := NewEntryKeyManager(db, model, hasher, crypto)
-	entryKey, key, err := manager.Create(ctx, entryUUID, *dek, nil, &maxRead)
+	entryKey, key, err := manager.Create(ctx, entryUUID, *dek, nil, &maxRead, nil)
 
 	hasher.AssertExpectations(t)
 	encrypter.AssertExpectations(t)
@@ -205,18 +248,14 @@ func TestEntryKeyManager_Create_NoMaxRead(t *testing.T) {
 	entryUUID := "test-entry-uuid"
 	dek := []byte("test-dek")
 	encryptedKey := []byte("test-encrypted-key")
-	hash := []byte("test-hash")
 	expire := time.Now()
 
-	hasher.On("Hash", dek).Return(hash)
-	encrypter.On("Encrypt", dek).Return(encryptedKey, nil)
 	var maxRead *int
-	model.On("Create", ctx, mock.Anything, entryUUID, encryptedKey, hash, &expire, maxRead).
+	model.On("Create", ctx, mock.Anything, entryUUID, mock.Anything, "", []byte{}, &expire, maxRead, (*models.KeyPassphrase)(nil)).
 		Return(&models.EntryKey{
 			UUID:           "test-uuid",
 			EntryUUID:      entryUUID,
 			EncryptedKey:   encryptedKey,
-			KeyHash:        hash,
 			Created:        time.Now(),
 			Expire:         sql.NullTime{Time: expire, Valid: false},
 			RemainingReads: sql.NullInt16{Int16: 0, Valid: false},
@@ -227,7 +266,7 @@ func TestEntryKeyManager_Create_NoMaxRead(t *testing.T) {
 	}
 
 	manager := NewEntryKeyManager(db, model, hasher, crypto)
-	entryKey, key, err := manager.Create(ctx, entryUUID, dek, &expire, nil)
+	entryKey, key, err := manager.Create(ctx, entryUUID, dek, &expire, nil, nil)
 
 	model.AssertExpectations(t)
 	hasher.AssertExpectations(t)
@@ -249,6 +288,75 @@ func TestEntryKeyManager_GetDEK(t *testing.T) {
 
 	defer db.Close()
 
+	ctx := context.Background()
+	model := &MockEntryKeyModel{}
+	hasher := &MockHasher{}
+	encrypter := &EncrypterMock{}
+	entryUUID := "test-entry-uuid"
+	dek, err := key.NewGeneratedKey()
+	assert.NoError(t, err)
+	kek, err := key.NewGeneratedKey()
+	assert.NoError(t, err)
+	otherKEK, err := key.NewGeneratedKey()
+	assert.NoError(t, err)
+
+	wk, err := wrappingKey(*kek, entryUUID)
+	assert.NoError(t, err)
+	wrappedKey, err := keywrapper.NewAesKeyWrapperWithPadding().Wrap(wk, dek.Get())
+	assert.NoError(t, err)
+
+	otherWK, err := wrappingKey(*otherKEK, entryUUID)
+	assert.NoError(t, err)
+	otherWrappedKey, err := keywrapper.NewAesKeyWrapperWithPadding().Wrap(otherWK, dek.Get())
+	assert.NoError(t, err)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectCommit()
+	model.On("Get", ctx, mock.Anything, entryUUID).Return([]models.EntryKey{
+		{
+			UUID:         "other-uuid",
+			EntryUUID:    entryUUID,
+			EncryptedKey: otherWrappedKey,
+			KeyHash:      []byte{},
+			Created:      time.Now(),
+		},
+		{
+			UUID:         "test-uuid",
+			EntryUUID:    entryUUID,
+			EncryptedKey: wrappedKey,
+			KeyHash:      []byte{},
+			Created:      time.Now(),
+		},
+	}, nil)
+
+	crypto := func(key key.Key) Encrypter {
+		return encrypter
+	}
+
+	manager := NewEntryKeyManager(db, model, hasher, crypto)
+	foundDEK, entryKey, err := manager.GetDEK(ctx, entryUUID, *kek, nil)
+
+	model.AssertExpectations(t)
+	hasher.AssertExpectations(t)
+	encrypter.AssertExpectations(t)
+	if sqlMock.ExpectationsWereMet() != nil {
+		t.Errorf("there were unfulfilled expectations: %s", sqlMock.ExpectationsWereMet())
+	}
+	assert.NoError(t, err)
+	assert.Equal(t, *dek, foundDEK)
+	assert.Equal(t, "test-uuid", entryKey.UUID, "the key is found without key hash")
+}
+
+// TestEntryKeyManager_GetDEK_Legacy tests the entry key which was encrypted
+// before the keys were wrapped, it is found by its hash and wrapped
+func TestEntryKeyManager_GetDEK_Legacy(t *testing.T) {
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+
+	defer db.Close()
+
 	ctx := context.Background()
 	model := &MockEntryKeyModel{}
 	hasher := &MockHasher{}
@@ -264,7 +372,8 @@ func TestEntryKeyManager_GetDEK(t *testing.T) {
 	sqlMock.ExpectBegin()
 	sqlMock.ExpectCommit()
 	hasher.On("Hash", dek.Get()).Return(hash)
-	encrypter.On("Decrypt", encryptedKey).Return(dek.Get(), nil)
+	encrypter.On("Decrypt", encryptedKey, entryKeyAD(entryUUID)).Return(dek.Get(), nil)
+	model.On("SetWrappedKey", ctx, mock.Anything, "test-uuid", wrapsKey(*kek, entryUUID, dek.Get()), "").Return(nil)
 	model.On("Get", ctx, mock.Anything, entryUUID).Return([]models.EntryKey{
 		{
 			UUID:         "test-uuid",
@@ -280,7 +389,7 @@ func TestEntryKeyManager_GetDEK(t *testing.T) {
 	}
 
 	manager := NewEntryKeyManager(db, model, hasher, crypto)
-	foundDEK, entryKey, err := manager.GetDEK(ctx, entryUUID, *kek)
+	foundDEK, entryKey, err := manager.GetDEK(ctx, entryUUID, *kek, nil)
 
 	model.AssertExpectations(t)
 	hasher.AssertExpectations(t)
@@ -291,6 +400,7 @@ func TestEntryKeyManager_GetDEK(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, *dek, foundDEK)
 	assert.Equal(t, "test-uuid", entryKey.UUID)
+	assert.Empty(t, entryKey.KeyHash)
 }
 
 // TestEntryKeyManager_GetDEK_NotFound tests the case when the entry key is not
@@ -319,7 +429,7 @@ func TestEntryKeyManager_GetDEK_NotFound(t *testing.T) {
 	}
 
 	manager := NewEntryKeyManager(db, model, hasher, crypto)
-	foundDEK, entryKey, err := manager.GetDEK(ctx, entryUUID, dek)
+	foundDEK, entryKey, err := manager.GetDEK(ctx, entryUUID, dek, nil)
 
 	model.AssertExpectations(t)
 	hasher.AssertExpectations(t)
@@ -352,7 +462,7 @@ func TestEntryKeyManager_GetDEK_DecryptError(t *testing.T) {
 	sqlMock.ExpectBegin()
 	sqlMock.ExpectRollback()
 
-	encrypter.On("Decrypt", encryptedKey).Return([]byte{}, assert.AnError)
+	encrypter.On("Decrypt", encryptedKey, entryKeyAD(entryUUID)).Return([]byte{}, assert.AnError)
 
 	model.On("Get", ctx, mock.Anything, entryUUID).Return([]models.EntryKey{
 		{
@@ -369,7 +479,7 @@ func TestEntryKeyManager_GetDEK_DecryptError(t *testing.T) {
 	}
 
 	manager := NewEntryKeyManager(db, model, hasher, crypto)
-	foundDEK, entryKey, err := manager.GetDEK(ctx, entryUUID, dek)
+	foundDEK, entryKey, err := manager.GetDEK(ctx, entryUUID, dek, nil)
 
 	assert.Error(t, err)
 	assert.Nil(t, foundDEK)
@@ -403,7 +513,7 @@ func TestEntryManager_InvalidDEK(t *testing.T) {
 
 	sqlMock.ExpectBegin()
 	sqlMock.ExpectRollback()
-	encrypter.On("Decrypt", encryptedKey).Return(badDEK, nil)
+	encrypter.On("Decrypt", encryptedKey, entryKeyAD(entryUUID)).Return(badDEK, nil)
 	hasher.On("Hash", badDEK).Return(badHash)
 
 	model.On("Get", ctx, mock.Anything, entryUUID).Return([]models.EntryKey{
@@ -421,7 +531,7 @@ func TestEntryManager_InvalidDEK(t *testing.T) {
 	}
 
 	manager := NewEntryKeyManager(db, model, hasher, crypto)
-	foundDEK, entryKey, err := manager.GetDEK(ctx, entryUUID, dek)
+	foundDEK, entryKey, err := manager.GetDEK(ctx, entryUUID, dek, nil)
 
 	model.AssertExpectations(t)
 	hasher.AssertExpectations(t)
@@ -469,15 +579,14 @@ func TestEntryKeyManager_GenerateEncryptionKey(t *testing.T) {
 			Created:      time.Now(),
 		},
 	}, nil)
-	encrypter.On("Decrypt", encryptedKey).Return(dek, nil)
+	encrypter.On("Decrypt", encryptedKey, entryKeyAD(entryUUID)).Return(dek, nil)
 	hasher.On("Hash", dek).Return(hash)
+	model.On("SetWrappedKey", ctx, mock.Anything, "test-uuid", wrapsKey(encryptedKey, entryUUID, dek), "").Return(nil)
 
-	encrypter.On("Encrypt", mock.Anything).Return(newEncryptedKey, nil)
-	model.On("Create", ctx, mock.Anything, entryUUID, newEncryptedKey, hash, &expire, &maxRead).Return(&models.EntryKey{
+	model.On("Create", ctx, mock.Anything, entryUUID, mock.Anything, "", []byte{}, &expire, &maxRead, (*models.KeyPassphrase)(nil)).Return(&models.EntryKey{
 		UUID:           "new-test-uuid",
 		EntryUUID:      entryUUID,
 		EncryptedKey:   newEncryptedKey,
-		KeyHash:        hash,
 		Created:        time.Now(),
 		Expire:         sql.NullTime{Time: expire, Valid: false},
 		RemainingReads: sql.NullInt16{Int16: int16(maxRead), Valid: false},
@@ -491,7 +600,7 @@ func TestEntryKeyManager_GenerateEncryptionKey(t *testing.T) {
 
 	manager := NewEntryKeyManager(db, model, hasher, crypto)
 
-	entryKey, key, err := manager.GenerateEncryptionKey(ctx, entryUUID, encryptedKey, &expire, &maxRead)
+	entryKey, key, err := manager.GenerateEncryptionKey(ctx, entryUUID, encryptedKey, nil, &expire, &maxRead, nil)
 
 	model.AssertExpectations(t)
 	hasher.AssertExpectations(t)
@@ -569,7 +678,8 @@ func Test_EntryKeyManager_GetDEKTx_NoRemainingReads(t *testing.T) {
 	sqlMock.ExpectBegin()
 	sqlMock.ExpectRollback()
 	hasher.On("Hash", dek).Return(hash)
-	encrypter.On("Decrypt", encryptedKey).Return(dek, nil)
+	encrypter.On("Decrypt", encryptedKey, entryKeyAD(entryUUID)).Return(dek, nil)
+	model.On("SetWrappedKey", ctx, mock.Anything, "test-uuid", wrapsKey(dek, entryUUID, dek), "").Return(nil)
 	model.On("Get", ctx, mock.Anything, entryUUID).Return([]models.EntryKey{
 		{
 			UUID:           "test-uuid",
@@ -586,7 +696,7 @@ func Test_EntryKeyManager_GetDEKTx_NoRemainingReads(t *testing.T) {
 	}
 
 	manager := NewEntryKeyManager(db, model, hasher, crypto)
-	foundDEK, entryKey, err := manager.GetDEK(ctx, entryUUID, dek)
+	foundDEK, entryKey, err := manager.GetDEK(ctx, entryUUID, dek, nil)
 
 	model.AssertExpectations(t)
 	hasher.AssertExpectations(t)
@@ -619,7 +729,8 @@ func Test_EntryKeyManager_GetDEKTx_Expired(t *testing.T) {
 	sqlMock.ExpectBegin()
 	sqlMock.ExpectRollback()
 	hasher.On("Hash", dek).Return(hash)
-	encrypter.On("Decrypt", encryptedKey).Return(dek, nil)
+	encrypter.On("Decrypt", encryptedKey, entryKeyAD(entryUUID)).Return(dek, nil)
+	model.On("SetWrappedKey", ctx, mock.Anything, "test-uuid", wrapsKey(dek, entryUUID, dek), "").Return(nil)
 	model.On("Get", ctx, mock.Anything, entryUUID).Return([]models.EntryKey{
 		{
 			UUID:           "test-uuid",
@@ -637,7 +748,7 @@ func Test_EntryKeyManager_GetDEKTx_Expired(t *testing.T) {
 	}
 
 	manager := NewEntryKeyManager(db, model, hasher, crypto)
-	foundDEK, entryKey, err := manager.GetDEK(ctx, entryUUID, dek)
+	foundDEK, entryKey, err := manager.GetDEK(ctx, entryUUID, dek, nil)
 
 	model.AssertExpectations(t)
 	hasher.AssertExpectations(t)
@@ -683,3 +794,200 @@ func Test_EntryKeyManager_Delete(t *testing.T) {
 	}
 	assert.NoError(t, err)
 }
+
+func TestEntryKeyManager_GetDEK_Passphrase(t *testing.T) {
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+
+	defer db.Close()
+
+	ctx := context.Background()
+	model := &MockEntryKeyModel{}
+	entryUUID := "test-entry-uuid"
+	dek, err := key.NewGeneratedKey()
+	assert.NoError(t, err)
+
+	var stored models.EntryKey
+	model.On("Create", ctx, mock.Anything, entryUUID, mock.Anything, "", mock.Anything, (*time.Time)(nil), (*int)(nil), mock.Anything).Run(func(args mock.Arguments) {
+		stored = models.EntryKey{
+			UUID:         "test-uuid",
+			EntryUUID:    entryUUID,
+			EncryptedKey: args.Get(3).([]byte),
+			KeyHash:      args.Get(5).([]byte),
+			Passphrase:   args.Get(8).(*models.KeyPassphrase),
+		}
+	}).Return(&models.EntryKey{UUID: "test-uuid"}, nil)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectCommit()
+
+	manager := NewEntryKeyManager(db, model, hasher.NewSHA256Hasher(), func(k key.Key) Encrypter {
+		return NewAESEncrypter(k)
+	}).WithMaxPassphraseAttempts(2)
+	_, kek, err := manager.Create(ctx, entryUUID, *dek, nil, nil, []byte("secret"))
+	assert.NoError(t, err)
+	assert.NotNil(t, stored.Passphrase)
+	assert.NotEqual(t, dek.Get(), stored.EncryptedKey)
+
+	model.On("Get", ctx, mock.Anything, entryUUID).Return([]models.EntryKey{stored}, nil)
+
+	t.Run("passphrase required", func(t *testing.T) {
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectRollback()
+		_, _, err := manager.GetDEK(ctx, entryUUID, kek, nil)
+		assert.ErrorIs(t, err, ErrPassphraseRequired)
+	})
+
+	t.Run("valid passphrase", func(t *testing.T) {
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectCommit()
+		foundDEK, _, err := manager.GetDEK(ctx, entryUUID, kek, []byte("secret"))
+		assert.NoError(t, err)
+		assert.Equal(t, *dek, foundDEK)
+	})
+
+	t.Run("invalid passphrase", func(t *testing.T) {
+		model.On("AddFailedAttempt", ctx, mock.Anything, "test-uuid").Return(1, nil).Once()
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectCommit()
+		_, _, err := manager.GetDEK(ctx, entryUUID, kek, []byte("wrong"))
+		assert.ErrorIs(t, err, ErrInvalidPassphrase)
+	})
+
+	t.Run("max attempts reached", func(t *testing.T) {
+		model.On("AddFailedAttempt", ctx, mock.Anything, "test-uuid").Return(2, nil).Once()
+		model.On("Delete", ctx, mock.Anything, "test-uuid").Return(nil).Once()
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectCommit()
+		_, _, err := manager.GetDEK(ctx, entryUUID, kek, []byte("wrong"))
+		assert.ErrorIs(t, err, ErrInvalidPassphrase)
+	})
+
+	model.AssertExpectations(t)
+	if err := sqlMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestEntryKeyManager_GetDEK_LegacyPassphrase(t *testing.T) {
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+
+	defer db.Close()
+
+	ctx := context.Background()
+	model := &MockEntryKeyModel{}
+	entryUUID := "test-entry-uuid"
+	dek, err := key.NewGeneratedKey()
+	assert.NoError(t, err)
+	kek, err := key.NewGeneratedKey()
+	assert.NoError(t, err)
+
+	manager := NewEntryKeyManager(db, model, hasher.NewSHA256Hasher(), func(k key.Key) Encrypter {
+		return NewCipherEncrypter(k, ciphersuite.AES256GCM)
+	})
+
+	// the key was locked with the passphrase before the lock was bound to
+	// the entry
+	salt, err := passphrase.NewSalt()
+	assert.NoError(t, err)
+	params := passphrase.DefaultParams
+	legacyLock, err := NewAESEncrypter(passphrase.DeriveKey([]byte("secret"), salt, params)).Encrypt(dek.Get(), nil)
+	assert.NoError(t, err)
+	_, wrapped, err := manager.wrapKey(*kek, entryUUID, legacyLock)
+	assert.NoError(t, err)
+
+	model.On("Get", ctx, mock.Anything, entryUUID).Return([]models.EntryKey{
+		{
+			UUID:         "test-uuid",
+			EntryUUID:    entryUUID,
+			EncryptedKey: wrapped,
+			Passphrase:   &models.KeyPassphrase{Salt: salt, Params: params.String()},
+		},
+	}, nil)
+
+	var relocked []byte
+	var keyPassphrase *models.KeyPassphrase
+	model.On("SetPassphraseKey", ctx, mock.Anything, "test-uuid", mock.Anything, "", mock.Anything).Run(func(args mock.Arguments) {
+		relocked = args.Get(3).([]byte)
+		keyPassphrase = args.Get(5).(*models.KeyPassphrase)
+	}).Return(nil).Once()
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectCommit()
+
+	foundDEK, entryKey, err := manager.GetDEK(ctx, entryUUID, *kek, []byte("secret"))
+	assert.NoError(t, err)
+	assert.Equal(t, *dek, foundDEK)
+	assert.True(t, entryKey.HasPassphrase)
+
+	locked, err := unwrapKey(*kek, entryUUID, relocked)
+	assert.NoError(t, err)
+	assert.NotEqual(t, salt, keyPassphrase.Salt)
+
+	unlocked, legacy, err := manager.unlockWithPassphrase(entryUUID, locked, []byte("secret"), keyPassphrase)
+	assert.NoError(t, err)
+	assert.False(t, legacy, "the key is locked again bound to its entry")
+	assert.Equal(t, *dek, unlocked)
+
+	model.AssertExpectations(t)
+	if err := sqlMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_EntryKeyManager_DeleteTx(t *testing.T) {
+	ctx := context.Background()
+	entryUUID := "test-entry-uuid"
+
+	t.Run("delete the key of the entry", func(t *testing.T) {
+		model := &MockEntryKeyModel{}
+		model.On("Get", ctx, mock.Anything, entryUUID).Return([]models.EntryKey{
+			{UUID: "key-1", EntryUUID: entryUUID},
+			{UUID: "key-2", EntryUUID: entryUUID},
+		}, nil)
+		model.On("Delete", ctx, mock.Anything, "key-2").Return(nil)
+
+		manager := NewEntryKeyManager(nil, model, &MockHasher{}, nil)
+		err := manager.DeleteTx(ctx, nil, entryUUID, "key-2")
+
+		assert.NoError(t, err)
+		model.AssertExpectations(t)
+	})
+
+	t.Run("key of an other entry", func(t *testing.T) {
+		model := &MockEntryKeyModel{}
+		model.On("Get", ctx, mock.Anything, entryUUID).Return([]models.EntryKey{
+			{UUID: "key-1", EntryUUID: entryUUID},
+		}, nil)
+
+		manager := NewEntryKeyManager(nil, model, &MockHasher{}, nil)
+		err := manager.DeleteTx(ctx, nil, entryUUID, "key-3")
+
+		assert.ErrorIs(t, err, ErrEntryKeyNotFound)
+		model.AssertExpectations(t)
+		model.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func Test_EntryKeyManager_UpdateTx(t *testing.T) {
+	ctx := context.Background()
+	expire := time.Now().Add(time.Hour)
+	maxReads := 3
+
+	model := &MockEntryKeyModel{}
+	model.On("SetExpire", ctx, mock.Anything, "key-uuid", expire).Return(nil)
+	model.On("SetMaxReads", ctx, mock.Anything, "key-uuid", maxReads).Return(nil)
+
+	manager := NewEntryKeyManager(nil, model, &MockHasher{}, nil)
+
+	assert.NoError(t, manager.UpdateTx(ctx, nil, "key-uuid", &expire, &maxReads))
+	assert.NoError(t, manager.UpdateTx(ctx, nil, "key-uuid", nil, nil))
+
+	model.AssertNumberOfCalls(t, "SetExpire", 1)
+	model.AssertNumberOfCalls(t, "SetMaxReads", 1)
+}
@@ -2,11 +2,14 @@ package services
 
 import (
 	"context"
+	"crypto/subtle"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/Ajnasz/sekret.link/internal/key"
+	"github.com/Ajnasz/sekret.link/internal/metrics"
 	"github.com/Ajnasz/sekret.link/internal/models"
 	"github.com/Ajnasz/sekret.link/internal/uuid"
 )
@@ -20,6 +23,15 @@ var ErrReadEntryFailed = errors.New("read entry failed")
 var ErrDeleteEntryFailed = errors.New("delete entry failed")
 var DeleteExpiredFailed = errors.New("delete expired failed")
 
+// ErrInvalidDeleteKey is returned when the delete key does not belong to the
+// entry
+var ErrInvalidDeleteKey = errors.New("invalid delete key")
+
+// ErrEntryKeyLimitRaised is returned when the holder of a key tries to raise
+// its remaining reads or extend its expiration, only the owner of the entry
+// can do that with the delete key
+var ErrEntryKeyLimitRaised = errors.New("entry key limit raised")
+
 // EntryMeta provides the entry meta
 type EntryMeta struct {
 	UUID           string
@@ -29,6 +41,8 @@ type EntryMeta struct {
 	Accessed       time.Time
 	Expire         time.Time
 	ContentType    string
+	// Size is the size of the decrypted data, it is set by ReadEntryMeta
+	Size int
 }
 
 type Entry struct {
@@ -49,6 +63,9 @@ type EntryManager struct {
 	model      EntryModel
 	crypto     EncrypterFactory
 	keyManager EntryKeyer
+	events     EventRecorder
+	audit      AuditRecorder
+	masterKey  MasterKey
 }
 
 // NewEntryManager creates a new EntryService
@@ -61,13 +78,60 @@ func NewEntryManager(db *sql.DB, model EntryModel, crypto EncrypterFactory, keyM
 	}
 }
 
+// WithEvents sets the recorder of the entry events, the entries can have
+// webhooks only when it is set
+func (e *EntryManager) WithEvents(events EventRecorder) *EntryManager {
+	e.events = events
+	return e
+}
+
+// recordEvent records the event in the transaction of the change when the
+// events are recorded
+func (e *EntryManager) recordEvent(ctx context.Context, tx *sql.Tx, event Event) error {
+	if e.events == nil {
+		return nil
+	}
+
+	return e.events.RecordTx(ctx, tx, event)
+}
+
+// WithMasterKey sets the master key which wraps the stored data, the data
+// is stored as it is without it
+func (e *EntryManager) WithMasterKey(masterKey MasterKey) *EntryManager {
+	e.masterKey = masterKey
+	return e
+}
+
+// WithAudit sets the audit log, the lifecycle of the entries is recorded in
+// it when it is set
+func (e *EntryManager) WithAudit(audit AuditRecorder) *EntryManager {
+	e.audit = audit
+	return e
+}
+
+// recordAudit appends the event to the audit log in the transaction of the
+// change when the audit log is set
+func (e *EntryManager) recordAudit(ctx context.Context, tx *sql.Tx, event AuditEventType, entryUUID string, keyUUID string) error {
+	if e.audit == nil {
+		return nil
+	}
+
+	return e.audit.RecordTx(ctx, tx, event, entryUUID, keyUUID)
+}
+
 // CreateEntry creates a new entry
 // It generates a new UUID for the entry
 // It encrypts the data with a new generated key
 // It stores the encrypted data in the database
 // It stores the key in the key manager
 // It returns the meta data of the entry and the key
-func (e *EntryManager) CreateEntry(ctx context.Context, contentType string, data []byte, expire *time.Duration, remainingReads *int) (*EntryMeta, key.Key, error) {
+// The key is protected with the passphrase when it is not empty
+// The events of the entry are sent to the webhook when it is not nil
+func (e *EntryManager) CreateEntry(ctx context.Context, contentType string, data []byte, expire *time.Duration, remainingReads *int, passphrase []byte, webhook *Webhook) (*EntryMeta, key.Key, error) {
+	if webhook != nil && e.events == nil {
+		return nil, nil, ErrWebhooksDisabled
+	}
+
 	uid := uuid.NewUUIDString()
 
 	// use context-aware begin and ensure rollback on all early exits
@@ -75,6 +139,7 @@ func (e *EntryManager) CreateEntry(ctx context.Context, contentType string, data
 	if err != nil {
 		return nil, nil, errors.Join(ErrCreateEntryFailed, err)
 	}
+	defer metrics.TransactionTimer("create_entry").ObserveDuration()
 	// ensure tx is rolled back unless committed; setting tx = nil prevents rollback
 	defer func() {
 		if tx != nil {
@@ -89,11 +154,19 @@ func (e *EntryManager) CreateEntry(ctx context.Context, contentType string, data
 
 	crypto := e.crypto(dek.Get())
 
-	encryptedData, err := crypto.Encrypt(data)
+	timer := metrics.CryptoTimer("encrypt")
+	encryptedData, err := crypto.Encrypt(data, entryDataAD(uid, contentType))
+	timer.ObserveDuration()
+	if err != nil {
+		return nil, nil, errors.Join(ErrCreateEntryFailed, err)
+	}
+
+	masterKeyID, sealedData, err := sealBlob(e.masterKey, encryptedData)
 	if err != nil {
 		return nil, nil, errors.Join(ErrCreateEntryFailed, err)
 	}
-	meta, err := e.model.CreateEntry(ctx, tx, uid, contentType, encryptedData)
+
+	meta, err := e.model.CreateEntry(ctx, tx, uid, contentType, sealedData, masterKeyID)
 	if err != nil {
 		return nil, nil, errors.Join(ErrCreateEntryFailed, err)
 	}
@@ -105,15 +178,20 @@ func (e *EntryManager) CreateEntry(ctx context.Context, contentType string, data
 		expireAt = &fromNow
 	}
 
-	entryKey, kek, err := e.keyManager.CreateWithTx(ctx, tx, uid, dek.Get(), expireAt, remainingReads)
+	entryKey, kek, err := e.keyManager.CreateWithTx(ctx, tx, uid, dek.Get(), expireAt, remainingReads, passphrase)
 
 	if err != nil {
 		return nil, nil, errors.Join(ErrCreateEntryFailed, err)
 	}
 
-	// try to zero sensitive key material if the key implementation supports it
-	if z, ok := any(dek).(interface{ Wipe() }); ok {
-		z.Wipe()
+	if webhook != nil {
+		if err := e.events.RegisterTx(ctx, tx, uid, *webhook); err != nil {
+			return nil, nil, errors.Join(ErrCreateEntryFailed, err)
+		}
+	}
+
+	if err := e.recordAudit(ctx, tx, AuditCreated, uid, entryKey.UUID); err != nil {
+		return nil, nil, errors.Join(ErrCreateEntryFailed, err)
 	}
 
 	// commit the transaction and disable deferred rollback on success
@@ -121,6 +199,7 @@ func (e *EntryManager) CreateEntry(ctx context.Context, contentType string, data
 		return nil, nil, errors.Join(ErrCreateEntryFailed, err)
 	}
 	tx = nil
+	metrics.ObservePayloadSize("create", len(data))
 
 	return &EntryMeta{
 		UUID:           meta.UUID,
@@ -140,7 +219,8 @@ func (e *EntryManager) CreateEntry(ctx context.Context, contentType string, data
 // It returns the decrypted data
 // It returns an error if the entry is not found or expired
 // It returns an error if the key is not found
-func (e *EntryManager) ReadEntry(ctx context.Context, UUID string, k key.Key) (*Entry, error) {
+// It returns an error if the key is protected and the passphrase is wrong
+func (e *EntryManager) ReadEntry(ctx context.Context, UUID string, k key.Key, passphrase []byte) (*Entry, error) {
 	if ctx.Err() != nil {
 		return nil, ctx.Err()
 	}
@@ -149,6 +229,7 @@ func (e *EntryManager) ReadEntry(ctx context.Context, UUID string, k key.Key) (*
 	if err != nil {
 		return nil, errors.Join(ErrReadEntryFailed, err)
 	}
+	defer metrics.TransactionTimer("read_entry").ObserveDuration()
 	defer func() {
 		if tx != nil {
 			_ = tx.Rollback()
@@ -167,28 +248,56 @@ func (e *EntryManager) ReadEntry(ctx context.Context, UUID string, k key.Key) (*
 		return nil, err
 	}
 
-	dek, entryKey, err := e.keyManager.GetDEKTx(ctx, tx, UUID, k)
+	// the server does not have the key of the client encrypted entries
+	if entry.ClientEncrypted {
+		return nil, ErrEntryNotFound
+	}
+
+	dek, entryKey, err := e.keyManager.GetDEKTx(ctx, tx, UUID, k, passphrase)
 	var decryptedData []byte
 	if err != nil {
+		err = finishFailedTx(tx, err)
+		tx = nil
+		if errors.Is(err, ErrInvalidPassphrase) || errors.Is(err, ErrPassphraseRequired) || errors.Is(err, ErrEntryLocked) {
+			return nil, err
+		}
 		// map key-manager errors to service-level errors consistently
 		if errors.Is(err, ErrEntryKeyNotFound) {
 			return nil, ErrEntryNoRemainingReads
 		}
 		return nil, errors.Join(err, ErrReadEntryFailed)
 	} else {
-		crypto := e.crypto(dek)
-		decryptedData, err = crypto.Decrypt(entry.Data)
-		// try to zero dek as soon as we've used it
-		if z, ok := any(dek).(interface{ Wipe() }); ok {
-			z.Wipe()
+		encryptedData, err := openBlob(e.masterKey, entry.MasterKeyID, entry.Data)
+		if err != nil {
+			return nil, errors.Join(err, ErrReadEntryFailed)
 		}
+
+		crypto := e.crypto(dek)
+		timer := metrics.CryptoTimer("decrypt")
+		var legacy bool
+		decryptedData, legacy, err = decryptLegacy(crypto, encryptedData, entryDataAD(entry.UUID, entry.ContentType))
+		timer.ObserveDuration()
 		if err != nil {
 			return nil, errors.Join(err, ErrReadEntryFailed)
 		}
 
+		if legacy {
+			if err := e.rebindData(ctx, tx, entry, crypto, decryptedData); err != nil {
+				return nil, errors.Join(err, ErrReadEntryFailed)
+			}
+		}
+
 		if err := e.keyManager.UseTx(ctx, tx, entryKey.UUID); err != nil {
 			return nil, errors.Join(err, ErrReadEntryFailed)
 		}
+
+		if err := e.recordEvent(ctx, tx, readEvent(UUID, entryKey)); err != nil {
+			return nil, errors.Join(err, ErrReadEntryFailed)
+		}
+
+		if err := e.recordAudit(ctx, tx, AuditRead, UUID, entryKey.UUID); err != nil {
+			return nil, errors.Join(err, ErrReadEntryFailed)
+		}
 	}
 
 	if err := e.model.Use(ctx, tx, UUID); err != nil {
@@ -199,6 +308,7 @@ func (e *EntryManager) ReadEntry(ctx context.Context, UUID string, k key.Key) (*
 		return nil, errors.Join(ErrReadEntryFailed, err)
 	}
 	tx = nil
+	metrics.ObservePayloadSize("read", len(decryptedData))
 
 	return &Entry{
 		EntryMeta: EntryMeta{
@@ -214,11 +324,245 @@ func (e *EntryManager) ReadEntry(ctx context.Context, UUID string, k key.Key) (*
 	}, nil
 }
 
+// rebindData encrypts the legacy data of the entry again, bound to the entry
+// and its content type, so the legacy data is gone after its first read
+func (e *EntryManager) rebindData(ctx context.Context, tx *sql.Tx, entry *models.Entry, crypto Encrypter, data []byte) error {
+	encryptedData, err := crypto.Encrypt(data, entryDataAD(entry.UUID, entry.ContentType))
+	if err != nil {
+		return err
+	}
+
+	masterKeyID, sealedData, err := sealBlob(e.masterKey, encryptedData)
+	if err != nil {
+		return err
+	}
+
+	return e.model.SetData(ctx, tx, entry.UUID, sealedData, masterKeyID)
+}
+
+// ReadEntryMeta returns the metadata of the entry without reading it
+// The key is validated like in ReadEntry, but the data is not decrypted and
+// the remaining reads are not decreased
+func (e *EntryManager) ReadEntryMeta(ctx context.Context, UUID string, k key.Key, passphrase []byte) (*EntryMeta, error) {
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Join(ErrReadEntryFailed, err)
+	}
+	defer metrics.TransactionTimer("read_entry_meta").ObserveDuration()
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// the data is read for its header, the header names the cipher, so the
+	// size of the decrypted data can be calculated
+	entry, err := e.model.ReadEntry(ctx, tx, UUID)
+	if err != nil {
+		if errors.Is(err, models.ErrEntryNotFound) {
+			return nil, ErrEntryNotFound
+		}
+		return nil, errors.Join(err, ErrReadEntryFailed)
+	}
+
+	if entry.ClientEncrypted {
+		return nil, ErrEntryNotFound
+	}
+
+	dek, entryKey, err := e.keyManager.GetDEKTx(ctx, tx, UUID, k, passphrase)
+	if err != nil {
+		err = finishFailedTx(tx, err)
+		tx = nil
+		if errors.Is(err, ErrInvalidPassphrase) || errors.Is(err, ErrEntryLocked) {
+			return nil, err
+		}
+		if errors.Is(err, ErrEntryKeyNotFound) {
+			return nil, ErrEntryNoRemainingReads
+		}
+		return nil, err
+	}
+
+	encryptedData, err := openBlob(e.masterKey, entry.MasterKeyID, entry.Data)
+	if err != nil {
+		return nil, errors.Join(err, ErrReadEntryFailed)
+	}
+
+	size := e.crypto(dek).PlaintextSize(encryptedData)
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Join(ErrReadEntryFailed, err)
+	}
+	tx = nil
+
+	return &EntryMeta{
+		UUID:           entry.UUID,
+		DeleteKey:      entry.DeleteKey,
+		Created:        entry.Created,
+		Accessed:       entry.Accessed.Time,
+		ContentType:    entry.ContentType,
+		Expire:         entryKey.Expire,
+		RemainingReads: entryKey.RemainingReads,
+		Size:           size,
+	}, nil
+}
+
+// CreateClientEncryptedEntry creates a new entry from data encrypted by the
+// client. The data is stored as it is, the key never reaches the server, only
+// the keyHash which is needed to read the entry.
+// It returns the meta data of the entry
+func (e *EntryManager) CreateClientEncryptedEntry(ctx context.Context, contentType string, data []byte, keyHash []byte, expire *time.Duration, remainingReads *int) (*EntryMeta, error) {
+	uid := uuid.NewUUIDString()
+
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Join(ErrCreateEntryFailed, err)
+	}
+	defer metrics.TransactionTimer("create_client_encrypted_entry").ObserveDuration()
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	masterKeyID, sealedData, err := sealBlob(e.masterKey, data)
+	if err != nil {
+		return nil, errors.Join(ErrCreateEntryFailed, err)
+	}
+
+	meta, err := e.model.CreateClientEncryptedEntry(ctx, tx, uid, contentType, sealedData, masterKeyID)
+	if err != nil {
+		return nil, errors.Join(ErrCreateEntryFailed, err)
+	}
+
+	var expireAt *time.Time
+
+	if expire != nil {
+		fromNow := time.Now().Add(*expire)
+		expireAt = &fromNow
+	}
+
+	entryKey, err := e.keyManager.CreateKeyHashWithTx(ctx, tx, uid, keyHash, expireAt, remainingReads)
+	if err != nil {
+		return nil, errors.Join(ErrCreateEntryFailed, err)
+	}
+
+	if err := e.recordAudit(ctx, tx, AuditCreated, uid, entryKey.UUID); err != nil {
+		return nil, errors.Join(ErrCreateEntryFailed, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Join(ErrCreateEntryFailed, err)
+	}
+	tx = nil
+	metrics.ObservePayloadSize("create", len(data))
+
+	return &EntryMeta{
+		UUID:           meta.UUID,
+		DeleteKey:      meta.DeleteKey,
+		Created:        meta.Created,
+		Accessed:       meta.Accessed.Time,
+		ContentType:    meta.ContentType,
+		RemainingReads: entryKey.RemainingReads,
+		Expire:         entryKey.Expire,
+	}, nil
+}
+
+// ReadClientEncryptedEntry reads an entry encrypted by the client
+// It returns the encrypted data, the client must decrypt it
+// It returns an error if the entry is not found or expired
+// It returns an error if the keyHash does not belong to the entry
+func (e *EntryManager) ReadClientEncryptedEntry(ctx context.Context, UUID string, keyHash []byte) (*Entry, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Join(ErrReadEntryFailed, err)
+	}
+	defer metrics.TransactionTimer("read_client_encrypted_entry").ObserveDuration()
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	entry, err := e.model.ReadEntry(ctx, tx, UUID)
+	if err != nil {
+		if errors.Is(err, models.ErrEntryNotFound) {
+			return nil, ErrEntryNotFound
+		}
+		return nil, errors.Join(err, ErrReadEntryFailed)
+	}
+
+	if err := validateEntry(entry); err != nil {
+		return nil, err
+	}
+
+	if !entry.ClientEncrypted {
+		return nil, ErrEntryNotFound
+	}
+
+	data, err := openBlob(e.masterKey, entry.MasterKeyID, entry.Data)
+	if err != nil {
+		return nil, errors.Join(err, ErrReadEntryFailed)
+	}
+
+	entryKey, err := e.keyManager.FindByKeyHashTx(ctx, tx, UUID, keyHash)
+	if err != nil {
+		err = finishFailedTx(tx, err)
+		tx = nil
+		if errors.Is(err, ErrEntryLocked) {
+			return nil, err
+		}
+		if errors.Is(err, ErrEntryKeyNotFound) {
+			return nil, ErrEntryNoRemainingReads
+		}
+		return nil, errors.Join(err, ErrReadEntryFailed)
+	}
+
+	if err := e.keyManager.UseTx(ctx, tx, entryKey.UUID); err != nil {
+		return nil, errors.Join(err, ErrReadEntryFailed)
+	}
+
+	if err := e.recordEvent(ctx, tx, readEvent(UUID, entryKey)); err != nil {
+		return nil, errors.Join(err, ErrReadEntryFailed)
+	}
+
+	if err := e.recordAudit(ctx, tx, AuditRead, UUID, entryKey.UUID); err != nil {
+		return nil, errors.Join(err, ErrReadEntryFailed)
+	}
+
+	if err := e.model.Use(ctx, tx, UUID); err != nil {
+		return nil, errors.Join(err, ErrReadEntryFailed)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Join(ErrReadEntryFailed, err)
+	}
+	tx = nil
+	metrics.ObservePayloadSize("read", len(data))
+
+	return &Entry{
+		EntryMeta: EntryMeta{
+			UUID:           entry.UUID,
+			DeleteKey:      entry.DeleteKey,
+			Created:        entry.Created,
+			Accessed:       entry.Accessed.Time,
+			ContentType:    entry.ContentType,
+			Expire:         entryKey.Expire,
+			RemainingReads: entryKey.RemainingReads,
+		},
+		Data: data,
+	}, nil
+}
+
 func (e *EntryManager) DeleteEntry(ctx context.Context, UUID string, deleteKey string) error {
 	tx, err := e.db.BeginTx(ctx, nil)
 	if err != nil {
 		return errors.Join(ErrDeleteEntryFailed, err)
 	}
+	defer metrics.TransactionTimer("delete_entry").ObserveDuration()
 	defer func() {
 		if tx != nil {
 			_ = tx.Rollback()
@@ -229,6 +573,14 @@ func (e *EntryManager) DeleteEntry(ctx context.Context, UUID string, deleteKey s
 		return errors.Join(ErrDeleteEntryFailed, err)
 	}
 
+	if err := e.recordEvent(ctx, tx, Event{Type: EventDeleted, EntryUUID: UUID}); err != nil {
+		return errors.Join(ErrDeleteEntryFailed, err)
+	}
+
+	if err := e.recordAudit(ctx, tx, AuditDeleted, UUID, ""); err != nil {
+		return errors.Join(ErrDeleteEntryFailed, err)
+	}
+
 	if err := tx.Commit(); err != nil {
 		return errors.Join(ErrDeleteEntryFailed, err)
 	}
@@ -236,18 +588,264 @@ func (e *EntryManager) DeleteEntry(ctx context.Context, UUID string, deleteKey s
 	return nil
 }
 
+// checkDeleteKey returns ErrInvalidDeleteKey when the deleteKey does not
+// belong to the entry
+func (e *EntryManager) checkDeleteKey(ctx context.Context, tx *sql.Tx, UUID string, deleteKey string) error {
+	meta, err := e.model.ReadEntryMeta(ctx, tx, UUID)
+	if err != nil {
+		if errors.Is(err, models.ErrEntryNotFound) {
+			return ErrEntryNotFound
+		}
+		return err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(meta.DeleteKey)), []byte(deleteKey)) != 1 {
+		return ErrInvalidDeleteKey
+	}
+
+	return nil
+}
+
+// ListEntryKeys returns the keys of the entry
+// The deleteKey authenticates the owner of the entry
+func (e *EntryManager) ListEntryKeys(ctx context.Context, UUID string, deleteKey string) ([]EntryKey, error) {
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Join(ErrReadEntryFailed, err)
+	}
+	defer metrics.TransactionTimer("list_entry_keys").ObserveDuration()
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err := e.checkDeleteKey(ctx, tx, UUID, deleteKey); err != nil {
+		return nil, err
+	}
+
+	entryKeys, err := e.keyManager.ListTx(ctx, tx, UUID)
+	if err != nil {
+		return nil, errors.Join(ErrReadEntryFailed, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Join(ErrReadEntryFailed, err)
+	}
+	tx = nil
+
+	return entryKeys, nil
+}
+
+// ListAuditEvents returns the audit log of the entry, the oldest event first
+// The deleteKey authenticates the owner of the entry
+func (e *EntryManager) ListAuditEvents(ctx context.Context, UUID string, deleteKey string) ([]AuditEvent, error) {
+	if e.audit == nil {
+		return nil, ErrAuditDisabled
+	}
+
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Join(ErrReadEntryFailed, err)
+	}
+	defer metrics.TransactionTimer("list_audit_events").ObserveDuration()
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err := e.checkDeleteKey(ctx, tx, UUID, deleteKey); err != nil {
+		return nil, err
+	}
+
+	events, err := e.audit.ListTx(ctx, tx, UUID)
+	if err != nil {
+		return nil, errors.Join(ErrReadEntryFailed, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Join(ErrReadEntryFailed, err)
+	}
+	tx = nil
+
+	return events, nil
+}
+
+// DeleteEntryKey revokes a key of the entry, the entry and its other keys
+// can still be used
+// The deleteKey authenticates the owner of the entry
+func (e *EntryManager) DeleteEntryKey(ctx context.Context, UUID string, deleteKey string, keyUUID string) error {
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Join(ErrEntryKeyDeleteFailed, err)
+	}
+	defer metrics.TransactionTimer("delete_entry_key").ObserveDuration()
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err := e.checkDeleteKey(ctx, tx, UUID, deleteKey); err != nil {
+		return err
+	}
+
+	if err := e.keyManager.DeleteTx(ctx, tx, UUID, keyUUID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Join(ErrEntryKeyDeleteFailed, err)
+	}
+	tx = nil
+
+	return nil
+}
+
+// updateEntryKeyTx applies the new expiration and remaining reads to the
+// entry key and returns the updated entry key
+func (e *EntryManager) updateEntryKeyTx(ctx context.Context, tx *sql.Tx, entryKey EntryKey, expire *time.Duration, maxReads *int) (*EntryKey, error) {
+	var expireAt *time.Time
+	if expire != nil {
+		fromNow := time.Now().Add(*expire)
+		expireAt = &fromNow
+	}
+
+	if err := e.keyManager.UpdateTx(ctx, tx, entryKey.UUID, expireAt, maxReads); err != nil {
+		return nil, err
+	}
+
+	if expireAt != nil {
+		entryKey.Expire = *expireAt
+	}
+
+	if maxReads != nil {
+		entryKey.RemainingReads = *maxReads
+		entryKey.HasReadLimit = true
+	}
+
+	return &entryKey, nil
+}
+
+// raisesEntryKeyLimit reports whether the new expiration or remaining reads
+// would allow more access to the entry than the current limits of the key
+func raisesEntryKeyLimit(entryKey EntryKey, expire *time.Duration, maxReads *int) bool {
+	if maxReads != nil && entryKey.HasReadLimit && *maxReads > entryKey.RemainingReads {
+		return true
+	}
+
+	if expire != nil && !entryKey.Expire.IsZero() && time.Now().Add(*expire).After(entryKey.Expire) {
+		return true
+	}
+
+	return false
+}
+
+// UpdateEntryKey changes the expiration and the remaining reads of a key of
+// the entry, the nil values are left unchanged
+// The deleteKey authenticates the owner of the entry
+func (e *EntryManager) UpdateEntryKey(ctx context.Context, UUID string, deleteKey string, keyUUID string, expire *time.Duration, maxReads *int) (*EntryKey, error) {
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Join(ErrEntryKeyUpdateFailed, err)
+	}
+	defer metrics.TransactionTimer("update_entry_key").ObserveDuration()
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err := e.checkDeleteKey(ctx, tx, UUID, deleteKey); err != nil {
+		return nil, err
+	}
+
+	entryKeys, err := e.keyManager.ListTx(ctx, tx, UUID)
+	if err != nil {
+		return nil, errors.Join(ErrEntryKeyUpdateFailed, err)
+	}
+
+	var updated *EntryKey
+	for _, entryKey := range entryKeys {
+		if entryKey.UUID != keyUUID {
+			continue
+		}
+
+		updated, err = e.updateEntryKeyTx(ctx, tx, entryKey, expire, maxReads)
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	if updated == nil {
+		return nil, ErrEntryKeyNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Join(ErrEntryKeyUpdateFailed, err)
+	}
+	tx = nil
+
+	return updated, nil
+}
+
+// UpdateEntryKeyByKey changes the expiration and the remaining reads of the
+// key k, the nil values are left unchanged
+// The passphrase unlocks the key when it is protected
+// The holder of the key can only lower the limits of the key,
+// ErrEntryKeyLimitRaised is returned otherwise
+func (e *EntryManager) UpdateEntryKeyByKey(ctx context.Context, UUID string, k key.Key, passphrase []byte, expire *time.Duration, maxReads *int) (*EntryKey, error) {
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Join(ErrEntryKeyUpdateFailed, err)
+	}
+	defer metrics.TransactionTimer("update_entry_key_by_key").ObserveDuration()
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	_, entryKey, err := e.keyManager.GetDEKTx(ctx, tx, UUID, k, passphrase)
+	if err != nil {
+		err = finishFailedTx(tx, err)
+		tx = nil
+		return nil, err
+	}
+
+	if raisesEntryKeyLimit(*entryKey, expire, maxReads) {
+		return nil, ErrEntryKeyLimitRaised
+	}
+
+	updated, err := e.updateEntryKeyTx(ctx, tx, *entryKey, expire, maxReads)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Join(ErrEntryKeyUpdateFailed, err)
+	}
+	tx = nil
+
+	return updated, nil
+}
+
 func (e *EntryManager) DeleteExpired(ctx context.Context) error {
 	tx, err := e.db.BeginTx(ctx, nil)
 	if err != nil {
 		return errors.Join(DeleteExpiredFailed, err)
 	}
+	defer metrics.TransactionTimer("delete_expired").ObserveDuration()
 	defer func() {
 		if tx != nil {
 			_ = tx.Rollback()
 		}
 	}()
 
-	if err := e.model.DeleteExpired(ctx, tx); err != nil {
+	deleted, err := e.model.DeleteExpired(ctx, tx)
+	if err != nil {
 		return errors.Join(DeleteExpiredFailed, err)
 	}
 
@@ -255,10 +853,13 @@ func (e *EntryManager) DeleteExpired(ctx context.Context) error {
 		return errors.Join(DeleteExpiredFailed, err)
 	}
 	tx = nil
+	metrics.ExpiredDeleted.WithLabelValues("entry").Add(float64(deleted))
 	return nil
 }
 
-func (e *EntryManager) GenerateEntryKey(ctx context.Context, entryUUID string, k key.Key, expire *time.Duration, maxReads *int) (*EntryKeyData, error) {
+// GenerateEntryKey creates a new key for the entry
+// The passphrase unlocks the key k, the newPassphrase protects the new key
+func (e *EntryManager) GenerateEntryKey(ctx context.Context, entryUUID string, k key.Key, passphrase []byte, expire *time.Duration, maxReads *int, newPassphrase []byte) (*EntryKeyData, error) {
 	var expireAt *time.Time
 
 	if expire != nil {
@@ -266,10 +867,32 @@ func (e *EntryManager) GenerateEntryKey(ctx context.Context, entryUUID string, k
 		expireAt = &fromNow
 	}
 
-	meta, kek, err := e.keyManager.GenerateEncryptionKey(ctx, entryUUID, k, expireAt, maxReads)
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer metrics.TransactionTimer("generate_entry_key").ObserveDuration()
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	meta, kek, err := e.keyManager.GenerateEncryptionKeyTx(ctx, tx, entryUUID, k, passphrase, expireAt, maxReads, newPassphrase)
 	if err != nil {
+		err = finishFailedTx(tx, err)
+		tx = nil
+		return nil, err
+	}
+
+	if err := e.recordAudit(ctx, tx, AuditKeyCreated, entryUUID, meta.UUID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
+	tx = nil
 
 	return &EntryKeyData{
 		EntryUUID:      entryUUID,
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Ajnasz/sekret.link/internal/ciphersuite"
 	"github.com/Ajnasz/sekret.link/internal/key"
 	"github.com/Ajnasz/sekret.link/internal/models"
 	"github.com/DATA-DOG/go-sqlmock"
@@ -40,7 +41,7 @@ func Test_EntryService_Create(t *testing.T) {
 		}, nil)
 
 	entryCrypto := new(MockEntryCrypto)
-	entryCrypto.On("Encrypt", data).Return(encryptedData, nil)
+	entryCrypto.On("Encrypt", data, mock.Anything).Return(encryptedData, nil)
 	crypto := func(key key.Key) Encrypter {
 		return entryCrypto
 	}
@@ -51,7 +52,7 @@ func Test_EntryService_Create(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	keyManager.On("CreateWithTx", ctx, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&EntryKey{
+	keyManager.On("CreateWithTx", ctx, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&EntryKey{
 		RemainingReads: 1,
 		Expire:         time.Now().Add(time.Minute),
 	}, *kek, nil)
@@ -59,7 +60,7 @@ func Test_EntryService_Create(t *testing.T) {
 	service := NewEntryManager(db, entryModel, crypto, keyManager)
 	expire := time.Minute
 	maxReads := 1
-	meta, key, err := service.CreateEntry(ctx, "text/plain", data, &expire, &maxReads)
+	meta, key, err := service.CreateEntry(ctx, "text/plain", data, &expire, &maxReads, nil, nil)
 
 	assert.NoError(t, err)
 	assert.NotNil(t, meta)
@@ -110,7 +111,7 @@ func TestCreateError(t *testing.T) {
 		Return(&models.EntryMeta{}, fmt.Errorf("error"))
 
 	entryCrypto := new(MockEntryCrypto)
-	entryCrypto.On("Encrypt", data).Return(encryptedData, nil)
+	entryCrypto.On("Encrypt", data, mock.Anything).Return(encryptedData, nil)
 	crypto := func(key key.Key) Encrypter {
 		return entryCrypto
 	}
@@ -120,7 +121,7 @@ func TestCreateError(t *testing.T) {
 	service := NewEntryManager(db, entryModel, crypto, keyManager)
 	expire := time.Minute
 	maxReads := 1
-	meta, key, err := service.CreateEntry(ctx, "text/plain", data, &expire, &maxReads)
+	meta, key, err := service.CreateEntry(ctx, "text/plain", data, &expire, &maxReads, nil, nil)
 
 	assert.Error(t, err)
 	assert.Nil(t, meta)
@@ -168,7 +169,7 @@ func TestReadEntry(t *testing.T) {
 		}
 
 		entryCrypto := new(MockEntryCrypto)
-		entryCrypto.On("Decrypt", []byte("encrypted")).Return([]byte("data"), nil)
+		entryCrypto.On("Decrypt", []byte("encrypted"), entryDataAD("uuid", "")).Return([]byte("data"), nil)
 
 		crypto := func(key key.Key) Encrypter {
 			return entryCrypto
@@ -181,13 +182,13 @@ func TestReadEntry(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		keyManager.On("GetDEKTx", ctx, mock.Anything, "uuid", *k).Return(*dek, &EntryKey{
+		keyManager.On("GetDEKTx", ctx, mock.Anything, "uuid", *k, []byte(nil)).Return(*dek, &EntryKey{
 			UUID: "entrykey uuid",
 		}, nil)
 		keyManager.On("UseTx", ctx, mock.Anything, "entrykey uuid").Return(nil)
 
 		service := NewEntryManager(db, entryModel, crypto, keyManager)
-		data, err := service.ReadEntry(ctx, "uuid", *k)
+		data, err := service.ReadEntry(ctx, "uuid", *k, nil)
 
 		assert.NoError(t, err)
 		assert.NotNil(t, data)
@@ -234,7 +235,7 @@ func TestReadEntry(t *testing.T) {
 
 		k, err := key.NewGeneratedKey()
 		assert.NoError(t, err)
-		data, err := service.ReadEntry(ctx, "uuid", *k)
+		data, err := service.ReadEntry(ctx, "uuid", *k, nil)
 
 		assert.Error(t, err)
 		assert.Nil(t, data)
@@ -270,7 +271,7 @@ func TestReadEntryError(t *testing.T) {
 	keyManager := new(MockEntryKeyer)
 
 	service := NewEntryManager(db, entryModel, crypto, keyManager)
-	data, err := service.ReadEntry(ctx, "uuid", []byte("key"))
+	data, err := service.ReadEntry(ctx, "uuid", []byte("key"), nil)
 
 	assert.Error(t, err, ErrEntryNotFound)
 	assert.Nil(t, data)
@@ -405,7 +406,7 @@ func Test_EntryManager_DeleteExpired(t *testing.T) {
 		entryModel := new(models.MockEntryModel)
 		entryModel.
 			On("DeleteExpired", ctx, mock.Anything).
-			Return(nil)
+			Return(int64(1), nil)
 
 		entryCrypto := new(MockEntryCrypto)
 		crypto := func(key key.Key) Encrypter {
@@ -440,7 +441,7 @@ func Test_EntryManager_DeleteExpired(t *testing.T) {
 		entryModel := new(models.MockEntryModel)
 		entryModel.
 			On("DeleteExpired", ctx, mock.Anything).
-			Return(fmt.Errorf("error"))
+			Return(int64(0), fmt.Errorf("error"))
 
 		entryCrypto := new(MockEntryCrypto)
 		crypto := func(key key.Key) Encrypter {
@@ -477,19 +478,34 @@ func Test_EntryManager_GenerateEntryKey(t *testing.T) {
 		expire := time.Minute
 		remainingReads := 1
 
+		db, sqlMock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectCommit()
+
 		keyManager := new(MockEntryKeyer)
-		keyManager.On("GenerateEncryptionKey", mock.Anything, entryUUID, *dek, mock.Anything, mock.Anything).
+		keyManager.On("GenerateEncryptionKeyTx", mock.Anything, mock.Anything, entryUUID, *dek, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 			Return(&EntryKey{
+				UUID:           "key-uuid",
 				EntryUUID:      entryUUID,
 				RemainingReads: remainingReads,
 				Expire:         time.Now().Add(expire),
 			}, *kek, nil)
 
-		service := NewEntryManager(nil, nil, nil, keyManager)
+		audit := new(MockAuditRecorder)
+		audit.On("RecordTx", mock.Anything, mock.Anything, AuditKeyCreated, entryUUID, "key-uuid").Return(nil)
+
+		service := NewEntryManager(db, nil, nil, keyManager).WithAudit(audit)
 
-		entryKey, err := service.GenerateEntryKey(context.Background(), entryUUID, *dek, &expire, &remainingReads)
+		entryKey, err := service.GenerateEntryKey(context.Background(), entryUUID, *dek, nil, &expire, &remainingReads, nil)
 
 		assert.NoError(t, err)
+		audit.AssertExpectations(t)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
 		assert.Equal(t, entryUUID, entryKey.EntryUUID)
 		assert.Equal(t, *kek, entryKey.KEK)
 	})
@@ -504,18 +520,570 @@ func Test_EntryManager_GenerateEntryKey(t *testing.T) {
 		var emptyEntryKey *EntryKey
 		var emptyKey key.Key
 
+		db, sqlMock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectRollback()
+
 		keyManager := new(MockEntryKeyer)
-		keyManager.On("GenerateEncryptionKey", mock.Anything, entryUUID, *dek, mock.Anything, mock.Anything).
+		keyManager.On("GenerateEncryptionKeyTx", mock.Anything, mock.Anything, entryUUID, *dek, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 			Return(emptyEntryKey, emptyKey, fmt.Errorf("error"))
 
 		expire := time.Minute
 		remainingReads := 1
 
-		service := NewEntryManager(nil, nil, nil, keyManager)
+		service := NewEntryManager(db, nil, nil, keyManager)
 
-		entryKey, err := service.GenerateEntryKey(context.Background(), entryUUID, *dek, &expire, &remainingReads)
+		entryKey, err := service.GenerateEntryKey(context.Background(), entryUUID, *dek, nil, &expire, &remainingReads, nil)
 
 		assert.Error(t, err)
 		assert.Nil(t, entryKey)
+		assert.NoError(t, sqlMock.ExpectationsWereMet())
+	})
+}
+
+func Test_EntryService_CreateClientEncrypted(t *testing.T) {
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectCommit()
+
+	ctx := context.Background()
+
+	data := []byte("encrypted by the client")
+	keyHash := []byte("key hash")
+	entryModel := new(models.MockEntryModel)
+	entryModel.
+		On("CreateClientEncryptedEntry", ctx, mock.Anything, mock.Anything, data).
+		Return(&models.EntryMeta{
+			UUID:            "uuid",
+			DeleteKey:       "delete_key",
+			Created:         timenow,
+			ClientEncrypted: true,
+		}, nil)
+
+	// the data must not be encrypted by the server
+	entryCrypto := new(MockEntryCrypto)
+	crypto := func(key key.Key) Encrypter {
+		return entryCrypto
+	}
+
+	keyManager := new(MockEntryKeyer)
+	keyManager.On("CreateKeyHashWithTx", ctx, mock.Anything, mock.Anything, keyHash, mock.Anything, mock.Anything).Return(&EntryKey{
+		RemainingReads: 1,
+		Expire:         time.Now().Add(time.Minute),
+	}, nil)
+
+	service := NewEntryManager(db, entryModel, crypto, keyManager)
+	expire := time.Minute
+	maxReads := 1
+	meta, err := service.CreateClientEncryptedEntry(ctx, "text/plain", data, keyHash, &expire, &maxReads)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "uuid", meta.UUID)
+	assert.Equal(t, "delete_key", meta.DeleteKey)
+	assert.Equal(t, 1, meta.RemainingReads)
+
+	entryModel.AssertExpectations(t)
+	keyManager.AssertExpectations(t)
+	entryCrypto.AssertExpectations(t)
+	if err := sqlMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func Test_EntryService_ReadClientEncrypted(t *testing.T) {
+	t.Run("should return the stored data", func(t *testing.T) {
+		db, sqlMock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectCommit()
+
+		ctx := context.Background()
+		keyHash := []byte("key hash")
+
+		entryModel := new(models.MockEntryModel)
+		entryModel.
+			On("ReadEntry", ctx, mock.Anything, "uuid").
+			Return(&models.Entry{
+				EntryMeta: models.EntryMeta{
+					UUID:            "uuid",
+					ClientEncrypted: true,
+				},
+				Data: []byte("encrypted"),
+			}, nil)
+		entryModel.
+			On("Use", ctx, mock.Anything, "uuid").
+			Return(nil)
+
+		keyManager := new(MockEntryKeyer)
+		keyManager.On("FindByKeyHashTx", ctx, mock.Anything, "uuid", keyHash).Return(&EntryKey{
+			UUID: "entrykey uuid",
+		}, nil)
+		keyManager.On("UseTx", ctx, mock.Anything, "entrykey uuid").Return(nil)
+
+		service := NewEntryManager(db, entryModel, nil, keyManager)
+		entry, err := service.ReadClientEncryptedEntry(ctx, "uuid", keyHash)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("encrypted"), entry.Data)
+
+		entryModel.AssertExpectations(t)
+		keyManager.AssertExpectations(t)
 	})
+
+	t.Run("should not return server encrypted entries", func(t *testing.T) {
+		db, sqlMock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectRollback()
+
+		ctx := context.Background()
+
+		entryModel := new(models.MockEntryModel)
+		entryModel.
+			On("ReadEntry", ctx, mock.Anything, "uuid").
+			Return(&models.Entry{
+				EntryMeta: models.EntryMeta{UUID: "uuid"},
+				Data:      []byte("encrypted"),
+			}, nil)
+
+		keyManager := new(MockEntryKeyer)
+
+		service := NewEntryManager(db, entryModel, nil, keyManager)
+		_, err = service.ReadClientEncryptedEntry(ctx, "uuid", []byte("key hash"))
+
+		assert.ErrorIs(t, err, ErrEntryNotFound)
+		keyManager.AssertExpectations(t)
+	})
+}
+
+func Test_EntryManager_ListEntryKeys(t *testing.T) {
+	t.Run("list the keys with the delete key", func(t *testing.T) {
+		db, sqlMock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectCommit()
+
+		ctx := context.Background()
+
+		entryModel := new(models.MockEntryModel)
+		entryModel.On("ReadEntryMeta", ctx, mock.Anything, "uuid").
+			Return(&models.EntryMeta{UUID: "uuid", DeleteKey: "delete_key"}, nil)
+
+		keyManager := new(MockEntryKeyer)
+		keyManager.On("ListTx", ctx, mock.Anything, "uuid").
+			Return([]EntryKey{{UUID: "key-uuid", EntryUUID: "uuid"}}, nil)
+
+		service := NewEntryManager(db, entryModel, nil, keyManager)
+		entryKeys, err := service.ListEntryKeys(ctx, "uuid", "delete_key")
+
+		assert.NoError(t, err)
+		assert.Len(t, entryKeys, 1)
+		assert.Equal(t, "key-uuid", entryKeys[0].UUID)
+
+		entryModel.AssertExpectations(t)
+		keyManager.AssertExpectations(t)
+		if sqlMock.ExpectationsWereMet() != nil {
+			t.Errorf("there were unfulfilled expectations: %s", sqlMock.ExpectationsWereMet())
+		}
+	})
+
+	t.Run("invalid delete key", func(t *testing.T) {
+		db, sqlMock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectRollback()
+
+		ctx := context.Background()
+
+		entryModel := new(models.MockEntryModel)
+		entryModel.On("ReadEntryMeta", ctx, mock.Anything, "uuid").
+			Return(&models.EntryMeta{UUID: "uuid", DeleteKey: "delete_key"}, nil)
+
+		keyManager := new(MockEntryKeyer)
+
+		service := NewEntryManager(db, entryModel, nil, keyManager)
+		entryKeys, err := service.ListEntryKeys(ctx, "uuid", "wrong_key")
+
+		assert.ErrorIs(t, err, ErrInvalidDeleteKey)
+		assert.Nil(t, entryKeys)
+
+		entryModel.AssertExpectations(t)
+		keyManager.AssertExpectations(t)
+		if sqlMock.ExpectationsWereMet() != nil {
+			t.Errorf("there were unfulfilled expectations: %s", sqlMock.ExpectationsWereMet())
+		}
+	})
+}
+
+func Test_EntryManager_DeleteEntryKey(t *testing.T) {
+	t.Run("delete the key with the delete key", func(t *testing.T) {
+		db, sqlMock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectCommit()
+
+		ctx := context.Background()
+
+		entryModel := new(models.MockEntryModel)
+		entryModel.On("ReadEntryMeta", ctx, mock.Anything, "uuid").
+			Return(&models.EntryMeta{UUID: "uuid", DeleteKey: "delete_key"}, nil)
+
+		keyManager := new(MockEntryKeyer)
+		keyManager.On("DeleteTx", ctx, mock.Anything, "uuid", "key-uuid").Return(nil)
+
+		service := NewEntryManager(db, entryModel, nil, keyManager)
+		err = service.DeleteEntryKey(ctx, "uuid", "delete_key", "key-uuid")
+
+		assert.NoError(t, err)
+
+		entryModel.AssertExpectations(t)
+		keyManager.AssertExpectations(t)
+		if sqlMock.ExpectationsWereMet() != nil {
+			t.Errorf("there were unfulfilled expectations: %s", sqlMock.ExpectationsWereMet())
+		}
+	})
+
+	t.Run("entry not found", func(t *testing.T) {
+		db, sqlMock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectRollback()
+
+		ctx := context.Background()
+
+		entryModel := new(models.MockEntryModel)
+		entryModel.On("ReadEntryMeta", ctx, mock.Anything, "uuid").
+			Return((*models.EntryMeta)(nil), models.ErrEntryNotFound)
+
+		keyManager := new(MockEntryKeyer)
+
+		service := NewEntryManager(db, entryModel, nil, keyManager)
+		err = service.DeleteEntryKey(ctx, "uuid", "delete_key", "key-uuid")
+
+		assert.ErrorIs(t, err, ErrEntryNotFound)
+
+		entryModel.AssertExpectations(t)
+		keyManager.AssertExpectations(t)
+		if sqlMock.ExpectationsWereMet() != nil {
+			t.Errorf("there were unfulfilled expectations: %s", sqlMock.ExpectationsWereMet())
+		}
+	})
+}
+
+func Test_EntryManager_UpdateEntryKey(t *testing.T) {
+	t.Run("update the key with the delete key", func(t *testing.T) {
+		db, sqlMock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectCommit()
+
+		ctx := context.Background()
+		maxReads := 0
+
+		entryModel := new(models.MockEntryModel)
+		entryModel.On("ReadEntryMeta", ctx, mock.Anything, "uuid").
+			Return(&models.EntryMeta{UUID: "uuid", DeleteKey: "delete_key"}, nil)
+
+		keyManager := new(MockEntryKeyer)
+		keyManager.On("ListTx", ctx, mock.Anything, "uuid").
+			Return([]EntryKey{{UUID: "key-uuid", EntryUUID: "uuid", RemainingReads: 3}}, nil)
+		keyManager.On("UpdateTx", ctx, mock.Anything, "key-uuid", (*time.Time)(nil), &maxReads).Return(nil)
+
+		service := NewEntryManager(db, entryModel, nil, keyManager)
+		entryKey, err := service.UpdateEntryKey(ctx, "uuid", "delete_key", "key-uuid", nil, &maxReads)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, entryKey.RemainingReads)
+
+		entryModel.AssertExpectations(t)
+		keyManager.AssertExpectations(t)
+		if sqlMock.ExpectationsWereMet() != nil {
+			t.Errorf("there were unfulfilled expectations: %s", sqlMock.ExpectationsWereMet())
+		}
+	})
+
+	t.Run("key of an other entry", func(t *testing.T) {
+		db, sqlMock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectRollback()
+
+		ctx := context.Background()
+		maxReads := 0
+
+		entryModel := new(models.MockEntryModel)
+		entryModel.On("ReadEntryMeta", ctx, mock.Anything, "uuid").
+			Return(&models.EntryMeta{UUID: "uuid", DeleteKey: "delete_key"}, nil)
+
+		keyManager := new(MockEntryKeyer)
+		keyManager.On("ListTx", ctx, mock.Anything, "uuid").
+			Return([]EntryKey{{UUID: "key-uuid", EntryUUID: "uuid"}}, nil)
+
+		service := NewEntryManager(db, entryModel, nil, keyManager)
+		entryKey, err := service.UpdateEntryKey(ctx, "uuid", "delete_key", "other-key-uuid", nil, &maxReads)
+
+		assert.ErrorIs(t, err, ErrEntryKeyNotFound)
+		assert.Nil(t, entryKey)
+
+		entryModel.AssertExpectations(t)
+		keyManager.AssertExpectations(t)
+		if sqlMock.ExpectationsWereMet() != nil {
+			t.Errorf("there were unfulfilled expectations: %s", sqlMock.ExpectationsWereMet())
+		}
+	})
+}
+
+func Test_EntryManager_UpdateEntryKeyByKey(t *testing.T) {
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectCommit()
+
+	ctx := context.Background()
+	k, err := key.NewGeneratedKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dek, err := key.NewGeneratedKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expire := time.Hour
+
+	keyManager := new(MockEntryKeyer)
+	keyManager.On("GetDEKTx", ctx, mock.Anything, "uuid", *k, []byte(nil)).
+		Return(*dek, &EntryKey{UUID: "key-uuid", EntryUUID: "uuid", RemainingReads: 1}, nil)
+	keyManager.On("UpdateTx", ctx, mock.Anything, "key-uuid", mock.Anything, (*int)(nil)).Return(nil)
+
+	service := NewEntryManager(db, nil, nil, keyManager)
+	entryKey, err := service.UpdateEntryKeyByKey(ctx, "uuid", *k, nil, &expire, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, entryKey.RemainingReads)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), entryKey.Expire, time.Minute)
+
+	keyManager.AssertExpectations(t)
+	if sqlMock.ExpectationsWereMet() != nil {
+		t.Errorf("there were unfulfilled expectations: %s", sqlMock.ExpectationsWereMet())
+	}
+}
+
+func Test_EntryManager_UpdateEntryKeyByKey_LimitRaised(t *testing.T) {
+	maxReads := 3
+	expire := 2 * time.Hour
+	testCases := map[string]struct {
+		expire   *time.Duration
+		maxReads *int
+	}{
+		"more reads":        {maxReads: &maxReads},
+		"longer expiration": {expire: &expire},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db, sqlMock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectRollback()
+
+			ctx := context.Background()
+			k, err := key.NewGeneratedKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			keyManager := new(MockEntryKeyer)
+			keyManager.On("GetDEKTx", ctx, mock.Anything, "uuid", *k, []byte(nil)).
+				Return(key.Key{}, &EntryKey{
+					UUID:           "key-uuid",
+					EntryUUID:      "uuid",
+					RemainingReads: 2,
+					HasReadLimit:   true,
+					Expire:         time.Now().Add(time.Hour),
+				}, nil)
+
+			service := NewEntryManager(db, nil, nil, keyManager)
+			_, err = service.UpdateEntryKeyByKey(ctx, "uuid", *k, nil, tc.expire, tc.maxReads)
+
+			assert.ErrorIs(t, err, ErrEntryKeyLimitRaised)
+			keyManager.AssertNotCalled(t, "UpdateTx", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			assert.NoError(t, sqlMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_EntryManager_ReadEntryMeta(t *testing.T) {
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectCommit()
+
+	ctx := context.Background()
+	k, err := key.NewGeneratedKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dek, err := key.NewGeneratedKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := NewCipherEncrypter(dek.Get(), ciphersuite.XChaCha20Poly1305).Encrypt([]byte("foobar"), entryDataAD("uuid", "text/plain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entryModel := new(models.MockEntryModel)
+	entryModel.On("ReadEntry", ctx, mock.Anything, "uuid").
+		Return(&models.Entry{EntryMeta: models.EntryMeta{UUID: "uuid", ContentType: "text/plain"}, Data: encrypted}, nil)
+
+	keyManager := new(MockEntryKeyer)
+	keyManager.On("GetDEKTx", ctx, mock.Anything, "uuid", *k, []byte(nil)).
+		Return(*dek, &EntryKey{UUID: "key-uuid", EntryUUID: "uuid", RemainingReads: 2}, nil)
+
+	service := NewEntryManager(db, entryModel, func(k key.Key) Encrypter { return NewCipherEncrypter(k, ciphersuite.AES256GCM) }, keyManager)
+	meta, err := service.ReadEntryMeta(ctx, "uuid", *k, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain", meta.ContentType)
+	assert.Equal(t, 2, meta.RemainingReads)
+	assert.Equal(t, 6, meta.Size)
+
+	entryModel.AssertExpectations(t)
+	keyManager.AssertExpectations(t)
+	keyManager.AssertNotCalled(t, "UseTx", mock.Anything, mock.Anything, mock.Anything)
+	if sqlMock.ExpectationsWereMet() != nil {
+		t.Errorf("there were unfulfilled expectations: %s", sqlMock.ExpectationsWereMet())
+	}
+}
+
+func Test_EntryManager_ReadEntry_RebindLegacy(t *testing.T) {
+	ctx := context.Background()
+	k, err := key.NewGeneratedKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dek, err := key.NewGeneratedKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crypto := func(k key.Key) Encrypter { return NewCipherEncrypter(k, ciphersuite.AES256GCM) }
+	ad := entryDataAD("uuid", "text/plain")
+
+	legacy, err := NewAESEncrypter(dek.Get()).Encrypt([]byte("foobar"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bound, err := crypto(*dek).Encrypt([]byte("foobar"), ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		data   []byte
+		rebind bool
+	}{
+		"legacy data": {data: legacy, rebind: true},
+		"bound data":  {data: bound, rebind: false},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db, sqlMock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectCommit()
+
+			entryModel := new(models.MockEntryModel)
+			entryModel.On("ReadEntry", ctx, mock.Anything, "uuid").
+				Return(&models.Entry{EntryMeta: models.EntryMeta{UUID: "uuid", ContentType: "text/plain"}, Data: tc.data}, nil)
+			entryModel.On("Use", ctx, mock.Anything, "uuid").Return(nil)
+			if tc.rebind {
+				entryModel.On("SetData", ctx, mock.Anything, "uuid", mock.MatchedBy(func(data []byte) bool {
+					decrypted, err := crypto(*dek).(*CipherEncrypter).WithRejectLegacy(true).Decrypt(data, ad)
+					return err == nil && string(decrypted) == "foobar"
+				}), "").Return(nil)
+			}
+
+			keyManager := new(MockEntryKeyer)
+			keyManager.On("GetDEKTx", ctx, mock.Anything, "uuid", *k, []byte(nil)).
+				Return(*dek, &EntryKey{UUID: "key-uuid", EntryUUID: "uuid"}, nil)
+			keyManager.On("UseTx", ctx, mock.Anything, "key-uuid").Return(nil)
+
+			service := NewEntryManager(db, entryModel, crypto, keyManager)
+			entry, err := service.ReadEntry(ctx, "uuid", *k, nil)
+
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("foobar"), entry.Data)
+
+			entryModel.AssertExpectations(t)
+			if !tc.rebind {
+				entryModel.AssertNotCalled(t, "SetData", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+			keyManager.AssertExpectations(t)
+			if err := sqlMock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
 }
@@ -12,20 +12,28 @@ import (
 // EntryModel is the interface for the entry model
 // It is used to create, read and access entries
 type EntryModel interface {
-	CreateEntry(ctx context.Context, tx *sql.Tx, UUID string, contentType string, data []byte) (*models.EntryMeta, error)
+	CreateEntry(ctx context.Context, tx *sql.Tx, UUID string, contentType string, data []byte, masterKeyID string) (*models.EntryMeta, error)
+	CreateClientEncryptedEntry(ctx context.Context, tx *sql.Tx, UUID string, contentType string, data []byte, masterKeyID string) (*models.EntryMeta, error)
 	ReadEntry(ctx context.Context, tx *sql.Tx, UUID string) (*models.Entry, error)
+	ReadEntryMeta(ctx context.Context, tx *sql.Tx, UUID string) (*models.EntryMeta, error)
 	Use(ctx context.Context, tx *sql.Tx, UUID string) error
+	SetData(ctx context.Context, tx *sql.Tx, UUID string, data []byte, masterKeyID string) error
 	DeleteEntry(ctx context.Context, tx *sql.Tx, UUID string, deleteKey string) error
-	DeleteExpired(ctx context.Context, tx *sql.Tx) error
+	DeleteExpired(ctx context.Context, tx *sql.Tx) (int64, error)
 }
 
 // EntryKeyer is the interface for the entry key manager
 // It is used to create, read and access entry keys
 type EntryKeyer interface {
-	CreateWithTx(ctx context.Context, tx *sql.Tx, entryUUID string, dek key.Key, expire *time.Time, maxRead *int) (entryKey *EntryKey, kek key.Key, err error)
-	GetDEKTx(ctx context.Context, tx *sql.Tx, entryUUID string, kek key.Key) (dek key.Key, entryKey *EntryKey, err error)
-	GenerateEncryptionKey(ctx context.Context, entryUUID string, existingKey key.Key, expire *time.Time, maxRead *int) (*EntryKey, key.Key, error)
+	CreateWithTx(ctx context.Context, tx *sql.Tx, entryUUID string, dek key.Key, expire *time.Time, maxRead *int, passphrase []byte) (entryKey *EntryKey, kek key.Key, err error)
+	GetDEKTx(ctx context.Context, tx *sql.Tx, entryUUID string, kek key.Key, passphrase []byte) (dek key.Key, entryKey *EntryKey, err error)
+	GenerateEncryptionKeyTx(ctx context.Context, tx *sql.Tx, entryUUID string, existingKey key.Key, passphrase []byte, expire *time.Time, maxRead *int, newPassphrase []byte) (*EntryKey, key.Key, error)
 	UseTx(ctx context.Context, tx *sql.Tx, entryUUID string) error
+	CreateKeyHashWithTx(ctx context.Context, tx *sql.Tx, entryUUID string, keyHash []byte, expire *time.Time, maxRead *int) (*EntryKey, error)
+	FindByKeyHashTx(ctx context.Context, tx *sql.Tx, entryUUID string, keyHash []byte) (*EntryKey, error)
+	ListTx(ctx context.Context, tx *sql.Tx, entryUUID string) ([]EntryKey, error)
+	DeleteTx(ctx context.Context, tx *sql.Tx, entryUUID string, keyUUID string) error
+	UpdateTx(ctx context.Context, tx *sql.Tx, keyUUID string, expire *time.Time, maxReads *int) error
 }
 
 // EncrypterFactory is function to create a new Encrypter for a given key
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// ErrEntryLocked is returned when the entry is locked after too many failed
+// key attempts
+var ErrEntryLocked = errors.New("entry locked")
+
+// errAttemptRecorded marks the errors which come with a failed key attempt
+// recorded in the transaction
+var errAttemptRecorded = errors.New("failed attempt recorded")
+
+// ErrInvalidLockoutAction is returned when the lockout action is unknown
+var ErrInvalidLockoutAction = errors.New("invalid lockout action")
+
+// LockoutAction is what happens with an entry after too many failed key
+// attempts
+type LockoutAction string
+
+const (
+	// LockoutLock keeps the entry, but it can not be read anymore
+	LockoutLock LockoutAction = "lock"
+	// LockoutDelete deletes the entry and its keys
+	LockoutDelete LockoutAction = "delete"
+)
+
+// ParseLockoutAction converts the lock and delete values to a LockoutAction
+func ParseLockoutAction(value string) (LockoutAction, error) {
+	switch action := LockoutAction(value); action {
+	case LockoutLock, LockoutDelete:
+		return action, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidLockoutAction, value)
+	}
+}
+
+// EntryLockModel counts the failed key attempts of the entries and locks or
+// deletes them
+type EntryLockModel interface {
+	AddFailedKeyAttempt(ctx context.Context, tx *sql.Tx, uuid string) (int, error)
+	IsLocked(ctx context.Context, tx *sql.Tx, uuid string) (bool, error)
+	Lock(ctx context.Context, tx *sql.Tx, uuid string) error
+	Destroy(ctx context.Context, tx *sql.Tx, uuid string) error
+}
+
+// LockoutNotifier is notified in the transaction of the lockout when an
+// entry is locked or deleted after too many failed key attempts, the lockout
+// is rolled back when it returns an error
+type LockoutNotifier interface {
+	EntryLocked(ctx context.Context, tx *sql.Tx, entryUUID string, failedAttempts int, action LockoutAction) error
+}
+
+// LogLockoutNotifier logs the lockouts
+type LogLockoutNotifier struct{}
+
+// EntryLocked logs the lockout of the entry
+func (LogLockoutNotifier) EntryLocked(ctx context.Context, _ *sql.Tx, entryUUID string, failedAttempts int, action LockoutAction) error {
+	slog.WarnContext(ctx, "too many failed key attempts", "entry", entryUUID, "failed_attempts", failedAttempts, "action", action)
+	return nil
+}
+
+// LockoutNotifiers notifies every notifier of the list
+type LockoutNotifiers []LockoutNotifier
+
+// EntryLocked notifies the notifiers in order, it stops at the first error
+func (n LockoutNotifiers) EntryLocked(ctx context.Context, tx *sql.Tx, entryUUID string, failedAttempts int, action LockoutAction) error {
+	for _, notifier := range n {
+		if err := notifier.EntryLocked(ctx, tx, entryUUID, failedAttempts, action); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isRecordedFailure reports whether a failed attempt was recorded in the
+// transaction, so the callers should commit it instead of rolling it back
+func isRecordedFailure(err error) bool {
+	return errors.Is(err, ErrInvalidPassphrase) || errors.Is(err, errAttemptRecorded)
+}
+
+// finishFailedTx ends the transaction of the failed operation: it is
+// committed when a failed attempt was recorded in it, so the lockout counters
+// are kept, otherwise it is rolled back. The returned error is err joined with
+// the error of the commit or the rollback.
+func finishFailedTx(tx *sql.Tx, err error) error {
+	if isRecordedFailure(err) {
+		if commitErr := tx.Commit(); commitErr != nil {
+			return errors.Join(err, commitErr)
+		}
+
+		return err
+	}
+
+	if rollbackErr := tx.Rollback(); rollbackErr != nil {
+		return errors.Join(err, rollbackErr)
+	}
+
+	return err
+}
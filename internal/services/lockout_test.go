@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/Ajnasz/sekret.link/internal/key"
+	"github.com/Ajnasz/sekret.link/internal/models"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockEntryLockModel struct {
+	mock.Mock
+}
+
+func (m *MockEntryLockModel) AddFailedKeyAttempt(ctx context.Context, tx *sql.Tx, uuid string) (int, error) {
+	args := m.Called(ctx, tx, uuid)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockEntryLockModel) IsLocked(ctx context.Context, tx *sql.Tx, uuid string) (bool, error) {
+	args := m.Called(ctx, tx, uuid)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockEntryLockModel) Lock(ctx context.Context, tx *sql.Tx, uuid string) error {
+	args := m.Called(ctx, tx, uuid)
+	return args.Error(0)
+}
+
+func (m *MockEntryLockModel) Destroy(ctx context.Context, tx *sql.Tx, uuid string) error {
+	args := m.Called(ctx, tx, uuid)
+	return args.Error(0)
+}
+
+type MockLockoutNotifier struct {
+	mock.Mock
+}
+
+func (m *MockLockoutNotifier) EntryLocked(ctx context.Context, tx *sql.Tx, entryUUID string, failedAttempts int, action LockoutAction) error {
+	args := m.Called(ctx, tx, entryUUID, failedAttempts, action)
+	return args.Error(0)
+}
+
+func TestParseLockoutAction(t *testing.T) {
+	action, err := ParseLockoutAction("lock")
+	assert.NoError(t, err)
+	assert.Equal(t, LockoutLock, action)
+
+	action, err = ParseLockoutAction("delete")
+	assert.NoError(t, err)
+	assert.Equal(t, LockoutDelete, action)
+
+	_, err = ParseLockoutAction("destroy")
+	assert.ErrorIs(t, err, ErrInvalidLockoutAction)
+}
+
+func TestEntryKeyManager_KeyLockout(t *testing.T) {
+	entryUUID := "test-entry-uuid"
+	testCases := []struct {
+		name           string
+		failedAttempts int
+		action         LockoutAction
+		expectedErr    error
+	}{
+		{name: "below the limit", failedAttempts: 2, action: LockoutLock, expectedErr: ErrEntryKeyNotFound},
+		{name: "lock", failedAttempts: 3, action: LockoutLock, expectedErr: ErrEntryLocked},
+		{name: "delete", failedAttempts: 3, action: LockoutDelete, expectedErr: ErrEntryLocked},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, sqlMock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			ctx := context.Background()
+			model := &MockEntryKeyModel{}
+			lockModel := &MockEntryLockModel{}
+			notifier := &MockLockoutNotifier{}
+
+			sqlMock.ExpectBegin()
+			// the failed attempt is kept
+			sqlMock.ExpectCommit()
+			model.On("Get", ctx, mock.Anything, entryUUID).Return([]models.EntryKey{}, nil)
+			lockModel.On("IsLocked", ctx, mock.Anything, entryUUID).Return(false, nil)
+			lockModel.On("AddFailedKeyAttempt", ctx, mock.Anything, entryUUID).Return(tc.failedAttempts, nil)
+			if tc.failedAttempts >= 3 {
+				if tc.action == LockoutDelete {
+					lockModel.On("Destroy", ctx, mock.Anything, entryUUID).Return(nil)
+				} else {
+					lockModel.On("Lock", ctx, mock.Anything, entryUUID).Return(nil)
+				}
+				notifier.On("EntryLocked", ctx, mock.Anything, entryUUID, tc.failedAttempts, tc.action).Return(nil)
+			}
+
+			crypto := func(key key.Key) Encrypter {
+				return &EncrypterMock{}
+			}
+
+			manager := NewEntryKeyManager(db, model, &MockHasher{}, crypto).
+				WithKeyLockout(lockModel, 3, tc.action).
+				WithLockoutNotifier(notifier)
+			_, _, err = manager.GetDEK(ctx, entryUUID, []byte("test-key"), nil)
+
+			assert.ErrorIs(t, err, tc.expectedErr)
+			model.AssertExpectations(t)
+			lockModel.AssertExpectations(t)
+			notifier.AssertExpectations(t)
+			assert.NoError(t, sqlMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestEntryKeyManager_Locked(t *testing.T) {
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	entryUUID := "test-entry-uuid"
+	model := &MockEntryKeyModel{}
+	lockModel := &MockEntryLockModel{}
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectRollback()
+	lockModel.On("IsLocked", ctx, mock.Anything, entryUUID).Return(true, nil)
+
+	crypto := func(key key.Key) Encrypter {
+		return &EncrypterMock{}
+	}
+
+	manager := NewEntryKeyManager(db, model, &MockHasher{}, crypto).WithKeyLockout(lockModel, 3, LockoutLock)
+	_, _, err = manager.GetDEK(ctx, entryUUID, []byte("test-key"), nil)
+
+	assert.ErrorIs(t, err, ErrEntryLocked)
+	model.AssertNotCalled(t, "Get", mock.Anything, mock.Anything, mock.Anything)
+	lockModel.AssertExpectations(t)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_finishFailedTx(t *testing.T) {
+	testCases := map[string]struct {
+		err    error
+		commit bool
+	}{
+		"invalid passphrase": {err: ErrInvalidPassphrase, commit: true},
+		"recorded attempt":   {err: errors.Join(ErrEntryLocked, errAttemptRecorded), commit: true},
+		"other error":        {err: ErrEntryLocked, commit: false},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db, sqlMock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			sqlMock.ExpectBegin()
+			if tc.commit {
+				sqlMock.ExpectCommit()
+			} else {
+				sqlMock.ExpectRollback()
+			}
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = finishFailedTx(tx, tc.err)
+			assert.ErrorIs(t, err, tc.err)
+			assert.NoError(t, sqlMock.ExpectationsWereMet())
+		})
+	}
+}
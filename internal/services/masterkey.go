@@ -0,0 +1,39 @@
+package services
+
+import "errors"
+
+// ErrMasterKeyRequired is returned when the stored data is wrapped with a
+// master key, but the master keys are not configured
+var ErrMasterKeyRequired = errors.New("master key required")
+
+// MasterKey wraps the stored data with a server side key. The id of the key
+// is stored with the data, so the data wrapped with the former keys stays
+// readable while the keys are configured.
+type MasterKey interface {
+	Seal(plaintext []byte) (keyID string, sealed []byte, err error)
+	Open(keyID string, sealed []byte) ([]byte, error)
+}
+
+// sealBlob wraps the data with the master key, the data is stored as it is
+// when there is no master key
+func sealBlob(masterKey MasterKey, data []byte) (string, []byte, error) {
+	if masterKey == nil {
+		return "", data, nil
+	}
+
+	return masterKey.Seal(data)
+}
+
+// openBlob unwraps the data stored by sealBlob, the data without key id was
+// stored as it is
+func openBlob(masterKey MasterKey, keyID string, data []byte) ([]byte, error) {
+	if keyID == "" {
+		return data, nil
+	}
+
+	if masterKey == nil {
+		return nil, ErrMasterKeyRequired
+	}
+
+	return masterKey.Open(keyID, data)
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/Ajnasz/sekret.link/internal/hasher"
+	"github.com/Ajnasz/sekret.link/internal/key"
+	"github.com/Ajnasz/sekret.link/internal/masterkey"
+	"github.com/Ajnasz/sekret.link/internal/models"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestKeyring(t *testing.T) *masterkey.Keyring {
+	t.Helper()
+
+	keyring, err := masterkey.New([]masterkey.Key{{ID: "test", Secret: bytes.Repeat([]byte{1}, masterkey.KeySize)}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keyring
+}
+
+func Test_openBlob(t *testing.T) {
+	keyring := newTestKeyring(t)
+
+	data, err := openBlob(nil, "", []byte("legacy"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("legacy"), data, "the data stored without master key is returned as it is")
+
+	keyID, sealed, err := sealBlob(keyring, []byte("data"))
+	assert.NoError(t, err)
+
+	_, err = openBlob(nil, keyID, sealed)
+	assert.ErrorIs(t, err, ErrMasterKeyRequired)
+
+	data, err = openBlob(keyring, keyID, sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data"), data)
+}
+
+func Test_EntryManager_MasterKey(t *testing.T) {
+	keyring := newTestKeyring(t)
+	ctx := context.Background()
+
+	t.Run("create", func(t *testing.T) {
+		db, sqlMock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectCommit()
+
+		var stored []byte
+		entryModel := new(models.MockEntryModel)
+		entryModel.
+			On("CreateEntry", ctx, mock.Anything, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				stored = args.Get(3).([]byte)
+			}).
+			Return(&models.EntryMeta{UUID: "uuid"}, nil)
+
+		entryCrypto := new(MockEntryCrypto)
+		entryCrypto.On("Encrypt", []byte("data"), mock.Anything).Return([]byte("encrypted"), nil)
+
+		kek, err := key.NewGeneratedKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keyManager := new(MockEntryKeyer)
+		keyManager.On("CreateWithTx", ctx, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&EntryKey{}, *kek, nil)
+
+		service := NewEntryManager(db, entryModel, func(key.Key) Encrypter { return entryCrypto }, keyManager).WithMasterKey(keyring)
+		_, _, err = service.CreateEntry(ctx, "text/plain", []byte("data"), nil, nil, nil, nil)
+
+		assert.NoError(t, err)
+		assert.NotEqual(t, []byte("encrypted"), stored, "the encrypted data is wrapped with the master key")
+
+		opened, err := keyring.Open(keyring.CurrentID(), stored)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("encrypted"), opened)
+	})
+
+	t.Run("read", func(t *testing.T) {
+		testCases := []struct {
+			name        string
+			masterKeyID string
+			data        []byte
+		}{
+			{name: "wrapped", masterKeyID: keyring.CurrentID()},
+			{name: "stored before the master key", data: []byte("encrypted")},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				data := tc.data
+				if tc.masterKeyID != "" {
+					_, data, _ = keyring.Seal([]byte("encrypted"))
+				}
+
+				db, sqlMock, err := sqlmock.New()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer db.Close()
+
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectCommit()
+
+				entryModel := new(models.MockEntryModel)
+				entryModel.On("ReadEntry", ctx, mock.Anything, "uuid").Return(&models.Entry{
+					EntryMeta: models.EntryMeta{UUID: "uuid", MasterKeyID: tc.masterKeyID},
+					Data:      data,
+				}, nil)
+				entryModel.On("Use", ctx, mock.Anything, "uuid").Return(nil)
+
+				entryCrypto := new(MockEntryCrypto)
+				entryCrypto.On("Decrypt", []byte("encrypted"), entryDataAD("uuid", "")).Return([]byte("data"), nil)
+
+				k, err := key.NewGeneratedKey()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				keyManager := new(MockEntryKeyer)
+				keyManager.On("GetDEKTx", ctx, mock.Anything, "uuid", *k, []byte(nil)).Return(*k, &EntryKey{UUID: "key"}, nil)
+				keyManager.On("UseTx", ctx, mock.Anything, "key").Return(nil)
+
+				service := NewEntryManager(db, entryModel, func(key.Key) Encrypter { return entryCrypto }, keyManager).WithMasterKey(keyring)
+				entry, err := service.ReadEntry(ctx, "uuid", *k, nil)
+
+				assert.NoError(t, err)
+				assert.Equal(t, []byte("data"), entry.Data)
+				entryCrypto.AssertExpectations(t)
+			})
+		}
+	})
+
+	t.Run("read without the master key", func(t *testing.T) {
+		_, data, err := keyring.Seal([]byte("encrypted"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db, sqlMock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectRollback()
+
+		entryModel := new(models.MockEntryModel)
+		entryModel.On("ReadEntry", ctx, mock.Anything, "uuid").Return(&models.Entry{
+			EntryMeta: models.EntryMeta{UUID: "uuid", MasterKeyID: keyring.CurrentID()},
+			Data:      data,
+		}, nil)
+
+		k, err := key.NewGeneratedKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keyManager := new(MockEntryKeyer)
+		keyManager.On("GetDEKTx", ctx, mock.Anything, "uuid", *k, []byte(nil)).Return(*k, &EntryKey{UUID: "key"}, nil)
+
+		service := NewEntryManager(db, entryModel, func(key.Key) Encrypter { return new(MockEntryCrypto) }, keyManager)
+		_, err = service.ReadEntry(ctx, "uuid", *k, nil)
+
+		assert.ErrorIs(t, err, ErrMasterKeyRequired)
+		assert.ErrorIs(t, err, ErrReadEntryFailed)
+	})
+}
+
+func Test_EntryKeyManager_MasterKey(t *testing.T) {
+	keyring := newTestKeyring(t)
+
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	entryUUID := "test-entry-uuid"
+	dek, err := key.NewGeneratedKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stored models.EntryKey
+	model := &MockEntryKeyModel{}
+	model.On("Create", ctx, mock.Anything, entryUUID, mock.Anything, keyring.CurrentID(), mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		stored = models.EntryKey{
+			UUID:         "test-uuid",
+			EntryUUID:    entryUUID,
+			EncryptedKey: args.Get(3).([]byte),
+			MasterKeyID:  args.Get(4).(string),
+			KeyHash:      args.Get(5).([]byte),
+		}
+	}).Return(&models.EntryKey{UUID: "test-uuid"}, nil)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectCommit()
+
+	encrypter := func(k key.Key) Encrypter {
+		return NewAESEncrypter(k)
+	}
+	manager := NewEntryKeyManager(db, model, hasher.NewSHA256Hasher(), encrypter).WithMasterKey(keyring)
+	_, kek, err := manager.Create(ctx, entryUUID, *dek, nil, nil, nil)
+	assert.NoError(t, err)
+
+	model.On("Get", ctx, mock.Anything, entryUUID).Return([]models.EntryKey{stored}, nil)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectCommit()
+	foundDEK, _, err := manager.GetDEK(ctx, entryUUID, kek, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, *dek, foundDEK)
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectRollback()
+	_, _, err = NewEntryKeyManager(db, model, hasher.NewSHA256Hasher(), encrypter).GetDEK(ctx, entryUUID, kek, nil)
+	assert.ErrorIs(t, err, ErrMasterKeyRequired, "the wrapped keys can not be read without the master key")
+
+	model.AssertExpectations(t)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/Ajnasz/sekret.link/internal/metrics"
+	"github.com/Ajnasz/sekret.link/internal/models"
+)
+
+// ErrRotationIncomplete is returned when some rows could not be rewrapped,
+// the rotation can be run again after the problem is fixed
+var ErrRotationIncomplete = errors.New("master key rotation incomplete")
+
+// defaultRotationBatchSize is the number of the rows rewrapped in one
+// transaction
+const defaultRotationBatchSize = 100
+
+// RotatingMasterKey is a MasterKey which knows the id of the key it wraps the
+// new blobs with
+type RotatingMasterKey interface {
+	MasterKey
+	CurrentID() string
+}
+
+// RewrapModel reads and rewrites the wrapped blobs of a table
+type RewrapModel interface {
+	CountWrapped(ctx context.Context, tx *sql.Tx, exceptKeyID string) (int, error)
+	ListWrapped(ctx context.Context, tx *sql.Tx, exceptKeyID string, afterUUID string, limit int) ([]models.WrappedBlob, error)
+	Rewrap(ctx context.Context, tx *sql.Tx, blob models.WrappedBlob, newKeyID string, data []byte) (bool, error)
+}
+
+// RotationProgress is reported after every batch of a table
+type RotationProgress struct {
+	Table string
+	// Total is the number of the rows to rewrap when the table was started
+	Total int
+	// Rewrapped is the number of the rows wrapped with the current key
+	Rewrapped int
+	// Skipped is the number of the rows which were changed or deleted
+	// while they were rewrapped
+	Skipped int
+	// Failed is the number of the rows which could not be opened
+	Failed int
+}
+
+type rotationTable struct {
+	name  string
+	model RewrapModel
+}
+
+// MasterKeyRotator rewraps the stored blobs with the current master key. The
+// rows are rewrapped in small transactions, so the service keeps serving the
+// secrets while the rotation runs, and the rotation continues with the rows
+// which are not wrapped with the current key when it is run again.
+type MasterKeyRotator struct {
+	db        *sql.DB
+	masterKey RotatingMasterKey
+	tables    []rotationTable
+	batchSize int
+}
+
+// NewMasterKeyRotator creates a MasterKeyRotator which rewraps the entries,
+// the entry keys and the secrets of the webhooks and the queued events
+func NewMasterKeyRotator(db *sql.DB, masterKey RotatingMasterKey, entryModel RewrapModel, entryKeyModel RewrapModel, webhookModel RewrapModel, webhookEventModel RewrapModel) *MasterKeyRotator {
+	return &MasterKeyRotator{
+		db:        db,
+		masterKey: masterKey,
+		tables: []rotationTable{
+			{name: "entries", model: entryModel},
+			{name: "entry_key", model: entryKeyModel},
+			{name: "webhook", model: webhookModel},
+			{name: "webhook_event", model: webhookEventModel},
+		},
+		batchSize: defaultRotationBatchSize,
+	}
+}
+
+// WithBatchSize sets the number of the rows rewrapped in one transaction
+func (r *MasterKeyRotator) WithBatchSize(batchSize int) *MasterKeyRotator {
+	if batchSize > 0 {
+		r.batchSize = batchSize
+	}
+	return r
+}
+
+// Rotate rewraps every row which is not wrapped with the current master key,
+// the progress is called after every batch
+func (r *MasterKeyRotator) Rotate(ctx context.Context, progress func(RotationProgress)) error {
+	var failed int
+	for _, table := range r.tables {
+		p, err := r.rotateTable(ctx, table, progress)
+		if err != nil {
+			return fmt.Errorf("%s: %w", table.name, err)
+		}
+
+		failed += p.Failed
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%w: %d rows could not be opened", ErrRotationIncomplete, failed)
+	}
+
+	return nil
+}
+
+func (r *MasterKeyRotator) count(ctx context.Context, table rotationTable) (int, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	return table.model.CountWrapped(ctx, tx, r.masterKey.CurrentID())
+}
+
+func (r *MasterKeyRotator) rotateTable(ctx context.Context, table rotationTable, progress func(RotationProgress)) (RotationProgress, error) {
+	p := RotationProgress{Table: table.name}
+
+	total, err := r.count(ctx, table)
+	if err != nil {
+		return p, err
+	}
+	p.Total = total
+
+	afterUUID := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return p, err
+		}
+
+		last, n, err := r.rotateBatch(ctx, table, afterUUID, &p)
+		if err != nil {
+			return p, err
+		}
+
+		if progress != nil {
+			progress(p)
+		}
+
+		if n < r.batchSize {
+			return p, nil
+		}
+
+		afterUUID = last
+	}
+}
+
+// rotateBatch rewraps the next batch in a transaction, it returns the uuid
+// of the last row and the number of the rows in the batch
+func (r *MasterKeyRotator) rotateBatch(ctx context.Context, table rotationTable, afterUUID string, p *RotationProgress) (string, int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	defer metrics.TransactionTimer("rotate_master_key").ObserveDuration()
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	currentID := r.masterKey.CurrentID()
+	blobs, err := table.model.ListWrapped(ctx, tx, currentID, afterUUID, r.batchSize)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var rewrapped, skipped, failed int
+	for _, blob := range blobs {
+		data, err := openBlob(r.masterKey, blob.MasterKeyID, blob.Data)
+		if err != nil {
+			slog.Warn("can not open the blob", "table", table.name, "uuid", blob.UUID, "master_key_id", blob.MasterKeyID, "error", err)
+			failed++
+			continue
+		}
+
+		keyID, sealed, err := r.masterKey.Seal(data)
+		if err != nil {
+			return "", 0, err
+		}
+
+		ok, err := table.model.Rewrap(ctx, tx, blob, keyID, sealed)
+		if err != nil {
+			return "", 0, err
+		}
+
+		if ok {
+			rewrapped++
+		} else {
+			skipped++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", 0, err
+	}
+	tx = nil
+
+	p.Rewrapped += rewrapped
+	p.Skipped += skipped
+	p.Failed += failed
+
+	if len(blobs) == 0 {
+		return afterUUID, 0, nil
+	}
+
+	return blobs[len(blobs)-1].UUID, len(blobs), nil
+}
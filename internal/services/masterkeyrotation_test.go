@@ -0,0 +1,132 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/Ajnasz/sekret.link/internal/masterkey"
+	"github.com/Ajnasz/sekret.link/internal/models"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockRewrapModel struct {
+	mock.Mock
+}
+
+func (m *MockRewrapModel) CountWrapped(ctx context.Context, tx *sql.Tx, exceptKeyID string) (int, error) {
+	args := m.Called(ctx, tx, exceptKeyID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRewrapModel) ListWrapped(ctx context.Context, tx *sql.Tx, exceptKeyID string, afterUUID string, limit int) ([]models.WrappedBlob, error) {
+	args := m.Called(ctx, tx, exceptKeyID, afterUUID, limit)
+	return args.Get(0).([]models.WrappedBlob), args.Error(1)
+}
+
+func (m *MockRewrapModel) Rewrap(ctx context.Context, tx *sql.Tx, blob models.WrappedBlob, newKeyID string, data []byte) (bool, error) {
+	args := m.Called(ctx, tx, blob, newKeyID, data)
+	return args.Bool(0), args.Error(1)
+}
+
+func TestMasterKeyRotator_Rotate(t *testing.T) {
+	ctx := context.Background()
+
+	oldKey := masterkey.Key{ID: "old", Secret: bytes.Repeat([]byte{1}, masterkey.KeySize)}
+	newKey := masterkey.Key{ID: "new", Secret: bytes.Repeat([]byte{2}, masterkey.KeySize)}
+
+	old, err := masterkey.New([]masterkey.Key{oldKey}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := masterkey.New([]masterkey.Key{oldKey, newKey}, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, sealed, err := old.Seal([]byte("entry"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rewrappedTo := func(plaintext string) any {
+		return mock.MatchedBy(func(data []byte) bool {
+			opened, err := keyring.Open("new", data)
+			return err == nil && string(opened) == plaintext
+		})
+	}
+
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	entries := &MockRewrapModel{}
+	entries.On("CountWrapped", ctx, mock.Anything, "new").Return(3, nil)
+	entries.On("ListWrapped", ctx, mock.Anything, "new", "", 2).Return([]models.WrappedBlob{
+		{UUID: "a", Data: sealed, MasterKeyID: "old"},
+		{UUID: "b", Data: []byte("legacy"), MasterKeyID: ""},
+	}, nil)
+	entries.On("ListWrapped", ctx, mock.Anything, "new", "b", 2).Return([]models.WrappedBlob{
+		{UUID: "c", Data: sealed, MasterKeyID: "old"},
+	}, nil)
+	entries.On("Rewrap", ctx, mock.Anything, models.WrappedBlob{UUID: "a", Data: sealed, MasterKeyID: "old"}, "new", rewrappedTo("entry")).Return(true, nil)
+	entries.On("Rewrap", ctx, mock.Anything, models.WrappedBlob{UUID: "b", Data: []byte("legacy"), MasterKeyID: ""}, "new", rewrappedTo("legacy")).Return(true, nil)
+	entries.On("Rewrap", ctx, mock.Anything, models.WrappedBlob{UUID: "c", Data: sealed, MasterKeyID: "old"}, "new", rewrappedTo("entry")).Return(false, nil)
+
+	keys := &MockRewrapModel{}
+	keys.On("CountWrapped", ctx, mock.Anything, "new").Return(1, nil)
+	keys.On("ListWrapped", ctx, mock.Anything, "new", "", 2).Return([]models.WrappedBlob{
+		{UUID: "k", Data: sealed, MasterKeyID: "missing"},
+	}, nil)
+
+	webhooks := &MockRewrapModel{}
+	webhooks.On("CountWrapped", ctx, mock.Anything, "new").Return(1, nil)
+	webhooks.On("ListWrapped", ctx, mock.Anything, "new", "", 2).Return([]models.WrappedBlob{
+		{UUID: "w", Data: []byte("secret"), MasterKeyID: ""},
+	}, nil)
+	webhooks.On("Rewrap", ctx, mock.Anything, models.WrappedBlob{UUID: "w", Data: []byte("secret"), MasterKeyID: ""}, "new", rewrappedTo("secret")).Return(true, nil)
+
+	events := &MockRewrapModel{}
+	events.On("CountWrapped", ctx, mock.Anything, "new").Return(0, nil)
+	events.On("ListWrapped", ctx, mock.Anything, "new", "", 2).Return([]models.WrappedBlob{}, nil)
+
+	// the count and the two batches of the entries
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectRollback()
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectCommit()
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectCommit()
+	// the count and the batch of the keys, the webhooks and the events
+	for range 3 {
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectRollback()
+		sqlMock.ExpectBegin()
+		sqlMock.ExpectCommit()
+	}
+
+	var reported []RotationProgress
+	err = NewMasterKeyRotator(db, keyring, entries, keys, webhooks, events).WithBatchSize(2).Rotate(ctx, func(p RotationProgress) {
+		reported = append(reported, p)
+	})
+
+	assert.ErrorIs(t, err, ErrRotationIncomplete, "the key of an unknown master key is not rewrapped")
+	assert.Equal(t, []RotationProgress{
+		{Table: "entries", Total: 3, Rewrapped: 2},
+		{Table: "entries", Total: 3, Rewrapped: 2, Skipped: 1},
+		{Table: "entry_key", Total: 1, Failed: 1},
+		{Table: "webhook", Total: 1, Rewrapped: 1},
+		{Table: "webhook_event"},
+	}, reported)
+	entries.AssertExpectations(t)
+	keys.AssertExpectations(t)
+	webhooks.AssertExpectations(t)
+	events.AssertExpectations(t)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+}
@@ -18,8 +18,9 @@ func (m *MockEntryKeyer) Create(ctx context.Context,
 	dek key.Key,
 	expire *time.Time,
 	maxRead *int,
+	passphrase []byte,
 ) (*EntryKey, key.Key, error) {
-	args := m.Called(ctx, entryUUID, dek, expire, maxRead)
+	args := m.Called(ctx, entryUUID, dek, expire, maxRead, passphrase)
 	if args.Get(1) == nil {
 		return args.Get(0).(*EntryKey), nil, args.Error(2)
 	}
@@ -32,30 +33,48 @@ func (m *MockEntryKeyer) CreateWithTx(ctx context.Context,
 	dek key.Key,
 	expire *time.Time,
 	maxRead *int,
+	passphrase []byte,
 ) (*EntryKey, key.Key, error) {
-	args := m.Called(ctx, tx, entryUUID, dek, expire, maxRead)
+	args := m.Called(ctx, tx, entryUUID, dek, expire, maxRead, passphrase)
 	return args.Get(0).(*EntryKey), args.Get(1).(key.Key), args.Error(2)
 }
 
-func (m *MockEntryKeyer) GetDEK(ctx context.Context, entryUUID string, kek key.Key) (key.Key, *EntryKey, error) {
-	args := m.Called(ctx, entryUUID, kek)
+func (m *MockEntryKeyer) GetDEK(ctx context.Context, entryUUID string, kek key.Key, passphrase []byte) (key.Key, *EntryKey, error) {
+	args := m.Called(ctx, entryUUID, kek, passphrase)
 	return args.Get(0).(key.Key), args.Get(1).(*EntryKey), args.Error(2)
 }
 
-func (m *MockEntryKeyer) GetDEKTx(ctx context.Context, tx *sql.Tx, entryUUID string, kek key.Key) (key.Key, *EntryKey, error) {
-	args := m.Called(ctx, tx, entryUUID, kek)
+func (m *MockEntryKeyer) GetDEKTx(ctx context.Context, tx *sql.Tx, entryUUID string, kek key.Key, passphrase []byte) (key.Key, *EntryKey, error) {
+	args := m.Called(ctx, tx, entryUUID, kek, passphrase)
 	return args.Get(0).(key.Key), args.Get(1).(*EntryKey), args.Error(2)
 }
 
 func (m *MockEntryKeyer) GenerateEncryptionKey(ctx context.Context,
 	entryUUID string,
 	existingKey key.Key,
+	passphrase []byte,
 	expire *time.Time,
 	maxRead *int,
+	newPassphrase []byte,
 ) (*EntryKey,
 	key.Key,
 	error) {
-	args := m.Called(ctx, entryUUID, existingKey, expire, maxRead)
+	args := m.Called(ctx, entryUUID, existingKey, passphrase, expire, maxRead, newPassphrase)
+	return args.Get(0).(*EntryKey), args.Get(1).(key.Key), args.Error(2)
+}
+
+func (m *MockEntryKeyer) GenerateEncryptionKeyTx(ctx context.Context,
+	tx *sql.Tx,
+	entryUUID string,
+	existingKey key.Key,
+	passphrase []byte,
+	expire *time.Time,
+	maxRead *int,
+	newPassphrase []byte,
+) (*EntryKey,
+	key.Key,
+	error) {
+	args := m.Called(ctx, tx, entryUUID, existingKey, passphrase, expire, maxRead, newPassphrase)
 	return args.Get(0).(*EntryKey), args.Get(1).(key.Key), args.Error(2)
 }
 
@@ -64,16 +83,52 @@ func (m *MockEntryKeyer) UseTx(ctx context.Context, tx *sql.Tx, entryUUID string
 	return args.Error(0)
 }
 
+func (m *MockEntryKeyer) CreateKeyHashWithTx(ctx context.Context,
+	tx *sql.Tx,
+	entryUUID string,
+	keyHash []byte,
+	expire *time.Time,
+	maxRead *int,
+) (*EntryKey, error) {
+	args := m.Called(ctx, tx, entryUUID, keyHash, expire, maxRead)
+	return args.Get(0).(*EntryKey), args.Error(1)
+}
+
+func (m *MockEntryKeyer) FindByKeyHashTx(ctx context.Context, tx *sql.Tx, entryUUID string, keyHash []byte) (*EntryKey, error) {
+	args := m.Called(ctx, tx, entryUUID, keyHash)
+	return args.Get(0).(*EntryKey), args.Error(1)
+}
+
+func (m *MockEntryKeyer) ListTx(ctx context.Context, tx *sql.Tx, entryUUID string) ([]EntryKey, error) {
+	args := m.Called(ctx, tx, entryUUID)
+	return args.Get(0).([]EntryKey), args.Error(1)
+}
+
+func (m *MockEntryKeyer) DeleteTx(ctx context.Context, tx *sql.Tx, entryUUID string, keyUUID string) error {
+	args := m.Called(ctx, tx, entryUUID, keyUUID)
+	return args.Error(0)
+}
+
+func (m *MockEntryKeyer) UpdateTx(ctx context.Context, tx *sql.Tx, keyUUID string, expire *time.Time, maxReads *int) error {
+	args := m.Called(ctx, tx, keyUUID, expire, maxReads)
+	return args.Error(0)
+}
+
 type MockEntryCrypto struct {
 	mock.Mock
 }
 
-func (m *MockEntryCrypto) Encrypt(data []byte) ([]byte, error) {
-	args := m.Called(data)
+func (m *MockEntryCrypto) Encrypt(data []byte, additionalData []byte) ([]byte, error) {
+	args := m.Called(data, additionalData)
 	return args.Get(0).([]byte), args.Error(1)
 }
 
-func (m *MockEntryCrypto) Decrypt(data []byte) ([]byte, error) {
-	args := m.Called(data)
+func (m *MockEntryCrypto) Decrypt(data []byte, additionalData []byte) ([]byte, error) {
+	args := m.Called(data, additionalData)
 	return args.Get(0).([]byte), args.Error(1)
 }
+
+func (m *MockEntryCrypto) PlaintextSize(data []byte) int {
+	args := m.Called(data)
+	return args.Int(0)
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+var ErrCountFailed = errors.New("count failed")
+
+// CountModel counts the stored records
+type CountModel interface {
+	Count(ctx context.Context, tx *sql.Tx) (int, error)
+}
+
+// StatsManager provides the number of the live entries and keys
+type StatsManager struct {
+	db            *sql.DB
+	entryModel    CountModel
+	entryKeyModel CountModel
+}
+
+// NewStatsManager creates a StatsManager
+func NewStatsManager(db *sql.DB, entryModel CountModel, entryKeyModel CountModel) *StatsManager {
+	return &StatsManager{
+		db:            db,
+		entryModel:    entryModel,
+		entryKeyModel: entryKeyModel,
+	}
+}
+
+func (s *StatsManager) count(ctx context.Context, model CountModel) (int, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return 0, errors.Join(ErrCountFailed, err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	count, err := model.Count(ctx, tx)
+	if err != nil {
+		return 0, errors.Join(ErrCountFailed, err)
+	}
+
+	return count, nil
+}
+
+// CountEntries returns the number of the stored entries
+func (s *StatsManager) CountEntries(ctx context.Context) (int, error) {
+	return s.count(ctx, s.entryModel)
+}
+
+// CountEntryKeys returns the number of the entry keys which are not expired
+func (s *StatsManager) CountEntryKeys(ctx context.Context) (int, error) {
+	return s.count(ctx, s.entryKeyModel)
+}
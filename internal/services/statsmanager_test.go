@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Ajnasz/sekret.link/internal/models"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_StatsManager_CountEntries(t *testing.T) {
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectRollback()
+
+	entryModel := new(models.MockEntryModel)
+	entryModel.On("Count", ctx, mock.Anything).Return(3, nil)
+
+	manager := NewStatsManager(db, entryModel, new(models.MockEntryModel))
+	count, err := manager.CountEntries(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	entryModel.AssertExpectations(t)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func Test_StatsManager_CountEntryKeys_Error(t *testing.T) {
+	db, sqlMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectRollback()
+
+	entryKeyModel := new(models.MockEntryModel)
+	entryKeyModel.On("Count", ctx, mock.Anything).Return(0, fmt.Errorf("error"))
+
+	manager := NewStatsManager(db, new(models.MockEntryModel), entryKeyModel)
+	_, err = manager.CountEntryKeys(ctx)
+
+	assert.ErrorIs(t, err, ErrCountFailed)
+	entryKeyModel.AssertExpectations(t)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/models"
+)
+
+// ErrWebhooksDisabled is returned when an entry is created with a webhook,
+// but the entry manager does not record the events
+var ErrWebhooksDisabled = errors.New("webhooks are disabled")
+
+// EventType is the type of the entry events sent to the webhooks
+type EventType string
+
+const (
+	// EventRead is sent when the entry is read
+	EventRead EventType = "read"
+	// EventLastRead is sent when the entry is read with the last remaining
+	// read of the key
+	EventLastRead EventType = "last_read"
+	// EventExpired is sent when the expired entry is removed by the cleanup
+	EventExpired EventType = "expired"
+	// EventDeleted is sent when the entry is deleted with the delete key
+	EventDeleted EventType = "deleted"
+	// EventLocked is sent when the entry is locked or deleted after too many
+	// failed key attempts
+	EventLocked EventType = "locked"
+)
+
+// terminal reports whether the entry is gone after the event, so no more
+// events are sent to its webhook
+func (t EventType) terminal() bool {
+	return t == EventExpired || t == EventDeleted
+}
+
+// Webhook is the callback of an entry, the events are posted to the URL and
+// signed with the secret when it is not empty
+type Webhook struct {
+	URL    string
+	Secret []byte
+}
+
+// Event is the payload posted to the webhooks
+type Event struct {
+	Type           EventType     `json:"event"`
+	EntryUUID      string        `json:"uuid"`
+	KeyUUID        string        `json:"keyUUID,omitempty"`
+	Time           time.Time     `json:"time"`
+	FailedAttempts int           `json:"failedAttempts,omitempty"`
+	Action         LockoutAction `json:"action,omitempty"`
+}
+
+// EventRecorder records the events of the entries in the transaction of the
+// change, so they are delivered only when the change is committed
+type EventRecorder interface {
+	RegisterTx(ctx context.Context, tx *sql.Tx, entryUUID string, webhook Webhook) error
+	RecordTx(ctx context.Context, tx *sql.Tx, event Event) error
+}
+
+// ExpiredEventRecorder records the expiration of the entries removed by the
+// cleanup
+type ExpiredEventRecorder interface {
+	RecordExpiredTx(ctx context.Context, tx *sql.Tx) (int, error)
+}
+
+// WebhookModel stores the webhooks of the entries
+type WebhookModel interface {
+	Create(ctx context.Context, tx *sql.Tx, entryUUID string, url string, secret []byte, masterKeyID string) error
+	Get(ctx context.Context, tx *sql.Tx, entryUUID string) (*models.Webhook, error)
+	Delete(ctx context.Context, tx *sql.Tx, entryUUID string) error
+	ListOrphans(ctx context.Context, tx *sql.Tx, limit int) ([]models.Webhook, error)
+}
+
+// WebhookEventModel is the delivery queue of the events
+type WebhookEventModel interface {
+	Enqueue(ctx context.Context, tx *sql.Tx, entryUUID string, event string, url string, secret []byte, masterKeyID string, payload []byte) (*models.WebhookEvent, error)
+	ListDue(ctx context.Context, tx *sql.Tx, now time.Time, limit int) ([]models.WebhookEvent, error)
+	Claim(ctx context.Context, tx *sql.Tx, uuid string, now time.Time, until time.Time) (bool, error)
+	Retry(ctx context.Context, tx *sql.Tx, uuid string, nextAttempt time.Time, lastError string) error
+	Delete(ctx context.Context, tx *sql.Tx, uuid string) error
+}
+
+// expiredBatchSize is the number of the orphaned webhooks notified in one
+// cleanup run
+const expiredBatchSize = 1000
+
+// WebhookRecorder queues the events of the entries which have a webhook
+type WebhookRecorder struct {
+	model      WebhookModel
+	eventModel WebhookEventModel
+	masterKey  MasterKey
+	now        func() time.Time
+}
+
+// NewWebhookRecorder creates a WebhookRecorder
+func NewWebhookRecorder(model WebhookModel, eventModel WebhookEventModel) *WebhookRecorder {
+	return &WebhookRecorder{
+		model:      model,
+		eventModel: eventModel,
+		now:        time.Now,
+	}
+}
+
+// WithClock sets the function which returns the current time, for testing
+func (w *WebhookRecorder) WithClock(now func() time.Time) *WebhookRecorder {
+	w.now = now
+	return w
+}
+
+// WithMasterKey sets the master key which wraps the secrets of the webhooks,
+// the secrets are stored as they are without it
+func (w *WebhookRecorder) WithMasterKey(masterKey MasterKey) *WebhookRecorder {
+	w.masterKey = masterKey
+	return w
+}
+
+// RegisterTx stores the webhook of the entry
+func (w *WebhookRecorder) RegisterTx(ctx context.Context, tx *sql.Tx, entryUUID string, webhook Webhook) error {
+	secret, masterKeyID := webhook.Secret, ""
+	if len(webhook.Secret) > 0 {
+		var err error
+		masterKeyID, secret, err = sealBlob(w.masterKey, webhook.Secret)
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.model.Create(ctx, tx, entryUUID, webhook.URL, secret, masterKeyID)
+}
+
+// enqueue adds the event to the delivery queue of the webhook, the secret is
+// queued as it is stored, wrapped with the master key of the webhook
+func (w *WebhookRecorder) enqueue(ctx context.Context, tx *sql.Tx, webhook *models.Webhook, event Event) error {
+	if event.Time.IsZero() {
+		event.Time = w.now()
+	}
+	event.Time = event.Time.UTC()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.eventModel.Enqueue(ctx, tx, event.EntryUUID, string(event.Type), webhook.URL, webhook.Secret, webhook.MasterKeyID, payload)
+	return err
+}
+
+// RecordTx queues the event when the entry has a webhook, the webhook is
+// removed after the terminal events
+func (w *WebhookRecorder) RecordTx(ctx context.Context, tx *sql.Tx, event Event) error {
+	webhook, err := w.model.Get(ctx, tx, event.EntryUUID)
+	if err != nil {
+		if errors.Is(err, models.ErrWebhookNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if err := w.enqueue(ctx, tx, webhook, event); err != nil {
+		return err
+	}
+
+	if event.Type.terminal() {
+		return w.model.Delete(ctx, tx, event.EntryUUID)
+	}
+
+	return nil
+}
+
+// RecordExpiredTx queues the expired event for the webhooks whose entry was
+// removed, it returns the number of the queued events
+func (w *WebhookRecorder) RecordExpiredTx(ctx context.Context, tx *sql.Tx) (int, error) {
+	webhooks, err := w.model.ListOrphans(ctx, tx, expiredBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, webhook := range webhooks {
+		if err := w.enqueue(ctx, tx, &webhook, Event{Type: EventExpired, EntryUUID: webhook.EntryUUID}); err != nil {
+			return 0, err
+		}
+
+		if err := w.model.Delete(ctx, tx, webhook.EntryUUID); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(webhooks), nil
+}
+
+// EntryLocked queues the locked event, the webhook is removed when the
+// entry is deleted
+func (w *WebhookRecorder) EntryLocked(ctx context.Context, tx *sql.Tx, entryUUID string, failedAttempts int, action LockoutAction) error {
+	err := w.RecordTx(ctx, tx, Event{
+		Type:           EventLocked,
+		EntryUUID:      entryUUID,
+		FailedAttempts: failedAttempts,
+		Action:         action,
+	})
+	if err != nil {
+		return err
+	}
+
+	if action == LockoutDelete {
+		return w.model.Delete(ctx, tx, entryUUID)
+	}
+
+	return nil
+}
+
+// readEvent returns the read event of the entry key, it is the last read
+// when the key had one remaining read
+func readEvent(entryUUID string, entryKey *EntryKey) Event {
+	event := Event{Type: EventRead, EntryUUID: entryUUID, KeyUUID: entryKey.UUID}
+	if entryKey.RemainingReads == 1 {
+		event.Type = EventLastRead
+	}
+
+	return event
+}
+
+// logDroppedEvent logs the event which could not be delivered
+func logDroppedEvent(ctx context.Context, event models.WebhookEvent, attempts int, err error) {
+	slog.WarnContext(ctx, "webhook event dropped", "event", event.Event, "entry", event.EntryUUID, "delivery", event.UUID, "attempts", attempts, "error", err)
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/masterkey"
+	"github.com/Ajnasz/sekret.link/internal/models"
+	"github.com/Ajnasz/sekret.link/internal/webhook"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockWebhookModel struct {
+	mock.Mock
+}
+
+func (m *MockWebhookModel) Create(ctx context.Context, tx *sql.Tx, entryUUID string, url string, secret []byte, masterKeyID string) error {
+	args := m.Called(ctx, tx, entryUUID, url, secret, masterKeyID)
+	return args.Error(0)
+}
+
+func (m *MockWebhookModel) Get(ctx context.Context, tx *sql.Tx, entryUUID string) (*models.Webhook, error) {
+	args := m.Called(ctx, tx, entryUUID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Webhook), args.Error(1)
+}
+
+func (m *MockWebhookModel) Delete(ctx context.Context, tx *sql.Tx, entryUUID string) error {
+	args := m.Called(ctx, tx, entryUUID)
+	return args.Error(0)
+}
+
+func (m *MockWebhookModel) ListOrphans(ctx context.Context, tx *sql.Tx, limit int) ([]models.Webhook, error) {
+	args := m.Called(ctx, tx, limit)
+	return args.Get(0).([]models.Webhook), args.Error(1)
+}
+
+type MockWebhookEventModel struct {
+	mock.Mock
+}
+
+func (m *MockWebhookEventModel) Enqueue(ctx context.Context, tx *sql.Tx, entryUUID string, event string, url string, secret []byte, masterKeyID string, payload []byte) (*models.WebhookEvent, error) {
+	args := m.Called(ctx, tx, entryUUID, event, url, secret, masterKeyID, payload)
+	return &models.WebhookEvent{EntryUUID: entryUUID, Event: event, URL: url, Secret: secret, MasterKeyID: masterKeyID, Payload: payload}, args.Error(0)
+}
+
+func (m *MockWebhookEventModel) ListDue(ctx context.Context, tx *sql.Tx, now time.Time, limit int) ([]models.WebhookEvent, error) {
+	args := m.Called(ctx, tx, now, limit)
+	return args.Get(0).([]models.WebhookEvent), args.Error(1)
+}
+
+func (m *MockWebhookEventModel) Claim(ctx context.Context, tx *sql.Tx, uuid string, now time.Time, until time.Time) (bool, error) {
+	args := m.Called(ctx, tx, uuid, now, until)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockWebhookEventModel) Retry(ctx context.Context, tx *sql.Tx, uuid string, nextAttempt time.Time, lastError string) error {
+	args := m.Called(ctx, tx, uuid, nextAttempt, lastError)
+	return args.Error(0)
+}
+
+func (m *MockWebhookEventModel) Delete(ctx context.Context, tx *sql.Tx, uuid string) error {
+	args := m.Called(ctx, tx, uuid)
+	return args.Error(0)
+}
+
+func TestWebhookRecorder_RecordTx(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	registered := &models.Webhook{EntryUUID: "entry", URL: "https://example.com/hook", Secret: []byte("sealed"), MasterKeyID: "key-id"}
+
+	testCases := []struct {
+		name    string
+		event   Event
+		payload string
+	}{
+		{
+			name:    "read",
+			event:   Event{Type: EventRead, EntryUUID: "entry", KeyUUID: "key"},
+			payload: `{"event":"read","uuid":"entry","keyUUID":"key","time":"2024-01-01T12:00:00Z"}`,
+		},
+		{
+			name:    "deleted",
+			event:   Event{Type: EventDeleted, EntryUUID: "entry"},
+			payload: `{"event":"deleted","uuid":"entry","time":"2024-01-01T12:00:00Z"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			model := &MockWebhookModel{}
+			eventModel := &MockWebhookEventModel{}
+
+			model.On("Get", ctx, mock.Anything, "entry").Return(registered, nil)
+			eventModel.On("Enqueue", ctx, mock.Anything, "entry", string(tc.event.Type), registered.URL, registered.Secret, registered.MasterKeyID, []byte(tc.payload)).Return(nil)
+			if tc.event.Type.terminal() {
+				model.On("Delete", ctx, mock.Anything, "entry").Return(nil)
+			}
+
+			recorder := NewWebhookRecorder(model, eventModel).WithClock(func() time.Time { return now })
+			err := recorder.RecordTx(ctx, nil, tc.event)
+
+			assert.NoError(t, err)
+			model.AssertExpectations(t)
+			eventModel.AssertExpectations(t)
+		})
+	}
+
+	t.Run("without webhook", func(t *testing.T) {
+		model := &MockWebhookModel{}
+		eventModel := &MockWebhookEventModel{}
+		model.On("Get", ctx, mock.Anything, "entry").Return(nil, models.ErrWebhookNotFound)
+
+		err := NewWebhookRecorder(model, eventModel).RecordTx(ctx, nil, Event{Type: EventRead, EntryUUID: "entry"})
+
+		assert.NoError(t, err)
+		eventModel.AssertNotCalled(t, "Enqueue")
+	})
+}
+
+func TestWebhookRecorder_RegisterTx(t *testing.T) {
+	ctx := context.Background()
+	keyring, err := masterkey.New([]masterkey.Key{{ID: "key-id", Secret: bytes.Repeat([]byte{1}, masterkey.KeySize)}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealedSecret := mock.MatchedBy(func(sealed []byte) bool {
+		opened, err := keyring.Open("key-id", sealed)
+		return err == nil && string(opened) == "secret"
+	})
+
+	model := &MockWebhookModel{}
+	model.On("Create", ctx, mock.Anything, "signed", "https://example.com/hook", sealedSecret, "key-id").Return(nil)
+	model.On("Create", ctx, mock.Anything, "unsigned", "https://example.com/hook", []byte(nil), "").Return(nil)
+
+	recorder := NewWebhookRecorder(model, &MockWebhookEventModel{}).WithMasterKey(keyring)
+
+	assert.NoError(t, recorder.RegisterTx(ctx, nil, "signed", Webhook{URL: "https://example.com/hook", Secret: []byte("secret")}))
+	assert.NoError(t, recorder.RegisterTx(ctx, nil, "unsigned", Webhook{URL: "https://example.com/hook"}))
+	model.AssertExpectations(t)
+}
+
+func TestWebhookRecorder_RecordExpiredTx(t *testing.T) {
+	ctx := context.Background()
+	model := &MockWebhookModel{}
+	eventModel := &MockWebhookEventModel{}
+
+	orphans := []models.Webhook{
+		{EntryUUID: "a", URL: "https://example.com/a"},
+		{EntryUUID: "b", URL: "https://example.com/b"},
+	}
+	model.On("ListOrphans", ctx, mock.Anything, expiredBatchSize).Return(orphans, nil)
+	for _, orphan := range orphans {
+		eventModel.On("Enqueue", ctx, mock.Anything, orphan.EntryUUID, string(EventExpired), orphan.URL, []byte(nil), "", mock.Anything).Return(nil)
+		model.On("Delete", ctx, mock.Anything, orphan.EntryUUID).Return(nil)
+	}
+
+	count, err := NewWebhookRecorder(model, eventModel).RecordExpiredTx(ctx, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	model.AssertExpectations(t)
+	eventModel.AssertExpectations(t)
+}
+
+func TestWebhookRecorder_EntryLocked(t *testing.T) {
+	ctx := context.Background()
+	registered := &models.Webhook{EntryUUID: "entry", URL: "https://example.com/hook"}
+
+	for _, action := range []LockoutAction{LockoutLock, LockoutDelete} {
+		t.Run(string(action), func(t *testing.T) {
+			model := &MockWebhookModel{}
+			eventModel := &MockWebhookEventModel{}
+
+			model.On("Get", ctx, mock.Anything, "entry").Return(registered, nil)
+			eventModel.On("Enqueue", ctx, mock.Anything, "entry", string(EventLocked), registered.URL, []byte(nil), "", mock.Anything).Return(nil)
+			if action == LockoutDelete {
+				model.On("Delete", ctx, mock.Anything, "entry").Return(nil)
+			}
+
+			err := NewWebhookRecorder(model, eventModel).EntryLocked(ctx, nil, "entry", 3, action)
+
+			assert.NoError(t, err)
+			model.AssertExpectations(t)
+			eventModel.AssertExpectations(t)
+			if action == LockoutLock {
+				model.AssertNotCalled(t, "Delete", ctx, mock.Anything, "entry")
+			}
+		})
+	}
+}
+
+func TestReadEvent(t *testing.T) {
+	assert.Equal(t, EventRead, readEvent("entry", &EntryKey{UUID: "key", RemainingReads: 2}).Type)
+	assert.Equal(t, EventRead, readEvent("entry", &EntryKey{UUID: "key"}).Type, "the unlimited keys have no last read")
+	assert.Equal(t, EventLastRead, readEvent("entry", &EntryKey{UUID: "key", RemainingReads: 1}).Type)
+}
+
+func TestWebhookDispatcher_Backoff(t *testing.T) {
+	dispatcher := NewWebhookDispatcher(nil, nil, &http.Client{}).WithBackoff(10*time.Second, time.Minute)
+
+	assert.Equal(t, 10*time.Second, dispatcher.backoff(1))
+	assert.Equal(t, 20*time.Second, dispatcher.backoff(2))
+	assert.Equal(t, 40*time.Second, dispatcher.backoff(3))
+	assert.Equal(t, time.Minute, dispatcher.backoff(4))
+	assert.Equal(t, time.Minute, dispatcher.backoff(100))
+}
+
+func TestWebhookDispatcher_Dispatch(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	keyring, err := masterkey.New([]masterkey.Key{{ID: "key-id", Secret: bytes.Repeat([]byte{1}, masterkey.KeySize)}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyID, sealedSecret, err := keyring.Seal([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var received []Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if !webhook.Verify([]byte("secret"), now.Unix(), body, r.Header.Get(webhook.SignatureHeader)) {
+			t.Error("expected the request to be signed with the unwrapped secret")
+		}
+
+		var event Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Error(err)
+		}
+		received = append(received, event)
+
+		if r.Header.Get(webhook.EventHeader) != string(EventRead) {
+			http.Error(w, "error", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		name      string
+		event     EventType
+		attempts  int
+		result    string
+		delivered int
+	}{
+		{name: "delivered", event: EventRead, result: "delivered", delivered: 1},
+		{name: "retried", event: EventDeleted, attempts: 1, result: "retried"},
+		{name: "dropped", event: EventDeleted, attempts: 2, result: "dropped"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, sqlMock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			payload, _ := json.Marshal(Event{Type: tc.event, EntryUUID: "entry", Time: now})
+			event := models.WebhookEvent{
+				UUID:        "delivery",
+				EntryUUID:   "entry",
+				Event:       string(tc.event),
+				URL:         server.URL,
+				Secret:      sealedSecret,
+				MasterKeyID: keyID,
+				Payload:     payload,
+				Attempts:    tc.attempts,
+			}
+
+			model := &MockWebhookEventModel{}
+			model.On("ListDue", ctx, mock.Anything, now, webhookClaimCandidates).Return([]models.WebhookEvent{event}, nil).Once()
+			model.On("ListDue", ctx, mock.Anything, now, webhookClaimCandidates).Return([]models.WebhookEvent{}, nil).Once()
+			model.On("Claim", ctx, mock.Anything, "delivery", now, now.Add(2*time.Second)).Return(true, nil)
+			switch tc.result {
+			case "retried":
+				model.On("Retry", ctx, mock.Anything, "delivery", now.Add(20*time.Second), mock.Anything).Return(nil)
+			default:
+				model.On("Delete", ctx, mock.Anything, "delivery").Return(nil)
+			}
+
+			// claim, complete and the empty claim
+			for range 3 {
+				sqlMock.ExpectBegin()
+				sqlMock.ExpectCommit()
+			}
+
+			dispatcher := NewWebhookDispatcher(db, model, webhook.NewClient(time.Second, true)).
+				WithMaxAttempts(3).
+				WithMasterKey(keyring).
+				WithClock(func() time.Time { return now })
+
+			delivered, err := dispatcher.Dispatch(ctx)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.delivered, delivered)
+			model.AssertExpectations(t)
+			assert.NoError(t, sqlMock.ExpectationsWereMet())
+		})
+	}
+
+	assert.Len(t, received, 3)
+}
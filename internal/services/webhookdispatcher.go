@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/metrics"
+	"github.com/Ajnasz/sekret.link/internal/models"
+	"github.com/Ajnasz/sekret.link/internal/webhook"
+)
+
+// ErrDispatchFailed is returned when the queued events can not be read or
+// updated
+var ErrDispatchFailed = errors.New("webhook dispatch failed")
+
+const (
+	defaultWebhookMaxAttempts = 10
+	defaultWebhookMinBackoff  = 10 * time.Second
+	defaultWebhookMaxBackoff  = time.Hour
+	// webhookBatchSize is the number of the events delivered in one run
+	webhookBatchSize = 100
+	// webhookClaimCandidates is the number of the due events listed to claim
+	// one of them
+	webhookClaimCandidates = 10
+)
+
+// WebhookDispatcher delivers the queued events to the webhooks, the failed
+// deliveries are retried with exponential backoff
+type WebhookDispatcher struct {
+	db          *sql.DB
+	model       WebhookEventModel
+	client      *http.Client
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	lease       time.Duration
+	masterKey   MasterKey
+	now         func() time.Time
+}
+
+// NewWebhookDispatcher creates a WebhookDispatcher
+func NewWebhookDispatcher(db *sql.DB, model WebhookEventModel, client *http.Client) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		db:          db,
+		model:       model,
+		client:      client,
+		maxAttempts: defaultWebhookMaxAttempts,
+		minBackoff:  defaultWebhookMinBackoff,
+		maxBackoff:  defaultWebhookMaxBackoff,
+		lease:       leaseOf(client),
+		now:         time.Now,
+	}
+}
+
+// leaseOf returns how long a claimed event is skipped by the other
+// dispatchers, it is retried after the lease when the dispatcher stops
+// during the delivery
+func leaseOf(client *http.Client) time.Duration {
+	if client.Timeout > 0 {
+		return 2 * client.Timeout
+	}
+
+	return time.Minute
+}
+
+// WithMaxAttempts sets how many times an event is tried before it is
+// dropped
+func (d *WebhookDispatcher) WithMaxAttempts(maxAttempts int) *WebhookDispatcher {
+	if maxAttempts > 0 {
+		d.maxAttempts = maxAttempts
+	}
+	return d
+}
+
+// WithBackoff sets the delay after the first failed attempt, it is doubled
+// after every failure up to maxBackoff
+func (d *WebhookDispatcher) WithBackoff(minBackoff time.Duration, maxBackoff time.Duration) *WebhookDispatcher {
+	d.minBackoff = minBackoff
+	d.maxBackoff = maxBackoff
+	return d
+}
+
+// WithMasterKey sets the master key which unwraps the secrets of the queued
+// events
+func (d *WebhookDispatcher) WithMasterKey(masterKey MasterKey) *WebhookDispatcher {
+	d.masterKey = masterKey
+	return d
+}
+
+// WithClock sets the function which returns the current time, for testing
+func (d *WebhookDispatcher) WithClock(now func() time.Time) *WebhookDispatcher {
+	d.now = now
+	return d
+}
+
+// backoff returns the delay before the next attempt after the failed
+// attempts
+func (d *WebhookDispatcher) backoff(attempts int) time.Duration {
+	delay := d.minBackoff
+	for i := 1; i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, d.maxBackoff)
+}
+
+// claim returns a due event which is claimed by this dispatcher, nil when no
+// event is due
+// The events are claimed one by one, so the lease of the event covers its
+// own delivery only
+func (d *WebhookDispatcher) claim(ctx context.Context) (*models.WebhookEvent, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Join(ErrDispatchFailed, err)
+	}
+	defer metrics.TransactionTimer("claim_webhook_events").ObserveDuration()
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	now := d.now()
+	// the other dispatchers may claim some of the due events meanwhile
+	due, err := d.model.ListDue(ctx, tx, now, webhookClaimCandidates)
+	if err != nil {
+		return nil, errors.Join(ErrDispatchFailed, err)
+	}
+
+	var event *models.WebhookEvent
+	for _, candidate := range due {
+		claimed, err := d.model.Claim(ctx, tx, candidate.UUID, now, now.Add(d.lease))
+		if err != nil {
+			return nil, errors.Join(ErrDispatchFailed, err)
+		}
+
+		if claimed {
+			event = &candidate
+			break
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Join(ErrDispatchFailed, err)
+	}
+	tx = nil
+
+	return event, nil
+}
+
+// complete removes the delivered event or schedules its next attempt, the
+// event is dropped after the last attempt
+func (d *WebhookDispatcher) complete(ctx context.Context, event models.WebhookEvent, deliveryErr error) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Join(ErrDispatchFailed, err)
+	}
+	defer metrics.TransactionTimer("complete_webhook_event").ObserveDuration()
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	attempts := event.Attempts + 1
+	result := "delivered"
+	switch {
+	case deliveryErr == nil:
+		err = d.model.Delete(ctx, tx, event.UUID)
+	case attempts >= d.maxAttempts:
+		result = "dropped"
+		logDroppedEvent(ctx, event, attempts, deliveryErr)
+		err = d.model.Delete(ctx, tx, event.UUID)
+	default:
+		result = "retried"
+		err = d.model.Retry(ctx, tx, event.UUID, d.now().Add(d.backoff(attempts)), deliveryErr.Error())
+	}
+
+	if err != nil {
+		return errors.Join(ErrDispatchFailed, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Join(ErrDispatchFailed, err)
+	}
+	tx = nil
+
+	metrics.WebhookDeliveries.WithLabelValues(event.Event, result).Inc()
+
+	return nil
+}
+
+// send delivers the event signed with its secret
+func (d *WebhookDispatcher) send(ctx context.Context, event models.WebhookEvent) error {
+	secret, err := openBlob(d.masterKey, event.MasterKeyID, event.Secret)
+	if err != nil {
+		return err
+	}
+
+	return webhook.Send(ctx, d.client, webhook.Delivery{
+		ID:      event.UUID,
+		Event:   event.Event,
+		URL:     event.URL,
+		Secret:  secret,
+		Payload: event.Payload,
+	}, d.now())
+}
+
+// Dispatch delivers the due events, at most webhookBatchSize in one run, and
+// returns the number of the successful deliveries
+func (d *WebhookDispatcher) Dispatch(ctx context.Context) (int, error) {
+	delivered := 0
+	for range webhookBatchSize {
+		event, err := d.claim(ctx)
+		if err != nil {
+			return delivered, err
+		}
+
+		if event == nil {
+			break
+		}
+
+		deliveryErr := d.send(ctx, *event)
+
+		if err := d.complete(ctx, *event, deliveryErr); err != nil {
+			return delivered, err
+		}
+
+		if deliveryErr == nil {
+			delivered++
+		}
+	}
+
+	return delivered, nil
+}
@@ -6,9 +6,17 @@ import (
 
 	"github.com/Ajnasz/sekret.link/internal/config"
 	"github.com/Ajnasz/sekret.link/internal/durable"
+	"github.com/Ajnasz/sekret.link/internal/models/migrate"
 )
 
+// TestConnection opens the test database. When no connection string is set
+// in the environment, a migrated in-memory database is returned, so the tests
+// can run without a database server.
 func TestConnection(ctx context.Context) (*sql.DB, error) {
+	if config.GetConnectionString("") == "" {
+		return memoryConnection(ctx)
+	}
+
 	conf := durable.ConnectionInfo{
 		Host:     "localhost",
 		Port:     5432,
@@ -25,3 +33,17 @@ func TestConnection(ctx context.Context) (*sql.DB, error) {
 
 	return db, nil
 }
+
+func memoryConnection(ctx context.Context) (*sql.DB, error) {
+	db, err := durable.OpenDatabaseClient(ctx, durable.MemoryConnectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate.PrepareDatabase(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
@@ -0,0 +1,216 @@
+// Package tlsconfig builds the TLS configuration of the server and reloads
+// the certificate when it changes
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// ErrInvalidVersion is returned when the TLS version is not supported
+var ErrInvalidVersion = errors.New("invalid TLS version")
+
+// ErrInvalidClientCA is returned when the client CA file contains no
+// certificates
+var ErrInvalidClientCA = errors.New("invalid client CA")
+
+// Options are the TLS options of the server
+type Options struct {
+	CertFile   string
+	KeyFile    string
+	MinVersion string
+	// ClientCAFile enables the client certificate authentication, the
+	// clients must present a certificate signed by one of the CAs
+	ClientCAFile string
+}
+
+// ParseVersion converts the 1.2 and 1.3 versions to their tls constants
+func ParseVersion(version string) (uint16, error) {
+	switch version {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrInvalidVersion, version)
+	}
+}
+
+// CertReloader serves the certificate loaded from the files, it reloads the
+// certificate without restarting the server, the new connections get the new
+// certificate, the established connections are kept
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+	modTime  atomic.Int64
+}
+
+// NewCertReloader creates a CertReloader and loads the certificate
+func NewCertReloader(certFile string, keyFile string) (*CertReloader, error) {
+	reloader := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// lastModified returns the latest modification time of the certificate and
+// the key files
+func (c *CertReloader) lastModified() (int64, error) {
+	var latest int64
+	for _, file := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return 0, err
+		}
+
+		if modTime := info.ModTime().UnixNano(); modTime > latest {
+			latest = modTime
+		}
+	}
+
+	return latest, nil
+}
+
+// Reload loads the certificate from the files, the previous certificate is
+// kept when the files are invalid
+func (c *CertReloader) Reload() error {
+	modTime, err := c.lastModified()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.cert.Store(&cert)
+	c.modTime.Store(modTime)
+
+	return nil
+}
+
+// GetCertificate returns the current certificate, it can be used as
+// tls.Config.GetCertificate
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+// Watch checks the files in every interval and reloads the certificate when
+// they change, it returns when the context is done
+func (c *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			modTime, err := c.lastModified()
+			if err != nil {
+				slog.Error("checking certificate failed", "error", err)
+				continue
+			}
+
+			if modTime == c.modTime.Load() {
+				continue
+			}
+
+			if err := c.Reload(); err != nil {
+				slog.Error("reloading certificate failed", "error", err)
+				continue
+			}
+
+			slog.Info("certificate reloaded", "file", c.certFile)
+		}
+	}
+}
+
+func loadClientCAs(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidClientCA, file)
+	}
+
+	return pool, nil
+}
+
+// New creates the TLS configuration of the server and the reloader of its
+// certificate
+func New(opts Options) (*tls.Config, *CertReloader, error) {
+	minVersion, err := ParseVersion(opts.MinVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reloader, err := NewCertReloader(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if opts.ClientCAFile != "" {
+		pool, err := loadClientCAs(opts.ClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, reloader, nil
+}
+
+// RedirectHandler redirects the plain http requests to the https server
+// listening on the listenAddress
+func RedirectHandler(listenAddress string) http.Handler {
+	_, port, _ := net.SplitHostPort(listenAddress)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		target := url.URL{
+			Scheme:   "https",
+			Host:     host,
+			Path:     r.URL.Path,
+			RawQuery: r.URL.RawQuery,
+		}
+
+		http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,177 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCertificate writes a self signed certificate with the common name to
+// the files
+func writeCertificate(t *testing.T, certFile string, keyFile string, commonName string) {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func commonName(t *testing.T, reloader *CertReloader) string {
+	t.Helper()
+
+	cert, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return parsed.Subject.CommonName
+}
+
+func TestParseVersion(t *testing.T) {
+	version, err := ParseVersion("1.2")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), version)
+
+	version, err = ParseVersion("1.3")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), version)
+
+	_, err = ParseVersion("1.0")
+	assert.ErrorIs(t, err, ErrInvalidVersion)
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile, "first")
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "first", commonName(t, reloader))
+
+	t.Run("reload", func(t *testing.T) {
+		writeCertificate(t, certFile, keyFile, "second")
+		assert.NoError(t, reloader.Reload())
+		assert.Equal(t, "second", commonName(t, reloader))
+	})
+
+	t.Run("invalid files keep the certificate", func(t *testing.T) {
+		if err := os.WriteFile(keyFile, []byte("invalid"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		assert.Error(t, reloader.Reload())
+		assert.Equal(t, "second", commonName(t, reloader))
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go reloader.Watch(ctx, time.Millisecond)
+
+		writeCertificate(t, certFile, keyFile, "third")
+		// make sure the modification time differs from the loaded one
+		later := time.Now().Add(time.Second)
+		if err := os.Chtimes(keyFile, later, later); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Eventually(t, func() bool {
+			cert, _ := reloader.GetCertificate(nil)
+			parsed, err := x509.ParseCertificate(cert.Certificate[0])
+			return err == nil && parsed.Subject.CommonName == "third"
+		}, time.Second, time.Millisecond)
+	})
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile, "server")
+
+	config, _, err := New(Options{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.3"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), config.MinVersion)
+	assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+
+	config, _, err = New(Options{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.2", ClientCAFile: certFile})
+	assert.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+	assert.NotNil(t, config.ClientCAs)
+
+	_, _, err = New(Options{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.2", ClientCAFile: keyFile})
+	assert.ErrorIs(t, err, ErrInvalidClientCA)
+
+	_, _, err = New(Options{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.1"})
+	assert.ErrorIs(t, err, ErrInvalidVersion)
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		listenAddress string
+		target        string
+		expected      string
+	}{
+		{":8443", "http://example.com/api/foo?bar=1", "https://example.com:8443/api/foo?bar=1"},
+		{":443", "http://example.com:80/api/", "https://example.com/api/"},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		RedirectHandler(test.listenAddress).ServeHTTP(w, httptest.NewRequest("GET", test.target, nil))
+
+		assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+		assert.Equal(t, test.expected, w.Header().Get("Location"))
+	}
+}
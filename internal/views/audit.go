@@ -0,0 +1,58 @@
+package views
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/services"
+)
+
+// AuditEventResponse describes an event of the audit log of an entry
+type AuditEventResponse struct {
+	Event     string
+	KeyUUID   string `json:",omitempty"`
+	Created   time.Time
+	ClientIP  string
+	UserAgent string
+}
+
+// AuditEventListResponse is the response of the ListAuditEvents endpoint
+type AuditEventListResponse struct {
+	UUID   string
+	Events []AuditEventResponse
+}
+
+func BuildAuditEventListResponse(UUID string, auditEvents []services.AuditEvent) AuditEventListResponse {
+	events := make([]AuditEventResponse, 0, len(auditEvents))
+	for _, event := range auditEvents {
+		events = append(events, AuditEventResponse{
+			Event:     string(event.Event),
+			KeyUUID:   event.KeyUUID,
+			Created:   event.Created,
+			ClientIP:  event.ClientIP,
+			UserAgent: event.UserAgent,
+		})
+	}
+
+	return AuditEventListResponse{UUID: UUID, Events: events}
+}
+
+// AuditEventListView is the view for the ListAuditEvents endpoint
+type AuditEventListView struct{}
+
+func NewAuditEventListView() AuditEventListView {
+	return AuditEventListView{}
+}
+
+func (a AuditEventListView) Render(w http.ResponseWriter, r *http.Request, response AuditEventListResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("JSON encode failed", "error", err)
+	}
+}
+
+func (a AuditEventListView) RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	renderEntryKeyError(w, err)
+}
@@ -0,0 +1,128 @@
+package views
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/parsers"
+	"github.com/Ajnasz/sekret.link/internal/services"
+)
+
+// ClientEncryptedEntryCreatedResponse is the response of the client encrypted
+// create endpoint, the key is not part of it, the server never sees the key
+type ClientEncryptedEntryCreatedResponse struct {
+	UUID      string
+	Created   time.Time
+	Expire    time.Time
+	DeleteKey string
+}
+
+func BuildClientEncryptedEntryCreatedResponse(meta *services.EntryMeta) ClientEncryptedEntryCreatedResponse {
+	return ClientEncryptedEntryCreatedResponse{
+		UUID:      meta.UUID,
+		Created:   meta.Created,
+		Expire:    meta.Expire,
+		DeleteKey: meta.DeleteKey,
+	}
+}
+
+type ClientEncryptedEntryCreateView struct {
+	webExternalURL *url.URL
+}
+
+func NewClientEncryptedEntryCreateView(webExternalURL *url.URL) ClientEncryptedEntryCreateView {
+	return ClientEncryptedEntryCreateView{webExternalURL: webExternalURL}
+}
+
+// Render writes the entry url, the client appends the key as the url fragment
+func (e ClientEncryptedEntryCreateView) Render(w http.ResponseWriter, r *http.Request, entry ClientEncryptedEntryCreatedResponse) {
+	w.Header().Add("x-entry-uuid", entry.UUID)
+	w.Header().Add("x-entry-expire", entry.Expire.Format(time.RFC3339))
+	w.Header().Add("x-entry-delete-key", entry.DeleteKey)
+
+	if r.Header.Get("Accept") == "application/json" {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(entry); err != nil {
+			slog.Error("JSON encode failed", "error", err)
+		}
+	} else {
+		fmt.Fprintf(w, "%s", e.webExternalURL.JoinPath("zk", entry.UUID).String())
+	}
+}
+
+func (e ClientEncryptedEntryCreateView) RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, parsers.ErrInvalidKeyHash) {
+		http.Error(w, "Invalid key hash", http.StatusBadRequest)
+		return
+	}
+
+	NewEntryCreateView(e.webExternalURL).RenderError(w, r, err)
+}
+
+// ClientEncryptedEntryReadResponse is the response of the client encrypted
+// read endpoint, the Data is the encrypted data as it was uploaded
+type ClientEncryptedEntryReadResponse struct {
+	UUID           string
+	Data           []byte
+	Created        time.Time
+	Accessed       time.Time
+	Expire         time.Time
+	RemainingReads int
+	DeleteKey      string
+	ContentType    string
+}
+
+func BuildClientEncryptedEntryReadResponse(entry services.Entry) ClientEncryptedEntryReadResponse {
+	return ClientEncryptedEntryReadResponse{
+		UUID:           entry.UUID,
+		Data:           entry.Data,
+		Created:        entry.Created,
+		Accessed:       entry.Accessed,
+		Expire:         entry.Expire,
+		RemainingReads: entry.RemainingReads,
+		DeleteKey:      entry.DeleteKey,
+		ContentType:    entry.ContentType,
+	}
+}
+
+type ClientEncryptedEntryReadView struct{}
+
+func NewClientEncryptedEntryReadView() ClientEncryptedEntryReadView {
+	return ClientEncryptedEntryReadView{}
+}
+
+// Render writes the encrypted data, the content type of the decrypted data is
+// sent in the x-entry-content-type header
+func (e ClientEncryptedEntryReadView) Render(w http.ResponseWriter, r *http.Request, response ClientEncryptedEntryReadResponse) {
+	if r.Header.Get("Accept") == "application/json" {
+		w.Header().Add("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			slog.Error("JSON encode failed", "error", err)
+		}
+		return
+	}
+
+	headers := w.Header()
+	headers.Add("Content-Type", "application/octet-stream")
+	headers.Add("x-entry-content-type", response.ContentType)
+	headers.Add("x-entry-expire", response.Expire.Format(time.RFC3339))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(response.Data); err != nil {
+		slog.Error("write failed", "error", err)
+	}
+}
+
+func (e ClientEncryptedEntryReadView) RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, parsers.ErrInvalidKeyHash) {
+		http.Error(w, "Invalid key hash", http.StatusBadRequest)
+		return
+	}
+
+	NewEntryReadView().RenderError(w, r, err)
+}
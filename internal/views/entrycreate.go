@@ -78,6 +78,8 @@ func (e EntryCreateView) RenderError(w http.ResponseWriter, r *http.Request, err
 		return
 	} else if errors.Is(err, parsers.ErrInvalidData) {
 		http.Error(w, "Invalid data", http.StatusBadRequest)
+	} else if errors.Is(err, parsers.ErrInvalidWebhookURL) {
+		http.Error(w, "Invalid webhook URL", http.StatusBadRequest)
 	} else if strings.Contains(err.Error(), "http: request body too large") {
 		http.Error(w, "Too large", http.StatusRequestEntityTooLarge)
 	} else {
@@ -31,7 +31,8 @@ func (e EntryDeleteView) RenderError(w http.ResponseWriter, r *http.Request, err
 	}
 
 	if errors.Is(err, models.ErrInvalidKey) {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		http.Error(w, "Invalid delete key", http.StatusUnauthorized)
+		return
 	}
 
 	if uuid.IsInvalidLengthError(err) || errors.Is(err, parsers.ErrInvalidUUID) {
@@ -12,6 +12,7 @@ import (
 
 	"github.com/Ajnasz/sekret.link/internal/key"
 	"github.com/Ajnasz/sekret.link/internal/parsers"
+	"github.com/Ajnasz/sekret.link/internal/services"
 	"github.com/Ajnasz/sekret.link/internal/uuid"
 )
 
@@ -73,6 +74,15 @@ func (v GenerateEntryKeyView) RenderError(w http.ResponseWriter, r *http.Request
 	} else if errors.Is(err, parsers.ErrInvalidMaxRead) {
 		http.Error(w, "Invalid max read", http.StatusBadRequest)
 		return
+	} else if errors.Is(err, services.ErrEntryLocked) {
+		http.Error(w, "Entry locked", http.StatusLocked)
+		return
+	} else if errors.Is(err, services.ErrPassphraseRequired) {
+		http.Error(w, "Passphrase required", http.StatusUnauthorized)
+		return
+	} else if errors.Is(err, services.ErrInvalidPassphrase) {
+		http.Error(w, "Invalid passphrase", http.StatusUnauthorized)
+		return
 	} else {
 		http.Error(w, "Internal error", http.StatusInternalServerError)
 	}
@@ -0,0 +1,175 @@
+package views
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/parsers"
+	"github.com/Ajnasz/sekret.link/internal/services"
+)
+
+// EntryKeyResponse describes a key of an entry, the key itself is never
+// returned
+// Expire and RemainingReads are omitted when the key has no expiration or no
+// read limit, Accessed is omitted when the key was not read yet
+type EntryKeyResponse struct {
+	UUID           string
+	Created        time.Time
+	Expire         *time.Time `json:",omitempty"`
+	Accessed       *time.Time `json:",omitempty"`
+	RemainingReads *int       `json:",omitempty"`
+	HasPassphrase  bool
+}
+
+// EntryKeyListResponse is the response of the ListEntryKeys endpoint
+type EntryKeyListResponse struct {
+	UUID string
+	Keys []EntryKeyResponse
+}
+
+func BuildEntryKeyResponse(entryKey services.EntryKey) EntryKeyResponse {
+	response := EntryKeyResponse{
+		UUID:          entryKey.UUID,
+		Created:       entryKey.Created,
+		HasPassphrase: entryKey.HasPassphrase,
+	}
+
+	if !entryKey.Expire.IsZero() {
+		response.Expire = &entryKey.Expire
+	}
+
+	if !entryKey.Accessed.IsZero() {
+		response.Accessed = &entryKey.Accessed
+	}
+
+	if entryKey.HasReadLimit {
+		response.RemainingReads = &entryKey.RemainingReads
+	}
+
+	return response
+}
+
+func BuildEntryKeyListResponse(UUID string, entryKeys []services.EntryKey) EntryKeyListResponse {
+	keys := make([]EntryKeyResponse, 0, len(entryKeys))
+	for _, entryKey := range entryKeys {
+		keys = append(keys, BuildEntryKeyResponse(entryKey))
+	}
+
+	return EntryKeyListResponse{UUID: UUID, Keys: keys}
+}
+
+// renderEntryKeyError renders the errors of the endpoints managing the keys
+// of an entry
+func renderEntryKeyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, services.ErrEntryNotFound) || errors.Is(err, services.ErrEntryKeyNotFound) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, services.ErrEntryExpired) || errors.Is(err, services.ErrEntryNoRemainingReads) {
+		http.Error(w, "Gone", http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, services.ErrEntryLocked) {
+		http.Error(w, "Entry locked", http.StatusLocked)
+		return
+	}
+
+	if errors.Is(err, services.ErrInvalidDeleteKey) {
+		http.Error(w, "Invalid delete key", http.StatusUnauthorized)
+		return
+	}
+
+	if errors.Is(err, services.ErrEntryKeyLimitRaised) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if errors.Is(err, services.ErrPassphraseRequired) {
+		http.Error(w, "Passphrase required", http.StatusUnauthorized)
+		return
+	}
+
+	if errors.Is(err, services.ErrInvalidPassphrase) {
+		http.Error(w, "Invalid passphrase", http.StatusUnauthorized)
+		return
+	}
+
+	if errors.Is(err, parsers.ErrInvalidExpirationDate) {
+		http.Error(w, "Invalid expiration", http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, parsers.ErrInvalidMaxRead) {
+		http.Error(w, "Invalid max read", http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, parsers.ErrInvalidUUID) || errors.Is(err, parsers.ErrInvalidKey) || errors.Is(err, parsers.ErrInvalidData) {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	slog.Error("entry key request failed", "error", err)
+	http.Error(w, "Internal error", http.StatusInternalServerError)
+}
+
+// EntryKeyListView is the view for the ListEntryKeys endpoint
+type EntryKeyListView struct{}
+
+func NewEntryKeyListView() EntryKeyListView {
+	return EntryKeyListView{}
+}
+
+func (e EntryKeyListView) Render(w http.ResponseWriter, r *http.Request, response EntryKeyListResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("JSON encode failed", "error", err)
+	}
+}
+
+func (e EntryKeyListView) RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	renderEntryKeyError(w, err)
+}
+
+// EntryKeyUpdateView is the view for the UpdateEntryKey endpoint
+type EntryKeyUpdateView struct{}
+
+func NewEntryKeyUpdateView() EntryKeyUpdateView {
+	return EntryKeyUpdateView{}
+}
+
+func (e EntryKeyUpdateView) Render(w http.ResponseWriter, r *http.Request, response EntryKeyResponse) {
+	if response.Expire != nil {
+		w.Header().Add("x-entry-expire", response.Expire.Format(time.RFC3339))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("JSON encode failed", "error", err)
+	}
+}
+
+func (e EntryKeyUpdateView) RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	renderEntryKeyError(w, err)
+}
+
+type DeleteEntryKeyResponse struct{}
+
+// EntryKeyDeleteView is the view for the DeleteEntryKey endpoint
+type EntryKeyDeleteView struct{}
+
+func NewEntryKeyDeleteView() EntryKeyDeleteView {
+	return EntryKeyDeleteView{}
+}
+
+func (e EntryKeyDeleteView) Render(w http.ResponseWriter, r *http.Request, response DeleteEntryKeyResponse) {
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (e EntryKeyDeleteView) RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	renderEntryKeyError(w, err)
+}
@@ -0,0 +1,66 @@
+package views
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Ajnasz/sekret.link/internal/services"
+)
+
+// EntryMetaResponse is the metadata of an entry, it is returned without
+// reading the entry
+type EntryMetaResponse struct {
+	UUID           string
+	ContentType    string
+	Size           int
+	Created        time.Time
+	Accessed       time.Time
+	Expire         time.Time
+	RemainingReads int
+}
+
+func BuildEntryMetaResponse(meta services.EntryMeta) EntryMetaResponse {
+	return EntryMetaResponse{
+		UUID:           meta.UUID,
+		ContentType:    meta.ContentType,
+		Size:           meta.Size,
+		Created:        meta.Created,
+		Accessed:       meta.Accessed,
+		Expire:         meta.Expire,
+		RemainingReads: meta.RemainingReads,
+	}
+}
+
+// EntryMetaView renders the metadata of an entry in headers, for GET
+// requests the metadata is in the JSON body too
+type EntryMetaView struct{}
+
+func NewEntryMetaView() EntryMetaView {
+	return EntryMetaView{}
+}
+
+func (e EntryMetaView) Render(w http.ResponseWriter, r *http.Request, response EntryMetaResponse) {
+	headers := w.Header()
+	headers.Add("x-entry-uuid", response.UUID)
+	headers.Add("x-entry-expire", response.Expire.Format(time.RFC3339))
+	headers.Add("x-entry-remaining-reads", strconv.Itoa(response.RemainingReads))
+	headers.Add("x-entry-content-type", response.ContentType)
+	headers.Add("x-entry-size", strconv.Itoa(response.Size))
+
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	headers.Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("JSON encode failed", "error", err)
+	}
+}
+
+func (e EntryMetaView) RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	NewEntryReadView().RenderError(w, r, err)
+}
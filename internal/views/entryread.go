@@ -81,6 +81,21 @@ func (e EntryReadView) RenderError(w http.ResponseWriter, r *http.Request, err e
 		return
 	}
 
+	if errors.Is(err, services.ErrEntryLocked) {
+		http.Error(w, "Entry locked", http.StatusLocked)
+		return
+	}
+
+	if errors.Is(err, services.ErrPassphraseRequired) {
+		http.Error(w, "Passphrase required", http.StatusUnauthorized)
+		return
+	}
+
+	if errors.Is(err, services.ErrInvalidPassphrase) {
+		http.Error(w, "Invalid passphrase", http.StatusUnauthorized)
+		return
+	}
+
 	if errors.Is(err, parsers.ErrInvalidUUID) {
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
@@ -0,0 +1,68 @@
+package views
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+
+	"github.com/Ajnasz/sekret.link/internal/web"
+)
+
+// EntryRevealResponse is the data of the reveal page
+type EntryRevealResponse struct {
+	UUID string
+}
+
+var revealTemplate = template.Must(template.New("reveal").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex, nofollow">
+<title>Reveal secret</title>
+<link rel="stylesheet" href="../static/style.css">
+<script src="../static/reveal.js" defer></script>
+</head>
+<body>
+<h1>Someone shared a secret with you</h1>
+<p>The secret can be read a limited number of times. Reveal it only when you are ready to save it.</p>
+<form id="reveal" method="post">
+<p><label>Passphrase, if the secret is protected with one:<br><input type="password" name="passphrase" autocomplete="off"></label></p>
+<p><button type="submit">Reveal secret</button></p>
+</form>
+<section id="result" hidden>
+<pre id="secret" hidden></pre>
+<p><button id="copy" type="button" hidden>Copy</button> <a id="download" download hidden>Download the secret</a></p>
+</section>
+<p id="error" class="error" hidden></p>
+</body>
+</html>
+`))
+
+// EntryRevealView renders a confirmation page instead of the secret, so link
+// previews and scanners which fetch the url do not use up the reads of the
+// secret. The page posts back to the same url to read the secret, the script
+// of the frontend shows the secret on the page when it is text.
+type EntryRevealView struct{}
+
+func NewEntryRevealView() EntryRevealView {
+	return EntryRevealView{}
+}
+
+func (e EntryRevealView) Render(w http.ResponseWriter, r *http.Request, response EntryRevealResponse) {
+	headers := w.Header()
+	headers.Set("Content-Type", "text/html; charset=utf-8")
+	headers.Set("Cache-Control", "no-store")
+	headers.Set("Referrer-Policy", "no-referrer")
+	headers.Set("X-Robots-Tag", "noindex, nofollow")
+	headers.Set("X-Frame-Options", "deny")
+	headers.Set("Content-Security-Policy", web.ContentSecurityPolicy)
+
+	if err := revealTemplate.Execute(w, response); err != nil {
+		slog.Error("reveal page render failed", "error", err)
+	}
+}
+
+func (e EntryRevealView) RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	NewEntryReadView().RenderError(w, r, err)
+}
@@ -0,0 +1,101 @@
+'use strict';
+
+(function () {
+	const form = document.getElementById('create');
+	const secret = document.getElementById('secret');
+	const fileInput = document.getElementById('file');
+	const result = document.getElementById('result');
+	const link = document.getElementById('link');
+	const error = document.getElementById('error');
+	const token = document.getElementById('token');
+	let file = null;
+
+	function setFile(f) {
+		file = f;
+		secret.value = '';
+		secret.placeholder = f ? f.name : 'Paste the secret here or drop a file';
+	}
+
+	function showError(message) {
+		error.textContent = message;
+		error.hidden = false;
+	}
+
+	fileInput.addEventListener('change', function () {
+		setFile(fileInput.files[0] || null);
+	});
+
+	secret.addEventListener('input', function () {
+		if (file) {
+			file = null;
+			fileInput.value = '';
+		}
+	});
+
+	secret.addEventListener('dragover', function (event) {
+		event.preventDefault();
+		secret.classList.add('dragover');
+	});
+
+	secret.addEventListener('dragleave', function () {
+		secret.classList.remove('dragover');
+	});
+
+	secret.addEventListener('drop', function (event) {
+		event.preventDefault();
+		secret.classList.remove('dragover');
+		if (event.dataTransfer.files.length > 0) {
+			setFile(event.dataTransfer.files[0]);
+		}
+	});
+
+	form.addEventListener('submit', function (event) {
+		event.preventDefault();
+		error.hidden = true;
+
+		const data = new FormData(form);
+		if (file) {
+			data.set('secret', file, file.name);
+		} else if (!secret.value) {
+			showError('The secret is empty');
+			return;
+		}
+
+		// the token is not part of the form, it is sent in the
+		// Authorization header and kept for the next secret
+		const headers = {};
+		if (token.value) {
+			headers.Authorization = 'Bearer ' + token.value;
+		}
+
+		// the form is served from the API root, the entries are created
+		// there
+		fetch(form.action, { method: 'POST', body: data, headers: headers })
+			.then(function (response) {
+				if (!response.ok) {
+					return response.text().then(function (text) {
+						throw new Error(text || response.statusText);
+					});
+				}
+
+				document.getElementById('delete-key').textContent = response.headers.get('x-entry-delete-key');
+				return response.text();
+			})
+			.then(function (url) {
+				link.value = url;
+				result.hidden = false;
+				const tokenValue = token.value;
+				form.reset();
+				token.value = tokenValue;
+				setFile(null);
+				link.select();
+			})
+			.catch(function (err) {
+				showError(err.message);
+			});
+	});
+
+	document.getElementById('copy-link').addEventListener('click', function () {
+		navigator.clipboard.writeText(link.value);
+	});
+}());
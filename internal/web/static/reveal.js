@@ -0,0 +1,64 @@
+'use strict';
+
+(function () {
+	const form = document.getElementById('reveal');
+	const result = document.getElementById('result');
+	const error = document.getElementById('error');
+
+	function isText(contentType) {
+		return /^(text\/|application\/(json|xml))/.test(contentType || '');
+	}
+
+	function showText(blob) {
+		return blob.text().then(function (text) {
+			const pre = document.getElementById('secret');
+			pre.textContent = text;
+			pre.hidden = false;
+
+			const copy = document.getElementById('copy');
+			copy.hidden = false;
+			copy.addEventListener('click', function () {
+				navigator.clipboard.writeText(text);
+			});
+		});
+	}
+
+	function showDownload(blob) {
+		const download = document.getElementById('download');
+		download.href = URL.createObjectURL(blob);
+		download.hidden = false;
+	}
+
+	form.addEventListener('submit', function (event) {
+		event.preventDefault();
+		error.hidden = true;
+
+		fetch(window.location.href, {
+			method: 'POST',
+			body: new URLSearchParams(new FormData(form)),
+		})
+			.then(function (response) {
+				if (!response.ok) {
+					return response.text().then(function (text) {
+						throw new Error(text || response.statusText);
+					});
+				}
+
+				return response.blob();
+			})
+			.then(function (blob) {
+				form.hidden = true;
+				result.hidden = false;
+
+				if (isText(blob.type)) {
+					return showText(blob);
+				}
+
+				showDownload(blob);
+			})
+			.catch(function (err) {
+				error.textContent = err.message;
+				error.hidden = false;
+			});
+	});
+}());
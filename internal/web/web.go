@@ -0,0 +1,25 @@
+// Package web contains the browser frontend, which is embedded into the
+// binary
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed static
+var static embed.FS
+
+// ContentSecurityPolicy is the policy of the frontend pages, scripts and
+// styles are loaded from the static files only
+const ContentSecurityPolicy = "default-src 'none'; script-src 'self'; style-src 'self'; connect-src 'self'; img-src 'self' data: blob:; form-action 'self'; base-uri 'none'; frame-ancestors 'none';"
+
+// Static returns the static files of the frontend
+func Static() fs.FS {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+
+	return sub
+}
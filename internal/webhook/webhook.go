@@ -0,0 +1,211 @@
+// Package webhook delivers the signed event notifications to the webhook
+// URLs of the entries
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	// EventHeader is the request header with the type of the event
+	EventHeader = "X-Sekret-Event"
+	// DeliveryHeader is the request header with the unique id of the event,
+	// it is the same when the delivery is retried
+	DeliveryHeader = "X-Sekret-Delivery"
+	// TimestampHeader is the request header with the unix time of the
+	// delivery attempt, it is part of the signature
+	TimestampHeader = "X-Sekret-Timestamp"
+	// SignatureHeader is the request header with the HMAC-SHA256 signature of
+	// the request
+	SignatureHeader = "X-Sekret-Signature"
+)
+
+// ErrInvalidURL is returned when the webhook URL is not an absolute http or
+// https URL
+var ErrInvalidURL = errors.New("invalid webhook URL")
+
+// ErrForbiddenAddress is returned when the webhook URL resolves to a
+// loopback, private or link local address and those are not allowed
+var ErrForbiddenAddress = errors.New("forbidden webhook address")
+
+// ErrDeliveryFailed is returned when the webhook does not respond with a 2xx
+// status code
+var ErrDeliveryFailed = errors.New("webhook delivery failed")
+
+// maxURLLength is the maximum length of a webhook URL
+const maxURLLength = 2048
+
+// ValidateURL returns ErrInvalidURL when the URL is not an absolute http or
+// https URL
+func ValidateURL(rawURL string) error {
+	if len(rawURL) > maxURLLength {
+		return fmt.Errorf("%w: longer than %d characters", ErrInvalidURL, maxURLLength)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.Join(ErrInvalidURL, err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: the scheme must be http or https", ErrInvalidURL)
+	}
+
+	if u.Hostname() == "" {
+		return fmt.Errorf("%w: missing host", ErrInvalidURL)
+	}
+
+	if u.User != nil {
+		return fmt.Errorf("%w: credentials are not allowed", ErrInvalidURL)
+	}
+
+	return nil
+}
+
+// Sign returns the signature of the payload sent at the timestamp, it is the
+// hex encoded HMAC-SHA256 of the "timestamp.payload" string prefixed with
+// sha256=
+func Sign(secret []byte, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether the signature belongs to the payload sent at the
+// timestamp
+func Verify(secret []byte, timestamp int64, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, payload)), []byte(signature))
+}
+
+// forbiddenPrefixes are the special purpose ranges which are not covered by
+// the netip.Addr predicates
+var forbiddenPrefixes = []netip.Prefix{
+	// shared address space of the carrier-grade NATs
+	netip.MustParsePrefix("100.64.0.0/10"),
+	// IETF protocol assignments
+	netip.MustParsePrefix("192.0.0.0/24"),
+	// benchmarking
+	netip.MustParsePrefix("198.18.0.0/15"),
+	// NAT64, it translates to any IPv4 address, including the private ones
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// isForbidden reports whether the address is not routed on the internet
+func isForbidden(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() {
+		return true
+	}
+
+	for _, prefix := range forbiddenPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// denyPrivate refuses the connections to the addresses which are not routed
+// on the internet, it runs after the host name is resolved, so the DNS
+// records can not point to the internal services
+func denyPrivate(network string, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return errors.Join(ErrForbiddenAddress, err)
+	}
+
+	if isForbidden(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, addrPort.Addr())
+	}
+
+	return nil
+}
+
+// NewClient creates the http client of the deliveries, the redirects are not
+// followed. The loopback, private and link local addresses are refused
+// unless allowPrivate is true.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = denyPrivate
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Delivery is an event to post to a webhook
+type Delivery struct {
+	ID      string
+	Event   string
+	URL     string
+	Secret  []byte
+	Payload []byte
+}
+
+// Send posts the payload of the delivery as JSON, the request is signed when
+// the delivery has a secret
+func Send(ctx context.Context, client *http.Client, delivery Delivery, now time.Time) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return errors.Join(ErrDeliveryFailed, err)
+	}
+
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sekret.link-webhook")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	if len(delivery.Secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(delivery.Secret, timestamp, delivery.Payload))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Join(ErrDeliveryFailed, err)
+	}
+	defer resp.Body.Close()
+
+	// drain the body, so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: status code %d", ErrDeliveryFailed, resp.StatusCode)
+	}
+
+	return nil
+}